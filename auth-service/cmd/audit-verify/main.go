@@ -0,0 +1,97 @@
+// Command audit-verify walks the audit_events hash chain and reports the
+// first event whose hash or link to its predecessor does not verify. When a
+// checkpoint file is available, every signed checkpoint is also checked
+// against the chain.
+//
+// Usage (from the auth-service directory, so config.yaml is found):
+//
+//	go run ./cmd/audit-verify [-checkpoints audit-checkpoints.jsonl] [-public-key BASE64]
+package main
+
+import (
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	_ "github.com/lib/pq"
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/repository"
+	"github.com/sales-tracker/auth-service/internal/service"
+)
+
+func main() {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		log.Fatalf("Failed to initialize config: %v", err)
+	}
+
+	checkpointFile := flag.String("checkpoints", cfg.Audit.CheckpointFile, "signed checkpoint file to verify against the chain (empty to skip)")
+	publicKeyFlag := flag.String("public-key", "", "base64 Ed25519 public key for checkpoints (defaults to the key derived from audit.checkpoint_key)")
+	flag.Parse()
+
+	db, err := sql.Open("postgres", cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	auditRepository := repository.NewPostgresAuditRepository(db)
+
+	var checkpoints []*domain.AuditCheckpoint
+	if *checkpointFile != "" {
+		if _, err := os.Stat(*checkpointFile); err == nil {
+			publicKey, err := checkpointPublicKey(*publicKeyFlag, cfg.Audit.CheckpointKey)
+			if err != nil {
+				log.Fatalf("Failed to load checkpoint public key: %v", err)
+			}
+			if checkpoints, err = service.ReadAuditCheckpoints(*checkpointFile, publicKey); err != nil {
+				log.Fatalf("Checkpoint verification failed: %v", err)
+			}
+		} else {
+			log.Printf("Warning: checkpoint file %s not found, verifying chain only", *checkpointFile)
+		}
+	}
+
+	report, err := service.VerifyAuditChain(auditRepository, checkpoints)
+	if err != nil {
+		log.Fatalf("Failed to verify audit chain: %v", err)
+	}
+
+	fmt.Printf("Unchained legacy events: %d\n", report.Unchained)
+	fmt.Printf("Verified events:         %d\n", report.Verified)
+	fmt.Printf("Redacted events:         %d\n", report.Redacted)
+	fmt.Printf("Checkpoints checked:     %d\n", len(checkpoints))
+	if report.Head != nil {
+		fmt.Printf("Chain head:              event %d (%s)\n", report.Head.ID, report.Head.Hash)
+	}
+
+	if report.BrokenAt != nil {
+		fmt.Printf("BROKEN at event %d: %s\n", report.BrokenAt.ID, report.Reason)
+		os.Exit(1)
+	}
+	fmt.Println("Audit chain OK")
+}
+
+func checkpointPublicKey(encodedPublicKey, encodedSeed string) (ed25519.PublicKey, error) {
+	if encodedPublicKey != "" {
+		key, err := base64.StdEncoding.DecodeString(encodedPublicKey)
+		if err != nil {
+			return nil, err
+		}
+		if len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("expected %d byte public key, got %d", ed25519.PublicKeySize, len(key))
+		}
+		return ed25519.PublicKey(key), nil
+	}
+
+	privateKey, err := service.ParseAuditCheckpointKey(encodedSeed)
+	if err != nil {
+		return nil, err
+	}
+	return privateKey.Public().(ed25519.PublicKey), nil
+}
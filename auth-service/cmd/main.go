@@ -15,7 +15,9 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 	_ "github.com/lib/pq"
 	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
 	"github.com/sales-tracker/auth-service/internal/handler"
+	authmiddleware "github.com/sales-tracker/auth-service/internal/middleware"
 	"github.com/sales-tracker/auth-service/internal/repository"
 	"github.com/sales-tracker/auth-service/internal/service"
 	"github.com/sales-tracker/auth-service/internal/usecase"
@@ -115,6 +117,127 @@ func runMigrations(db *sql.DB) error {
 	return nil
 }
 
+// runAccountPurgeJob periodically anonymizes accounts whose deletion grace period has ended
+func runAccountPurgeJob(userUsecase *usecase.UserUsecase, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		purged, err := userUsecase.PurgeDeletedAccounts()
+		if err != nil {
+			log.Printf("Failed to purge deleted accounts: %v", err)
+			continue
+		}
+		if purged > 0 {
+			log.Printf("Anonymized %d deleted accounts", purged)
+		}
+	}
+}
+
+// runEmailOutboxWorker delivers queued emails, draining the backlog a batch
+// at a time before waiting for the next poll
+func runEmailOutboxWorker(emailOutbox *service.EmailOutbox, cfg config.EmailOutboxConfig) {
+	ticker := time.NewTicker(cfg.PollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for {
+			claimed, err := emailOutbox.DeliverDue()
+			if err != nil {
+				log.Printf("Failed to deliver queued emails: %v", err)
+				break
+			}
+			if claimed == 0 || claimed < cfg.BatchSize {
+				break
+			}
+		}
+	}
+}
+
+// runWebhookWorker sends queued webhook deliveries, draining the backlog a
+// batch at a time on every tick
+func runWebhookWorker(dispatcher *service.WebhookDispatcher, cfg config.WebhookConfig) {
+	ticker := time.NewTicker(cfg.PollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for {
+			claimed, err := dispatcher.DeliverDue()
+			if err != nil {
+				log.Printf("Failed to deliver webhooks: %v", err)
+				break
+			}
+			if claimed == 0 || claimed < cfg.BatchSize {
+				break
+			}
+		}
+	}
+}
+
+// runAuditCheckpointJob periodically exports a signed checkpoint of the audit chain head
+func runAuditCheckpointJob(checkpointer *service.AuditCheckpointer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		checkpoint, err := checkpointer.WriteCheckpoint()
+		if err != nil {
+			log.Printf("Failed to write audit checkpoint: %v", err)
+			continue
+		}
+		if checkpoint != nil {
+			log.Printf("Wrote audit checkpoint at event %d", checkpoint.EventID)
+		}
+	}
+}
+
+// oidcProviders builds clients for the configured social login providers,
+// skipping those without a client ID
+func oidcProviders(cfg *config.Config) map[string]*service.OIDCProvider {
+	providers := make(map[string]*service.OIDCProvider)
+	for name, providerConfig := range cfg.SocialLogin.Providers {
+		if providerConfig.ClientID == "" {
+			continue
+		}
+		redirectURL := fmt.Sprintf("%s/auth/oidc/%s/callback", cfg.BaseURL, name)
+		providers[name] = service.NewOIDCProvider(name, providerConfig, redirectURL, nil)
+	}
+	return providers
+}
+
+// loginAuthenticator checks passwords against the configured LDAP
+// directories, by email domain or organization, and against the stored
+// bcrypt hash for everyone else. Directories without a URL are skipped.
+func loginAuthenticator(cfg *config.Config, userRepository repository.UserRepository, organizationRepository repository.OrganizationRepository, webhookUsecase *usecase.WebhookUsecase) usecase.Authenticator {
+	names := make([]string, 0, len(cfg.LDAP))
+	for name, directoryConfig := range cfg.LDAP {
+		if directoryConfig.URL != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	directories := make([]*usecase.LDAPAuthenticator, 0, len(names))
+	for _, name := range names {
+		directoryConfig := cfg.LDAP[name]
+		directories = append(directories, usecase.NewLDAPAuthenticator(
+			service.NewLDAPDirectory(name, directoryConfig),
+			domain.DirectoryPolicy{
+				OrgID:        directoryConfig.OrgID,
+				EmailDomains: directoryConfig.EmailDomains,
+				GroupRoles:   directoryConfig.GroupRoles,
+				DefaultRole:  directoryConfig.DefaultRole,
+				AllowSignup:  directoryConfig.AllowSignup,
+			},
+			userRepository,
+			organizationRepository,
+			webhookUsecase,
+		))
+	}
+
+	return usecase.NewRoutingAuthenticator(usecase.NewPasswordAuthenticator(userRepository), directories, userRepository)
+}
+
 func main() {
 	// Load environment variables
 	if err := godotenv.Load(); err != nil {
@@ -168,21 +291,104 @@ func main() {
 
 	// Initialize repositories
 	userRepository := repository.NewPostgresUserRepository(dbSQL)
+	auditRepository := repository.NewPostgresAuditRepository(dbSQL)
+	organizationRepository := repository.NewPostgresOrganizationRepository(dbSQL)
+	invitationRepository := repository.NewPostgresInvitationRepository(dbSQL)
+	apiKeyRepository := repository.NewPostgresAPIKeyRepository(dbSQL)
+	oauthClientRepository := repository.NewPostgresOAuthClientRepository(dbSQL)
+	oauthAuthorizationRepository := repository.NewPostgresOAuthAuthorizationRepository(dbSQL)
+	federatedIdentityRepository := repository.NewPostgresFederatedIdentityRepository(dbSQL)
+	samlRepository := repository.NewPostgresSAMLRepository(dbSQL)
+	scimRepository := repository.NewPostgresSCIMRepository(dbSQL)
+	emailOutboxRepository := repository.NewPostgresEmailOutboxRepository(dbSQL)
+	securityNotificationRepository := repository.NewPostgresSecurityNotificationRepository(dbSQL)
+	smsCodeRepository := repository.NewPostgresSMSCodeRepository(dbSQL)
+	webhookRepository := repository.NewPostgresWebhookRepository(dbSQL)
+	transactor := repository.NewPostgresTransactor(dbSQL)
+
+	// Initialize audit logger
+	auditService := service.NewAuditService(auditRepository)
+	samlServiceProvider := service.NewSAMLServiceProvider(cfg.BaseURL)
+	emailLinks, err := service.NewEmailLinks(cfg)
+	if err != nil {
+		log.Fatalf("Invalid frontend configuration: %v", err)
+	}
 
-	// Initialize usecase
-	userUsecase := usecase.NewUserUsecase(userRepository)
-
-	// Initialize email service
-	emailService := service.NewSMTPService(cfg)
+	// Initialize usecases
+	webhookUsecase := usecase.NewWebhookUsecase(webhookRepository, auditService)
+	authenticator := loginAuthenticator(cfg, userRepository, organizationRepository, webhookUsecase)
+	securityNotificationUsecase := usecase.NewSecurityNotificationUsecase(securityNotificationRepository, emailOutboxRepository, auditService)
+	userUsecase := usecase.NewUserUsecase(userRepository, auditRepository, oauthAuthorizationRepository, federatedIdentityRepository, apiKeyRepository, authenticator, transactor, emailLinks, securityNotificationUsecase, webhookUsecase, auditService)
+	auditUsecase := usecase.NewAuditUsecase(auditRepository)
+	organizationUsecase := usecase.NewOrganizationUsecase(organizationRepository, userRepository, transactor, webhookUsecase, auditService)
+	invitationUsecase := usecase.NewInvitationUsecase(invitationRepository, organizationRepository, userRepository, transactor, emailLinks, auditService)
+	apiKeyUsecase := usecase.NewAPIKeyUsecase(apiKeyRepository, organizationRepository, userRepository, auditService)
+	oauthUsecase := usecase.NewOAuthUsecase(oauthClientRepository, oauthAuthorizationRepository, organizationRepository, userRepository, auditService)
+	federationUsecase := usecase.NewFederationUsecase(oidcProviders(cfg), federatedIdentityRepository, userRepository, securityNotificationUsecase, webhookUsecase, auditService)
+	samlUsecase := usecase.NewSAMLUsecase(samlRepository, organizationRepository, userRepository, samlServiceProvider, securityNotificationUsecase, webhookUsecase, auditService)
+	scimUsecase := usecase.NewSCIMUsecase(scimRepository, organizationRepository, userRepository, transactor, webhookUsecase, auditService)
+	emailOutboxUsecase := usecase.NewEmailOutboxUsecase(emailOutboxRepository)
+
+	// Initialize services
+	emailTemplates, err := service.LoadEmailTemplates(cfg.Email)
+	if err != nil {
+		log.Fatalf("Failed to load email templates: %v", err)
+	}
+	mailTransport, err := service.NewMailTransport(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize email transport: %v", err)
+	}
+	dkimSigner, err := service.NewDKIMSigner(cfg.Email.DKIM)
+	if err != nil {
+		log.Fatalf("Failed to initialize DKIM signing: %v", err)
+	}
+	emailService := service.NewMailer(cfg, emailTemplates, mailTransport, dkimSigner)
+	smsSender, err := service.NewSMSSender(cfg.SMS)
+	if err != nil {
+		log.Fatalf("Failed to initialize SMS sender: %v", err)
+	}
+	emailOutbox := service.NewEmailOutbox(emailOutboxRepository, emailService, cfg.Email.Outbox)
+	webhookDispatcher := service.NewWebhookDispatcher(webhookRepository, nil, cfg.Webhooks)
+	tokenService := service.NewTokenService(cfg)
+	if cfg.OAuth.SigningKeyFile == "" {
+		log.Printf("Warning: oauth.signing_key_file not set, ID tokens are signed with a temporary key")
+	}
+	idTokenSigner, err := service.NewIDTokenSigner(cfg.OAuth)
+	if err != nil {
+		log.Fatalf("Failed to initialize ID token signing key: %v", err)
+	}
+	phoneUsecase := usecase.NewPhoneUsecase(userRepository, smsCodeRepository, authenticator, transactor, smsSender, usecase.SMSCodePolicy{
+		TTL:            cfg.SMS.CodeTTL,
+		ResendInterval: cfg.SMS.ResendInterval,
+		MaxAttempts:    cfg.SMS.MaxAttempts,
+		MaxCodesPerDay: cfg.SMS.MaxCodesPerDay,
+	}, cfg.Email.Brand.ProductName, webhookUsecase, auditService)
+	introspectionUsecase := usecase.NewIntrospectionUsecase(oauthClientRepository, oauthAuthorizationRepository, apiKeyRepository, organizationRepository, userRepository, tokenService)
 
 	// Initialize handlers
-	authHandler := handler.NewAuthHandler(cfg, *userUsecase, emailService)
+	authHandler := handler.NewAuthHandler(cfg, *userUsecase, phoneUsecase, organizationUsecase, tokenService)
+	auditHandler := handler.NewAuditHandler(auditUsecase)
+	emailOutboxHandler := handler.NewEmailOutboxHandler(emailOutboxUsecase)
+	webhookHandler := handler.NewWebhookHandler(webhookUsecase)
+	securityNotificationHandler := handler.NewSecurityNotificationHandler(securityNotificationUsecase)
+	phoneHandler := handler.NewPhoneHandler(phoneUsecase)
+	organizationHandler := handler.NewOrganizationHandler(cfg, organizationUsecase, invitationUsecase, tokenService)
+	invitationHandler := handler.NewInvitationHandler(cfg, invitationUsecase, tokenService)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyUsecase)
+	oauthHandler := handler.NewOAuthHandler(cfg, oauthUsecase, introspectionUsecase, userUsecase, phoneUsecase, tokenService, idTokenSigner)
+	federationHandler := handler.NewFederationHandler(cfg, federationUsecase, organizationUsecase, phoneUsecase, tokenService)
+	samlHandler := handler.NewSAMLHandler(cfg, samlUsecase, samlServiceProvider, phoneUsecase, tokenService)
+	scimHandler := handler.NewSCIMHandler(cfg, scimUsecase)
+
+	// Routes used by integrations accept API keys as well as user tokens
+	jwtAuth := authmiddleware.JWTMiddleware(cfg, userRepository)
+	jwtOrAPIKeyAuth := authmiddleware.APIKeyMiddleware(apiKeyUsecase, jwtAuth)
 
 	// Register middleware
 	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{}))
-	// Add CORS middleware
+	// Add CORS middleware for the configured frontends
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"https://sales-tracker-reset-password.onrender.com", "http://localhost:3000"},
+		AllowOrigins: cfg.Frontend.CORSOrigins,
 		AllowMethods: []string{echo.GET, echo.HEAD, echo.PUT, echo.PATCH, echo.POST, echo.DELETE, echo.OPTIONS},
 		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, "Authorization"},
 		AllowCredentials: true,
@@ -190,11 +396,163 @@ func main() {
 
 	// Register routes
 	e.POST("/auth/login", authHandler.Login)
+	e.POST("/auth/login/mfa", authHandler.LoginMFA)
 	e.POST("/auth/register", authHandler.Register)
 	e.GET("/auth/verify", authHandler.VerifyEmail)
 	e.POST("/auth/resend-verification", authHandler.ResendVerificationEmail)
 	e.POST("/auth/reset-password", authHandler.ResetPassword)
 	e.POST("/auth/forgot-password", authHandler.ForgotPassword)
+	e.POST("/auth/forgot-password/sms", phoneHandler.ForgotPasswordSMS)
+	e.POST("/auth/forgot-password/sms/verify", phoneHandler.VerifyPasswordResetSMS)
+	e.GET("/auth/confirm-email", authHandler.ConfirmEmailChange)
+	e.GET("/auth/invitations/accept", invitationHandler.GetInvitation)
+	e.POST("/auth/invitations/accept", invitationHandler.AcceptInvitation)
+
+	// OAuth2 / OpenID Connect provider
+	e.GET("/.well-known/openid-configuration", oauthHandler.Discovery)
+	e.GET("/.well-known/jwks.json", oauthHandler.JWKS)
+	e.GET("/oauth/authorize", oauthHandler.Authorize)
+	e.POST("/oauth/authorize", oauthHandler.ApproveAuthorization)
+	e.POST("/oauth/token", oauthHandler.Token)
+	e.POST("/oauth/introspect", oauthHandler.Introspect)
+	e.GET("/userinfo", oauthHandler.UserInfo, jwtAuth, authmiddleware.RequireScope(domain.ScopeOpenID))
+	e.POST("/userinfo", oauthHandler.UserInfo, jwtAuth, authmiddleware.RequireScope(domain.ScopeOpenID))
+
+	// Social login through upstream OIDC providers
+	e.GET("/auth/oidc/providers", federationHandler.ListProviders)
+	e.GET("/auth/oidc/:provider/login", federationHandler.Login)
+	e.GET("/auth/oidc/:provider/callback", federationHandler.Callback)
+
+	// Enterprise SSO through each organization's SAML identity provider
+	e.GET("/auth/saml/:org_id/metadata", samlHandler.Metadata)
+	e.GET("/auth/saml/:org_id/login", samlHandler.Login)
+	e.POST("/auth/saml/:org_id/acs", samlHandler.ACS)
+
+	// Register authenticated routes. Access tokens issued to OAuth clients
+	// carry no user, so they are kept off routes that act for the caller.
+	userAuth := authmiddleware.RequireUserToken()
+	me := e.Group("/auth/me", jwtAuth, userAuth)
+	me.POST("/email", authHandler.ChangeEmail)
+	me.PUT("/locale", authHandler.UpdateLocale)
+	me.GET("/notifications", securityNotificationHandler.GetPreferences)
+	me.PUT("/notifications", securityNotificationHandler.UpdatePreferences)
+	me.POST("/phone", phoneHandler.AddPhone)
+	me.POST("/phone/verify", phoneHandler.VerifyPhone)
+	me.DELETE("/phone", phoneHandler.RemovePhone)
+	me.POST("/mfa/sms", phoneHandler.EnableSMSMFA)
+	me.DELETE("/mfa/sms", phoneHandler.DisableSMSMFA)
+	me.DELETE("", authHandler.DeleteAccount)
+	// Tokens of accounts scheduled for deletion are accepted here only, so
+	// that the deletion can be cancelled
+	e.POST("/auth/me/restore", authHandler.RestoreAccount, authmiddleware.PendingDeletionJWTMiddleware(cfg, userRepository), userAuth)
+	me.GET("/export", authHandler.ExportData)
+	me.GET("/consents", oauthHandler.ListConsents)
+	me.DELETE("/consents/:client_id", oauthHandler.RevokeConsent)
+
+	apiKeys := e.Group("/auth/api-keys", jwtAuth, userAuth)
+	apiKeys.POST("", apiKeyHandler.CreateAPIKey)
+	apiKeys.GET("", apiKeyHandler.ListAPIKeys)
+	apiKeys.DELETE("/:id", apiKeyHandler.RevokeAPIKey)
+
+	admin := e.Group("/auth/admin", jwtOrAPIKeyAuth, authmiddleware.RoleMiddleware("admin"))
+	admin.GET("/audit-events", auditHandler.ListEvents, authmiddleware.RequireScope(domain.ScopeAuditRead))
+
+	emails := admin.Group("/emails", authmiddleware.RequireScope(domain.ScopeEmails))
+	emails.GET("", emailOutboxHandler.ListEmails)
+	emails.GET("/:id", emailOutboxHandler.GetEmail)
+
+	webhooks := admin.Group("/webhooks", authmiddleware.RequireScope(domain.ScopeWebhooks))
+	webhooks.POST("", webhookHandler.CreateWebhook)
+	webhooks.GET("", webhookHandler.ListWebhooks)
+	webhooks.GET("/:id", webhookHandler.GetWebhook)
+	webhooks.PUT("/:id", webhookHandler.UpdateWebhook)
+	webhooks.DELETE("/:id", webhookHandler.DeleteWebhook)
+	webhooks.POST("/:id/rotate-secret", webhookHandler.RotateWebhookSecret)
+	webhooks.GET("/:id/deliveries", webhookHandler.ListDeliveries)
+	webhooks.GET("/:id/deliveries/:delivery_id", webhookHandler.GetDelivery)
+	webhooks.POST("/:id/deliveries/:delivery_id/replay", webhookHandler.ReplayDelivery)
+
+	oauthClients := admin.Group("/oauth/clients", authmiddleware.RequireScope(domain.ScopeOAuthClients))
+	oauthClients.POST("", oauthHandler.CreateClient)
+	oauthClients.GET("", oauthHandler.ListClients)
+	oauthClients.POST("/:client_id/rotate-secret", oauthHandler.RotateClientSecret)
+	oauthClients.DELETE("/:client_id", oauthHandler.RevokeClient)
+
+	orgs := e.Group("/auth/orgs", jwtOrAPIKeyAuth, userAuth, authmiddleware.RequireScope(domain.ScopeOrgs))
+	orgs.POST("", organizationHandler.CreateOrganization)
+	orgs.GET("", organizationHandler.ListOrganizations)
+	orgs.POST("/:org_id/switch", organizationHandler.SwitchOrganization)
+
+	// Organization-scoped admin endpoints require a token for that organization
+	orgAdmin := orgs.Group("/:org_id", authmiddleware.OrgRoleMiddleware(organizationUsecase, domain.OrgRoleAdmin))
+	orgAdmin.GET("/members", organizationHandler.ListMembers)
+	orgAdmin.POST("/members", organizationHandler.AddMember)
+	orgAdmin.PUT("/members/:user_id", organizationHandler.UpdateMember)
+	orgAdmin.DELETE("/members/:user_id", organizationHandler.RemoveMember)
+	orgAdmin.PUT("/members/:user_id/manager", organizationHandler.SetManager)
+	orgAdmin.GET("/invitations", invitationHandler.ListInvitations)
+	orgAdmin.GET("/saml", samlHandler.GetConfig)
+	orgAdmin.PUT("/saml", samlHandler.UpdateConfig)
+	orgAdmin.DELETE("/saml", samlHandler.DeleteConfig)
+
+	e.GET("/auth/users/:id/reports", organizationHandler.ListReports, jwtOrAPIKeyAuth, userAuth, authmiddleware.RequireScope(domain.ScopeUsersRead))
+
+	// Sales managers can invite reps into their organization as well
+	orgInviter := orgs.Group("/:org_id/invitations", authmiddleware.OrgRoleMiddleware(organizationUsecase, domain.OrgRoleAdmin, domain.OrgRoleSalesManager))
+	orgInviter.POST("", invitationHandler.CreateInvitation)
+	orgInviter.POST("/:invitation_id/resend", invitationHandler.ResendInvitation)
+	orgInviter.DELETE("/:invitation_id", invitationHandler.RevokeInvitation)
+
+	// SCIM 2.0 provisioning, authenticated with an organization API key
+	scim := e.Group("/scim/v2", authmiddleware.SCIMMiddleware(apiKeyUsecase))
+	scim.GET("/ServiceProviderConfig", scimHandler.ServiceProviderConfig)
+	scim.GET("/Users", scimHandler.ListUsers)
+	scim.POST("/Users", scimHandler.CreateUser)
+	scim.GET("/Users/:id", scimHandler.GetUser)
+	scim.PUT("/Users/:id", scimHandler.ReplaceUser)
+	scim.PATCH("/Users/:id", scimHandler.PatchUser)
+	scim.DELETE("/Users/:id", scimHandler.DeleteUser)
+	scim.GET("/Groups", scimHandler.ListGroups)
+	scim.POST("/Groups", scimHandler.CreateGroup)
+	scim.GET("/Groups/:id", scimHandler.GetGroup)
+	scim.PUT("/Groups/:id", scimHandler.ReplaceGroup)
+	scim.PATCH("/Groups/:id", scimHandler.PatchGroup)
+	scim.DELETE("/Groups/:id", scimHandler.DeleteGroup)
+
+	// Bounce and complaint reports from the email provider
+	if cfg.Email.HTTP.WebhookPassword != "" {
+		emailWebhookHandler := handler.NewEmailWebhookHandler(cfg.Email.HTTP, userUsecase)
+		e.POST("/auth/webhooks/email", emailWebhookHandler.DeliveryEvents, authmiddleware.WebhookBasicAuth(cfg.Email.HTTP.WebhookUser, cfg.Email.HTTP.WebhookPassword))
+	}
+
+	// Captured emails let integration tests follow the links they carry.
+	// Those links sign users in, so the API is opt-in and admin-only; never
+	// select capture in production.
+	if captureTransport, ok := mailTransport.(*service.CaptureTransport); ok {
+		log.Printf("Warning: email.transport is capture, emails are kept in memory and never delivered")
+		if cfg.Email.Capture.ExposeAPI {
+			log.Printf("Warning: email.capture.expose_api is set, captured emails are served to admins at /auth/test/emails")
+			mailCaptureHandler := handler.NewMailCaptureHandler(captureTransport)
+			testEmails := e.Group("/auth/test/emails", jwtOrAPIKeyAuth, authmiddleware.RoleMiddleware("admin"), authmiddleware.RequireScope(domain.ScopeEmails))
+			testEmails.GET("", mailCaptureHandler.ListEmails)
+			testEmails.GET("/latest", mailCaptureHandler.LatestEmail)
+			testEmails.DELETE("", mailCaptureHandler.ClearEmails)
+		}
+	}
+
+	// Start background jobs
+	go runAccountPurgeJob(userUsecase, cfg.AccountPurgeInterval)
+	go runEmailOutboxWorker(emailOutbox, cfg.Email.Outbox)
+	go runWebhookWorker(webhookDispatcher, cfg.Webhooks)
+	if cfg.Audit.CheckpointKey != "" {
+		checkpointer, err := service.NewAuditCheckpointer(auditRepository, cfg.Audit)
+		if err != nil {
+			log.Fatalf("Failed to initialize audit checkpoints: %v", err)
+		}
+		go runAuditCheckpointJob(checkpointer, cfg.Audit.CheckpointInterval)
+	} else {
+		log.Printf("Warning: audit.checkpoint_key not set, signed audit checkpoints are disabled")
+	}
 
 	// Start server
 	if err := e.Start(":" + cfg.Port); err != nil {
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/spf13/viper"
@@ -24,17 +25,263 @@ type SMTPConfig struct {
 	Pass     string `mapstructure:"pass"`
 	From     string `mapstructure:"from"`
 	FromName string `mapstructure:"from_name"`
+	// Security is "starttls" to upgrade a plain connection (usually port
+	// 587), "tls" for implicit TLS (usually port 465) or "none"
+	Security           string        `mapstructure:"security"`
+	InsecureSkipVerify bool          `mapstructure:"insecure_skip_verify"`
+	Timeout            time.Duration `mapstructure:"timeout"`
+}
+
+// FileTransportConfig is where the file transport writes messages: one .eml
+// file per message in Dir, or a maildir rooted at Dir
+type FileTransportConfig struct {
+	Dir    string `mapstructure:"dir"`
+	Format string `mapstructure:"format"` // "eml" or "maildir"
+}
+
+// BrandConfig is the product identity shown in emails
+type BrandConfig struct {
+	ProductName  string `mapstructure:"product_name"`
+	TeamName     string `mapstructure:"team_name"` // used to sign emails
+	LogoURL      string `mapstructure:"logo_url"`
+	PrimaryColor string `mapstructure:"primary_color"` // CSS color for buttons and links
+	SupportEmail string `mapstructure:"support_email"`
+	WebsiteURL   string `mapstructure:"website_url"`
+	Address      string `mapstructure:"address"` // postal address for the footer
+}
+
+// HTTPMailConfig is a transactional email provider reached through its
+// HTTP API. Endpoint defaults to the provider's own; point it elsewhere to
+// send to a stand-in. The bounce and complaint webhook authenticates with
+// HTTP basic auth and is disabled without a WebhookPassword.
+type HTTPMailConfig struct {
+	Provider        string        `mapstructure:"provider"` // "postmark" or "sendgrid"
+	Endpoint        string        `mapstructure:"endpoint"`
+	APIKey          string        `mapstructure:"api_key"`
+	Timeout         time.Duration `mapstructure:"timeout"`
+	MessageStream   string        `mapstructure:"message_stream"` // Postmark only
+	WebhookUser     string        `mapstructure:"webhook_user"`
+	WebhookPassword string        `mapstructure:"webhook_password"`
+}
+
+// DKIMConfig signs outgoing mail for Domain with an RSA key whose public
+// half is published at <Selector>._domainkey.<Domain>. Signing is off
+// without a PrivateKeyFile.
+type DKIMConfig struct {
+	Domain         string `mapstructure:"domain"`
+	Selector       string `mapstructure:"selector"`
+	PrivateKeyFile string `mapstructure:"private_key_file"` // PEM, PKCS#1 or PKCS#8
+}
+
+type EmailConfig struct {
+	// TemplateDir holds templates that replace or add to the embedded ones,
+	// laid out the same way: <locale>/<name>.txt and <locale>/<name>.html
+	TemplateDir   string            `mapstructure:"template_dir"`
+	DefaultLocale string            `mapstructure:"default_locale"`
+	Brand         BrandConfig       `mapstructure:"brand"`
+	Outbox        EmailOutboxConfig `mapstructure:"outbox"`
+	// Transport carries sent messages: "smtp", "http" (a provider API),
+	// "file", "log" (stdout) or "capture", which keeps them in memory for
+	// integration tests
+	Transport string              `mapstructure:"transport"`
+	File      FileTransportConfig `mapstructure:"file"`
+	HTTP      HTTPMailConfig      `mapstructure:"http"`
+	Capture   CaptureConfig       `mapstructure:"capture"`
+	// DKIM applies to the messages built here, so to every transport but
+	// http, where the provider signs with its own key
+	DKIM DKIMConfig `mapstructure:"dkim"`
+}
+
+// CaptureConfig controls the capture transport. Captured emails carry
+// working sign-in and reset links, so they are only served, to admins,
+// when ExposeAPI is set.
+type CaptureConfig struct {
+	ExposeAPI bool `mapstructure:"expose_api"`
+}
+
+// EmailOutboxConfig controls delivery of queued emails. A failed attempt is
+// retried after RetryDelay, doubling with every attempt up to MaxRetryDelay,
+// and the email is dead-lettered once MaxAttempts have failed.
+type EmailOutboxConfig struct {
+	PollInterval  time.Duration `mapstructure:"poll_interval"`
+	BatchSize     int           `mapstructure:"batch_size"`
+	MaxAttempts   int           `mapstructure:"max_attempts"`
+	RetryDelay    time.Duration `mapstructure:"retry_delay"`
+	MaxRetryDelay time.Duration `mapstructure:"max_retry_delay"`
+	// SendTimeout is how long an attempt may take before the email is
+	// handed to another worker
+	SendTimeout time.Duration `mapstructure:"send_timeout"`
+}
+
+type AuditConfig struct {
+	CheckpointFile     string        `mapstructure:"checkpoint_file"`
+	CheckpointInterval time.Duration `mapstructure:"checkpoint_interval"`
+	CheckpointKey      string        `mapstructure:"checkpoint_key"` // base64 Ed25519 seed
+}
+
+// SMSConfig controls the one-time codes texted to users' phones. sender is
+// http, which sends through a Twilio-compatible API, or log, which prints
+// messages to stdout.
+type SMSConfig struct {
+	Sender         string        `mapstructure:"sender"`
+	CodeTTL        time.Duration `mapstructure:"code_ttl"`
+	ResendInterval time.Duration `mapstructure:"resend_interval"`   // minimum time between codes
+	MaxAttempts    int           `mapstructure:"max_attempts"`      // wrong guesses before a code is void
+	MaxCodesPerDay int           `mapstructure:"max_codes_per_day"` // codes sent to one user in 24 hours, 0 for no cap
+	HTTP           HTTPSMSConfig `mapstructure:"http"`
+}
+
+// HTTPSMSConfig is the account of the SMS provider. Endpoint defaults to
+// the provider's Messages resource for AccountSID.
+type HTTPSMSConfig struct {
+	Endpoint   string        `mapstructure:"endpoint"`
+	AccountSID string        `mapstructure:"account_sid"`
+	AuthToken  string        `mapstructure:"auth_token"`
+	From       string        `mapstructure:"from"`
+	Timeout    time.Duration `mapstructure:"timeout"`
+}
+
+// WebhookConfig controls delivery of outbound webhooks. Like queued emails,
+// a failed delivery is retried after RetryDelay, doubling with every attempt
+// up to MaxRetryDelay, until MaxAttempts have failed.
+type WebhookConfig struct {
+	PollInterval  time.Duration `mapstructure:"poll_interval"`
+	BatchSize     int           `mapstructure:"batch_size"`
+	MaxAttempts   int           `mapstructure:"max_attempts"`
+	RetryDelay    time.Duration `mapstructure:"retry_delay"`
+	MaxRetryDelay time.Duration `mapstructure:"max_retry_delay"`
+	// Timeout bounds each request to a subscriber
+	Timeout time.Duration `mapstructure:"timeout"`
+	// AllowPrivateNetworks lets webhooks reach loopback, private and
+	// link-local addresses, for subscribers inside the deployment
+	AllowPrivateNetworks bool `mapstructure:"allow_private_networks"`
+}
+
+// FrontendClientConfig is a frontend, such as the web app or a mobile app
+// opened through deep links, and the pages of it that emailed links open.
+// Pages left empty fall back to the service's endpoints under base_url.
+type FrontendClientConfig struct {
+	PasswordResetURL string `mapstructure:"password_reset_url"`
+	VerificationURL  string `mapstructure:"verification_url"`
+	EmailChangeURL   string `mapstructure:"email_change_url"`
+	InvitationURL    string `mapstructure:"invitation_url"`
+	// AllowedRedirects are the pages a request may have its links open
+	// instead. An entry ending in "/" allows every page under it.
+	AllowedRedirects []string `mapstructure:"allowed_redirects"`
+}
+
+// FrontendConfig lists the frontends using the service. Requests choose one
+// by client ID; the default client is used when they don't.
+type FrontendConfig struct {
+	DefaultClient string                          `mapstructure:"default_client"`
+	Clients       map[string]FrontendClientConfig `mapstructure:"clients"`
+	// CORSOrigins are the browser origins allowed to call the API
+	CORSOrigins []string `mapstructure:"cors_origins"`
+}
+
+type OAuthConfig struct {
+	Issuer                    string        `mapstructure:"issuer"` // defaults to base_url
+	SigningKeyFile            string        `mapstructure:"signing_key_file"`
+	AccessTokenTTL            time.Duration `mapstructure:"access_token_ttl"`
+	IDTokenTTL                time.Duration `mapstructure:"id_token_ttl"`
+	AuthorizationCodeTTL      time.Duration `mapstructure:"authorization_code_ttl"`
+	SecretRotationGracePeriod time.Duration `mapstructure:"secret_rotation_grace_period"`
+}
+
+// OIDCProviderConfig describes an upstream OpenID Connect provider used for
+// social login. Providers without a client ID are disabled.
+type OIDCProviderConfig struct {
+	DisplayName  string   `mapstructure:"display_name"`
+	Issuer       string   `mapstructure:"issuer"`
+	ClientID     string   `mapstructure:"client_id"`
+	ClientSecret string   `mapstructure:"client_secret"`
+	Scopes       []string `mapstructure:"scopes"`
+	// TrustEmail treats the email claim as verified for providers that do
+	// not send email_verified, e.g. a single-tenant directory
+	TrustEmail bool `mapstructure:"trust_email"`
+	// AllowSignup creates an account with DefaultRole when no user has
+	// the provider's verified email; otherwise only existing users can link
+	AllowSignup bool   `mapstructure:"allow_signup"`
+	DefaultRole string `mapstructure:"default_role"`
+	// AllowedTenants lists the tenant IDs accepted from a multi-tenant
+	// provider, whose discovery issuer contains {tenantid}. Tokens from
+	// any other tenant, or from every tenant when the list is empty, are
+	// rejected.
+	AllowedTenants []string `mapstructure:"allowed_tenants"`
+}
+
+type SocialLoginConfig struct {
+	StateTTL  time.Duration                 `mapstructure:"state_ttl"`
+	Providers map[string]OIDCProviderConfig `mapstructure:"providers"`
+}
+
+// LDAPDirectoryConfig is an LDAP or Active Directory server that users of
+// an email domain, or whose accounts it created, sign in against by binding
+// with their own credentials
+type LDAPDirectoryConfig struct {
+	URL                string        `mapstructure:"url"` // ldap:// or ldaps://
+	StartTLS           bool          `mapstructure:"start_tls"`
+	InsecureSkipVerify bool          `mapstructure:"insecure_skip_verify"`
+	Timeout            time.Duration `mapstructure:"timeout"`
+	// Service account used to look users up; anonymous when empty
+	BindDN       string `mapstructure:"bind_dn"`
+	BindPassword string `mapstructure:"bind_password"`
+	BaseDN       string `mapstructure:"base_dn"`
+	// UserFilter finds the user's entry; %s is replaced by the escaped email
+	UserFilter     string `mapstructure:"user_filter"`
+	EmailAttribute string `mapstructure:"email_attribute"`
+	NameAttribute  string `mapstructure:"name_attribute"`
+	// Groups come from GroupAttribute on the user entry (memberOf in AD) or,
+	// when GroupFilter is set, from searching GroupBaseDN with the escaped
+	// user DN substituted for %s
+	GroupAttribute string `mapstructure:"group_attribute"`
+	GroupBaseDN    string `mapstructure:"group_base_dn"`
+	GroupFilter    string `mapstructure:"group_filter"`
+	// Users with an email in EmailDomains, and accounts the directory
+	// created, sign in here. GroupRoles maps group DNs to roles in OrgID.
+	OrgID        int64             `mapstructure:"org_id"`
+	EmailDomains []string          `mapstructure:"email_domains"`
+	GroupRoles   map[string]string `mapstructure:"group_roles"`
+	DefaultRole  string            `mapstructure:"default_role"`
+	AllowSignup  bool              `mapstructure:"allow_signup"`
 }
 
 type Config struct {
-	Port          string         `mapstructure:"port"`
-	Database      DatabaseConfig `mapstructure:"database"`
-	JWTSecret     string         `mapstructure:"jwt_secret"`
-	SMTP          SMTPConfig     `mapstructure:"smtp"`
-	BaseURL       string         `mapstructure:"base_url"`
-	PasswordReset string         `mapstructure:"password_reset_path"`
-	Verification  string         `mapstructure:"verification_path"`
-	DatabaseURL   string         // This will be constructed
+	Port          string                         `mapstructure:"port"`
+	Database      DatabaseConfig                 `mapstructure:"database"`
+	JWTSecret     string                         `mapstructure:"jwt_secret"`
+	SMTP          SMTPConfig                     `mapstructure:"smtp"`
+	Email         EmailConfig                    `mapstructure:"email"`
+	Audit         AuditConfig                    `mapstructure:"audit"`
+	OAuth         OAuthConfig                    `mapstructure:"oauth"`
+	SocialLogin   SocialLoginConfig              `mapstructure:"social_login"`
+	LDAP          map[string]LDAPDirectoryConfig `mapstructure:"ldap"`
+	Frontend      FrontendConfig                 `mapstructure:"frontend"`
+	SMS           SMSConfig                      `mapstructure:"sms"`
+	Webhooks      WebhookConfig                  `mapstructure:"webhooks"`
+	BaseURL       string                         `mapstructure:"base_url"`
+	PasswordReset string                         `mapstructure:"password_reset_path"`
+	Verification  string                         `mapstructure:"verification_path"`
+	EmailChange   string                         `mapstructure:"email_change_path"`
+	Invitation    string                         `mapstructure:"invitation_path"`
+	InvitationTTL time.Duration                  `mapstructure:"invitation_ttl"`
+	DatabaseURL   string                         // This will be constructed
+
+	// InvitationMaxTTL caps the expiry an inviter may choose
+	InvitationMaxTTL time.Duration `mapstructure:"invitation_max_ttl"`
+
+	// EmbedManagerClaim adds the member's direct manager as manager_id to
+	// org-scoped tokens, as of when the token was issued
+	EmbedManagerClaim bool `mapstructure:"embed_manager_claim"`
+
+	// SAMLRequestTTL bounds how long the IdP may take to answer an
+	// SP-initiated SAML login
+	SAMLRequestTTL time.Duration `mapstructure:"saml_request_ttl"`
+
+	// Account deletion: how long a soft-deleted account can be restored,
+	// and how often the purge job anonymizes expired ones
+	AccountDeletionGracePeriod time.Duration `mapstructure:"account_deletion_grace_period"`
+	AccountPurgeInterval       time.Duration `mapstructure:"account_purge_interval"`
 }
 
 func NewConfig() (*Config, error) {
@@ -48,6 +295,54 @@ func NewConfig() (*Config, error) {
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath(".") // Look in the current directory
 
+	viper.SetDefault("account_deletion_grace_period", 30*24*time.Hour)
+	viper.SetDefault("account_purge_interval", time.Hour)
+	viper.SetDefault("invitation_ttl", 7*24*time.Hour)
+	viper.SetDefault("invitation_max_ttl", 30*24*time.Hour)
+	viper.SetDefault("audit.checkpoint_file", "audit-checkpoints.jsonl")
+	viper.SetDefault("audit.checkpoint_interval", time.Hour)
+	viper.SetDefault("oauth.access_token_ttl", time.Hour)
+	viper.SetDefault("oauth.id_token_ttl", time.Hour)
+	viper.SetDefault("oauth.authorization_code_ttl", 10*time.Minute)
+	viper.SetDefault("social_login.state_ttl", 10*time.Minute)
+	viper.SetDefault("oauth.secret_rotation_grace_period", 24*time.Hour)
+	viper.SetDefault("saml_request_ttl", 10*time.Minute)
+	viper.SetDefault("frontend.default_client", "web")
+	viper.SetDefault("frontend.cors_origins", []string{"http://localhost:3000"})
+	viper.SetDefault("sms.sender", "log")
+	viper.SetDefault("sms.code_ttl", 10*time.Minute)
+	viper.SetDefault("sms.resend_interval", time.Minute)
+	viper.SetDefault("sms.max_attempts", 5)
+	viper.SetDefault("sms.max_codes_per_day", 10)
+	viper.SetDefault("sms.http.timeout", 10*time.Second)
+	viper.SetDefault("webhooks.poll_interval", 5*time.Second)
+	viper.SetDefault("webhooks.batch_size", 20)
+	viper.SetDefault("webhooks.max_attempts", 10)
+	viper.SetDefault("webhooks.retry_delay", 30*time.Second)
+	viper.SetDefault("webhooks.max_retry_delay", 6*time.Hour)
+	viper.SetDefault("webhooks.timeout", 10*time.Second)
+	viper.SetDefault("webhooks.allow_private_networks", false)
+	viper.SetDefault("email.default_locale", "en")
+	viper.SetDefault("email.brand.product_name", "Sales Tracker")
+	viper.SetDefault("email.brand.team_name", "The Sales Tracker Team")
+	viper.SetDefault("email.brand.primary_color", "#2563eb")
+	viper.SetDefault("email.outbox.poll_interval", 5*time.Second)
+	viper.SetDefault("email.outbox.batch_size", 20)
+	viper.SetDefault("email.outbox.max_attempts", 8)
+	viper.SetDefault("email.outbox.retry_delay", 30*time.Second)
+	viper.SetDefault("email.outbox.max_retry_delay", time.Hour)
+	viper.SetDefault("email.outbox.send_timeout", 5*time.Minute)
+	viper.SetDefault("email.transport", "smtp")
+	viper.SetDefault("email.file.dir", "mail")
+	viper.SetDefault("email.file.format", "eml")
+	viper.SetDefault("email.capture.expose_api", false)
+	viper.SetDefault("email.http.provider", "postmark")
+	viper.SetDefault("email.http.timeout", 10*time.Second)
+	viper.SetDefault("email.http.message_stream", "outbound")
+	viper.SetDefault("email.http.webhook_user", "email-webhook")
+	viper.SetDefault("smtp.security", "starttls")
+	viper.SetDefault("smtp.timeout", 30*time.Second)
+
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
@@ -72,5 +367,9 @@ func NewConfig() (*Config, error) {
 		return nil, fmt.Errorf("database configuration is incomplete - check config.yaml")
 	}
 
+	if config.OAuth.Issuer == "" {
+		config.OAuth.Issuer = config.BaseURL
+	}
+
 	return &config, nil
 }
@@ -0,0 +1,114 @@
+package domain
+
+import "time"
+
+// Audit event types
+const (
+	AuditEventUserRegistered           = "user.registered"
+	AuditEventLogin                    = "user.login"
+	AuditEventEmailVerified            = "user.email_verified"
+	AuditEventVerificationResent       = "user.verification_resent"
+	AuditEventPasswordResetRequested   = "user.password_reset_requested"
+	AuditEventPasswordReset            = "user.password_reset"
+	AuditEventEmailChangeRequested     = "user.email_change_requested"
+	AuditEventEmailChanged             = "user.email_changed"
+	AuditEventAccountDeletionScheduled = "user.deletion_scheduled"
+	AuditEventAccountDeletionCancelled = "user.deletion_cancelled"
+	AuditEventAccountsPurged           = "user.purged"
+	AuditEventDataExported             = "user.data_exported"
+	AuditEventRoleChanged              = "user.role_changed"
+	AuditEventOrganizationSwitched     = "user.org_switched"
+	AuditEventOrganizationCreated      = "org.created"
+	AuditEventMemberAdded              = "org.member_added"
+	AuditEventMemberRemoved            = "org.member_removed"
+	AuditEventManagerChanged           = "org.manager_changed"
+	AuditEventInvitationCreated        = "org.invitation_created"
+	AuditEventInvitationResent         = "org.invitation_resent"
+	AuditEventInvitationRevoked        = "org.invitation_revoked"
+	AuditEventInvitationAccepted       = "org.invitation_accepted"
+	AuditEventAPIKeyCreated            = "api_key.created"
+	AuditEventAPIKeyRevoked            = "api_key.revoked"
+	AuditEventOAuthClientCreated       = "oauth.client_created"
+	AuditEventOAuthClientRotated       = "oauth.client_secret_rotated"
+	AuditEventOAuthClientRevoked       = "oauth.client_revoked"
+	AuditEventOAuthTokenIssued         = "oauth.token_issued"
+	AuditEventOAuthAuthorized          = "oauth.authorization_granted"
+	AuditEventOAuthConsentRevoked      = "oauth.consent_revoked"
+	AuditEventFederatedLogin           = "user.federated_login"
+	AuditEventIdentityLinked           = "user.identity_linked"
+	AuditEventSAMLLogin                = "user.saml_login"
+	AuditEventSAMLConfigUpdated        = "org.saml_config_updated"
+	AuditEventSAMLConfigDeleted        = "org.saml_config_deleted"
+	AuditEventSCIMUserProvisioned      = "scim.user_provisioned"
+	AuditEventSCIMUserUpdated          = "scim.user_updated"
+	AuditEventSCIMUserDeprovisioned    = "scim.user_deprovisioned"
+	AuditEventSCIMGroupCreated         = "scim.group_created"
+	AuditEventSCIMGroupUpdated         = "scim.group_updated"
+	AuditEventSCIMGroupDeleted         = "scim.group_deleted"
+	AuditEventEmailUndeliverable       = "user.email_undeliverable"
+	AuditEventNotificationsUpdated     = "user.notifications_updated"
+	AuditEventSMSCodeSent              = "user.sms_code_sent"
+	AuditEventPhoneVerified            = "user.phone_verified"
+	AuditEventPhoneRemoved             = "user.phone_removed"
+	AuditEventMFAEnabled               = "user.mfa_enabled"
+	AuditEventMFADisabled              = "user.mfa_disabled"
+	AuditEventMFALogin                 = "user.mfa_login"
+	AuditEventPasswordResetSMSVerified = "user.password_reset_sms_verified"
+	AuditEventWebhookCreated           = "webhook.created"
+	AuditEventWebhookUpdated           = "webhook.updated"
+	AuditEventWebhookDeleted           = "webhook.deleted"
+	AuditEventWebhookSecretRotated     = "webhook.secret_rotated"
+	AuditEventWebhookReplayed          = "webhook.delivery_replayed"
+	AuditEventRedacted                 = "audit.redacted"
+)
+
+// Audit event outcomes
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+// AuditEvent is a single append-only record in the security audit log.
+// ActorID is the user who performed the action and SubjectID the user it
+// was performed on; either may be nil (e.g. failed logins, background jobs).
+type AuditEvent struct {
+	ID        int64                  `json:"id"`
+	EventType string                 `json:"event_type"`
+	ActorID   *int64                 `json:"actor_id,omitempty"`
+	SubjectID *int64                 `json:"subject_id,omitempty"`
+	IP        string                 `json:"ip,omitempty"`
+	UserAgent string                 `json:"user_agent,omitempty"`
+	Outcome   string                 `json:"outcome"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+	PrevHash  string                 `json:"prev_hash,omitempty"`
+	Hash      string                 `json:"hash,omitempty"`
+	// MetadataHash commits to Metadata as it was recorded. Hash covers
+	// MetadataHash rather than Metadata itself, so personal data can be
+	// redacted from Metadata without breaking the chain. It is empty for
+	// events recorded before metadata was hashed separately.
+	MetadataHash string `json:"metadata_hash,omitempty"`
+	// RedactedAt is set once personal data was scrubbed from Metadata. An
+	// audit.redacted event in the chain commits to the redacted metadata.
+	RedactedAt *time.Time `json:"redacted_at,omitempty"`
+}
+
+// AuditEventFilter narrows an audit log query. Zero values are ignored.
+// Results are returned newest first, starting strictly before Cursor.
+type AuditEventFilter struct {
+	EventType string
+	ActorID   *int64
+	SubjectID *int64
+	Outcome   string
+	From      time.Time
+	To        time.Time
+	Cursor    int64
+	Limit     int
+}
+
+// RequestInfo describes who made a request and from where, for auditing
+type RequestInfo struct {
+	ActorID   *int64
+	IP        string
+	UserAgent string
+}
@@ -0,0 +1,176 @@
+package domain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// auditHashContent is the canonical, fixed-order representation of an
+// audit event that is fed into the hash chain
+type auditHashContent struct {
+	PrevHash  string          `json:"prev_hash"`
+	EventType string          `json:"event_type"`
+	ActorID   *int64          `json:"actor_id"`
+	SubjectID *int64          `json:"subject_id"`
+	IP        string          `json:"ip"`
+	UserAgent string          `json:"user_agent"`
+	Outcome   string          `json:"outcome"`
+	Metadata  json.RawMessage `json:"metadata"`
+	CreatedAt string          `json:"created_at"`
+}
+
+// auditHashContentV2 replaces the metadata with its hash, so that redacting
+// the metadata leaves the chain intact
+type auditHashContentV2 struct {
+	PrevHash     string `json:"prev_hash"`
+	EventType    string `json:"event_type"`
+	ActorID      *int64 `json:"actor_id"`
+	SubjectID    *int64 `json:"subject_id"`
+	IP           string `json:"ip"`
+	UserAgent    string `json:"user_agent"`
+	Outcome      string `json:"outcome"`
+	MetadataHash string `json:"metadata_hash"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// redactionMetadataKey holds, in an audit.redacted event, the hash of the
+// redacted metadata of each event it accounts for, keyed by event ID
+const redactionMetadataKey = "redacted"
+
+// ComputeHash returns the hex SHA-256 over the event's content and PrevHash.
+// Metadata is normalized (sorted keys, numbers kept verbatim) so the result
+// is the same before insert and after a round trip through JSONB. Events
+// with a MetadataHash are hashed over it instead of the metadata.
+func (e *AuditEvent) ComputeHash() (string, error) {
+	if e.MetadataHash != "" {
+		return hashJSON(auditHashContentV2{
+			PrevHash:     e.PrevHash,
+			EventType:    e.EventType,
+			ActorID:      e.ActorID,
+			SubjectID:    e.SubjectID,
+			IP:           e.IP,
+			UserAgent:    e.UserAgent,
+			Outcome:      e.Outcome,
+			MetadataHash: e.MetadataHash,
+			CreatedAt:    e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		})
+	}
+
+	metadata, err := canonicalJSON(e.Metadata)
+	if err != nil {
+		return "", err
+	}
+
+	return hashJSON(auditHashContent{
+		PrevHash:  e.PrevHash,
+		EventType: e.EventType,
+		ActorID:   e.ActorID,
+		SubjectID: e.SubjectID,
+		IP:        e.IP,
+		UserAgent: e.UserAgent,
+		Outcome:   e.Outcome,
+		Metadata:  metadata,
+		CreatedAt: e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+}
+
+// ComputeMetadataHash returns the hex SHA-256 over the event's normalized
+// metadata
+func (e *AuditEvent) ComputeMetadataHash() (string, error) {
+	metadata, err := canonicalJSON(e.Metadata)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(metadata)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// NewAuditRedactionEvent records that the metadata of the given events was
+// redacted for userID, committing to the hash of each event's new metadata
+func NewAuditRedactionEvent(userID int64, metadataHashes map[int64]string, at time.Time) *AuditEvent {
+	redacted := make(map[string]interface{}, len(metadataHashes))
+	for id, hash := range metadataHashes {
+		redacted[strconv.FormatInt(id, 10)] = hash
+	}
+
+	return &AuditEvent{
+		EventType: AuditEventRedacted,
+		SubjectID: &userID,
+		Outcome:   AuditOutcomeSuccess,
+		Metadata:  map[string]interface{}{redactionMetadataKey: redacted},
+		CreatedAt: at,
+	}
+}
+
+// RedactedMetadataHashes returns the metadata hashes an audit.redacted event
+// commits to, keyed by event ID. It returns nil for any other event.
+func (e *AuditEvent) RedactedMetadataHashes() map[int64]string {
+	if e.EventType != AuditEventRedacted {
+		return nil
+	}
+
+	redacted, _ := e.Metadata[redactionMetadataKey].(map[string]interface{})
+	hashes := make(map[int64]string, len(redacted))
+	for key, value := range redacted {
+		id, err := strconv.ParseInt(key, 10, 64)
+		hash, ok := value.(string)
+		if err != nil || !ok {
+			continue
+		}
+		hashes[id] = hash
+	}
+	return hashes
+}
+
+func hashJSON(v interface{}) (string, error) {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func canonicalJSON(v map[string]interface{}) (json.RawMessage, error) {
+	if len(v) == 0 {
+		return json.RawMessage("{}"), nil
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var normalized interface{}
+	if err := decoder.Decode(&normalized); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(normalized)
+}
+
+// AuditCheckpoint is a signed statement of the audit chain head at a point
+// in time. Checkpoints are exported outside the database so that a rewrite
+// of the whole chain can still be detected.
+type AuditCheckpoint struct {
+	EventID   int64     `json:"event_id"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+	Signature string    `json:"signature,omitempty"`
+}
+
+// SigningPayload returns the bytes covered by the checkpoint signature
+func (c *AuditCheckpoint) SigningPayload() []byte {
+	unsigned := *c
+	unsigned.Signature = ""
+	payload, _ := json.Marshal(unsigned)
+	return payload
+}
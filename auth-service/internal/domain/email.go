@@ -0,0 +1,76 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidEmailAddress = errors.New("invalid email address")
+	ErrOutboxEmailNotFound = errors.New("outbox email not found")
+	// ErrEmailUndeliverable is a provider refusing a recipient outright;
+	// retrying will not help
+	ErrEmailUndeliverable = errors.New("email address is undeliverable")
+
+	ErrUnknownFrontendClient = errors.New("unknown client_id")
+	ErrRedirectNotAllowed    = errors.New("redirect is not allowed for this client")
+)
+
+// LinkHint is a request's choice of where the links emailed in response to
+// it lead: the frontend client whose pages they open and, optionally, one
+// of that client's allowed redirects to open instead. Zero values pick the
+// default client's pages.
+type LinkHint struct {
+	ClientID string `json:"client_id"`
+	Redirect string `json:"redirect"`
+}
+
+// Delivery states of an outbox email. Pending emails are retried until they
+// are sent or run out of attempts, at which point they are dead-lettered.
+const (
+	OutboxStatusPending = "pending"
+	OutboxStatusSent    = "sent"
+	OutboxStatusDead    = "dead"
+)
+
+// OutboxEmail is an email waiting for, or done with, delivery. Data is the
+// template data; it holds single-use links and is never returned by the API.
+type OutboxEmail struct {
+	ID            int64                  `json:"id"`
+	Recipient     string                 `json:"recipient"`
+	Locale        string                 `json:"locale"`
+	Template      string                 `json:"template"`
+	Data          map[string]interface{} `json:"-"`
+	Status        string                 `json:"status"`
+	Attempts      int                    `json:"attempts"`
+	NextAttemptAt time.Time              `json:"next_attempt_at"`
+	LastError     string                 `json:"last_error,omitempty"`
+	SentAt        *time.Time             `json:"sent_at,omitempty"`
+	CreatedAt     time.Time              `json:"created_at"`
+	UpdatedAt     time.Time              `json:"updated_at"`
+}
+
+// Kinds of delivery problems reported by email provider webhooks
+const (
+	EmailEventBounce    = "bounce"
+	EmailEventComplaint = "complaint"
+)
+
+// EmailDeliveryEvent is a provider's report that mail to Address hard
+// bounced or was marked as spam by the recipient
+type EmailDeliveryEvent struct {
+	Type       string
+	Address    string
+	Reason     string
+	OccurredAt time.Time
+}
+
+// OutboxEmailFilter narrows an outbox query. Zero values are ignored.
+// Results are returned newest first, starting strictly before Cursor.
+type OutboxEmailFilter struct {
+	Status    string
+	Recipient string
+	Template  string
+	Cursor    int64
+	Limit     int
+}
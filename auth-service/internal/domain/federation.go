@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrUnknownProvider        = errors.New("unknown identity provider")
+	ErrInvalidLoginState      = errors.New("login state is invalid or expired")
+	ErrInvalidUpstreamToken   = errors.New("identity provider returned an invalid ID token")
+	ErrUnverifiedUpstreamMail = errors.New("identity provider did not verify the email address")
+	ErrNoLinkedAccount        = errors.New("no account matches this identity")
+	ErrIdentityNotFound       = errors.New("federated identity not found")
+)
+
+// FederatedIdentity links a local user to an account at an upstream OIDC
+// provider, identified by the provider's stable subject
+type FederatedIdentity struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"subject"`
+	Email       string     `json:"email,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// FederatedLoginState is the server side half of an in-flight social login.
+// The state value itself travels through the browser and is stored hashed.
+type FederatedLoginState struct {
+	StateHash    string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+}
+
+// UpstreamClaims are the identity claims taken from a validated upstream ID
+// token. TenantID is set for multi-tenant providers.
+type UpstreamClaims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	TenantID      string
+}
@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Invitation statuses, derived from the timestamps on the invitation
+const (
+	InvitationStatusPending  = "pending"
+	InvitationStatusAccepted = "accepted"
+	InvitationStatusRevoked  = "revoked"
+	InvitationStatusExpired  = "expired"
+)
+
+var (
+	ErrInvitationNotFound   = errors.New("invitation not found")
+	ErrInvitationNotPending = errors.New("invitation is no longer valid")
+	ErrInvitationExists     = errors.New("a pending invitation already exists for this email")
+	ErrRoleNotAssignable    = errors.New("role cannot be assigned by this member")
+	ErrInvitationForbidden  = errors.New("only admins and the member who sent the invitation can manage it")
+	ErrPasswordTooShort     = errors.New("password must be at least 8 characters long")
+)
+
+// Invitation offers an email address membership of an organization with a
+// pre-assigned role
+type Invitation struct {
+	ID         int64      `json:"id"`
+	OrgID      int64      `json:"org_id"`
+	OrgName    string     `json:"org_name,omitempty"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	Token      string     `json:"-"`
+	InvitedBy  *int64     `json:"invited_by,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// Status reports where the invitation is in its lifecycle
+func (i *Invitation) Status() string {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationStatusAccepted
+	case i.RevokedAt != nil:
+		return InvitationStatusRevoked
+	case i.ExpiresAt.Before(time.Now()):
+		return InvitationStatusExpired
+	}
+	return InvitationStatusPending
+}
+
+// MarshalJSON includes the derived status alongside the stored fields
+func (i *Invitation) MarshalJSON() ([]byte, error) {
+	type invitation Invitation
+	return json.Marshal(struct {
+		*invitation
+		Status string `json:"status"`
+	}{(*invitation)(i), i.Status()})
+}
+
+type InvitationCreate struct {
+	Email          string `json:"email" validate:"required,email"`
+	Role           string `json:"role" validate:"required"`
+	ExpiresInHours int    `json:"expires_in_hours"`
+}
+
+// InvitationAccept is the body of POST /auth/invitations/accept. Password is
+// only required when the invited email has no verified account yet.
+type InvitationAccept struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password"`
+	Name     string `json:"name"`
+}
@@ -0,0 +1,31 @@
+package domain
+
+import "errors"
+
+var (
+	ErrDirectoryUnavailable = errors.New("directory server is unavailable")
+)
+
+// DirectoryIdentity is the entry of a user who bound to an LDAP directory
+// with their own password
+type DirectoryIdentity struct {
+	DN     string
+	Email  string
+	Name   string
+	Groups []string
+}
+
+// DirectoryPolicy decides who signs in through a directory and what they
+// become locally. Users with an email in EmailDomains, and accounts the
+// directory created for OrgID, authenticate against the directory; on
+// success they are given a membership in OrgID with the highest-ranked role
+// mapped from their groups, or DefaultRole. Unknown users are only created
+// with AllowSignup. Membership of OrgID alone never routes a user here, as
+// the organization could otherwise pick their password.
+type DirectoryPolicy struct {
+	OrgID        int64
+	EmailDomains []string
+	GroupRoles   map[string]string
+	DefaultRole  string
+	AllowSignup  bool
+}
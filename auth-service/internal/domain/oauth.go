@@ -0,0 +1,175 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// OAuth2 grant types
+const (
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeAuthorizationCode = "authorization_code"
+)
+
+// OAuth2 client types (RFC 6749 section 2.1)
+const (
+	OAuthClientConfidential = "confidential"
+	OAuthClientPublic       = "public"
+)
+
+// Token types reported by the introspection endpoint
+const (
+	IntrospectedAccessToken = "access_token"
+	IntrospectedAPIKey      = "api_key"
+)
+
+// ScopeIntrospect lets a confidential client call the introspection
+// endpoint. Without it a client can only use the tokens it is issued.
+const ScopeIntrospect = "tokens:introspect"
+
+// OAuthClientIDPrefix marks client IDs issued by this service
+const OAuthClientIDPrefix = "stc_"
+
+// OAuthClientRole is the role claim carried by access tokens issued to
+// clients, so they never pass checks meant for user roles
+const OAuthClientRole = "service"
+
+// OAuth2 error codes (RFC 6749 section 5.2)
+const (
+	OAuthErrorInvalidRequest       = "invalid_request"
+	OAuthErrorInvalidClient        = "invalid_client"
+	OAuthErrorInvalidGrant         = "invalid_grant"
+	OAuthErrorInvalidScope         = "invalid_scope"
+	OAuthErrorUnauthorizedClient   = "unauthorized_client"
+	OAuthErrorUnsupportedGrantType = "unsupported_grant_type"
+	OAuthErrorAccessDenied         = "access_denied"
+	OAuthErrorUnsupportedResponse  = "unsupported_response_type"
+	OAuthErrorLoginRequired        = "login_required"
+	OAuthErrorInvalidToken         = "invalid_token"
+)
+
+var (
+	ErrInvalidClient       = errors.New("invalid client credentials")
+	ErrInvalidScope        = errors.New("requested scope is not allowed for this client")
+	ErrOAuthClientNotFound = errors.New("OAuth client not found")
+	ErrUnauthorizedClient  = errors.New("client is not allowed to use this grant type")
+	ErrInvalidOAuthClient  = errors.New("invalid OAuth client registration")
+	ErrPublicClientSecret  = errors.New("public clients have no secret")
+	ErrIntrospectionDenied = errors.New("client is not allowed to introspect tokens")
+)
+
+// OAuthClient is an application registered to obtain access tokens, either
+// for itself (client_credentials) or on behalf of a user (authorization_code).
+// Only bcrypt hashes of confidential client secrets are stored. After a
+// rotation the previous secret keeps working until PreviousSecretExpiresAt.
+type OAuthClient struct {
+	ID                      int64      `json:"id"`
+	ClientID                string     `json:"client_id"`
+	Type                    string     `json:"client_type"`
+	RedirectURIs            []string   `json:"redirect_uris"`
+	GrantTypes              []string   `json:"grant_types"`
+	SecretHash              string     `json:"-"`
+	PreviousSecretHash      string     `json:"-"`
+	PreviousSecretExpiresAt *time.Time `json:"previous_secret_expires_at,omitempty"`
+	Name                    string     `json:"name"`
+	OrgID                   *int64     `json:"org_id,omitempty"`
+	Scopes                  []string   `json:"scopes"`
+	CreatedBy               *int64     `json:"created_by,omitempty"`
+	SecretRotatedAt         *time.Time `json:"secret_rotated_at,omitempty"`
+	RevokedAt               *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt               time.Time  `json:"created_at"`
+	UpdatedAt               time.Time  `json:"updated_at"`
+}
+
+func (c *OAuthClient) IsPublic() bool {
+	return c.Type == OAuthClientPublic
+}
+
+func (c *OAuthClient) AllowsGrant(grantType string) bool {
+	for _, granted := range c.GrantTypes {
+		if granted == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the client was registered with scope
+func (c *OAuthClient) HasScope(scope string) bool {
+	for _, registered := range c.Scopes {
+		if registered == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRedirectURI reports whether uri exactly matches a registered redirect URI
+func (c *OAuthClient) HasRedirectURI(uri string) bool {
+	for _, registered := range c.RedirectURIs {
+		if registered == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// GrantedScopes returns the subset of the space-delimited requested scopes
+// that the client may receive. An empty request grants every client scope.
+func (c *OAuthClient) GrantedScopes(requested string) ([]string, error) {
+	if strings.TrimSpace(requested) == "" {
+		return c.Scopes, nil
+	}
+
+	allowed := make(map[string]bool, len(c.Scopes))
+	for _, scope := range c.Scopes {
+		allowed[scope] = true
+	}
+
+	var granted []string
+	for _, scope := range strings.Fields(requested) {
+		if !allowed[scope] {
+			return nil, ErrInvalidScope
+		}
+		granted = append(granted, scope)
+	}
+	return granted, nil
+}
+
+type OAuthClientCreate struct {
+	Name         string   `json:"name" validate:"required"`
+	Type         string   `json:"client_type"`
+	Scopes       []string `json:"scopes"`
+	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types"`
+	OrgID        *int64   `json:"org_id"`
+}
+
+// OAuthTokenResponse is the successful token endpoint response (RFC 6749 section 5.1)
+type OAuthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+	IDToken     string `json:"id_token,omitempty"`
+}
+
+// TokenIntrospection is the introspection endpoint response (RFC 7662
+// section 2.2). Inactive tokens carry nothing but Active. User details
+// reflect the account as it is now, not as it was when the token was issued,
+// and Email and Role are only given to the client the token was issued to.
+type TokenIntrospection struct {
+	Active    bool   `json:"active"`
+	TokenType string `json:"token_type,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	UserID    int64  `json:"user_id,omitempty"`
+	Role      string `json:"role,omitempty"`
+	Email     string `json:"email,omitempty"`
+	OrgID     int64  `json:"org_id,omitempty"`
+	OrgRole   string `json:"org_role,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
@@ -0,0 +1,138 @@
+package domain
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// OpenID Connect scopes
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// CodeChallengeMethodS256 is the only PKCE method accepted; "plain" offers
+// no protection if the authorization request is observed
+const CodeChallengeMethodS256 = "S256"
+
+var (
+	ErrInvalidRedirectURI      = errors.New("redirect_uri is not registered for this client")
+	ErrUnsupportedResponseType = errors.New("only the code response type is supported")
+	ErrPKCERequired            = errors.New("code_challenge with method S256 is required")
+	ErrInvalidGrant            = errors.New("authorization code is invalid, expired or already used")
+	ErrConsentNotFound         = errors.New("consent not found")
+)
+
+// AuthorizationRequest holds the parameters of an /oauth/authorize request.
+// GET requests carry them in the query, the login form posts them back.
+type AuthorizationRequest struct {
+	ResponseType        string `query:"response_type" form:"response_type"`
+	ClientID            string `query:"client_id" form:"client_id"`
+	RedirectURI         string `query:"redirect_uri" form:"redirect_uri"`
+	Scope               string `query:"scope" form:"scope"`
+	State               string `query:"state" form:"state"`
+	Nonce               string `query:"nonce" form:"nonce"`
+	CodeChallenge       string `query:"code_challenge" form:"code_challenge"`
+	CodeChallengeMethod string `query:"code_challenge_method" form:"code_challenge_method"`
+	Prompt              string `query:"prompt" form:"prompt"`
+}
+
+// AuthorizationCode is a pending authorization granted by a user to a
+// client. The code itself is only stored as CodeHash.
+type AuthorizationCode struct {
+	CodeHash            string
+	ClientID            string
+	UserID              int64
+	RedirectURI         string
+	Scopes              []string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	AuthTime            time.Time
+	ExpiresAt           time.Time
+	ConsumedAt          *time.Time
+	CreatedAt           time.Time
+}
+
+// OAuthConsent records the scopes a user agreed to share with a client
+type OAuthConsent struct {
+	UserID     int64     `json:"user_id"`
+	ClientID   string    `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// IDTokenClaims are the claims of an OpenID Connect ID token. Profile and
+// email claims are only filled in when the matching scope was granted.
+type IDTokenClaims struct {
+	AuthTime      int64  `json:"auth_time,omitempty"`
+	Nonce         string `json:"nonce,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	Name          string `json:"name,omitempty"`
+	jwt.StandardClaims
+}
+
+// UserInfo is the /userinfo response (OpenID Connect Core section 5.3)
+type UserInfo struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	Name          string `json:"name,omitempty"`
+}
+
+// NewUserInfo builds the OpenID Connect claims about user that scopes allow.
+// The subject is the stable user ID, never the email, which can change.
+func NewUserInfo(user *User, scopes []string) *UserInfo {
+	info := &UserInfo{Subject: strconv.FormatInt(user.ID, 10)}
+	for _, scope := range scopes {
+		switch scope {
+		case ScopeEmail:
+			verified := user.IsVerified
+			info.Email = user.Email
+			info.EmailVerified = &verified
+		case ScopeProfile:
+			info.Name = user.Name
+		}
+	}
+	return info
+}
+
+// JSONWebKey is an RSA public key in JWK format (RFC 7517)
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Modulus   string `json:"n"`
+	Exponent  string `json:"e"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// OpenIDConfiguration is the discovery document served at
+// /.well-known/openid-configuration
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
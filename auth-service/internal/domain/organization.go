@@ -0,0 +1,88 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// Organization roles
+const (
+	OrgRoleAdmin        = "admin"
+	OrgRoleSalesManager = "sales_manager"
+	OrgRoleSalesRep     = "sales_rep"
+	OrgRoleClient       = "client"
+)
+
+var (
+	ErrOrganizationNotFound = errors.New("organization not found")
+	ErrInvalidOrganization  = errors.New("organization name is required")
+	ErrSlugTaken            = errors.New("organization slug is already taken")
+	ErrMembershipNotFound   = errors.New("membership not found")
+	ErrMembershipExists     = errors.New("user is already a member of the organization")
+	ErrInvalidOrgRole       = errors.New("invalid organization role")
+	ErrLastOrgAdmin         = errors.New("organization must keep at least one admin")
+	ErrInvalidManager       = errors.New("manager must be another member of the organization outside the user's reports")
+	ErrReportsForbidden     = errors.New("not allowed to view this user's reports")
+	// ErrInvitationRequired is returned when adding a member whose account
+	// the organization did not create; they must accept an invitation
+	ErrInvitationRequired = errors.New("user must be invited to join the organization")
+)
+
+// IsValidOrgRole reports whether role is one of the organization roles
+func IsValidOrgRole(role string) bool {
+	switch role {
+	case OrgRoleAdmin, OrgRoleSalesManager, OrgRoleSalesRep, OrgRoleClient:
+		return true
+	}
+	return false
+}
+
+type Organization struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Membership links a user to an organization with a per-organization role.
+// Email and OrgName are filled in by queries that join users or organizations.
+type Membership struct {
+	UserID    int64     `json:"user_id"`
+	OrgID     int64     `json:"org_id"`
+	Role      string    `json:"role"`
+	ManagerID *int64    `json:"manager_id,omitempty"`
+	Email     string    `json:"email,omitempty"`
+	OrgName   string    `json:"org_name,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Report is a member below a manager in the reporting hierarchy. Depth is 1
+// for direct reports, 2 for their reports, and so on.
+type Report struct {
+	UserID    int64  `json:"user_id"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	ManagerID int64  `json:"manager_id"`
+	Depth     int    `json:"depth"`
+}
+
+type OrganizationCreate struct {
+	Name string `json:"name" validate:"required"`
+	Slug string `json:"slug"`
+}
+
+type MembershipCreate struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"required"`
+}
+
+type MembershipUpdate struct {
+	Role string `json:"role" validate:"required"`
+}
+
+// ManagerUpdate sets or, with a null manager_id, clears a member's manager
+type ManagerUpdate struct {
+	ManagerID *int64 `json:"manager_id"`
+}
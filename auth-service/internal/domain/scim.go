@@ -0,0 +1,234 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// SCIM 2.0 schema and message URNs (RFC 7643, RFC 7644)
+const (
+	SCIMSchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SCIMSchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SCIMSchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SCIMSchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SCIMSchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SCIMSchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+)
+
+// SCIMScope is the API key scope that grants access to /scim/v2. Only
+// organization-owned keys can use it.
+const SCIMScope = "scim"
+
+var (
+	ErrSCIMInvalidFilter = errors.New("invalid filter")
+	ErrSCIMInvalidValue  = errors.New("invalid value")
+	ErrSCIMInvalidPath   = errors.New("invalid path")
+	ErrSCIMNoTarget      = errors.New("no target")
+	ErrSCIMUniqueness    = errors.New("resource already exists")
+	ErrSCIMNotFound      = errors.New("resource not found")
+	// ErrSCIMUnmanagedUser rejects profile changes to an account the
+	// organization's directory did not create, which it must not control
+	ErrSCIMUnmanagedUser = errors.New("user was not provisioned by this organization; only their membership can be managed")
+)
+
+// Member attributes a DirectoryUserFilter can compare
+const (
+	DirectoryUserID         = "id"
+	DirectoryUserEmail      = "email"
+	DirectoryUserExternalID = "external_id"
+	DirectoryUserName       = "name"
+	DirectoryUserActive     = "active"
+	DirectoryUserRole       = "role"
+)
+
+// DirectoryUserFilter narrows a member listing to those whose Attribute
+// compares to Value under Operator, one of the SCIM filter operators eq,
+// ne, co, sw, ew and pr. Comparisons ignore case.
+type DirectoryUserFilter struct {
+	Attribute string
+	Operator  string
+	Value     string
+}
+
+// DirectoryUser is an organization member as exposed to a directory.
+// Provisioned is set when the organization's directory created the account.
+type DirectoryUser struct {
+	UserID      int64
+	Email       string
+	Name        string
+	IsActive    bool
+	Role        string
+	ExternalID  string
+	Provisioned bool
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// DirectoryGroup is a group pushed by a directory. Role is set when the
+// group is named after an organization role, and is granted to members.
+type DirectoryGroup struct {
+	ID          int64
+	OrgID       int64
+	DisplayName string
+	ExternalID  string
+	Role        string
+	Members     []DirectoryGroupMember
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type DirectoryGroupMember struct {
+	UserID int64
+	Email  string
+}
+
+type SCIMName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// SCIMValue is an element of a multi-valued attribute such as emails,
+// roles or members
+type SCIMValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type SCIMMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+// SCIMBool accepts JSON booleans as well as "True"/"False" strings, which
+// some directories send in PATCH values
+type SCIMBool bool
+
+func (b *SCIMBool) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		*b = SCIMBool(v)
+		return nil
+	}
+	var v bool
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*b = SCIMBool(v)
+	return nil
+}
+
+// SCIMUser is the SCIM User resource. userName is the sign-in email and
+// roles holds the member's organization role.
+type SCIMUser struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	UserName    string      `json:"userName"`
+	Name        *SCIMName   `json:"name,omitempty"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Emails      []SCIMValue `json:"emails,omitempty"`
+	Active      *SCIMBool   `json:"active,omitempty"`
+	Roles       []SCIMValue `json:"roles,omitempty"`
+	Password    string      `json:"password,omitempty"`
+	Meta        *SCIMMeta   `json:"meta,omitempty"`
+}
+
+type SCIMGroup struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	DisplayName string      `json:"displayName"`
+	Members     []SCIMValue `json:"members"`
+	Meta        *SCIMMeta   `json:"meta,omitempty"`
+}
+
+type SCIMListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+type SCIMPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []SCIMPatchOperation `json:"Operations"`
+}
+
+type SCIMPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+type SCIMErrorResponse struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	SCIMType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// NewSCIMUser renders a member as a SCIM User located under baseURL
+func NewSCIMUser(user *DirectoryUser, baseURL string) *SCIMUser {
+	id := strconv.FormatInt(user.UserID, 10)
+	active := SCIMBool(user.IsActive)
+	resource := &SCIMUser{
+		Schemas:     []string{SCIMSchemaUser},
+		ID:          id,
+		ExternalID:  user.ExternalID,
+		UserName:    user.Email,
+		DisplayName: user.Name,
+		Emails:      []SCIMValue{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Roles:       []SCIMValue{{Value: user.Role, Primary: true}},
+		Meta: &SCIMMeta{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			LastModified: user.UpdatedAt,
+			Location:     baseURL + "/Users/" + id,
+		},
+	}
+	if user.Name != "" {
+		resource.Name = &SCIMName{Formatted: user.Name}
+	}
+	return resource
+}
+
+// NewSCIMGroup renders a directory group as a SCIM Group located under baseURL
+func NewSCIMGroup(group *DirectoryGroup, baseURL string) *SCIMGroup {
+	id := strconv.FormatInt(group.ID, 10)
+	resource := &SCIMGroup{
+		Schemas:     []string{SCIMSchemaGroup},
+		ID:          id,
+		ExternalID:  group.ExternalID,
+		DisplayName: group.DisplayName,
+		Members:     make([]SCIMValue, 0, len(group.Members)),
+		Meta: &SCIMMeta{
+			ResourceType: "Group",
+			Created:      group.CreatedAt,
+			LastModified: group.UpdatedAt,
+			Location:     baseURL + "/Groups/" + id,
+		},
+	}
+	for _, member := range group.Members {
+		memberID := strconv.FormatInt(member.UserID, 10)
+		resource.Members = append(resource.Members, SCIMValue{
+			Value:   memberID,
+			Display: member.Email,
+			Ref:     baseURL + "/Users/" + memberID,
+		})
+	}
+	return resource
+}
@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrUnknownSecurityNotification  = errors.New("unknown security notification")
+	ErrCriticalSecurityNotification = errors.New("critical security notifications cannot be turned off")
+)
+
+// Security notifications emailed to users about their account
+const (
+	SecurityNotificationPasswordReset  = "password_reset"
+	SecurityNotificationEmailChanged   = "email_changed"
+	SecurityNotificationMFADisabled    = "mfa_disabled"
+	SecurityNotificationNewDeviceLogin = "new_device_login"
+)
+
+// SecurityNotifications lists every security notification, mapped to
+// whether it is critical. Critical notifications are always sent; users may
+// opt out of the others.
+var SecurityNotifications = map[string]bool{
+	SecurityNotificationPasswordReset:  true,
+	SecurityNotificationEmailChanged:   true,
+	SecurityNotificationMFADisabled:    true,
+	SecurityNotificationNewDeviceLogin: false,
+}
+
+// SecurityNotificationPreference is whether a user receives a notification
+type SecurityNotificationPreference struct {
+	Notification string `json:"notification"`
+	Critical     bool   `json:"critical"`
+	Enabled      bool   `json:"enabled"`
+}
+
+// LoginDevice is a browser and operating system a user has logged in from
+type LoginDevice struct {
+	Device      string    `json:"device"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
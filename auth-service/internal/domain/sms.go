@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidPhoneNumber = errors.New("invalid phone number")
+	ErrNoVerifiedPhone    = errors.New("no verified phone number")
+	ErrInvalidSMSCode     = errors.New("invalid or expired code")
+	ErrSMSCodeRateLimited = errors.New("a code was sent recently")
+	ErrSMSCodeLimit       = errors.New("too many codes were sent today")
+	ErrMFAAlreadyEnabled  = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled      = errors.New("two-factor authentication is not enabled")
+	// ErrSMSResetWithMFA refuses SMS password resets for users whose second
+	// factor is the same phone, which would then stand in for both factors
+	ErrSMSResetWithMFA = errors.New("password reset by SMS is unavailable with SMS two-factor authentication enabled")
+)
+
+// What an SMS code is for. A code only works for the purpose it was sent for.
+const (
+	SMSPurposePhoneVerification = "verify_phone"
+	SMSPurposeLogin             = "login"
+	SMSPurposePasswordReset     = "password_reset"
+)
+
+// MFAMethodSMS is the second factor of accounts with SMS MFA enabled
+const MFAMethodSMS = "sms"
+
+// SMSCode is a one-time code texted to PhoneNumber. ChallengeHash is set on
+// login codes only.
+type SMSCode struct {
+	ID            int64
+	UserID        int64
+	Purpose       string
+	PhoneNumber   string
+	CodeHash      string
+	ChallengeHash string
+	OrgID         *int64
+	Attempts      int
+	ExpiresAt     time.Time
+	ConsumedAt    *time.Time
+	CreatedAt     time.Time
+}
+
+// MFAChallenge is returned instead of a token when a password login needs
+// a second factor. Token and the texted code complete the login.
+type MFAChallenge struct {
+	Token     string    `json:"mfa_token"`
+	Method    string    `json:"method"`
+	PhoneHint string    `json:"phone_hint"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NormalizePhoneNumber strips the spaces, dots, dashes and parentheses
+// people write phone numbers with and returns the number in E.164 form,
+// e.g. "+14155550123". Numbers without a country code normalize to "".
+func NormalizePhoneNumber(phone string) string {
+	phone = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '.', '-', '(', ')':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(phone))
+
+	digits := strings.TrimPrefix(phone, "+")
+	if digits == phone || len(digits) < 8 || len(digits) > 15 || digits[0] == '0' {
+		return ""
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return ""
+		}
+	}
+	return phone
+}
+
+// MaskPhoneNumber hides all but the last two digits of a phone number
+func MaskPhoneNumber(phone string) string {
+	if len(phone) <= 2 {
+		return phone
+	}
+	return strings.Repeat("*", len(phone)-2) + phone[len(phone)-2:]
+}
@@ -2,33 +2,85 @@ package domain
 
 import (
 	"errors"
-	"time"
 	"github.com/dgrijalva/jwt-go"
+	"regexp"
+	"strings"
+	"time"
 )
 
 var (
 	ErrInvalidResetToken = errors.New("invalid reset token")
 	ErrExpiredResetToken = errors.New("reset token has expired")
+
+	ErrEmailAlreadyInUse       = errors.New("email address is already in use")
+	ErrInvalidEmailChangeToken = errors.New("invalid email change token")
+	ErrExpiredEmailChangeToken = errors.New("email change token has expired")
+	ErrInvalidCredentials      = errors.New("invalid credentials")
+	ErrAccountNotVerified      = errors.New("account not verified")
+	ErrAccountDeleted          = errors.New("account is scheduled for deletion")
+	ErrAccountDisabled         = errors.New("account is disabled")
 )
+
+var localePattern = regexp.MustCompile(`^[a-z]{2,8}(-[a-z0-9]{1,8})*$`)
+
+// NormalizeLocale lower-cases a BCP 47 language tag such as "pt_BR" to
+// "pt-br". Malformed tags normalize to "".
+func NormalizeLocale(locale string) string {
+	locale = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+	if len(locale) > 35 || !localePattern.MatchString(locale) {
+		return ""
+	}
+	return locale
+}
+
 type User struct {
-	ID                  int64     `json:"id"`
-	Email               string    `json:"email"`
-	PasswordHash        string    `json:"-"`
-	Password            string    `json:"-"`
-	Role                string    `json:"role"`
-	IsVerified          bool      `json:"is_verified"`
-	Name                string    `json:"name"`
-	VerificationToken   string    `json:"-"`
-	ResetToken          string    `json:"-"`
-	ResetTokenExpiresAt time.Time `json:"-"`
-	CreatedAt           time.Time `json:"created_at"`
-	UpdatedAt           time.Time `json:"updated_at"`
+	ID                   int64     `json:"id"`
+	Email                string    `json:"email"`
+	PasswordHash         string    `json:"-"`
+	Password             string    `json:"-"`
+	Role                 string    `json:"role"`
+	IsVerified           bool      `json:"is_verified"`
+	IsActive             bool      `json:"is_active"`
+	Name                 string    `json:"name"`
+	Locale               string    `json:"locale,omitempty"`
+	VerificationToken    string    `json:"-"`
+	ResetToken           string    `json:"-"`
+	ResetTokenExpiresAt  time.Time `json:"-"`
+	PendingEmail         string    `json:"pending_email,omitempty"`
+	EmailChangeToken     string    `json:"-"`
+	EmailChangeExpiresAt time.Time `json:"-"`
+	// Set when mail to Email hard bounced or was reported as spam
+	EmailUndeliverableAt     *time.Time `json:"email_undeliverable_at,omitempty"`
+	EmailUndeliverableReason string     `json:"email_undeliverable_reason,omitempty"`
+	// PhoneNumber is only set once verified; SMS MFA requires it
+	PhoneNumber     string     `json:"phone_number,omitempty"`
+	PhoneVerifiedAt *time.Time `json:"phone_verified_at,omitempty"`
+	SMSMFAEnabled   bool       `json:"sms_mfa_enabled"`
+	// ProvisionedByOrgID is the organization whose directory or IdP created
+	// the account. Only that organization may manage it or add it to itself
+	// without the user accepting an invitation.
+	ProvisionedByOrgID *int64     `json:"-"`
+	DeletedAt          *time.Time `json:"deleted_at,omitempty"`
+	PurgeAfter         *time.Time `json:"purge_after,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// ProvisionedBy reports whether orgID created the account
+func (u *User) ProvisionedBy(orgID int64) bool {
+	return u.ProvisionedByOrgID != nil && *u.ProvisionedByOrgID == orgID
 }
 
 type UserRegistration struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required,min=8"`
-	Role     string `json:"role" validate:"required,oneof=client sales_rep admin"`
+	// Role defaults to client. The admin role opens /auth/admin, so it
+	// cannot be picked at sign-up.
+	Role string `json:"role" validate:"omitempty,oneof=client sales_rep"`
+	// Locale picks the language of the account's emails; the request's
+	// Accept-Language header is used when it is empty
+	Locale string `json:"locale"`
+	LinkHint
 }
 
 type UserLogin struct {
@@ -42,10 +94,54 @@ type PasswordReset struct {
 	Password string `json:"password" validate:"required,min=8"`
 }
 
+type EmailChange struct {
+	NewEmail string `json:"new_email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+	LinkHint
+}
+
+type AccountDeletion struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// AnonymizedUser is a purged account. Email is the placeholder it now has
+// and FormerAddresses the current and pending addresses it had before, so
+// that copies of them elsewhere can be redacted.
+type AnonymizedUser struct {
+	ID              int64
+	Email           string
+	FormerAddresses []string
+}
+
+// UserExport is the data portability archive returned by GET /auth/me/export
+type UserExport struct {
+	ExportedAt              time.Time                        `json:"exported_at"`
+	Profile                 *User                            `json:"profile"`
+	AuditEvents             []*AuditEvent                    `json:"audit_events"`
+	OAuthConsents           []*OAuthConsent                  `json:"oauth_consents"`
+	Identities              []*FederatedIdentity             `json:"federated_identities"`
+	LoginDevices            []*LoginDevice                   `json:"login_devices"`
+	APIKeys                 []*APIKey                        `json:"api_keys"`
+	NotificationPreferences []SecurityNotificationPreference `json:"notification_preferences"`
+}
+
 type JWTClaims struct {
-	UserID int64  `json:"user_id"`
-	Role   string `json:"role"`
-	Email  string `json:"email"`
+	UserID  int64  `json:"user_id"`
+	Role    string `json:"role"`
+	Email   string `json:"email"`
+	OrgID   int64  `json:"org_id,omitempty"`
+	OrgRole string `json:"org_role,omitempty"`
+	// ManagerID is the user ID of the member's direct manager in the
+	// active organization when the token was issued. User tokens do not
+	// expire, so it goes stale when the manager changes until the user logs
+	// in or switches organization again; services that need the current
+	// hierarchy should ask /auth/users/:id/reports. Only set when
+	// embed_manager_claim is on.
+	ManagerID int64 `json:"manager_id,omitempty"`
+	// ClientID and Scope are set on OAuth2 access tokens issued to
+	// service accounts; Scope is space-delimited as in RFC 6749
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
 	jwt.StandardClaims
 }
 
@@ -0,0 +1,136 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	ErrWebhookNotFound         = errors.New("webhook not found")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrInvalidWebhookURL       = errors.New("webhook URL must be an absolute https URL")
+	ErrUnknownWebhookEvent     = errors.New("unknown webhook event")
+	ErrNoWebhookEvents         = errors.New("webhook must subscribe to at least one event")
+)
+
+// Events sent to webhook subscribers
+const (
+	WebhookEventUserCreated     = "user.created"
+	WebhookEventUserVerified    = "user.verified"
+	WebhookEventUserRoleChanged = "user.role_changed"
+	WebhookEventUserDeleted     = "user.deleted"
+	WebhookEventLoginFailed     = "login.failed"
+)
+
+// WebhookEventAll subscribes a webhook to every event, including ones added
+// later
+const WebhookEventAll = "*"
+
+// WebhookEvents lists the events a webhook can subscribe to
+var WebhookEvents = []string{
+	WebhookEventUserCreated,
+	WebhookEventUserVerified,
+	WebhookEventUserRoleChanged,
+	WebhookEventUserDeleted,
+	WebhookEventLoginFailed,
+}
+
+// IsWebhookEvent reports whether event is one webhooks can subscribe to
+func IsWebhookEvent(event string) bool {
+	for _, e := range WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery states of a webhook delivery. Pending deliveries are retried
+// until the subscriber accepts them or they run out of attempts.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// Webhook is an external service's subscription to auth events. Secret
+// signs every delivery; it is returned once, when created or rotated.
+type Webhook struct {
+	ID          int64     `json:"id"`
+	URL         string    `json:"url"`
+	Description string    `json:"description,omitempty"`
+	Secret      string    `json:"-"`
+	Events      []string  `json:"events"`
+	Active      bool      `json:"active"`
+	CreatedBy   *int64    `json:"created_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type WebhookCreate struct {
+	URL         string   `json:"url"`
+	Description string   `json:"description"`
+	Events      []string `json:"events"`
+}
+
+// WebhookUpdate changes the fields that are set
+type WebhookUpdate struct {
+	URL         *string  `json:"url"`
+	Description *string  `json:"description"`
+	Events      []string `json:"events"`
+	Active      *bool    `json:"active"`
+}
+
+// WebhookEvent is the body of every delivery of an event. ID is the same
+// for every delivery of the event, retries and replays included, so
+// subscribers can discard duplicates.
+type WebhookEvent struct {
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	CreatedAt time.Time              `json:"created_at"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// WebhookDelivery is one event sent, or waiting to be sent, to one webhook.
+// Payload is the exact request body. A replay is a new delivery of the same
+// payload, pointing at the delivery it replays.
+type WebhookDelivery struct {
+	ID             int64                     `json:"id"`
+	WebhookID      int64                     `json:"webhook_id"`
+	EventID        string                    `json:"event_id"`
+	EventType      string                    `json:"event_type"`
+	Payload        json.RawMessage           `json:"payload"`
+	Status         string                    `json:"status"`
+	Attempts       int                       `json:"attempts"`
+	NextAttemptAt  time.Time                 `json:"next_attempt_at"`
+	LastError      string                    `json:"last_error,omitempty"`
+	LastStatusCode *int                      `json:"last_status_code,omitempty"`
+	ReplayOf       *int64                    `json:"replay_of,omitempty"`
+	DeliveredAt    *time.Time                `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time                 `json:"created_at"`
+	UpdatedAt      time.Time                 `json:"updated_at"`
+	AttemptLog     []*WebhookDeliveryAttempt `json:"attempt_log,omitempty"`
+}
+
+// WebhookDeliveryAttempt logs one request made for a delivery. StatusCode
+// is nil when no response was received.
+type WebhookDeliveryAttempt struct {
+	ID           int64     `json:"id"`
+	DeliveryID   int64     `json:"delivery_id"`
+	StatusCode   *int      `json:"status_code,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	ResponseBody string    `json:"response_body,omitempty"`
+	DurationMS   int64     `json:"duration_ms"`
+	AttemptedAt  time.Time `json:"attempted_at"`
+}
+
+// WebhookDeliveryFilter narrows a delivery query. Zero values are ignored.
+// Results are returned newest first, starting strictly before Cursor.
+type WebhookDeliveryFilter struct {
+	WebhookID int64
+	Status    string
+	EventType string
+	Cursor    int64
+	Limit     int
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/usecase"
+)
+
+type APIKeyHandler struct {
+	apiKeyUsecase *usecase.APIKeyUsecase
+	logger        *logrus.Logger
+}
+
+func NewAPIKeyHandler(apiKeyUsecase *usecase.APIKeyUsecase) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyUsecase: apiKeyUsecase,
+		logger:        logrus.New(),
+	}
+}
+
+// CreateAPIKey creates an API key and returns its plaintext value once
+func (h *APIKeyHandler) CreateAPIKey(c echo.Context) error {
+	userID, ok := c.Get("user_id").(int64)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token claims")
+	}
+	orgID, _ := c.Get("org_id").(int64)
+
+	var req domain.APIKeyCreate
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.Name == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "API key name is required")
+	}
+
+	key, plaintext, err := h.apiKeyUsecase.CreateAPIKey(requestInfo(c), userID, orgID, req)
+	if err != nil {
+		h.logger.Errorf("Failed to create API key for user %d: %v", userID, err)
+		if errors.Is(err, domain.ErrInvalidAPIKeyScope) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Unknown scope; valid scopes are "+strings.Join(domain.APIKeyScopes, ", "))
+		}
+		if errors.Is(err, domain.ErrAPIKeyForbidden) {
+			return echo.NewHTTPError(http.StatusForbidden, "Organization API keys require an organization admin token")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create API key")
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"key":     plaintext,
+		"api_key": key,
+		"message": "Store this key securely. It will not be shown again.",
+	})
+}
+
+// ListAPIKeys lists the API keys the caller can manage
+func (h *APIKeyHandler) ListAPIKeys(c echo.Context) error {
+	userID, ok := c.Get("user_id").(int64)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token claims")
+	}
+	orgID, _ := c.Get("org_id").(int64)
+
+	keys, err := h.apiKeyUsecase.ListAPIKeys(userID, orgID)
+	if err != nil {
+		h.logger.Errorf("Failed to list API keys for user %d: %v", userID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to list API keys")
+	}
+
+	if keys == nil {
+		keys = []*domain.APIKey{}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"api_keys": keys,
+	})
+}
+
+// RevokeAPIKey revokes an API key immediately
+func (h *APIKeyHandler) RevokeAPIKey(c echo.Context) error {
+	userID, ok := c.Get("user_id").(int64)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token claims")
+	}
+	orgID, _ := c.Get("org_id").(int64)
+
+	keyID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid API key ID")
+	}
+
+	if err := h.apiKeyUsecase.RevokeAPIKey(requestInfo(c), userID, orgID, keyID); err != nil {
+		h.logger.Errorf("Failed to revoke API key %d: %v", keyID, err)
+		if errors.Is(err, domain.ErrAPIKeyNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "API key not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to revoke API key")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/usecase"
+)
+
+type AuditHandler struct {
+	auditUsecase *usecase.AuditUsecase
+	logger       *logrus.Logger
+}
+
+func NewAuditHandler(auditUsecase *usecase.AuditUsecase) *AuditHandler {
+	return &AuditHandler{
+		auditUsecase: auditUsecase,
+		logger:       logrus.New(),
+	}
+}
+
+// ListEvents returns audit events filtered by the query parameters
+// event_type, actor_id, subject_id, outcome, from, to (RFC 3339), cursor and limit
+func (h *AuditHandler) ListEvents(c echo.Context) error {
+	filter := domain.AuditEventFilter{
+		EventType: c.QueryParam("event_type"),
+		Outcome:   c.QueryParam("outcome"),
+	}
+
+	var err error
+	if filter.ActorID, err = optionalInt64Param(c, "actor_id"); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid actor_id")
+	}
+	if filter.SubjectID, err = optionalInt64Param(c, "subject_id"); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid subject_id")
+	}
+	if filter.From, err = optionalTimeParam(c, "from"); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid from timestamp")
+	}
+	if filter.To, err = optionalTimeParam(c, "to"); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid to timestamp")
+	}
+	if cursor := c.QueryParam("cursor"); cursor != "" {
+		if filter.Cursor, err = strconv.ParseInt(cursor, 10, 64); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid cursor")
+		}
+	}
+	if limit := c.QueryParam("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid limit")
+		}
+	}
+
+	events, nextCursor, err := h.auditUsecase.ListEvents(filter)
+	if err != nil {
+		h.logger.Error("Failed to list audit events:", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to list audit events")
+	}
+
+	if events == nil {
+		events = []*domain.AuditEvent{}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"events":      events,
+		"next_cursor": nextCursor,
+	})
+}
+
+func optionalInt64Param(c echo.Context, name string) (*int64, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+func optionalTimeParam(c echo.Context, name string) (time.Time, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -1,15 +1,16 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"net/mail"
 	"strings"
+	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/sirupsen/logrus"
-	"golang.org/x/crypto/bcrypt"
 
 	"github.com/sales-tracker/auth-service/internal/config"
 	"github.com/sales-tracker/auth-service/internal/domain"
@@ -17,28 +18,60 @@ import (
 	"github.com/sales-tracker/auth-service/internal/usecase"
 )
 
-// min returns the smaller of x or y
-func min(x, y int) int {
-	if x < y {
-		return x
+type AuthHandler struct {
+	userUsecase         usecase.UserUsecase
+	phoneUsecase        *usecase.PhoneUsecase
+	organizationUsecase *usecase.OrganizationUsecase
+	tokenService        *service.TokenService
+	config              *config.Config
+	logger              *logrus.Logger
+}
+
+func NewAuthHandler(config *config.Config, userUsecase usecase.UserUsecase, phoneUsecase *usecase.PhoneUsecase, organizationUsecase *usecase.OrganizationUsecase, tokenService *service.TokenService) *AuthHandler {
+	return &AuthHandler{
+		userUsecase:         userUsecase,
+		phoneUsecase:        phoneUsecase,
+		organizationUsecase: organizationUsecase,
+		tokenService:        tokenService,
+		config:              config,
+		logger:              logrus.New(),
 	}
-	return y
 }
 
-type AuthHandler struct {
-	userUsecase  usecase.UserUsecase
-	emailService service.EmailService
-	config       *config.Config
-	logger       *logrus.Logger
+// requestInfo captures the caller's identity and origin for audit events
+func requestInfo(c echo.Context) domain.RequestInfo {
+	info := domain.RequestInfo{
+		IP:        c.RealIP(),
+		UserAgent: c.Request().UserAgent(),
+	}
+	if userID, ok := c.Get("user_id").(int64); ok {
+		info.ActorID = &userID
+	}
+	return info
 }
 
-func NewAuthHandler(config *config.Config, userUsecase usecase.UserUsecase, emailService service.EmailService) *AuthHandler {
-	return &AuthHandler{
-		userUsecase:  userUsecase,
-		emailService: emailService,
-		config:       config,
-		logger:       logrus.New(),
+// requestLocale returns locale if it is a valid language tag or, failing
+// that, the first usable language in the request's Accept-Language header
+func requestLocale(c echo.Context, locale string) string {
+	if locale = domain.NormalizeLocale(locale); locale != "" {
+		return locale
 	}
+	for _, tag := range strings.Split(c.Request().Header.Get("Accept-Language"), ",") {
+		tag, _, _ = strings.Cut(tag, ";")
+		if locale = domain.NormalizeLocale(tag); locale != "" {
+			return locale
+		}
+	}
+	return ""
+}
+
+// linkHintError maps a client_id or redirect the request may not use to
+// a 400 and returns nil for any other error
+func linkHintError(err error) error {
+	if errors.Is(err, domain.ErrUnknownFrontendClient) || errors.Is(err, domain.ErrRedirectNotAllowed) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return nil
 }
 
 func (h *AuthHandler) Register(c echo.Context) error {
@@ -46,6 +79,16 @@ func (h *AuthHandler) Register(c echo.Context) error {
 	if err := c.Bind(&req); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
 	}
+	if address, err := mail.ParseAddress(req.Email); err != nil || address.Address != req.Email {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid email address")
+	}
+	role := req.Role
+	if role == "" {
+		role = "client"
+	}
+	if role != "client" && role != "sales_rep" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Role must be client or sales_rep")
+	}
 
 	// Generate verification token
 	token := uuid.New().String()
@@ -53,25 +96,21 @@ func (h *AuthHandler) Register(c echo.Context) error {
 	user := &domain.User{
 		Email:             req.Email,
 		Password:          req.Password,
-		Role:              req.Role,
+		Role:              role,
 		IsVerified:        false, // New users need verification
 		VerificationToken: token,
+		Locale:            requestLocale(c, req.Locale),
 	}
 
-	if err := h.userUsecase.RegisterUser(user); err != nil {
+	// The verification email is queued along with the new user
+	if err := h.userUsecase.RegisterUser(requestInfo(c), user, req.LinkHint); err != nil {
 		h.logger.Error("Failed to register user:", err)
+		if hintErr := linkHintError(err); hintErr != nil {
+			return hintErr
+		}
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to register user")
 	}
 
-	// Generate verification URL
-	verificationURL := fmt.Sprintf("%s%s?token=%s", h.config.BaseURL, h.config.Verification, token)
-
-	// Send verification email
-	if err := h.emailService.SendVerificationEmail(user.Email, verificationURL); err != nil {
-		h.logger.Error("Failed to send verification email:", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to send verification email")
-	}
-
 	return c.JSON(http.StatusCreated, map[string]interface{}{
 		"message": "User registered successfully. Please check your email for verification.",
 		"user": map[string]interface{}{
@@ -82,6 +121,8 @@ func (h *AuthHandler) Register(c echo.Context) error {
 	})
 }
 
+// Login checks the user's password and returns a token or, for accounts
+// with SMS two-factor login, the challenge that LoginMFA completes
 func (h *AuthHandler) Login(c echo.Context) error {
 	var req domain.UserLogin
 	if err := c.Bind(&req); err != nil {
@@ -90,86 +131,145 @@ func (h *AuthHandler) Login(c echo.Context) error {
 
 	h.logger.Infof("Login attempt for email: %s", req.Email)
 
-	user, err := h.userUsecase.FindUserByEmail(req.Email)
+	user, err := h.userUsecase.Login(requestInfo(c), req.Email, req.Password)
 	if err != nil {
-		h.logger.Errorf("Failed to find user with email %s: %v", req.Email, err)
+		h.logger.Warnf("Login failed for email %s: %v", req.Email, err)
+		switch {
+		case errors.Is(err, domain.ErrAccountNotVerified):
+			return echo.NewHTTPError(http.StatusUnauthorized, "Account not verified")
+		case errors.Is(err, domain.ErrAccountDeleted):
+			return echo.NewHTTPError(http.StatusUnauthorized, "Account is scheduled for deletion")
+		case errors.Is(err, domain.ErrAccountDisabled):
+			return echo.NewHTTPError(http.StatusUnauthorized, "Account is disabled")
+		case errors.Is(err, domain.ErrNoLinkedAccount):
+			return echo.NewHTTPError(http.StatusForbidden, "No account exists for this email address")
+		case errors.Is(err, domain.ErrDirectoryUnavailable):
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "Directory server is unavailable")
+		}
 		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid credentials")
 	}
 
-	h.logger.Infof("User found - ID: %d, Email: %s, Verified: %v",
-		user.ID, user.Email, user.IsVerified)
+	h.logger.Infof("User %s successfully authenticated", user.Email)
 
-	// Log the first few characters of the stored hash for debugging
-	h.logger.Debugf("Stored password hash: %s... (length: %d)",
-		user.PasswordHash[:min(10, len(user.PasswordHash))],
-		len(user.PasswordHash))
+	if user.SMSMFAEnabled {
+		challenge, err := h.phoneUsecase.StartLoginChallenge(requestInfo(c), user, nil)
+		if err != nil {
+			h.logger.Errorf("Failed to start login challenge for user %d: %v", user.ID, err)
+			return phoneError(err, "Failed to send sign-in code")
+		}
+		return c.JSON(http.StatusOK, mfaRequiredResponse(challenge))
+	}
 
-	h.logger.Debugf("Comparing with password: %s (length: %d)",
-		strings.Repeat("*", len(req.Password)),
-		len(req.Password))
+	return h.signIn(c, user, nil)
+}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password))
-	if err != nil {
-		h.logger.Errorf("Password comparison failed: %v", err)
-		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid credentials")
+// LoginMFA completes a password or single sign-on login with the code
+// texted for its challenge
+func (h *AuthHandler) LoginMFA(c echo.Context) error {
+	var req struct {
+		MFAToken string `json:"mfa_token"`
+		Code     string `json:"code"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
 	}
 
-	if !user.IsVerified {
-		h.logger.Warnf("Login attempt for unverified email: %s", req.Email)
-		return echo.NewHTTPError(http.StatusUnauthorized, "Account not verified")
+	user, orgID, err := h.phoneUsecase.CompleteLoginChallenge(requestInfo(c), req.MFAToken, strings.TrimSpace(req.Code))
+	if err != nil {
+		h.logger.Warnf("Login challenge failed: %v", err)
+		switch {
+		case errors.Is(err, domain.ErrAccountDeleted):
+			return echo.NewHTTPError(http.StatusUnauthorized, "Account is scheduled for deletion")
+		case errors.Is(err, domain.ErrAccountDisabled):
+			return echo.NewHTTPError(http.StatusUnauthorized, "Account is disabled")
+		}
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid or expired code")
 	}
 
-	h.logger.Infof("User %s successfully authenticated", user.Email)
+	return h.signIn(c, user, orgID)
+}
 
-	claims := &domain.JWTClaims{
-		UserID: user.ID,
-		Role:   user.Role,
-		Email:  user.Email,
+// signIn responds with a token for user, scoped to orgID when a single
+// sign-on into that organization started the login. Such tokens carry no
+// global role, as the organization's IdP vouched for the user.
+func (h *AuthHandler) signIn(c echo.Context, user *domain.User, orgID *int64) error {
+	var membership *domain.Membership
+	var err error
+	if orgID != nil {
+		membership, err = h.organizationUsecase.FindMembership(user.ID, *orgID)
+		if errors.Is(err, domain.ErrMembershipNotFound) {
+			return echo.NewHTTPError(http.StatusForbidden, "You are no longer a member of this organization")
+		}
+	} else {
+		// Scope the token to the user's default organization, if any
+		membership, err = h.organizationUsecase.DefaultMembership(user.ID)
+	}
+	if err != nil {
+		h.logger.Error("Failed to load organization membership:", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to generate token")
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString([]byte(h.config.JWTSecret))
+	issueToken := h.tokenService.IssueUserToken
+	if orgID != nil {
+		issueToken = h.tokenService.IssueOrganizationToken
+	}
+	signedToken, err := issueToken(user, membership)
 	if err != nil {
 		h.logger.Error("Failed to sign token:", err)
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to generate token")
 	}
 
-	return c.JSON(http.StatusOK, map[string]interface{}{
-		"token": signedToken,
+	return c.JSON(http.StatusOK, loginResponse(signedToken, user, membership))
+}
+
+// mfaRequiredResponse is returned instead of loginResponse when the user
+// has SMS two-factor login enabled. POST /auth/login/mfa redeems it.
+func mfaRequiredResponse(challenge *domain.MFAChallenge) map[string]interface{} {
+	return map[string]interface{}{
+		"mfa_required": true,
+		"mfa":          challenge,
+	}
+}
+
+// loginResponse is the body returned by every endpoint that signs a user in
+func loginResponse(token string, user *domain.User, membership *domain.Membership) map[string]interface{} {
+	response := map[string]interface{}{
+		"token": token,
 		"user": map[string]interface{}{
 			"id":    user.ID,
 			"email": user.Email,
 			"role":  user.Role,
 		},
-	})
+	}
+	if membership != nil {
+		response["organization"] = membership
+	}
+	return response
 }
 
+// ForgotPassword emails a password reset link. client_id and redirect in
+// the body choose the page the link opens.
 func (h *AuthHandler) ForgotPassword(c echo.Context) error {
-	var req domain.UserLogin
+	var req struct {
+		Email string `json:"email"`
+		domain.LinkHint
+	}
 	if err := c.Bind(&req); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
 	}
 
-	resetToken, err := h.userUsecase.GenerateResetToken(req.Email)
-	if err != nil {
-		h.logger.Error("Failed to generate reset token:", err)
+	if err := h.userUsecase.RequestPasswordReset(requestInfo(c), req.Email, req.LinkHint); err != nil {
+		h.logger.Error("Failed to request password reset:", err)
+		if hintErr := linkHintError(err); hintErr != nil {
+			return hintErr
+		}
 		// Return a generic message to avoid user enumeration
 		return c.JSON(http.StatusOK, map[string]string{
 			"message": "If an account with that email exists, a password reset link has been sent",
 		})
 	}
 
-	// Use the frontend URL for the reset link
-	//frontendURL := "http://localhost:3000" // Using port 3000 for the frontend
-	frontendURL := "https://sales-tracker-reset-password.onrender.com"
-	resetURL := fmt.Sprintf("%s/reset-password.html?token=%s", frontendURL, resetToken)
-
-	if err := h.emailService.SendPasswordResetEmail(req.Email, resetURL); err != nil {
-		h.logger.Error("Failed to send password reset email:", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to send password reset email")
-	}
-
-	h.logger.Info("Password reset instructions sent to:", req.Email)
+	h.logger.Info("Password reset instructions queued for:", req.Email)
 
 	return c.JSON(http.StatusOK, map[string]string{
 		"message": "If an account with that email exists, a password reset link has been sent",
@@ -205,7 +305,7 @@ func (h *AuthHandler) ResetPassword(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Password must be at least 8 characters long")
 	}
 
-	if err := h.userUsecase.ResetPassword(req.Token, req.Password); err != nil {
+	if err := h.userUsecase.ResetPassword(requestInfo(c), req.Token, req.Password); err != nil {
 		h.logger.Errorf("Failed to reset password: %v", err)
 		return echo.NewHTTPError(http.StatusBadRequest, "Failed to reset password. Please try again.")
 	}
@@ -220,30 +320,24 @@ func (h *AuthHandler) ResetPassword(c echo.Context) error {
 func (h *AuthHandler) ResendVerificationEmail(c echo.Context) error {
 	var req struct {
 		Email string `json:"email" validate:"required,email"`
+		domain.LinkHint
 	}
 
 	if err := c.Bind(&req); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
 	}
 
-	token, err := h.userUsecase.ResendVerificationEmail(req.Email)
-	if err != nil {
+	if err := h.userUsecase.ResendVerificationEmail(requestInfo(c), req.Email, req.LinkHint); err != nil {
 		h.logger.Error("Failed to resend verification email:", err)
+		if hintErr := linkHintError(err); hintErr != nil {
+			return hintErr
+		}
 		if err.Error() == "email already verified" {
 			return echo.NewHTTPError(http.StatusBadRequest, "Email is already verified")
 		}
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to resend verification email")
 	}
 
-	// Generate verification URL
-	verificationURL := fmt.Sprintf("%s%s?token=%s", h.config.BaseURL, h.config.Verification, token)
-
-	// Send verification email
-	if err := h.emailService.SendVerificationEmail(req.Email, verificationURL); err != nil {
-		h.logger.Error("Failed to send verification email:", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to send verification email")
-	}
-
 	return c.JSON(http.StatusOK, map[string]string{
 		"message": "Verification email resent successfully",
 	})
@@ -259,7 +353,7 @@ func (h *AuthHandler) VerifyEmail(c echo.Context) error {
 	}
 
 	// Verify the token and mark email as verified
-	err := h.userUsecase.VerifyEmail(token)
+	err := h.userUsecase.VerifyEmail(requestInfo(c), token)
 	if err != nil {
 		h.logger.Error("Failed to verify email:", err)
 		return c.JSON(http.StatusBadRequest, map[string]string{
@@ -271,3 +365,165 @@ func (h *AuthHandler) VerifyEmail(c echo.Context) error {
 		"message": "Email verified successfully. You can now log in.",
 	})
 }
+
+// ChangeEmail starts an email address change for the authenticated user
+func (h *AuthHandler) ChangeEmail(c echo.Context) error {
+	userID, ok := c.Get("user_id").(int64)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token claims")
+	}
+
+	var req domain.EmailChange
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	newEmail := strings.TrimSpace(req.NewEmail)
+	if _, err := mail.ParseAddress(newEmail); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid email address")
+	}
+
+	if err := h.userUsecase.RequestEmailChange(requestInfo(c), userID, newEmail, req.Password, req.LinkHint); err != nil {
+		h.logger.Errorf("Failed to request email change for user %d: %v", userID, err)
+		if hintErr := linkHintError(err); hintErr != nil {
+			return hintErr
+		}
+		switch {
+		case errors.Is(err, domain.ErrInvalidCredentials):
+			return echo.NewHTTPError(http.StatusUnauthorized, "Invalid credentials")
+		case errors.Is(err, domain.ErrDirectoryUnavailable):
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "Directory server is unavailable")
+		case errors.Is(err, domain.ErrEmailAlreadyInUse):
+			return echo.NewHTTPError(http.StatusConflict, "Email address is already in use")
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, "Failed to change email address")
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]string{
+		"message": "Please check your new email address to confirm the change.",
+	})
+}
+
+// ConfirmEmailChange completes a pending email address change
+func (h *AuthHandler) ConfirmEmailChange(c echo.Context) error {
+	token := c.QueryParam("token")
+	if token == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"message": "Confirmation token is required",
+		})
+	}
+
+	if _, err := h.userUsecase.ConfirmEmailChange(requestInfo(c), token); err != nil {
+		h.logger.Error("Failed to confirm email change:", err)
+		if errors.Is(err, domain.ErrEmailAlreadyInUse) {
+			return c.JSON(http.StatusConflict, map[string]string{
+				"message": "Email address is already in use",
+			})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"message": "Invalid or expired confirmation token",
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "Email address changed successfully. Please log in with your new email.",
+	})
+}
+
+// DeleteAccount soft deletes the authenticated user's account after re-authentication
+func (h *AuthHandler) DeleteAccount(c echo.Context) error {
+	userID, ok := c.Get("user_id").(int64)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token claims")
+	}
+
+	var req domain.AccountDeletion
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	purgeAfter := time.Now().Add(h.config.AccountDeletionGracePeriod)
+	user, err := h.userUsecase.ScheduleAccountDeletion(requestInfo(c), userID, req.Password, purgeAfter)
+	if err != nil {
+		h.logger.Errorf("Failed to delete account for user %d: %v", userID, err)
+		switch {
+		case errors.Is(err, domain.ErrInvalidCredentials):
+			return echo.NewHTTPError(http.StatusUnauthorized, "Invalid credentials")
+		case errors.Is(err, domain.ErrDirectoryUnavailable):
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "Directory server is unavailable")
+		case errors.Is(err, domain.ErrAccountDeleted):
+			return echo.NewHTTPError(http.StatusConflict, "Account is already scheduled for deletion")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete account")
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]interface{}{
+		"message":     "Account scheduled for deletion. It can be restored until the purge date.",
+		"purge_after": user.PurgeAfter,
+	})
+}
+
+// UpdateLocale sets the language of the authenticated user's emails. An
+// empty locale reverts to the default.
+func (h *AuthHandler) UpdateLocale(c echo.Context) error {
+	userID, ok := c.Get("user_id").(int64)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token claims")
+	}
+
+	var req struct {
+		Locale string `json:"locale"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	locale := domain.NormalizeLocale(req.Locale)
+	if locale == "" && strings.TrimSpace(req.Locale) != "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid locale")
+	}
+
+	if err := h.userUsecase.UpdateLocale(userID, locale); err != nil {
+		h.logger.Errorf("Failed to update locale for user %d: %v", userID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update locale")
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"locale": locale,
+	})
+}
+
+// RestoreAccount cancels a pending account deletion
+func (h *AuthHandler) RestoreAccount(c echo.Context) error {
+	userID, ok := c.Get("user_id").(int64)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token claims")
+	}
+
+	if err := h.userUsecase.CancelAccountDeletion(requestInfo(c), userID); err != nil {
+		h.logger.Errorf("Failed to restore account for user %d: %v", userID, err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Account can no longer be restored")
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "Account deletion cancelled",
+	})
+}
+
+// ExportData returns a JSON archive of the authenticated user's data
+func (h *AuthHandler) ExportData(c echo.Context) error {
+	userID, ok := c.Get("user_id").(int64)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token claims")
+	}
+
+	export, err := h.userUsecase.ExportUserData(requestInfo(c), userID)
+	if err != nil {
+		h.logger.Errorf("Failed to export data for user %d: %v", userID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to export user data")
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition,
+		fmt.Sprintf(`attachment; filename="user-%d-export.json"`, userID))
+	return c.JSON(http.StatusOK, export)
+}
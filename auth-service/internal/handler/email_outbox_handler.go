@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/usecase"
+)
+
+type EmailOutboxHandler struct {
+	emailOutboxUsecase *usecase.EmailOutboxUsecase
+	logger             *logrus.Logger
+}
+
+func NewEmailOutboxHandler(emailOutboxUsecase *usecase.EmailOutboxUsecase) *EmailOutboxHandler {
+	return &EmailOutboxHandler{
+		emailOutboxUsecase: emailOutboxUsecase,
+		logger:             logrus.New(),
+	}
+}
+
+// ListEmails returns queued and delivered emails filtered by the query
+// parameters status (pending, sent or dead), recipient, template, cursor and limit
+func (h *EmailOutboxHandler) ListEmails(c echo.Context) error {
+	filter := domain.OutboxEmailFilter{
+		Status:    c.QueryParam("status"),
+		Recipient: c.QueryParam("recipient"),
+		Template:  c.QueryParam("template"),
+	}
+
+	switch filter.Status {
+	case "", domain.OutboxStatusPending, domain.OutboxStatusSent, domain.OutboxStatusDead:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid status")
+	}
+
+	var err error
+	if cursor := c.QueryParam("cursor"); cursor != "" {
+		if filter.Cursor, err = strconv.ParseInt(cursor, 10, 64); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid cursor")
+		}
+	}
+	if limit := c.QueryParam("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid limit")
+		}
+	}
+
+	emails, nextCursor, err := h.emailOutboxUsecase.ListEmails(filter)
+	if err != nil {
+		h.logger.Error("Failed to list outbox emails:", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to list emails")
+	}
+
+	if emails == nil {
+		emails = []*domain.OutboxEmail{}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"emails":      emails,
+		"next_cursor": nextCursor,
+	})
+}
+
+// GetEmail returns the delivery status of one email
+func (h *EmailOutboxHandler) GetEmail(c echo.Context) error {
+	emailID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid email ID")
+	}
+
+	email, err := h.emailOutboxUsecase.FindEmail(emailID)
+	if err != nil {
+		h.logger.Errorf("Failed to get outbox email %d: %v", emailID, err)
+		return emailOutboxError(err, "Failed to get email")
+	}
+
+	return c.JSON(http.StatusOK, email)
+}
+
+// emailOutboxError maps outbox domain errors to HTTP errors
+func emailOutboxError(err error, fallback string) error {
+	switch {
+	case errors.Is(err, domain.ErrOutboxEmailNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, fallback)
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/service"
+	"github.com/sales-tracker/auth-service/internal/usecase"
+)
+
+// maxWebhookBody bounds the size of a provider webhook payload
+const maxWebhookBody = 1 << 20
+
+// EmailWebhookHandler receives bounce and complaint reports from the email
+// provider
+type EmailWebhookHandler struct {
+	config      config.HTTPMailConfig
+	userUsecase *usecase.UserUsecase
+	logger      *logrus.Logger
+}
+
+func NewEmailWebhookHandler(config config.HTTPMailConfig, userUsecase *usecase.UserUsecase) *EmailWebhookHandler {
+	return &EmailWebhookHandler{
+		config:      config,
+		userUsecase: userUsecase,
+		logger:      logrus.New(),
+	}
+}
+
+// DeliveryEvents marks the accounts whose address hard bounced or drew a
+// spam complaint as undeliverable. Other events are acknowledged and ignored
+// so the provider does not retry them.
+func (h *EmailWebhookHandler) DeliveryEvents(c echo.Context) error {
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxWebhookBody))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	events, err := service.ParseEmailWebhook(h.config, body)
+	if err != nil {
+		h.logger.Warnf("Rejected email webhook: %v", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid webhook payload")
+	}
+
+	marked, err := h.userUsecase.RecordEmailDeliveryEvents(requestInfo(c), events)
+	if err != nil {
+		h.logger.Error("Failed to record email delivery events:", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to record delivery events")
+	}
+	if marked > 0 {
+		h.logger.Infof("Marked %d email addresses undeliverable", marked)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/service"
+	"github.com/sales-tracker/auth-service/internal/usecase"
+)
+
+// federationStateCookie binds a social login to the browser that started
+// it, so a callback URL cannot be replayed in someone else's session
+const federationStateCookie = "oidc_state"
+
+type FederationHandler struct {
+	config              *config.Config
+	federationUsecase   *usecase.FederationUsecase
+	organizationUsecase *usecase.OrganizationUsecase
+	phoneUsecase        *usecase.PhoneUsecase
+	tokenService        *service.TokenService
+	logger              *logrus.Logger
+}
+
+func NewFederationHandler(config *config.Config, federationUsecase *usecase.FederationUsecase, organizationUsecase *usecase.OrganizationUsecase, phoneUsecase *usecase.PhoneUsecase, tokenService *service.TokenService) *FederationHandler {
+	return &FederationHandler{
+		config:              config,
+		federationUsecase:   federationUsecase,
+		organizationUsecase: organizationUsecase,
+		phoneUsecase:        phoneUsecase,
+		tokenService:        tokenService,
+		logger:              logrus.New(),
+	}
+}
+
+// ListProviders lists the social login providers that are enabled
+func (h *FederationHandler) ListProviders(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"providers": h.federationUsecase.Providers(),
+	})
+}
+
+// Login redirects the user to the provider's sign-in page
+func (h *FederationHandler) Login(c echo.Context) error {
+	providerName := c.Param("provider")
+
+	authURL, state, err := h.federationUsecase.StartLogin(c.Request().Context(), providerName, h.config.SocialLogin.StateTTL)
+	if err != nil {
+		if errors.Is(err, domain.ErrUnknownProvider) {
+			return echo.NewHTTPError(http.StatusNotFound, "Unknown identity provider")
+		}
+		h.logger.Errorf("Failed to start %s login: %v", providerName, err)
+		return echo.NewHTTPError(http.StatusBadGateway, "Identity provider is unavailable")
+	}
+
+	c.SetCookie(h.stateCookie(state, int(h.config.SocialLogin.StateTTL.Seconds())))
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback completes the login when the provider redirects back and returns
+// the same response as /auth/login, including its SMS challenge
+func (h *FederationHandler) Callback(c echo.Context) error {
+	providerName := c.Param("provider")
+	state := c.QueryParam("state")
+
+	cookie, err := c.Cookie(federationStateCookie)
+	c.SetCookie(h.stateCookie("", -1))
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Login state is invalid or expired")
+	}
+
+	if providerError := c.QueryParam("error"); providerError != "" {
+		h.logger.Warnf("%s login failed: %s: %s", providerName, providerError, c.QueryParam("error_description"))
+		return echo.NewHTTPError(http.StatusUnauthorized, "Sign-in was cancelled or denied by the identity provider")
+	}
+
+	user, err := h.federationUsecase.CompleteLogin(c.Request().Context(), requestInfo(c), providerName, state, c.QueryParam("code"))
+	if err != nil {
+		h.logger.Warnf("%s login failed: %v", providerName, err)
+		switch {
+		case errors.Is(err, domain.ErrUnknownProvider):
+			return echo.NewHTTPError(http.StatusNotFound, "Unknown identity provider")
+		case errors.Is(err, domain.ErrInvalidLoginState):
+			return echo.NewHTTPError(http.StatusBadRequest, "Login state is invalid or expired")
+		case errors.Is(err, domain.ErrInvalidUpstreamToken):
+			return echo.NewHTTPError(http.StatusUnauthorized, "Could not verify the identity provider's response")
+		case errors.Is(err, domain.ErrUnverifiedUpstreamMail):
+			return echo.NewHTTPError(http.StatusForbidden, "The identity provider did not confirm your email address")
+		case errors.Is(err, domain.ErrNoLinkedAccount):
+			return echo.NewHTTPError(http.StatusForbidden, "No account exists for this email address")
+		case errors.Is(err, domain.ErrAccountDeleted):
+			return echo.NewHTTPError(http.StatusUnauthorized, "Account is scheduled for deletion")
+		case errors.Is(err, domain.ErrAccountDisabled):
+			return echo.NewHTTPError(http.StatusUnauthorized, "Account is disabled")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to sign in")
+	}
+
+	if user.SMSMFAEnabled {
+		challenge, err := h.phoneUsecase.StartLoginChallenge(requestInfo(c), user, nil)
+		if err != nil {
+			h.logger.Errorf("Failed to start login challenge for user %d: %v", user.ID, err)
+			return phoneError(err, "Failed to send sign-in code")
+		}
+		return c.JSON(http.StatusOK, mfaRequiredResponse(challenge))
+	}
+
+	membership, err := h.organizationUsecase.DefaultMembership(user.ID)
+	if err != nil {
+		h.logger.Error("Failed to load organization membership:", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to generate token")
+	}
+
+	signedToken, err := h.tokenService.IssueUserToken(user, membership)
+	if err != nil {
+		h.logger.Error("Failed to sign token:", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to generate token")
+	}
+
+	return c.JSON(http.StatusOK, loginResponse(signedToken, user, membership))
+}
+
+func (h *FederationHandler) stateCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     federationStateCookie,
+		Value:    value,
+		Path:     "/auth/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.config.BaseURL, "https://"),
+		// Lax so the cookie is sent on the provider's top-level redirect
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/service"
+	"github.com/sales-tracker/auth-service/internal/usecase"
+)
+
+type InvitationHandler struct {
+	invitationUsecase *usecase.InvitationUsecase
+	tokenService      *service.TokenService
+	config            *config.Config
+	logger            *logrus.Logger
+}
+
+func NewInvitationHandler(config *config.Config, invitationUsecase *usecase.InvitationUsecase, tokenService *service.TokenService) *InvitationHandler {
+	return &InvitationHandler{
+		invitationUsecase: invitationUsecase,
+		tokenService:      tokenService,
+		config:            config,
+		logger:            logrus.New(),
+	}
+}
+
+// CreateInvitation invites an email address to the organization
+func (h *InvitationHandler) CreateInvitation(c echo.Context) error {
+	orgID, err := strconv.ParseInt(c.Param("org_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid organization ID")
+	}
+
+	var req domain.InvitationCreate
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	ttl := h.config.InvitationTTL
+	if req.ExpiresInHours > 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+		if ttl > h.config.InvitationMaxTTL {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("expires_in_hours must be at most %d", int(h.config.InvitationMaxTTL.Hours())))
+		}
+	}
+
+	orgRole, _ := c.Get("org_role").(string)
+	invitation, err := h.invitationUsecase.CreateInvitation(requestInfo(c), orgID, orgRole, req.Email, req.Role, ttl)
+	if err != nil {
+		h.logger.Errorf("Failed to invite %s to organization %d: %v", req.Email, orgID, err)
+		return invitationError(err, "Failed to create invitation")
+	}
+
+	return c.JSON(http.StatusCreated, invitation)
+}
+
+// ListInvitations lists every invitation of the organization
+func (h *InvitationHandler) ListInvitations(c echo.Context) error {
+	orgID, err := strconv.ParseInt(c.Param("org_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid organization ID")
+	}
+
+	invitations, err := h.invitationUsecase.ListInvitations(orgID)
+	if err != nil {
+		h.logger.Errorf("Failed to list invitations of organization %d: %v", orgID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to list invitations")
+	}
+
+	if invitations == nil {
+		invitations = []*domain.Invitation{}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"invitations": invitations,
+	})
+}
+
+// ResendInvitation emails a fresh link for a pending invitation
+func (h *InvitationHandler) ResendInvitation(c echo.Context) error {
+	orgID, invitationID, err := invitationParams(c)
+	if err != nil {
+		return err
+	}
+
+	orgRole, _ := c.Get("org_role").(string)
+	invitation, err := h.invitationUsecase.ResendInvitation(requestInfo(c), orgID, invitationID, orgRole, h.config.InvitationTTL)
+	if err != nil {
+		h.logger.Errorf("Failed to resend invitation %d: %v", invitationID, err)
+		return invitationError(err, "Failed to resend invitation")
+	}
+
+	return c.JSON(http.StatusOK, invitation)
+}
+
+// RevokeInvitation cancels a pending invitation
+func (h *InvitationHandler) RevokeInvitation(c echo.Context) error {
+	orgID, invitationID, err := invitationParams(c)
+	if err != nil {
+		return err
+	}
+
+	orgRole, _ := c.Get("org_role").(string)
+	if err := h.invitationUsecase.RevokeInvitation(requestInfo(c), orgID, invitationID, orgRole); err != nil {
+		h.logger.Errorf("Failed to revoke invitation %d: %v", invitationID, err)
+		return invitationError(err, "Failed to revoke invitation")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetInvitation describes a pending invitation so the accept page can tell
+// whether a password needs to be chosen
+func (h *InvitationHandler) GetInvitation(c echo.Context) error {
+	token := c.QueryParam("token")
+	if token == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invitation token is required")
+	}
+
+	invitation, err := h.invitationUsecase.FindPendingInvitationByToken(token)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid or expired invitation")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"email":             invitation.Email,
+		"org_name":          invitation.OrgName,
+		"role":              invitation.Role,
+		"expires_at":        invitation.ExpiresAt,
+		"password_required": h.invitationUsecase.PasswordRequired(invitation),
+	})
+}
+
+// AcceptInvitation joins the organization, creating the account if needed.
+// A new account gets a token scoped to the organization; an existing one
+// only gains the membership and must sign in through /auth/login as usual.
+func (h *InvitationHandler) AcceptInvitation(c echo.Context) error {
+	var req domain.InvitationAccept
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	user, membership, created, err := h.invitationUsecase.AcceptInvitation(requestInfo(c), req.Token, req.Password, req.Name)
+	if err != nil {
+		h.logger.Warnf("Failed to accept invitation: %v", err)
+		return invitationError(err, "Failed to accept invitation")
+	}
+
+	// Only accounts the invitation just created are signed in; they cannot
+	// have SMS two-factor login on yet. Existing users log in as usual, so
+	// their second factor is still checked.
+	if !created {
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"message":        "Invitation accepted. Log in to continue.",
+			"login_required": true,
+			"organization":   membership,
+		})
+	}
+
+	signedToken, err := h.tokenService.IssueUserToken(user, membership)
+	if err != nil {
+		h.logger.Error("Failed to sign token:", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to generate token")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"token": signedToken,
+		"user": map[string]interface{}{
+			"id":    user.ID,
+			"email": user.Email,
+			"role":  user.Role,
+		},
+		"organization": membership,
+	})
+}
+
+func invitationParams(c echo.Context) (int64, int64, error) {
+	orgID, err := strconv.ParseInt(c.Param("org_id"), 10, 64)
+	if err != nil {
+		return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "Invalid organization ID")
+	}
+	invitationID, err := strconv.ParseInt(c.Param("invitation_id"), 10, 64)
+	if err != nil {
+		return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "Invalid invitation ID")
+	}
+	return orgID, invitationID, nil
+}
+
+// invitationError maps invitation domain errors to HTTP errors
+func invitationError(err error, fallback string) error {
+	switch {
+	case errors.Is(err, domain.ErrInvalidOrgRole), errors.Is(err, domain.ErrPasswordTooShort):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, domain.ErrRoleNotAssignable), errors.Is(err, domain.ErrInvitationForbidden):
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	case errors.Is(err, domain.ErrInvitationExists), errors.Is(err, domain.ErrMembershipExists), errors.Is(err, domain.ErrEmailAlreadyInUse):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, domain.ErrInvitationNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, domain.ErrInvitationNotPending), errors.Is(err, domain.ErrAccountDeleted):
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid or expired invitation")
+	case errors.Is(err, domain.ErrAccountDisabled):
+		return echo.NewHTTPError(http.StatusForbidden, "Account is disabled")
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, fallback)
+}
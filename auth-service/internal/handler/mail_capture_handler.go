@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/sales-tracker/auth-service/internal/service"
+)
+
+// MailCaptureHandler exposes the emails held by the capture transport to
+// integration tests. It is only routed, for admins, when that transport is
+// selected and email.capture.expose_api is set.
+type MailCaptureHandler struct {
+	transport *service.CaptureTransport
+}
+
+func NewMailCaptureHandler(transport *service.CaptureTransport) *MailCaptureHandler {
+	return &MailCaptureHandler{
+		transport: transport,
+	}
+}
+
+// ListEmails returns captured emails, oldest first, filtered by the query
+// parameters to, subject and after_id
+func (h *MailCaptureHandler) ListEmails(c echo.Context) error {
+	filter, err := captureFilter(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"emails": h.transport.Emails(filter),
+	})
+}
+
+// LatestEmail returns the most recent captured email matching the same
+// filters as ListEmails
+func (h *MailCaptureHandler) LatestEmail(c echo.Context) error {
+	filter, err := captureFilter(c)
+	if err != nil {
+		return err
+	}
+
+	email := h.transport.Latest(filter)
+	if email == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "No matching email")
+	}
+	return c.JSON(http.StatusOK, email)
+}
+
+// ClearEmails forgets every captured email
+func (h *MailCaptureHandler) ClearEmails(c echo.Context) error {
+	h.transport.Clear()
+	return c.NoContent(http.StatusNoContent)
+}
+
+func captureFilter(c echo.Context) (service.CaptureFilter, error) {
+	filter := service.CaptureFilter{
+		To:      c.QueryParam("to"),
+		Subject: c.QueryParam("subject"),
+	}
+	if afterID := c.QueryParam("after_id"); afterID != "" {
+		var err error
+		if filter.AfterID, err = strconv.ParseInt(afterID, 10, 64); err != nil {
+			return filter, echo.NewHTTPError(http.StatusBadRequest, "Invalid after_id")
+		}
+	}
+	return filter, nil
+}
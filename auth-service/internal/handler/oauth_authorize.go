@@ -0,0 +1,309 @@
+package handler
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+// scopeDescriptions explains scopes on the consent screen
+var scopeDescriptions = map[string]string{
+	domain.ScopeOpenID:  "Confirm your identity",
+	domain.ScopeProfile: "See your name",
+	domain.ScopeEmail:   "See your email address",
+}
+
+type authorizePageData struct {
+	Request    domain.AuthorizationRequest
+	ClientName string
+	Scopes     []string
+	Error      string
+	// MFA asks for the code texted to a user whose password checked out
+	MFA *domain.MFAChallenge
+}
+
+var authorizePage = template.Must(template.New("authorize").Funcs(template.FuncMap{
+	"describe": func(scope string) string {
+		if description, ok := scopeDescriptions[scope]; ok {
+			return description
+		}
+		return scope
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Sign in - Sales Tracker</title>
+<style>
+body { font-family: Arial, sans-serif; background: #f4f4f4; margin: 0; }
+main { max-width: 400px; margin: 60px auto; background: #fff; padding: 30px; border-radius: 5px; }
+label, input { display: block; width: 100%; box-sizing: border-box; }
+input { margin: 5px 0 15px; padding: 10px; }
+.error { color: #b00020; }
+.actions { display: flex; gap: 10px; }
+button { flex: 1; padding: 10px; border: 0; border-radius: 3px; cursor: pointer; }
+button[value=allow] { background: #4CAF50; color: #fff; }
+</style>
+</head>
+<body>
+<main>
+{{if .ClientName}}
+<h1>Sign in to continue to {{.ClientName}}</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post" action="/oauth/authorize">
+<input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+<input type="hidden" name="client_id" value="{{.Request.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">
+<input type="hidden" name="scope" value="{{.Request.Scope}}">
+<input type="hidden" name="state" value="{{.Request.State}}">
+<input type="hidden" name="nonce" value="{{.Request.Nonce}}">
+<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+{{if .MFA}}
+<input type="hidden" name="mfa_token" value="{{.MFA.Token}}">
+<label for="code">Enter the code texted to your phone{{if .MFA.PhoneHint}} ({{.MFA.PhoneHint}}){{end}}</label>
+<input id="code" type="text" name="code" inputmode="numeric" autocomplete="one-time-code" required>
+{{else}}
+<label for="email">Email</label>
+<input id="email" type="email" name="email" autocomplete="username" required>
+<label for="password">Password</label>
+<input id="password" type="password" name="password" autocomplete="current-password" required>
+{{end}}
+<p>{{.ClientName}} will be able to:</p>
+<ul>{{range .Scopes}}<li>{{describe .}}</li>{{end}}</ul>
+<div class="actions">
+<button type="submit" name="decision" value="deny" formnovalidate>Deny</button>
+<button type="submit" name="decision" value="allow">Allow</button>
+</div>
+</form>
+{{else}}
+<h1>Authorization failed</h1>
+<p class="error">{{.Error}}</p>
+{{end}}
+</main>
+</body>
+</html>
+`))
+
+// Discovery serves the OpenID Connect discovery document
+func (h *OAuthHandler) Discovery(c echo.Context) error {
+	issuer := h.config.OAuth.Issuer
+	return c.JSON(http.StatusOK, domain.OpenIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserInfoEndpoint:                  issuer + "/userinfo",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		ScopesSupported:                   []string{domain.ScopeOpenID, domain.ScopeProfile, domain.ScopeEmail},
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{domain.GrantTypeAuthorizationCode, domain.GrantTypeClientCredentials},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{domain.CodeChallengeMethodS256},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "email", "email_verified", "name"},
+	})
+}
+
+// JWKS serves the public keys ID tokens are signed with
+func (h *OAuthHandler) JWKS(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.idTokenSigner.KeySet())
+}
+
+// Authorize shows the sign-in and consent page for an authorization request
+func (h *OAuthHandler) Authorize(c echo.Context) error {
+	var req domain.AuthorizationRequest
+	if err := c.Bind(&req); err != nil {
+		return h.renderAuthorizeError(c, http.StatusBadRequest, "Invalid authorization request")
+	}
+
+	client, scopes, err := h.oauthUsecase.ValidateAuthorizationRequest(req)
+	if err != nil {
+		return h.authorizeError(c, req, err)
+	}
+
+	// There is no browser session to reuse, so the user always signs in
+	if req.Prompt == "none" {
+		return redirectWithError(c, req, domain.OAuthErrorLoginRequired, "User interaction is required")
+	}
+
+	return h.renderAuthorizePage(c, http.StatusOK, authorizePageData{Request: req, ClientName: client.Name, Scopes: scopes})
+}
+
+// ApproveAuthorization handles the sign-in and consent form. On approval the
+// user is sent back to the client with an authorization code. Users with SMS
+// two-factor login get the form again, asking for the texted code.
+func (h *OAuthHandler) ApproveAuthorization(c echo.Context) error {
+	var req domain.AuthorizationRequest
+	if err := c.Bind(&req); err != nil {
+		return h.renderAuthorizeError(c, http.StatusBadRequest, "Invalid authorization request")
+	}
+
+	client, scopes, err := h.oauthUsecase.ValidateAuthorizationRequest(req)
+	if err != nil {
+		return h.authorizeError(c, req, err)
+	}
+
+	if c.FormValue("decision") != "allow" {
+		return redirectWithError(c, req, domain.OAuthErrorAccessDenied, "The user denied the request")
+	}
+
+	page := authorizePageData{Request: req, ClientName: client.Name, Scopes: scopes}
+	if mfaToken := c.FormValue("mfa_token"); mfaToken != "" {
+		user, _, err := h.phoneUsecase.CompleteLoginChallenge(requestInfo(c), mfaToken, strings.TrimSpace(c.FormValue("code")))
+		if err != nil {
+			// Keep the challenge so the user can retry until the code is void
+			page.MFA = &domain.MFAChallenge{Token: mfaToken, Method: domain.MFAMethodSMS}
+			page.Error = "Invalid or expired code."
+			return h.renderAuthorizePage(c, http.StatusUnauthorized, page)
+		}
+		return h.grantAuthorization(c, client, user, req, scopes)
+	}
+
+	user, err := h.userUsecase.Login(requestInfo(c), c.FormValue("email"), c.FormValue("password"))
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrAccountNotVerified):
+			page.Error = "Please verify your email address before signing in."
+		case errors.Is(err, domain.ErrAccountDeleted):
+			page.Error = "This account is scheduled for deletion."
+		case errors.Is(err, domain.ErrAccountDisabled):
+			page.Error = "This account is disabled."
+		default:
+			page.Error = "Invalid email or password."
+		}
+		return h.renderAuthorizePage(c, http.StatusUnauthorized, page)
+	}
+
+	if user.SMSMFAEnabled {
+		page.MFA, err = h.phoneUsecase.StartLoginChallenge(requestInfo(c), user, nil)
+		if err != nil {
+			h.logger.Errorf("Failed to start login challenge for user %d: %v", user.ID, err)
+			page.MFA = nil
+			page.Error = "We couldn't send a sign-in code. Please try again shortly."
+			return h.renderAuthorizePage(c, http.StatusServiceUnavailable, page)
+		}
+		return h.renderAuthorizePage(c, http.StatusOK, page)
+	}
+
+	return h.grantAuthorization(c, client, user, req, scopes)
+}
+
+// grantAuthorization sends the signed-in user back to the client with an
+// authorization code
+func (h *OAuthHandler) grantAuthorization(c echo.Context, client *domain.OAuthClient, user *domain.User, req domain.AuthorizationRequest, scopes []string) error {
+	info := requestInfo(c)
+	info.ActorID = &user.ID
+	code, err := h.oauthUsecase.GrantAuthorization(info, client, user, req, scopes, h.config.OAuth.AuthorizationCodeTTL)
+	if err != nil {
+		h.logger.Errorf("Failed to grant authorization to client %s: %v", client.ClientID, err)
+		return h.renderAuthorizeError(c, http.StatusInternalServerError, "Something went wrong. Please try again.")
+	}
+
+	return redirectWithParams(c, req.RedirectURI, url.Values{"code": {code}, "state": {req.State}})
+}
+
+// UserInfo returns claims about the user the access token was issued for
+func (h *OAuthHandler) UserInfo(c echo.Context) error {
+	userID, _ := c.Get("user_id").(int64)
+	if userID == 0 {
+		c.Response().Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		return oauthError(c, http.StatusUnauthorized, domain.OAuthErrorInvalidToken, "Token was not issued for a user")
+	}
+
+	// The user's own session tokens carry no scopes and see every claim
+	scopes, restricted := c.Get("scopes").([]string)
+	if !restricted {
+		scopes = []string{domain.ScopeOpenID, domain.ScopeProfile, domain.ScopeEmail}
+	}
+
+	userInfo, err := h.oauthUsecase.UserInfo(userID, scopes)
+	if err != nil {
+		h.logger.Errorf("Failed to load user info for user %d: %v", userID, err)
+		c.Response().Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		return oauthError(c, http.StatusUnauthorized, domain.OAuthErrorInvalidToken, "User is no longer available")
+	}
+
+	return c.JSON(http.StatusOK, userInfo)
+}
+
+// authorizeError reports an invalid authorization request. Errors about the
+// client or redirect URI are shown to the user, since redirecting to an
+// unverified URI would make this an open redirector.
+func (h *OAuthHandler) authorizeError(c echo.Context, req domain.AuthorizationRequest, err error) error {
+	switch {
+	case errors.Is(err, domain.ErrInvalidClient):
+		return h.renderAuthorizeError(c, http.StatusBadRequest, "Unknown application.")
+	case errors.Is(err, domain.ErrInvalidRedirectURI):
+		return h.renderAuthorizeError(c, http.StatusBadRequest, "The application's redirect URI is not registered.")
+	case errors.Is(err, domain.ErrUnsupportedResponseType):
+		return redirectWithError(c, req, domain.OAuthErrorUnsupportedResponse, err.Error())
+	case errors.Is(err, domain.ErrUnauthorizedClient):
+		return redirectWithError(c, req, domain.OAuthErrorUnauthorizedClient, err.Error())
+	case errors.Is(err, domain.ErrPKCERequired):
+		return redirectWithError(c, req, domain.OAuthErrorInvalidRequest, err.Error())
+	case errors.Is(err, domain.ErrInvalidScope):
+		return redirectWithError(c, req, domain.OAuthErrorInvalidScope, err.Error())
+	}
+	h.logger.Errorf("Failed to validate authorization request for client %s: %v", req.ClientID, err)
+	return h.renderAuthorizeError(c, http.StatusInternalServerError, "Something went wrong. Please try again.")
+}
+
+func (h *OAuthHandler) renderAuthorizeError(c echo.Context, status int, message string) error {
+	return h.renderAuthorizePage(c, status, authorizePageData{Error: message})
+}
+
+func (h *OAuthHandler) renderAuthorizePage(c echo.Context, status int, data authorizePageData) error {
+	// The page collects credentials, so it must not be framed or cached
+	header := c.Response().Header()
+	header.Set("X-Frame-Options", "DENY")
+	header.Set("Content-Security-Policy", "frame-ancestors 'none'")
+	header.Set("Cache-Control", "no-store")
+	header.Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
+	c.Response().WriteHeader(status)
+	return authorizePage.Execute(c.Response(), data)
+}
+
+// redirectWithError sends an error response to the client's redirect URI
+// (RFC 6749 section 4.1.2.1)
+func redirectWithError(c echo.Context, req domain.AuthorizationRequest, code, description string) error {
+	return redirectWithParams(c, req.RedirectURI, url.Values{
+		"error":             {code},
+		"error_description": {description},
+		"state":             {req.State},
+	})
+}
+
+func redirectWithParams(c echo.Context, redirectURI string, params url.Values) error {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid redirect URI")
+	}
+
+	query := target.Query()
+	for key, values := range params {
+		if len(values) > 0 && values[0] != "" {
+			query.Set(key, values[0])
+		}
+	}
+	target.RawQuery = query.Encode()
+
+	return c.Redirect(http.StatusSeeOther, target.String())
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
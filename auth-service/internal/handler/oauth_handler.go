@@ -0,0 +1,346 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/service"
+	"github.com/sales-tracker/auth-service/internal/usecase"
+)
+
+type OAuthHandler struct {
+	config               *config.Config
+	oauthUsecase         *usecase.OAuthUsecase
+	introspectionUsecase *usecase.IntrospectionUsecase
+	userUsecase          *usecase.UserUsecase
+	phoneUsecase         *usecase.PhoneUsecase
+	tokenService         *service.TokenService
+	idTokenSigner        *service.IDTokenSigner
+	logger               *logrus.Logger
+}
+
+func NewOAuthHandler(config *config.Config, oauthUsecase *usecase.OAuthUsecase, introspectionUsecase *usecase.IntrospectionUsecase, userUsecase *usecase.UserUsecase, phoneUsecase *usecase.PhoneUsecase, tokenService *service.TokenService, idTokenSigner *service.IDTokenSigner) *OAuthHandler {
+	return &OAuthHandler{
+		config:               config,
+		oauthUsecase:         oauthUsecase,
+		introspectionUsecase: introspectionUsecase,
+		userUsecase:          userUsecase,
+		phoneUsecase:         phoneUsecase,
+		tokenService:         tokenService,
+		idTokenSigner:        idTokenSigner,
+		logger:               logrus.New(),
+	}
+}
+
+// Token is the OAuth2 token endpoint. Clients authenticate with HTTP Basic
+// or with client_id and client_secret form parameters (RFC 6749 section 2.3);
+// public clients only send client_id.
+func (h *OAuthHandler) Token(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "no-store")
+	c.Response().Header().Set("Pragma", "no-cache")
+
+	clientID, clientSecret, ok := c.Request().BasicAuth()
+	if !ok {
+		clientID = c.FormValue("client_id")
+		clientSecret = c.FormValue("client_secret")
+	}
+
+	switch c.FormValue("grant_type") {
+	case domain.GrantTypeClientCredentials:
+		return h.clientCredentialsGrant(c, clientID, clientSecret)
+	case domain.GrantTypeAuthorizationCode:
+		return h.authorizationCodeGrant(c, clientID, clientSecret)
+	case "":
+		return oauthError(c, http.StatusBadRequest, domain.OAuthErrorInvalidRequest, "grant_type is required")
+	}
+	return oauthError(c, http.StatusBadRequest, domain.OAuthErrorUnsupportedGrantType, "Unsupported grant type")
+}
+
+func (h *OAuthHandler) clientCredentialsGrant(c echo.Context, clientID, clientSecret string) error {
+	if clientID == "" || clientSecret == "" {
+		c.Response().Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		return oauthError(c, http.StatusUnauthorized, domain.OAuthErrorInvalidClient, "Client authentication is required")
+	}
+
+	client, scopes, err := h.oauthUsecase.AuthorizeClientCredentials(requestInfo(c), clientID, clientSecret, c.FormValue("scope"))
+	if err != nil {
+		return h.tokenError(c, clientID, err)
+	}
+
+	token, ttl, err := h.tokenService.IssueClientToken(client, scopes)
+	if err != nil {
+		h.logger.Errorf("Failed to sign token for client %s: %v", clientID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to issue token")
+	}
+
+	return c.JSON(http.StatusOK, domain.OAuthTokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(ttl.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	})
+}
+
+func (h *OAuthHandler) authorizationCodeGrant(c echo.Context, clientID, clientSecret string) error {
+	code := c.FormValue("code")
+	redirectURI := c.FormValue("redirect_uri")
+	codeVerifier := c.FormValue("code_verifier")
+	if clientID == "" || code == "" || redirectURI == "" || codeVerifier == "" {
+		return oauthError(c, http.StatusBadRequest, domain.OAuthErrorInvalidRequest, "client_id, code, redirect_uri and code_verifier are required")
+	}
+
+	client, user, authCode, err := h.oauthUsecase.ExchangeAuthorizationCode(requestInfo(c), clientID, clientSecret, code, redirectURI, codeVerifier)
+	if err != nil {
+		return h.tokenError(c, clientID, err)
+	}
+
+	accessToken, ttl, err := h.tokenService.IssueDelegatedToken(user, client.ClientID, authCode.Scopes)
+	if err != nil {
+		h.logger.Errorf("Failed to sign access token for client %s: %v", clientID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to issue token")
+	}
+
+	response := domain.OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(ttl.Seconds()),
+		Scope:       strings.Join(authCode.Scopes, " "),
+	}
+
+	// An ID token is only issued for OpenID Connect requests
+	if hasScope(authCode.Scopes, domain.ScopeOpenID) {
+		response.IDToken, err = h.issueIDToken(client, user, authCode)
+		if err != nil {
+			h.logger.Errorf("Failed to sign ID token for client %s: %v", clientID, err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to issue token")
+		}
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+func (h *OAuthHandler) issueIDToken(client *domain.OAuthClient, user *domain.User, authCode *domain.AuthorizationCode) (string, error) {
+	now := time.Now()
+	userInfo := domain.NewUserInfo(user, authCode.Scopes)
+	return h.idTokenSigner.Sign(&domain.IDTokenClaims{
+		AuthTime:      authCode.AuthTime.Unix(),
+		Nonce:         authCode.Nonce,
+		Email:         userInfo.Email,
+		EmailVerified: userInfo.EmailVerified,
+		Name:          userInfo.Name,
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    h.config.OAuth.Issuer,
+			Subject:   userInfo.Subject,
+			Audience:  client.ClientID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(h.config.OAuth.IDTokenTTL).Unix(),
+		},
+	})
+}
+
+// Introspect is the token introspection endpoint (RFC 7662). Confidential
+// clients granted the tokens:introspect scope authenticate as on the token
+// endpoint and may ask about any access token or API key; token_type_hint is
+// accepted but not needed.
+func (h *OAuthHandler) Introspect(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "no-store")
+	c.Response().Header().Set("Pragma", "no-cache")
+
+	clientID, clientSecret, ok := c.Request().BasicAuth()
+	if !ok {
+		clientID = c.FormValue("client_id")
+		clientSecret = c.FormValue("client_secret")
+	}
+	if clientID == "" || clientSecret == "" {
+		c.Response().Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		return oauthError(c, http.StatusUnauthorized, domain.OAuthErrorInvalidClient, "Client authentication is required")
+	}
+
+	token := c.FormValue("token")
+	if token == "" {
+		return oauthError(c, http.StatusBadRequest, domain.OAuthErrorInvalidRequest, "token is required")
+	}
+
+	introspection, err := h.introspectionUsecase.Introspect(clientID, clientSecret, token)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidClient) {
+			c.Response().Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+			return oauthError(c, http.StatusUnauthorized, domain.OAuthErrorInvalidClient, "Invalid client credentials")
+		}
+		if errors.Is(err, domain.ErrIntrospectionDenied) {
+			return oauthError(c, http.StatusForbidden, domain.OAuthErrorUnauthorizedClient, "Client is not allowed to introspect tokens")
+		}
+		h.logger.Errorf("Failed to introspect token for client %s: %v", clientID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to introspect token")
+	}
+
+	return c.JSON(http.StatusOK, introspection)
+}
+
+// tokenError maps usecase errors to token endpoint error responses
+func (h *OAuthHandler) tokenError(c echo.Context, clientID string, err error) error {
+	switch {
+	case errors.Is(err, domain.ErrInvalidClient):
+		return oauthError(c, http.StatusUnauthorized, domain.OAuthErrorInvalidClient, "Invalid client credentials")
+	case errors.Is(err, domain.ErrUnauthorizedClient):
+		return oauthError(c, http.StatusBadRequest, domain.OAuthErrorUnauthorizedClient, "Client is not allowed to use this grant type")
+	case errors.Is(err, domain.ErrInvalidScope):
+		return oauthError(c, http.StatusBadRequest, domain.OAuthErrorInvalidScope, "Requested scope is not allowed")
+	case errors.Is(err, domain.ErrInvalidGrant):
+		return oauthError(c, http.StatusBadRequest, domain.OAuthErrorInvalidGrant, "Authorization code is invalid or expired")
+	}
+	h.logger.Errorf("Failed to issue token for client %s: %v", clientID, err)
+	return echo.NewHTTPError(http.StatusInternalServerError, "Failed to issue token")
+}
+
+// CreateClient registers a client and returns its secret, if any, once
+func (h *OAuthHandler) CreateClient(c echo.Context) error {
+	userID, ok := c.Get("user_id").(int64)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token claims")
+	}
+
+	var req domain.OAuthClientCreate
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Client name is required")
+	}
+
+	client, secret, err := h.oauthUsecase.CreateClient(requestInfo(c), userID, req)
+	if err != nil {
+		h.logger.Errorf("Failed to create OAuth client: %v", err)
+		switch {
+		case errors.Is(err, domain.ErrOrganizationNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Organization not found")
+		case errors.Is(err, domain.ErrInvalidOAuthClient):
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid client type, grant types or redirect URIs")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create client")
+	}
+
+	if client.IsPublic() {
+		return c.JSON(http.StatusCreated, map[string]interface{}{
+			"client": client,
+		})
+	}
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"client":        client,
+		"client_secret": secret,
+		"message":       "Store this secret securely. It will not be shown again.",
+	})
+}
+
+// ListClients lists every registered OAuth client
+func (h *OAuthHandler) ListClients(c echo.Context) error {
+	clients, err := h.oauthUsecase.ListClients()
+	if err != nil {
+		h.logger.Errorf("Failed to list OAuth clients: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to list clients")
+	}
+
+	if clients == nil {
+		clients = []*domain.OAuthClient{}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"clients": clients,
+	})
+}
+
+// RotateClientSecret issues a new client secret. The previous secret stays
+// valid for the configured grace period.
+func (h *OAuthHandler) RotateClientSecret(c echo.Context) error {
+	clientID := c.Param("client_id")
+
+	secret, err := h.oauthUsecase.RotateClientSecret(requestInfo(c), clientID, h.config.OAuth.SecretRotationGracePeriod)
+	if err != nil {
+		h.logger.Errorf("Failed to rotate secret for client %s: %v", clientID, err)
+		switch {
+		case errors.Is(err, domain.ErrOAuthClientNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, "Client not found")
+		case errors.Is(err, domain.ErrPublicClientSecret):
+			return echo.NewHTTPError(http.StatusBadRequest, "Public clients have no secret")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to rotate client secret")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"client_id":                  clientID,
+		"client_secret":              secret,
+		"previous_secret_expires_in": int64(h.config.OAuth.SecretRotationGracePeriod.Seconds()),
+		"message":                    "Store this secret securely. It will not be shown again.",
+	})
+}
+
+// RevokeClient revokes a client. Tokens already issued to it are reported
+// inactive by introspection but pass JWTMiddleware until they expire.
+func (h *OAuthHandler) RevokeClient(c echo.Context) error {
+	clientID := c.Param("client_id")
+
+	if err := h.oauthUsecase.RevokeClient(requestInfo(c), clientID); err != nil {
+		h.logger.Errorf("Failed to revoke client %s: %v", clientID, err)
+		if errors.Is(err, domain.ErrOAuthClientNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Client not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to revoke client")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ListConsents lists the applications the user has granted access to
+func (h *OAuthHandler) ListConsents(c echo.Context) error {
+	userID, ok := c.Get("user_id").(int64)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token claims")
+	}
+
+	consents, err := h.oauthUsecase.ListConsents(userID)
+	if err != nil {
+		h.logger.Errorf("Failed to list consents for user %d: %v", userID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to list consents")
+	}
+
+	if consents == nil {
+		consents = []*domain.OAuthConsent{}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"consents": consents,
+	})
+}
+
+// RevokeConsent withdraws the user's consent for an application
+func (h *OAuthHandler) RevokeConsent(c echo.Context) error {
+	userID, ok := c.Get("user_id").(int64)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token claims")
+	}
+	clientID := c.Param("client_id")
+
+	if err := h.oauthUsecase.RevokeConsent(requestInfo(c), userID, clientID); err != nil {
+		h.logger.Errorf("Failed to revoke consent of user %d for client %s: %v", userID, clientID, err)
+		if errors.Is(err, domain.ErrConsentNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Consent not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to revoke consent")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// oauthError writes an RFC 6749 section 5.2 error response
+func oauthError(c echo.Context, status int, code, description string) error {
+	return c.JSON(status, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
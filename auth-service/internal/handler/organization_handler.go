@@ -0,0 +1,284 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/service"
+	"github.com/sales-tracker/auth-service/internal/usecase"
+)
+
+type OrganizationHandler struct {
+	organizationUsecase *usecase.OrganizationUsecase
+	invitationUsecase   *usecase.InvitationUsecase
+	tokenService        *service.TokenService
+	config              *config.Config
+	logger              *logrus.Logger
+}
+
+func NewOrganizationHandler(config *config.Config, organizationUsecase *usecase.OrganizationUsecase, invitationUsecase *usecase.InvitationUsecase, tokenService *service.TokenService) *OrganizationHandler {
+	return &OrganizationHandler{
+		organizationUsecase: organizationUsecase,
+		invitationUsecase:   invitationUsecase,
+		tokenService:        tokenService,
+		config:              config,
+		logger:              logrus.New(),
+	}
+}
+
+// CreateOrganization creates an organization owned by the authenticated user
+func (h *OrganizationHandler) CreateOrganization(c echo.Context) error {
+	userID, ok := c.Get("user_id").(int64)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token claims")
+	}
+
+	var req domain.OrganizationCreate
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	org, err := h.organizationUsecase.CreateOrganization(requestInfo(c), userID, req.Name, req.Slug)
+	if err != nil {
+		h.logger.Errorf("Failed to create organization for user %d: %v", userID, err)
+		return organizationError(err, "Failed to create organization")
+	}
+
+	return c.JSON(http.StatusCreated, org)
+}
+
+// ListOrganizations lists the organizations the authenticated user belongs to
+func (h *OrganizationHandler) ListOrganizations(c echo.Context) error {
+	userID, ok := c.Get("user_id").(int64)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token claims")
+	}
+
+	memberships, err := h.organizationUsecase.ListUserMemberships(userID)
+	if err != nil {
+		h.logger.Errorf("Failed to list organizations for user %d: %v", userID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to list organizations")
+	}
+
+	if memberships == nil {
+		memberships = []*domain.Membership{}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"organizations": memberships,
+	})
+}
+
+// SwitchOrganization mints a new token scoped to the requested organization
+func (h *OrganizationHandler) SwitchOrganization(c echo.Context) error {
+	userID, ok := c.Get("user_id").(int64)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token claims")
+	}
+
+	// An API key must not be exchangeable for a full user token
+	if _, isAPIKey := c.Get("api_key_id").(int64); isAPIKey {
+		return echo.NewHTTPError(http.StatusForbidden, "API keys cannot switch organizations")
+	}
+
+	orgID, err := strconv.ParseInt(c.Param("org_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid organization ID")
+	}
+
+	user, membership, err := h.organizationUsecase.SwitchOrganization(requestInfo(c), userID, orgID)
+	if err != nil {
+		h.logger.Warnf("Failed to switch user %d to organization %d: %v", userID, orgID, err)
+		if errors.Is(err, domain.ErrMembershipNotFound) {
+			return echo.NewHTTPError(http.StatusForbidden, "Not a member of this organization")
+		}
+		return echo.NewHTTPError(http.StatusUnauthorized, "Failed to switch organization")
+	}
+
+	signedToken, err := h.tokenService.IssueUserToken(user, membership)
+	if err != nil {
+		h.logger.Error("Failed to sign token:", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to generate token")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"token":        signedToken,
+		"organization": membership,
+	})
+}
+
+// ListMembers lists the members of an organization
+func (h *OrganizationHandler) ListMembers(c echo.Context) error {
+	orgID, err := strconv.ParseInt(c.Param("org_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid organization ID")
+	}
+
+	members, err := h.organizationUsecase.ListMembers(orgID)
+	if err != nil {
+		h.logger.Errorf("Failed to list members of organization %d: %v", orgID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to list members")
+	}
+
+	if members == nil {
+		members = []*domain.Membership{}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"members": members,
+	})
+}
+
+// AddMember adds an account the organization provisioned. Anyone else is
+// sent an invitation instead and only joins once they accept it.
+func (h *OrganizationHandler) AddMember(c echo.Context) error {
+	orgID, err := strconv.ParseInt(c.Param("org_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid organization ID")
+	}
+
+	var req domain.MembershipCreate
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	membership, err := h.organizationUsecase.AddMember(requestInfo(c), orgID, req.Email, req.Role)
+	if errors.Is(err, domain.ErrInvitationRequired) {
+		invitation, err := h.invitationUsecase.CreateInvitation(requestInfo(c), orgID, domain.OrgRoleAdmin, req.Email, req.Role, h.config.InvitationTTL)
+		if err != nil {
+			h.logger.Errorf("Failed to invite %s to organization %d: %v", req.Email, orgID, err)
+			return invitationError(err, "Failed to add member")
+		}
+		return c.JSON(http.StatusAccepted, map[string]interface{}{
+			"message":    "Invitation sent. The user joins once they accept it.",
+			"invitation": invitation,
+		})
+	}
+	if err != nil {
+		h.logger.Errorf("Failed to add %s to organization %d: %v", req.Email, orgID, err)
+		return organizationError(err, "Failed to add member")
+	}
+
+	return c.JSON(http.StatusCreated, membership)
+}
+
+// UpdateMember changes a member's role within the organization
+func (h *OrganizationHandler) UpdateMember(c echo.Context) error {
+	orgID, userID, err := orgMemberParams(c)
+	if err != nil {
+		return err
+	}
+
+	var req domain.MembershipUpdate
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := h.organizationUsecase.ChangeMemberRole(requestInfo(c), orgID, userID, req.Role); err != nil {
+		h.logger.Errorf("Failed to change role of user %d in organization %d: %v", userID, orgID, err)
+		return organizationError(err, "Failed to update member")
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "Member role updated",
+	})
+}
+
+// RemoveMember removes a user from the organization
+func (h *OrganizationHandler) RemoveMember(c echo.Context) error {
+	orgID, userID, err := orgMemberParams(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.organizationUsecase.RemoveMember(requestInfo(c), orgID, userID); err != nil {
+		h.logger.Errorf("Failed to remove user %d from organization %d: %v", userID, orgID, err)
+		return organizationError(err, "Failed to remove member")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// SetManager sets or clears a member's manager
+func (h *OrganizationHandler) SetManager(c echo.Context) error {
+	orgID, userID, err := orgMemberParams(c)
+	if err != nil {
+		return err
+	}
+
+	var req domain.ManagerUpdate
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := h.organizationUsecase.SetManager(requestInfo(c), orgID, userID, req.ManagerID); err != nil {
+		h.logger.Errorf("Failed to set manager of user %d in organization %d: %v", userID, orgID, err)
+		return organizationError(err, "Failed to update manager")
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "Manager updated",
+	})
+}
+
+// ListReports lists everyone reporting to a user, directly or transitively,
+// in the organization the caller's token is scoped to
+func (h *OrganizationHandler) ListReports(c echo.Context) error {
+	callerID, ok := c.Get("user_id").(int64)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token claims")
+	}
+	orgID, _ := c.Get("org_id").(int64)
+	if orgID == 0 {
+		return echo.NewHTTPError(http.StatusForbidden, "Token is not scoped to an organization")
+	}
+
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	reports, err := h.organizationUsecase.ListReports(orgID, callerID, userID)
+	if err != nil {
+		h.logger.Warnf("Failed to list reports of user %d in organization %d: %v", userID, orgID, err)
+		return organizationError(err, "Failed to list reports")
+	}
+
+	if reports == nil {
+		reports = []*domain.Report{}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"reports": reports,
+	})
+}
+
+func orgMemberParams(c echo.Context) (int64, int64, error) {
+	orgID, err := strconv.ParseInt(c.Param("org_id"), 10, 64)
+	if err != nil {
+		return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "Invalid organization ID")
+	}
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+	return orgID, userID, nil
+}
+
+// organizationError maps organization domain errors to HTTP errors
+func organizationError(err error, fallback string) error {
+	switch {
+	case errors.Is(err, domain.ErrInvalidOrganization), errors.Is(err, domain.ErrInvalidOrgRole), errors.Is(err, domain.ErrInvalidManager):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, domain.ErrReportsForbidden):
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	case errors.Is(err, domain.ErrSlugTaken), errors.Is(err, domain.ErrMembershipExists), errors.Is(err, domain.ErrLastOrgAdmin):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, domain.ErrOrganizationNotFound), errors.Is(err, domain.ErrMembershipNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, fallback)
+}
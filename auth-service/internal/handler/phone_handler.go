@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/usecase"
+)
+
+type PhoneHandler struct {
+	phoneUsecase *usecase.PhoneUsecase
+	logger       *logrus.Logger
+}
+
+func NewPhoneHandler(phoneUsecase *usecase.PhoneUsecase) *PhoneHandler {
+	return &PhoneHandler{
+		phoneUsecase: phoneUsecase,
+		logger:       logrus.New(),
+	}
+}
+
+// passwordConfirmation is the body of requests that re-check the password
+type passwordConfirmation struct {
+	Password string `json:"password"`
+}
+
+// AddPhone texts a verification code to the phone number the authenticated
+// user wants to add
+func (h *PhoneHandler) AddPhone(c echo.Context) error {
+	userID, ok := c.Get("user_id").(int64)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token claims")
+	}
+
+	var req struct {
+		PhoneNumber string `json:"phone_number"`
+		Password    string `json:"password"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := h.phoneUsecase.StartPhoneVerification(requestInfo(c), userID, req.PhoneNumber, req.Password); err != nil {
+		h.logger.Errorf("Failed to start phone verification for user %d: %v", userID, err)
+		return phoneError(err, "Failed to send verification code")
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]string{
+		"message": "A verification code has been sent to your phone.",
+	})
+}
+
+// VerifyPhone confirms the authenticated user's new phone number with the
+// code texted to it
+func (h *PhoneHandler) VerifyPhone(c echo.Context) error {
+	userID, ok := c.Get("user_id").(int64)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token claims")
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	user, err := h.phoneUsecase.ConfirmPhoneVerification(requestInfo(c), userID, strings.TrimSpace(req.Code))
+	if err != nil {
+		h.logger.Errorf("Failed to verify phone for user %d: %v", userID, err)
+		return phoneError(err, "Failed to verify phone number")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"phone_number":      user.PhoneNumber,
+		"phone_verified_at": user.PhoneVerifiedAt,
+		"sms_mfa_enabled":   user.SMSMFAEnabled,
+	})
+}
+
+// RemovePhone removes the authenticated user's phone number, and with it
+// SMS two-factor login
+func (h *PhoneHandler) RemovePhone(c echo.Context) error {
+	userID, ok := c.Get("user_id").(int64)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token claims")
+	}
+
+	var req passwordConfirmation
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := h.phoneUsecase.RemovePhone(requestInfo(c), userID, req.Password); err != nil {
+		h.logger.Errorf("Failed to remove phone for user %d: %v", userID, err)
+		return phoneError(err, "Failed to remove phone number")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// EnableSMSMFA makes a texted code the second factor of the authenticated
+// user's password logins
+func (h *PhoneHandler) EnableSMSMFA(c echo.Context) error {
+	userID, ok := c.Get("user_id").(int64)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token claims")
+	}
+
+	var req passwordConfirmation
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := h.phoneUsecase.EnableSMSMFA(requestInfo(c), userID, req.Password); err != nil {
+		h.logger.Errorf("Failed to enable SMS MFA for user %d: %v", userID, err)
+		return phoneError(err, "Failed to enable two-factor authentication")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"sms_mfa_enabled": true,
+	})
+}
+
+// DisableSMSMFA turns SMS two-factor login off for the authenticated user
+func (h *PhoneHandler) DisableSMSMFA(c echo.Context) error {
+	userID, ok := c.Get("user_id").(int64)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token claims")
+	}
+
+	var req passwordConfirmation
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := h.phoneUsecase.DisableSMSMFA(requestInfo(c), userID, req.Password); err != nil {
+		h.logger.Errorf("Failed to disable SMS MFA for user %d: %v", userID, err)
+		return phoneError(err, "Failed to disable two-factor authentication")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"sms_mfa_enabled": false,
+	})
+}
+
+// ForgotPasswordSMS texts a password reset code to the account's verified
+// phone number
+func (h *PhoneHandler) ForgotPasswordSMS(c echo.Context) error {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	// Failures get the generic response too, to avoid user enumeration
+	if err := h.phoneUsecase.RequestPasswordResetSMS(requestInfo(c), req.Email); err != nil {
+		h.logger.Error("Failed to request password reset by SMS:", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "If an account with that email can reset its password by SMS, a reset code has been sent to it",
+	})
+}
+
+// VerifyPasswordResetSMS exchanges a texted reset code for the token that
+// /auth/reset-password accepts
+func (h *PhoneHandler) VerifyPasswordResetSMS(c echo.Context) error {
+	var req struct {
+		Email string `json:"email"`
+		Code  string `json:"code"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	token, err := h.phoneUsecase.VerifyPasswordResetSMS(requestInfo(c), req.Email, strings.TrimSpace(req.Code))
+	if err != nil {
+		h.logger.Error("Failed to verify password reset code:", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid or expired code")
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"reset_token": token,
+	})
+}
+
+// phoneError maps phone and SMS domain errors to HTTP errors
+func phoneError(err error, fallback string) error {
+	switch {
+	case errors.Is(err, domain.ErrInvalidCredentials):
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid credentials")
+	case errors.Is(err, domain.ErrDirectoryUnavailable):
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Directory server is unavailable")
+	case errors.Is(err, domain.ErrInvalidPhoneNumber), errors.Is(err, domain.ErrInvalidSMSCode):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, domain.ErrNoVerifiedPhone), errors.Is(err, domain.ErrMFAAlreadyEnabled), errors.Is(err, domain.ErrMFANotEnabled):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, domain.ErrSMSCodeRateLimited):
+		return echo.NewHTTPError(http.StatusTooManyRequests, "A code was sent recently. Please wait before requesting another.")
+	case errors.Is(err, domain.ErrSMSCodeLimit):
+		return echo.NewHTTPError(http.StatusTooManyRequests, "Too many codes were sent today. Please try again later.")
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, fallback)
+}
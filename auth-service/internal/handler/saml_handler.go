@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/service"
+	"github.com/sales-tracker/auth-service/internal/usecase"
+)
+
+type SAMLHandler struct {
+	config          *config.Config
+	samlUsecase     *usecase.SAMLUsecase
+	serviceProvider *service.SAMLServiceProvider
+	phoneUsecase    *usecase.PhoneUsecase
+	tokenService    *service.TokenService
+	logger          *logrus.Logger
+}
+
+func NewSAMLHandler(config *config.Config, samlUsecase *usecase.SAMLUsecase, serviceProvider *service.SAMLServiceProvider, phoneUsecase *usecase.PhoneUsecase, tokenService *service.TokenService) *SAMLHandler {
+	return &SAMLHandler{
+		config:          config,
+		samlUsecase:     samlUsecase,
+		serviceProvider: serviceProvider,
+		phoneUsecase:    phoneUsecase,
+		tokenService:    tokenService,
+		logger:          logrus.New(),
+	}
+}
+
+// GetConfig returns the organization's IdP configuration along with the SP
+// values to register at the IdP
+func (h *SAMLHandler) GetConfig(c echo.Context) error {
+	orgID, err := strconv.ParseInt(c.Param("org_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid organization ID")
+	}
+
+	cfg, err := h.samlUsecase.GetConfig(orgID)
+	if err != nil {
+		if !errors.Is(err, domain.ErrSAMLNotConfigured) {
+			h.logger.Errorf("Failed to load SAML configuration of organization %d: %v", orgID, err)
+		}
+		return samlError(err, "Failed to load SAML configuration")
+	}
+
+	return c.JSON(http.StatusOK, h.configResponse(cfg))
+}
+
+// UpdateConfig creates or replaces the organization's IdP configuration
+func (h *SAMLHandler) UpdateConfig(c echo.Context) error {
+	orgID, err := strconv.ParseInt(c.Param("org_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid organization ID")
+	}
+
+	var req domain.SAMLConfigUpdate
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	cfg, err := h.samlUsecase.SaveConfig(requestInfo(c), orgID, &req)
+	if err != nil {
+		h.logger.Errorf("Failed to save SAML configuration of organization %d: %v", orgID, err)
+		return samlError(err, "Failed to save SAML configuration")
+	}
+
+	return c.JSON(http.StatusOK, h.configResponse(cfg))
+}
+
+func (h *SAMLHandler) DeleteConfig(c echo.Context) error {
+	orgID, err := strconv.ParseInt(c.Param("org_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid organization ID")
+	}
+
+	if err := h.samlUsecase.DeleteConfig(requestInfo(c), orgID); err != nil {
+		h.logger.Errorf("Failed to delete SAML configuration of organization %d: %v", orgID, err)
+		return samlError(err, "Failed to delete SAML configuration")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Metadata serves the organization's SP metadata for upload to the IdP
+func (h *SAMLHandler) Metadata(c echo.Context) error {
+	orgID, err := strconv.ParseInt(c.Param("org_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid organization ID")
+	}
+
+	metadata, err := h.samlUsecase.Metadata(orgID)
+	if err != nil {
+		if !errors.Is(err, domain.ErrOrganizationNotFound) {
+			h.logger.Errorf("Failed to build SAML metadata of organization %d: %v", orgID, err)
+		}
+		return samlError(err, "Failed to build SAML metadata")
+	}
+
+	return c.Blob(http.StatusOK, "application/samlmetadata+xml", metadata)
+}
+
+// Login redirects the user to the organization's IdP. An optional
+// relay_state is returned by the IdP and echoed in the login response.
+func (h *SAMLHandler) Login(c echo.Context) error {
+	orgID, err := strconv.ParseInt(c.Param("org_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid organization ID")
+	}
+
+	relayState := c.QueryParam("relay_state")
+	// SAML bindings limit RelayState to 80 bytes
+	if len(relayState) > 80 {
+		return echo.NewHTTPError(http.StatusBadRequest, "relay_state must be at most 80 bytes")
+	}
+
+	authURL, err := h.samlUsecase.StartLogin(orgID, relayState, h.config.SAMLRequestTTL)
+	if err != nil {
+		if !errors.Is(err, domain.ErrSAMLNotConfigured) {
+			h.logger.Errorf("Failed to start SAML login for organization %d: %v", orgID, err)
+		}
+		return samlError(err, "Failed to start SAML login")
+	}
+
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+// ACS is the assertion consumer service the IdP posts its response to. It
+// returns the same response as /auth/login, including its SMS challenge,
+// with a token scoped to the organization and without a global role.
+func (h *SAMLHandler) ACS(c echo.Context) error {
+	orgID, err := strconv.ParseInt(c.Param("org_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid organization ID")
+	}
+
+	samlResponse := c.FormValue("SAMLResponse")
+	if samlResponse == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "SAMLResponse is required")
+	}
+
+	user, membership, err := h.samlUsecase.CompleteLogin(requestInfo(c), orgID, samlResponse)
+	if err != nil {
+		h.logger.Warnf("SAML login to organization %d failed: %v", orgID, err)
+		return samlError(err, "Failed to sign in")
+	}
+
+	// The IdP's assertion replaces the password, not the second factor.
+	// The code redeemed at /auth/login/mfa signs the user into orgID.
+	var response map[string]interface{}
+	if user.SMSMFAEnabled {
+		challenge, err := h.phoneUsecase.StartLoginChallenge(requestInfo(c), user, &orgID)
+		if err != nil {
+			h.logger.Errorf("Failed to start login challenge for user %d: %v", user.ID, err)
+			return phoneError(err, "Failed to send sign-in code")
+		}
+		response = mfaRequiredResponse(challenge)
+	} else {
+		signedToken, err := h.tokenService.IssueOrganizationToken(user, membership)
+		if err != nil {
+			h.logger.Error("Failed to sign token:", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to generate token")
+		}
+		response = loginResponse(signedToken, user, membership)
+	}
+	if relayState := c.FormValue("RelayState"); relayState != "" {
+		response["relay_state"] = relayState
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+func (h *SAMLHandler) configResponse(cfg *domain.SAMLConfig) map[string]interface{} {
+	return map[string]interface{}{
+		"config": cfg,
+		"service_provider": map[string]string{
+			"entity_id": h.serviceProvider.EntityID(cfg.OrgID),
+			"acs_url":   h.serviceProvider.ACSURL(cfg.OrgID),
+		},
+	}
+}
+
+func samlError(err error, fallback string) error {
+	switch {
+	case errors.Is(err, domain.ErrInvalidSAMLConfig):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, domain.ErrSAMLNotConfigured), errors.Is(err, domain.ErrOrganizationNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, domain.ErrInvalidSAMLResp), errors.Is(err, domain.ErrSAMLReplay):
+		// Details stay in the log; they would help an attacker tune a forgery
+		return echo.NewHTTPError(http.StatusUnauthorized, "Could not verify the identity provider's response")
+	case errors.Is(err, domain.ErrSAMLNoAccount):
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	case errors.Is(err, domain.ErrAccountDeleted):
+		return echo.NewHTTPError(http.StatusUnauthorized, "Account is scheduled for deletion")
+	case errors.Is(err, domain.ErrAccountDisabled):
+		return echo.NewHTTPError(http.StatusUnauthorized, "Account is disabled")
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, fallback)
+}
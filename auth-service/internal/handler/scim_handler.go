@@ -0,0 +1,326 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/usecase"
+)
+
+const (
+	scimContentType      = "application/scim+json"
+	scimDefaultPageSize  = 100
+	scimServiceProviders = `{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"],
+  "patch": {"supported": true},
+  "bulk": {"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+  "filter": {"supported": true, "maxResults": 200},
+  "changePassword": {"supported": true},
+  "sort": {"supported": false},
+  "etag": {"supported": false},
+  "authenticationSchemes": [{
+    "type": "oauthbearertoken",
+    "name": "Organization API key",
+    "description": "An organization-owned API key with the scim scope, sent as a bearer token"
+  }]
+}`
+)
+
+// SCIMHandler serves the SCIM 2.0 provisioning API under /scim/v2 for the
+// organization that owns the caller's API key
+type SCIMHandler struct {
+	config      *config.Config
+	scimUsecase *usecase.SCIMUsecase
+	logger      *logrus.Logger
+}
+
+func NewSCIMHandler(config *config.Config, scimUsecase *usecase.SCIMUsecase) *SCIMHandler {
+	return &SCIMHandler{
+		config:      config,
+		scimUsecase: scimUsecase,
+		logger:      logrus.New(),
+	}
+}
+
+func (h *SCIMHandler) ServiceProviderConfig(c echo.Context) error {
+	return c.Blob(http.StatusOK, scimContentType, []byte(scimServiceProviders))
+}
+
+func (h *SCIMHandler) ListUsers(c echo.Context) error {
+	orgID := c.Get("org_id").(int64)
+	startIndex, count := scimPagination(c)
+
+	users, total, err := h.scimUsecase.ListUsers(orgID, c.QueryParam("filter"), startIndex, count)
+	if err != nil {
+		h.logger.Errorf("Failed to list SCIM users of organization %d: %v", orgID, err)
+		return scimError(c, err)
+	}
+
+	resources := make([]*domain.SCIMUser, 0, len(users))
+	for _, user := range users {
+		resources = append(resources, domain.NewSCIMUser(user, h.baseURL()))
+	}
+	return scimJSON(c, http.StatusOK, scimList(resources, total, startIndex, len(resources)))
+}
+
+func (h *SCIMHandler) GetUser(c echo.Context) error {
+	orgID := c.Get("org_id").(int64)
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return scimError(c, domain.ErrSCIMNotFound)
+	}
+
+	user, err := h.scimUsecase.GetUser(orgID, userID)
+	if err != nil {
+		return scimError(c, err)
+	}
+	return scimJSON(c, http.StatusOK, domain.NewSCIMUser(user, h.baseURL()))
+}
+
+func (h *SCIMHandler) CreateUser(c echo.Context) error {
+	orgID := c.Get("org_id").(int64)
+
+	var req domain.SCIMUser
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return scimError(c, domain.ErrSCIMInvalidValue)
+	}
+
+	user, err := h.scimUsecase.CreateUser(requestInfo(c), orgID, &req)
+	if err != nil {
+		h.logger.Warnf("Failed to provision SCIM user %q in organization %d: %v", req.UserName, orgID, err)
+		return scimError(c, err)
+	}
+	return scimJSON(c, http.StatusCreated, domain.NewSCIMUser(user, h.baseURL()))
+}
+
+func (h *SCIMHandler) ReplaceUser(c echo.Context) error {
+	orgID := c.Get("org_id").(int64)
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return scimError(c, domain.ErrSCIMNotFound)
+	}
+
+	var req domain.SCIMUser
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return scimError(c, domain.ErrSCIMInvalidValue)
+	}
+
+	user, err := h.scimUsecase.ReplaceUser(requestInfo(c), orgID, userID, &req)
+	if err != nil {
+		h.logger.Warnf("Failed to replace SCIM user %d in organization %d: %v", userID, orgID, err)
+		return scimError(c, err)
+	}
+	return scimJSON(c, http.StatusOK, domain.NewSCIMUser(user, h.baseURL()))
+}
+
+func (h *SCIMHandler) PatchUser(c echo.Context) error {
+	orgID := c.Get("org_id").(int64)
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return scimError(c, domain.ErrSCIMNotFound)
+	}
+
+	var req domain.SCIMPatchRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return scimError(c, domain.ErrSCIMInvalidValue)
+	}
+
+	user, err := h.scimUsecase.PatchUser(requestInfo(c), orgID, userID, &req)
+	if err != nil {
+		h.logger.Warnf("Failed to patch SCIM user %d in organization %d: %v", userID, orgID, err)
+		return scimError(c, err)
+	}
+	return scimJSON(c, http.StatusOK, domain.NewSCIMUser(user, h.baseURL()))
+}
+
+func (h *SCIMHandler) DeleteUser(c echo.Context) error {
+	orgID := c.Get("org_id").(int64)
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return scimError(c, domain.ErrSCIMNotFound)
+	}
+
+	if err := h.scimUsecase.DeleteUser(requestInfo(c), orgID, userID); err != nil {
+		h.logger.Warnf("Failed to deprovision SCIM user %d in organization %d: %v", userID, orgID, err)
+		return scimError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *SCIMHandler) ListGroups(c echo.Context) error {
+	orgID := c.Get("org_id").(int64)
+	startIndex, count := scimPagination(c)
+
+	groups, total, err := h.scimUsecase.ListGroups(orgID, c.QueryParam("filter"), startIndex, count)
+	if err != nil {
+		h.logger.Errorf("Failed to list SCIM groups of organization %d: %v", orgID, err)
+		return scimError(c, err)
+	}
+
+	resources := make([]*domain.SCIMGroup, 0, len(groups))
+	for _, group := range groups {
+		resources = append(resources, domain.NewSCIMGroup(group, h.baseURL()))
+	}
+	return scimJSON(c, http.StatusOK, scimList(resources, total, startIndex, len(resources)))
+}
+
+func (h *SCIMHandler) GetGroup(c echo.Context) error {
+	orgID := c.Get("org_id").(int64)
+	groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return scimError(c, domain.ErrSCIMNotFound)
+	}
+
+	group, err := h.scimUsecase.GetGroup(orgID, groupID)
+	if err != nil {
+		return scimError(c, err)
+	}
+	return scimJSON(c, http.StatusOK, domain.NewSCIMGroup(group, h.baseURL()))
+}
+
+func (h *SCIMHandler) CreateGroup(c echo.Context) error {
+	orgID := c.Get("org_id").(int64)
+
+	var req domain.SCIMGroup
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return scimError(c, domain.ErrSCIMInvalidValue)
+	}
+
+	group, err := h.scimUsecase.CreateGroup(requestInfo(c), orgID, &req)
+	if err != nil {
+		h.logger.Warnf("Failed to create SCIM group %q in organization %d: %v", req.DisplayName, orgID, err)
+		return scimError(c, err)
+	}
+	return scimJSON(c, http.StatusCreated, domain.NewSCIMGroup(group, h.baseURL()))
+}
+
+func (h *SCIMHandler) ReplaceGroup(c echo.Context) error {
+	orgID := c.Get("org_id").(int64)
+	groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return scimError(c, domain.ErrSCIMNotFound)
+	}
+
+	var req domain.SCIMGroup
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return scimError(c, domain.ErrSCIMInvalidValue)
+	}
+
+	group, err := h.scimUsecase.ReplaceGroup(requestInfo(c), orgID, groupID, &req)
+	if err != nil {
+		h.logger.Warnf("Failed to replace SCIM group %d in organization %d: %v", groupID, orgID, err)
+		return scimError(c, err)
+	}
+	return scimJSON(c, http.StatusOK, domain.NewSCIMGroup(group, h.baseURL()))
+}
+
+func (h *SCIMHandler) PatchGroup(c echo.Context) error {
+	orgID := c.Get("org_id").(int64)
+	groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return scimError(c, domain.ErrSCIMNotFound)
+	}
+
+	var req domain.SCIMPatchRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return scimError(c, domain.ErrSCIMInvalidValue)
+	}
+
+	group, err := h.scimUsecase.PatchGroup(requestInfo(c), orgID, groupID, &req)
+	if err != nil {
+		h.logger.Warnf("Failed to patch SCIM group %d in organization %d: %v", groupID, orgID, err)
+		return scimError(c, err)
+	}
+	return scimJSON(c, http.StatusOK, domain.NewSCIMGroup(group, h.baseURL()))
+}
+
+func (h *SCIMHandler) DeleteGroup(c echo.Context) error {
+	orgID := c.Get("org_id").(int64)
+	groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return scimError(c, domain.ErrSCIMNotFound)
+	}
+
+	if err := h.scimUsecase.DeleteGroup(requestInfo(c), orgID, groupID); err != nil {
+		h.logger.Warnf("Failed to delete SCIM group %d in organization %d: %v", groupID, orgID, err)
+		return scimError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *SCIMHandler) baseURL() string {
+	return h.config.BaseURL + "/scim/v2"
+}
+
+// scimPagination reads startIndex and count, which default to the first
+// page of scimDefaultPageSize resources
+func scimPagination(c echo.Context) (startIndex, count int) {
+	startIndex, err := strconv.Atoi(c.QueryParam("startIndex"))
+	if err != nil || startIndex < 1 {
+		startIndex = 1
+	}
+	count, err = strconv.Atoi(c.QueryParam("count"))
+	if err != nil || count < 0 {
+		count = scimDefaultPageSize
+	}
+	return startIndex, count
+}
+
+func scimList(resources interface{}, total, startIndex, itemsPerPage int) *domain.SCIMListResponse {
+	return &domain.SCIMListResponse{
+		Schemas:      []string{domain.SCIMSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: itemsPerPage,
+		Resources:    resources,
+	}
+}
+
+func scimJSON(c echo.Context, status int, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.Blob(status, scimContentType, body)
+}
+
+// scimError renders err as a SCIM error response (RFC 7644 section 3.12)
+func scimError(c echo.Context, err error) error {
+	status, scimType := http.StatusInternalServerError, ""
+	detail := "Internal server error"
+	switch {
+	case errors.Is(err, domain.ErrSCIMInvalidFilter):
+		status, scimType = http.StatusBadRequest, "invalidFilter"
+	case errors.Is(err, domain.ErrSCIMInvalidPath):
+		status, scimType = http.StatusBadRequest, "invalidPath"
+	case errors.Is(err, domain.ErrSCIMNoTarget):
+		status, scimType = http.StatusBadRequest, "noTarget"
+	case errors.Is(err, domain.ErrSCIMInvalidValue):
+		status, scimType = http.StatusBadRequest, "invalidValue"
+	case errors.Is(err, domain.ErrSCIMUnmanagedUser):
+		status, scimType = http.StatusBadRequest, "mutability"
+	case errors.Is(err, domain.ErrSCIMUniqueness):
+		status, scimType = http.StatusConflict, "uniqueness"
+	case errors.Is(err, domain.ErrLastOrgAdmin):
+		status = http.StatusConflict
+	case errors.Is(err, domain.ErrSCIMNotFound):
+		status = http.StatusNotFound
+	}
+	if status != http.StatusInternalServerError {
+		detail = err.Error()
+	}
+
+	return scimJSON(c, status, domain.SCIMErrorResponse{
+		Schemas:  []string{domain.SCIMSchemaError},
+		Status:   strconv.Itoa(status),
+		SCIMType: scimType,
+		Detail:   detail,
+	})
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/usecase"
+)
+
+type SecurityNotificationHandler struct {
+	securityNotificationUsecase *usecase.SecurityNotificationUsecase
+	logger                      *logrus.Logger
+}
+
+func NewSecurityNotificationHandler(securityNotificationUsecase *usecase.SecurityNotificationUsecase) *SecurityNotificationHandler {
+	return &SecurityNotificationHandler{
+		securityNotificationUsecase: securityNotificationUsecase,
+		logger:                      logrus.New(),
+	}
+}
+
+// GetPreferences lists the security notifications the authenticated user
+// can receive and whether each is enabled
+func (h *SecurityNotificationHandler) GetPreferences(c echo.Context) error {
+	userID, ok := c.Get("user_id").(int64)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token claims")
+	}
+
+	preferences, err := h.securityNotificationUsecase.Preferences(userID)
+	if err != nil {
+		h.logger.Errorf("Failed to get notification preferences for user %d: %v", userID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get notification preferences")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"notifications": preferences,
+	})
+}
+
+// UpdatePreferences turns security notifications on or off for the
+// authenticated user, e.g. {"notifications": {"new_device_login": false}}
+func (h *SecurityNotificationHandler) UpdatePreferences(c echo.Context) error {
+	userID, ok := c.Get("user_id").(int64)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token claims")
+	}
+
+	var req struct {
+		Notifications map[string]bool `json:"notifications"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	preferences, err := h.securityNotificationUsecase.UpdatePreferences(requestInfo(c), userID, req.Notifications)
+	if err != nil {
+		h.logger.Errorf("Failed to update notification preferences for user %d: %v", userID, err)
+		if errors.Is(err, domain.ErrUnknownSecurityNotification) || errors.Is(err, domain.ErrCriticalSecurityNotification) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update notification preferences")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"notifications": preferences,
+	})
+}
@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/usecase"
+)
+
+type WebhookHandler struct {
+	webhookUsecase *usecase.WebhookUsecase
+	logger         *logrus.Logger
+}
+
+func NewWebhookHandler(webhookUsecase *usecase.WebhookUsecase) *WebhookHandler {
+	return &WebhookHandler{
+		webhookUsecase: webhookUsecase,
+		logger:         logrus.New(),
+	}
+}
+
+// CreateWebhook subscribes a URL to auth events. The signing secret is only
+// returned here and when rotated.
+func (h *WebhookHandler) CreateWebhook(c echo.Context) error {
+	userID, ok := c.Get("user_id").(int64)
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token claims")
+	}
+
+	var req domain.WebhookCreate
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	webhook, secret, err := h.webhookUsecase.CreateWebhook(requestInfo(c), userID, req)
+	if err != nil {
+		h.logger.Errorf("Failed to create webhook: %v", err)
+		return webhookError(err, "Failed to create webhook")
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"webhook": webhook,
+		"secret":  secret,
+		"message": "Store this secret securely. It will not be shown again.",
+	})
+}
+
+// ListWebhooks lists every webhook, along with the events they can
+// subscribe to
+func (h *WebhookHandler) ListWebhooks(c echo.Context) error {
+	webhooks, err := h.webhookUsecase.ListWebhooks()
+	if err != nil {
+		h.logger.Errorf("Failed to list webhooks: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to list webhooks")
+	}
+
+	if webhooks == nil {
+		webhooks = []*domain.Webhook{}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"webhooks": webhooks,
+		"events":   domain.WebhookEvents,
+	})
+}
+
+func (h *WebhookHandler) GetWebhook(c echo.Context) error {
+	webhookID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid webhook ID")
+	}
+
+	webhook, err := h.webhookUsecase.FindWebhook(webhookID)
+	if err != nil {
+		h.logger.Errorf("Failed to get webhook %d: %v", webhookID, err)
+		return webhookError(err, "Failed to get webhook")
+	}
+
+	return c.JSON(http.StatusOK, webhook)
+}
+
+// UpdateWebhook changes the fields present in the body: url, description,
+// events and active
+func (h *WebhookHandler) UpdateWebhook(c echo.Context) error {
+	webhookID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid webhook ID")
+	}
+
+	var req domain.WebhookUpdate
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	webhook, err := h.webhookUsecase.UpdateWebhook(requestInfo(c), webhookID, req)
+	if err != nil {
+		h.logger.Errorf("Failed to update webhook %d: %v", webhookID, err)
+		return webhookError(err, "Failed to update webhook")
+	}
+
+	return c.JSON(http.StatusOK, webhook)
+}
+
+func (h *WebhookHandler) DeleteWebhook(c echo.Context) error {
+	webhookID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid webhook ID")
+	}
+
+	if err := h.webhookUsecase.DeleteWebhook(requestInfo(c), webhookID); err != nil {
+		h.logger.Errorf("Failed to delete webhook %d: %v", webhookID, err)
+		return webhookError(err, "Failed to delete webhook")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RotateWebhookSecret issues a new signing secret for the webhook
+func (h *WebhookHandler) RotateWebhookSecret(c echo.Context) error {
+	webhookID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid webhook ID")
+	}
+
+	secret, err := h.webhookUsecase.RotateWebhookSecret(requestInfo(c), webhookID)
+	if err != nil {
+		h.logger.Errorf("Failed to rotate secret of webhook %d: %v", webhookID, err)
+		return webhookError(err, "Failed to rotate webhook secret")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"secret":  secret,
+		"message": "Store this secret securely. It will not be shown again.",
+	})
+}
+
+// ListDeliveries returns the webhook's delivery log filtered by the query
+// parameters status (pending, delivered or failed), event, cursor and limit
+func (h *WebhookHandler) ListDeliveries(c echo.Context) error {
+	webhookID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid webhook ID")
+	}
+
+	filter := domain.WebhookDeliveryFilter{
+		WebhookID: webhookID,
+		Status:    c.QueryParam("status"),
+		EventType: c.QueryParam("event"),
+	}
+
+	switch filter.Status {
+	case "", domain.WebhookDeliveryPending, domain.WebhookDeliveryDelivered, domain.WebhookDeliveryFailed:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid status")
+	}
+
+	if cursor := c.QueryParam("cursor"); cursor != "" {
+		if filter.Cursor, err = strconv.ParseInt(cursor, 10, 64); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid cursor")
+		}
+	}
+	if limit := c.QueryParam("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid limit")
+		}
+	}
+
+	deliveries, nextCursor, err := h.webhookUsecase.ListDeliveries(filter)
+	if err != nil {
+		h.logger.Errorf("Failed to list deliveries of webhook %d: %v", webhookID, err)
+		return webhookError(err, "Failed to list deliveries")
+	}
+
+	if deliveries == nil {
+		deliveries = []*domain.WebhookDelivery{}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"deliveries":  deliveries,
+		"next_cursor": nextCursor,
+	})
+}
+
+// GetDelivery returns one delivery with the log of its attempts
+func (h *WebhookHandler) GetDelivery(c echo.Context) error {
+	webhookID, deliveryID, err := webhookDeliveryParams(c)
+	if err != nil {
+		return err
+	}
+
+	delivery, err := h.webhookUsecase.FindDelivery(webhookID, deliveryID)
+	if err != nil {
+		h.logger.Errorf("Failed to get webhook delivery %d: %v", deliveryID, err)
+		return webhookError(err, "Failed to get delivery")
+	}
+
+	return c.JSON(http.StatusOK, delivery)
+}
+
+// ReplayDelivery sends a delivery's event to the webhook again
+func (h *WebhookHandler) ReplayDelivery(c echo.Context) error {
+	webhookID, deliveryID, err := webhookDeliveryParams(c)
+	if err != nil {
+		return err
+	}
+
+	replay, err := h.webhookUsecase.ReplayDelivery(requestInfo(c), webhookID, deliveryID)
+	if err != nil {
+		h.logger.Errorf("Failed to replay webhook delivery %d: %v", deliveryID, err)
+		return webhookError(err, "Failed to replay delivery")
+	}
+
+	return c.JSON(http.StatusAccepted, replay)
+}
+
+// webhookDeliveryParams parses the webhook and delivery IDs in the path
+func webhookDeliveryParams(c echo.Context) (int64, int64, error) {
+	webhookID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "Invalid webhook ID")
+	}
+	deliveryID, err := strconv.ParseInt(c.Param("delivery_id"), 10, 64)
+	if err != nil {
+		return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "Invalid delivery ID")
+	}
+	return webhookID, deliveryID, nil
+}
+
+// webhookError maps webhook domain errors to HTTP errors
+func webhookError(err error, fallback string) error {
+	switch {
+	case errors.Is(err, domain.ErrWebhookNotFound), errors.Is(err, domain.ErrWebhookDeliveryNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, domain.ErrInvalidWebhookURL), errors.Is(err, domain.ErrUnknownWebhookEvent), errors.Is(err, domain.ErrNoWebhookEvents):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, fallback)
+}
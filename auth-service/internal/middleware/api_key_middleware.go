@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+const apiKeyScheme = "ApiKey "
+
+// APIKeyAuthenticator resolves a plaintext API key to the principal it acts as
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(key string) (*domain.APIKeyPrincipal, error)
+}
+
+// APIKeyMiddleware authenticates requests sent with "Authorization: ApiKey
+// <key>" and sets the same context values as JWTMiddleware, plus the key's
+// scopes. Requests using any other scheme are passed on to fallback.
+func APIKeyMiddleware(authenticator APIKeyAuthenticator, fallback echo.MiddlewareFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		jwtNext := fallback(next)
+		return func(c echo.Context) error {
+			authorization := c.Request().Header.Get("Authorization")
+			if !strings.HasPrefix(authorization, apiKeyScheme) {
+				return jwtNext(c)
+			}
+
+			principal, err := authenticator.AuthenticateAPIKey(strings.TrimSpace(strings.TrimPrefix(authorization, apiKeyScheme)))
+			if err != nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, "Invalid API key")
+			}
+
+			c.Set("user_id", principal.User.ID)
+			c.Set("role", principal.GlobalRole())
+			c.Set("email", principal.User.Email)
+			c.Set("api_key_id", principal.Key.ID)
+			c.Set("scopes", principal.Key.Scopes)
+			if principal.Membership != nil {
+				c.Set("org_id", principal.Membership.OrgID)
+				c.Set("org_role", principal.Membership.Role)
+			}
+			return next(c)
+		}
+	}
+}
+
+// RequireScope limits API key and OAuth client requests to credentials
+// granted scope. Requests authenticated as a user (JWT) carry the user's full
+// rights and pass.
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			scopes, restricted := c.Get("scopes").([]string)
+			if !restricted {
+				return next(c)
+			}
+
+			for _, granted := range scopes {
+				if granted == scope {
+					return next(c)
+				}
+			}
+			return echo.NewHTTPError(http.StatusForbidden, "Credentials are missing the "+scope+" scope")
+		}
+	}
+}
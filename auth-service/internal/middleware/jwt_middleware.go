@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"errors"
 	"time"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/sales-tracker/auth-service/internal/config"
@@ -8,6 +9,7 @@ import (
 	"github.com/sales-tracker/auth-service/internal/domain"
 	"github.com/sirupsen/logrus"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
@@ -57,7 +59,26 @@ func CORS() echo.MiddlewareFunc {
 	}
 }
 
-func JWTMiddleware(config *config.Config) echo.MiddlewareFunc {
+// AccountFinder looks up the account a user token was issued to
+type AccountFinder interface {
+	FindUserByID(userID int64) (*domain.User, error)
+}
+
+// JWTMiddleware authenticates requests carrying a token signed by this
+// service. User tokens do not expire, so the account is looked up on every
+// request and tokens of deactivated accounts, or of accounts scheduled for
+// deletion, are rejected.
+func JWTMiddleware(config *config.Config, accounts AccountFinder) echo.MiddlewareFunc {
+	return jwtMiddleware(config, accounts, false)
+}
+
+// PendingDeletionJWTMiddleware is JWTMiddleware that also accepts tokens of
+// accounts scheduled for deletion, for the route that cancels the deletion
+func PendingDeletionJWTMiddleware(config *config.Config, accounts AccountFinder) echo.MiddlewareFunc {
+	return jwtMiddleware(config, accounts, true)
+}
+
+func jwtMiddleware(config *config.Config, accounts AccountFinder, allowPendingDeletion bool) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			authorization := c.Request().Header.Get("Authorization")
@@ -76,9 +97,30 @@ func JWTMiddleware(config *config.Config) echo.MiddlewareFunc {
 			}
 
 			if token.Valid {
+				// Tokens issued to an OAuth client alone carry no user
+				if claims.UserID != 0 {
+					user, err := accounts.FindUserByID(claims.UserID)
+					if err != nil {
+						logrus.Warnf("Rejected token of user %d: %v", claims.UserID, err)
+						return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token")
+					}
+					if !user.IsActive {
+						return echo.NewHTTPError(http.StatusUnauthorized, "Account is disabled")
+					}
+					if user.DeletedAt != nil && !allowPendingDeletion {
+						return echo.NewHTTPError(http.StatusUnauthorized, "Account is scheduled for deletion")
+					}
+				}
+
 				c.Set("user_id", claims.UserID)
 				c.Set("role", claims.Role)
 				c.Set("email", claims.Email)
+				c.Set("org_id", claims.OrgID)
+				c.Set("org_role", claims.OrgRole)
+				if claims.ClientID != "" {
+					c.Set("client_id", claims.ClientID)
+					c.Set("scopes", strings.Fields(claims.Scope))
+				}
 				return next(c)
 			}
 
@@ -87,6 +129,58 @@ func JWTMiddleware(config *config.Config) echo.MiddlewareFunc {
 	}
 }
 
+// RequireUserToken rejects access tokens issued to OAuth clients on routes
+// that act on behalf of the calling user
+func RequireUserToken() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if _, isClient := c.Get("client_id").(string); isClient {
+				return echo.NewHTTPError(http.StatusForbidden, "Client tokens cannot be used on user endpoints")
+			}
+			return next(c)
+		}
+	}
+}
+
+// MembershipFinder looks up a user's current membership of an organization
+type MembershipFinder interface {
+	FindMembership(userID, orgID int64) (*domain.Membership, error)
+}
+
+// OrgRoleMiddleware allows the request only if the token is scoped to the
+// organization named by the :org_id path parameter and the caller is still
+// a member with one of allowedRoles. User tokens do not expire, so the role
+// is read from the membership rather than the org_role claim, and org_role
+// is replaced with it for the handlers.
+func OrgRoleMiddleware(memberships MembershipFinder, allowedRoles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			orgID, _ := c.Get("org_id").(int64)
+			if orgID == 0 || strconv.FormatInt(orgID, 10) != c.Param("org_id") {
+				return echo.NewHTTPError(http.StatusForbidden, "Token is not scoped to this organization")
+			}
+
+			userID, _ := c.Get("user_id").(int64)
+			membership, err := memberships.FindMembership(userID, orgID)
+			if errors.Is(err, domain.ErrMembershipNotFound) {
+				return echo.NewHTTPError(http.StatusForbidden, "Not a member of this organization")
+			}
+			if err != nil {
+				logrus.Errorf("Failed to check membership of user %d in organization %d: %v", userID, orgID, err)
+				return echo.NewHTTPError(http.StatusInternalServerError, "Failed to check membership")
+			}
+			c.Set("org_role", membership.Role)
+
+			for _, allowedRole := range allowedRoles {
+				if membership.Role == allowedRole {
+					return next(c)
+				}
+			}
+			return echo.NewHTTPError(http.StatusForbidden, "Insufficient permissions")
+		}
+	}
+}
+
 func RoleMiddleware(allowedRoles ...string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
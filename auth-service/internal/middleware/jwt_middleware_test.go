@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type fakeAccountFinder map[int64]*domain.User
+
+func (f fakeAccountFinder) FindUserByID(userID int64) (*domain.User, error) {
+	if user, ok := f[userID]; ok {
+		return user, nil
+	}
+	return nil, errors.New("user not found")
+}
+
+func TestJWTMiddlewareChecksAccountStatus(t *testing.T) {
+	cfg := &config.Config{JWTSecret: "test-secret"}
+	deletedAt := time.Now()
+	accounts := fakeAccountFinder{
+		1: {ID: 1, IsActive: true},
+		2: {ID: 2, IsActive: false},
+		3: {ID: 3, IsActive: true, DeletedAt: &deletedAt},
+	}
+
+	e := echo.New()
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusNoContent) }
+	e.GET("/auth/me", ok, JWTMiddleware(cfg, accounts))
+	e.POST("/auth/me/restore", ok, PendingDeletionJWTMiddleware(cfg, accounts))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		claims *domain.JWTClaims
+		want   int
+	}{
+		{name: "active user", method: http.MethodGet, path: "/auth/me", claims: &domain.JWTClaims{UserID: 1}, want: http.StatusNoContent},
+		{name: "deactivated user", method: http.MethodGet, path: "/auth/me", claims: &domain.JWTClaims{UserID: 2}, want: http.StatusUnauthorized},
+		{name: "user scheduled for deletion", method: http.MethodGet, path: "/auth/me", claims: &domain.JWTClaims{UserID: 3}, want: http.StatusUnauthorized},
+		{name: "unknown user", method: http.MethodGet, path: "/auth/me", claims: &domain.JWTClaims{UserID: 4}, want: http.StatusUnauthorized},
+		{name: "client token", method: http.MethodGet, path: "/auth/me", claims: &domain.JWTClaims{ClientID: "reporting"}, want: http.StatusNoContent},
+		{name: "restore while scheduled for deletion", method: http.MethodPost, path: "/auth/me/restore", claims: &domain.JWTClaims{UserID: 3}, want: http.StatusNoContent},
+		{name: "restore while deactivated", method: http.MethodPost, path: "/auth/me/restore", claims: &domain.JWTClaims{UserID: 2}, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, tt.claims).SignedString([]byte(cfg.JWTSecret))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+const bearerScheme = "Bearer "
+
+// SCIMMiddleware authenticates directory provisioning requests. Directories
+// send "Authorization: Bearer <key>", where the key must be an
+// organization-owned API key with the scim scope whose creator is still an
+// admin there; that organization is the one being provisioned. Failures are
+// SCIM error responses.
+func SCIMMiddleware(authenticator APIKeyAuthenticator) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			authorization := c.Request().Header.Get("Authorization")
+			if !strings.HasPrefix(authorization, bearerScheme) {
+				c.Response().Header().Set("WWW-Authenticate", `Bearer realm="scim"`)
+				return scimAuthError(c, http.StatusUnauthorized, "Bearer token required")
+			}
+
+			principal, err := authenticator.AuthenticateAPIKey(strings.TrimSpace(strings.TrimPrefix(authorization, bearerScheme)))
+			if err != nil {
+				c.Response().Header().Set("WWW-Authenticate", `Bearer realm="scim", error="invalid_token"`)
+				return scimAuthError(c, http.StatusUnauthorized, "Invalid token")
+			}
+			if principal.Membership == nil || principal.Membership.Role != domain.OrgRoleAdmin || !principal.Key.HasScope(domain.SCIMScope) {
+				return scimAuthError(c, http.StatusForbidden, "Token must be an organization API key with the "+domain.SCIMScope+" scope")
+			}
+
+			c.Set("user_id", principal.User.ID)
+			c.Set("api_key_id", principal.Key.ID)
+			c.Set("scopes", principal.Key.Scopes)
+			c.Set("org_id", principal.Membership.OrgID)
+			c.Set("org_role", principal.Membership.Role)
+			return next(c)
+		}
+	}
+}
+
+func scimAuthError(c echo.Context, status int, detail string) error {
+	body, err := json.Marshal(domain.SCIMErrorResponse{
+		Schemas: []string{domain.SCIMSchemaError},
+		Status:  strconv.Itoa(status),
+		Detail:  detail,
+	})
+	if err != nil {
+		return err
+	}
+	return c.Blob(status, "application/scim+json", body)
+}
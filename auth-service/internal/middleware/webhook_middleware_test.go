@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestWebhookBasicAuth(t *testing.T) {
+	e := echo.New()
+	e.POST("/auth/webhooks/email", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}, WebhookBasicAuth("provider", "webhook-secret"))
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		noAuth   bool
+		want     int
+	}{
+		{name: "valid credentials", user: "provider", password: "webhook-secret", want: http.StatusNoContent},
+		{name: "wrong password", user: "provider", password: "wrong", want: http.StatusUnauthorized},
+		{name: "wrong user", user: "someone", password: "webhook-secret", want: http.StatusUnauthorized},
+		{name: "empty credentials", user: "", password: "", want: http.StatusUnauthorized},
+		{name: "no credentials", noAuth: true, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/auth/webhooks/email", nil)
+			if !tt.noAuth {
+				req.SetBasicAuth(tt.user, tt.password)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type APIKeyRepository interface {
+	CreateAPIKey(key *domain.APIKey) error
+	FindAPIKeyByID(keyID int64) (*domain.APIKey, error)
+	FindAPIKeyByPrefix(prefix string) (*domain.APIKey, error)
+	ListAPIKeysByUser(userID int64) ([]*domain.APIKey, error)
+	ListAPIKeysByOrg(orgID int64) ([]*domain.APIKey, error)
+	RevokeAPIKey(keyID int64) error
+	TouchAPIKey(keyID int64, usedAt time.Time) error
+}
@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type AuditRepository interface {
+	CreateEvent(event *domain.AuditEvent) error
+	ListEvents(filter domain.AuditEventFilter) ([]*domain.AuditEvent, error)
+	ListChain(afterID int64, limit int) ([]*domain.AuditEvent, error)
+	LatestChainHead() (*domain.AuditEvent, error)
+	RedactUserEvents(userID int64, addresses []string, replacement string, at time.Time) error
+}
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type EmailOutboxRepository interface {
+	EnqueueEmail(email *domain.OutboxEmail) error
+	// ClaimDueEmails takes up to limit pending emails due at now for
+	// delivery, counting the attempt and hiding them from other workers
+	// until now+lease, after which an unfinished attempt is retried
+	ClaimDueEmails(now time.Time, lease time.Duration, limit int) ([]*domain.OutboxEmail, error)
+	// MarkEmailSent records the delivery and clears the template data,
+	// which holds single-use links
+	MarkEmailSent(emailID int64, sentAt time.Time) error
+	// MarkEmailFailed records a failed attempt. Emails are retried at
+	// nextAttemptAt, or dead-lettered, clearing their data, when dead is set.
+	MarkEmailFailed(emailID int64, lastError string, nextAttemptAt time.Time, dead bool) error
+	FindEmailByID(emailID int64) (*domain.OutboxEmail, error)
+	ListEmails(filter domain.OutboxEmailFilter) ([]*domain.OutboxEmail, error)
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type FederatedIdentityRepository interface {
+	CreateLoginState(state *domain.FederatedLoginState) error
+	ConsumeLoginState(stateHash string, now time.Time) (*domain.FederatedLoginState, error)
+	FindIdentity(provider, subject string) (*domain.FederatedIdentity, error)
+	CreateIdentity(identity *domain.FederatedIdentity) error
+	TouchIdentity(identityID int64, email string, loginAt time.Time) error
+	ListIdentitiesByUser(userID int64) ([]*domain.FederatedIdentity, error)
+}
@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type InvitationRepository interface {
+	CreateInvitation(invitation *domain.Invitation) error
+	FindInvitationByID(orgID, invitationID int64) (*domain.Invitation, error)
+	FindInvitationByToken(token string) (*domain.Invitation, error)
+	FindPendingInvitation(orgID int64, email string) (*domain.Invitation, error)
+	ListInvitationsByOrg(orgID int64) ([]*domain.Invitation, error)
+	RenewInvitation(invitationID int64, token string, expiresAt time.Time) error
+	RevokeInvitation(invitationID int64) error
+	AcceptInvitation(invitation *domain.Invitation) error
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type OAuthAuthorizationRepository interface {
+	CreateAuthorizationCode(code *domain.AuthorizationCode) error
+	ConsumeAuthorizationCode(codeHash, clientID string, now time.Time) (*domain.AuthorizationCode, error)
+	SaveConsent(consent *domain.OAuthConsent) error
+	FindConsent(userID int64, clientID string) (*domain.OAuthConsent, error)
+	ListConsentsByUser(userID int64) ([]*domain.OAuthConsent, error)
+	DeleteConsent(userID int64, clientID string) error
+}
@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type OAuthClientRepository interface {
+	CreateOAuthClient(client *domain.OAuthClient) error
+	FindOAuthClientByClientID(clientID string) (*domain.OAuthClient, error)
+	ListOAuthClients() ([]*domain.OAuthClient, error)
+	RotateOAuthClientSecret(id int64, secretHash string, previousExpiresAt time.Time) error
+	RevokeOAuthClient(id int64) error
+}
@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type OrganizationRepository interface {
+	CreateOrganization(org *domain.Organization, ownerID int64) error
+	FindOrganizationByID(orgID int64) (*domain.Organization, error)
+	FindMembership(userID, orgID int64) (*domain.Membership, error)
+	ListMembershipsByUser(userID int64) ([]*domain.Membership, error)
+	ListMembershipsByOrg(orgID int64) ([]*domain.Membership, error)
+	CountMembersWithRole(orgID int64, role string) (int, error)
+	CreateMembership(membership *domain.Membership) error
+	UpdateMembershipRole(userID, orgID int64, role string) error
+	DeleteMembership(userID, orgID int64) error
+	SetManager(userID, orgID int64, managerID *int64) error
+	ListReports(orgID, managerID int64) ([]*domain.Report, error)
+}
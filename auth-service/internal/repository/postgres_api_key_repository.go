@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type postgresAPIKeyRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresAPIKeyRepository(db *sql.DB) APIKeyRepository {
+	return &postgresAPIKeyRepository{db: db}
+}
+
+const apiKeyColumns = `id, user_id, org_id, name, prefix, key_hash, scopes, expires_at, last_used_at, revoked_at, created_at`
+
+func (r *postgresAPIKeyRepository) CreateAPIKey(key *domain.APIKey) error {
+	key.CreatedAt = time.Now()
+	query := `INSERT INTO api_keys (user_id, org_id, name, prefix, key_hash, scopes, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+
+	return r.db.QueryRow(query,
+		key.UserID,
+		key.OrgID,
+		key.Name,
+		key.Prefix,
+		key.KeyHash,
+		pq.Array(key.Scopes),
+		key.ExpiresAt,
+		key.CreatedAt,
+	).Scan(&key.ID)
+}
+
+func (r *postgresAPIKeyRepository) FindAPIKeyByID(keyID int64) (*domain.APIKey, error) {
+	return r.findOne(`SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`, keyID)
+}
+
+func (r *postgresAPIKeyRepository) FindAPIKeyByPrefix(prefix string) (*domain.APIKey, error) {
+	return r.findOne(`SELECT `+apiKeyColumns+` FROM api_keys WHERE prefix = $1`, prefix)
+}
+
+func (r *postgresAPIKeyRepository) ListAPIKeysByUser(userID int64) ([]*domain.APIKey, error) {
+	rows, err := r.db.Query(`SELECT `+apiKeyColumns+` FROM api_keys WHERE user_id = $1 AND org_id IS NULL ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanAPIKeys(rows)
+}
+
+func (r *postgresAPIKeyRepository) ListAPIKeysByOrg(orgID int64) ([]*domain.APIKey, error) {
+	rows, err := r.db.Query(`SELECT `+apiKeyColumns+` FROM api_keys WHERE org_id = $1 ORDER BY created_at DESC`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	return scanAPIKeys(rows)
+}
+
+func (r *postgresAPIKeyRepository) RevokeAPIKey(keyID int64) error {
+	result, err := r.db.Exec(`UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`, time.Now(), keyID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return domain.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// TouchAPIKey records a use of the key. To keep hot keys from writing on
+// every request, last_used_at is only advanced once a minute.
+func (r *postgresAPIKeyRepository) TouchAPIKey(keyID int64, usedAt time.Time) error {
+	query := `UPDATE api_keys SET last_used_at = $1
+		WHERE id = $2 AND (last_used_at IS NULL OR last_used_at < $3)`
+
+	_, err := r.db.Exec(query, usedAt, keyID, usedAt.Add(-time.Minute))
+	return err
+}
+
+func (r *postgresAPIKeyRepository) findOne(query string, args ...interface{}) (*domain.APIKey, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := scanAPIKeys(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, domain.ErrAPIKeyNotFound
+	}
+	return keys[0], nil
+}
+
+func scanAPIKeys(rows *sql.Rows) ([]*domain.APIKey, error) {
+	defer rows.Close()
+
+	var keys []*domain.APIKey
+	for rows.Next() {
+		var key domain.APIKey
+		var orgID sql.NullInt64
+		var expiresAt sql.NullTime
+		var lastUsedAt sql.NullTime
+		var revokedAt sql.NullTime
+
+		err := rows.Scan(
+			&key.ID,
+			&key.UserID,
+			&orgID,
+			&key.Name,
+			&key.Prefix,
+			&key.KeyHash,
+			pq.Array(&key.Scopes),
+			&expiresAt,
+			&lastUsedAt,
+			&revokedAt,
+			&key.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if orgID.Valid {
+			key.OrgID = &orgID.Int64
+		}
+		if expiresAt.Valid {
+			key.ExpiresAt = &expiresAt.Time
+		}
+		if lastUsedAt.Valid {
+			key.LastUsedAt = &lastUsedAt.Time
+		}
+		if revokedAt.Valid {
+			key.RevokedAt = &revokedAt.Time
+		}
+		keys = append(keys, &key)
+	}
+
+	return keys, rows.Err()
+}
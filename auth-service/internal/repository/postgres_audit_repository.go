@@ -0,0 +1,314 @@
+package repository
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type postgresAuditRepository struct {
+	db dbtx
+}
+
+func NewPostgresAuditRepository(db *sql.DB) AuditRepository {
+	return &postgresAuditRepository{db: db}
+}
+
+// auditChainLockID serializes appends so that every event links to the one
+// inserted immediately before it
+const auditChainLockID = 7_201_028
+
+// CreateEvent appends event to the hash chain. The previous hash is read and
+// the new row inserted under a transaction-scoped advisory lock.
+func (r *postgresAuditRepository) CreateEvent(event *domain.AuditEvent) error {
+	return inTx(r.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", auditChainLockID); err != nil {
+			return fmt.Errorf("failed to lock audit chain: %w", err)
+		}
+		return appendAuditEvent(tx, event)
+	})
+}
+
+// appendAuditEvent links event to the chain head and inserts it. The caller
+// must hold the audit chain lock.
+func appendAuditEvent(tx *sql.Tx, event *domain.AuditEvent) error {
+	metadata, err := json.Marshal(event.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit metadata: %w", err)
+	}
+	if event.Metadata == nil {
+		metadata = []byte("{}")
+	}
+
+	// Postgres stores microseconds, so hash exactly what will be read back
+	event.CreatedAt = event.CreatedAt.UTC().Truncate(time.Microsecond)
+
+	var prevHash sql.NullString
+	err = tx.QueryRow("SELECT hash FROM audit_events WHERE hash IS NOT NULL ORDER BY id DESC LIMIT 1").Scan(&prevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to read audit chain head: %w", err)
+	}
+
+	event.PrevHash = prevHash.String
+	if event.MetadataHash, err = event.ComputeMetadataHash(); err != nil {
+		return fmt.Errorf("failed to hash audit metadata: %w", err)
+	}
+	if event.Hash, err = event.ComputeHash(); err != nil {
+		return fmt.Errorf("failed to hash audit event: %w", err)
+	}
+
+	query := `INSERT INTO audit_events (event_type, actor_id, subject_id, ip, user_agent, outcome, metadata, created_at, prev_hash, hash, metadata_hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id`
+
+	return tx.QueryRow(query,
+		event.EventType,
+		event.ActorID,
+		event.SubjectID,
+		event.IP,
+		event.UserAgent,
+		event.Outcome,
+		metadata,
+		event.CreatedAt,
+		event.PrevHash,
+		event.Hash,
+		event.MetadataHash,
+	).Scan(&event.ID)
+}
+
+// RedactUserEvents replaces every top-level metadata value equal to one of
+// addresses, ignoring case, with replacement in the events userID performed
+// or was the subject of. An audit.redacted event committing to the new
+// metadata of each changed event is appended in the same transaction, so
+// that the chain still vouches for the redacted events. Events recorded
+// before metadata was hashed separately are left untouched.
+func (r *postgresAuditRepository) RedactUserEvents(userID int64, addresses []string, replacement string, at time.Time) error {
+	return inTx(r.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", auditChainLockID); err != nil {
+			return fmt.Errorf("failed to lock audit chain: %w", err)
+		}
+
+		query := `SELECT ` + auditEventColumns + ` FROM audit_events
+			WHERE (subject_id = $1 OR actor_id = $1) AND metadata_hash IS NOT NULL AND event_type <> $2
+			ORDER BY id ASC FOR UPDATE`
+
+		rows, err := tx.Query(query, userID, domain.AuditEventRedacted)
+		if err != nil {
+			return err
+		}
+		var events []*domain.AuditEvent
+		for rows.Next() {
+			event, err := scanAuditEvent(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			events = append(events, event)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		metadataHashes := make(map[int64]string)
+		for _, event := range events {
+			if !redactMetadata(event.Metadata, addresses, replacement) {
+				continue
+			}
+
+			metadata, err := json.Marshal(event.Metadata)
+			if err != nil {
+				return fmt.Errorf("failed to encode audit metadata: %w", err)
+			}
+			if metadataHashes[event.ID], err = event.ComputeMetadataHash(); err != nil {
+				return fmt.Errorf("failed to hash audit metadata: %w", err)
+			}
+
+			_, err = tx.Exec("UPDATE audit_events SET metadata = $1, redacted_at = $2 WHERE id = $3", metadata, at, event.ID)
+			if err != nil {
+				return fmt.Errorf("failed to redact audit event %d: %w", event.ID, err)
+			}
+		}
+
+		if len(metadataHashes) == 0 {
+			return nil
+		}
+		return appendAuditEvent(tx, domain.NewAuditRedactionEvent(userID, metadataHashes, at))
+	})
+}
+
+// redactMetadata replaces the string values of metadata that match one of
+// addresses and reports whether any did
+func redactMetadata(metadata map[string]interface{}, addresses []string, replacement string) bool {
+	redacted := false
+	for key, value := range metadata {
+		text, ok := value.(string)
+		if !ok {
+			continue
+		}
+		for _, address := range addresses {
+			if address != "" && strings.EqualFold(text, address) {
+				metadata[key] = replacement
+				redacted = true
+				break
+			}
+		}
+	}
+	return redacted
+}
+
+func (r *postgresAuditRepository) ListEvents(filter domain.AuditEventFilter) ([]*domain.AuditEvent, error) {
+	var conditions []string
+	var args []interface{}
+
+	addCondition := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.EventType != "" {
+		addCondition("event_type = $%d", filter.EventType)
+	}
+	if filter.ActorID != nil {
+		addCondition("actor_id = $%d", *filter.ActorID)
+	}
+	if filter.SubjectID != nil {
+		addCondition("subject_id = $%d", *filter.SubjectID)
+	}
+	if filter.Outcome != "" {
+		addCondition("outcome = $%d", filter.Outcome)
+	}
+	if !filter.From.IsZero() {
+		addCondition("created_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("created_at < $%d", filter.To)
+	}
+	if filter.Cursor > 0 {
+		addCondition("id < $%d", filter.Cursor)
+	}
+
+	query := `SELECT ` + auditEventColumns + ` FROM audit_events`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*domain.AuditEvent
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// ListChain returns up to limit events with an ID greater than afterID in
+// chain order
+func (r *postgresAuditRepository) ListChain(afterID int64, limit int) ([]*domain.AuditEvent, error) {
+	query := `SELECT ` + auditEventColumns + ` FROM audit_events WHERE id > $1 ORDER BY id ASC LIMIT $2`
+
+	rows, err := r.db.Query(query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*domain.AuditEvent
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// LatestChainHead returns the most recent hashed event, or nil if the chain is empty
+func (r *postgresAuditRepository) LatestChainHead() (*domain.AuditEvent, error) {
+	query := `SELECT ` + auditEventColumns + ` FROM audit_events WHERE hash IS NOT NULL ORDER BY id DESC LIMIT 1`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	return scanAuditEvent(rows)
+}
+
+const auditEventColumns = `id, event_type, actor_id, subject_id, ip, user_agent, outcome, metadata, created_at, prev_hash, hash, metadata_hash, redacted_at`
+
+func scanAuditEvent(rows *sql.Rows) (*domain.AuditEvent, error) {
+	var event domain.AuditEvent
+	var actorID sql.NullInt64
+	var subjectID sql.NullInt64
+	var ip sql.NullString
+	var userAgent sql.NullString
+	var metadata []byte
+	var prevHash sql.NullString
+	var hash sql.NullString
+	var metadataHash sql.NullString
+	var redactedAt sql.NullTime
+
+	err := rows.Scan(
+		&event.ID,
+		&event.EventType,
+		&actorID,
+		&subjectID,
+		&ip,
+		&userAgent,
+		&event.Outcome,
+		&metadata,
+		&event.CreatedAt,
+		&prevHash,
+		&hash,
+		&metadataHash,
+		&redactedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if actorID.Valid {
+		event.ActorID = &actorID.Int64
+	}
+	if subjectID.Valid {
+		event.SubjectID = &subjectID.Int64
+	}
+	event.IP = ip.String
+	event.UserAgent = userAgent.String
+	event.PrevHash = prevHash.String
+	event.Hash = hash.String
+	event.MetadataHash = metadataHash.String
+	if redactedAt.Valid {
+		event.RedactedAt = &redactedAt.Time
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(metadata))
+	decoder.UseNumber()
+	if err := decoder.Decode(&event.Metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode audit metadata for event %d: %w", event.ID, err)
+	}
+
+	return &event, nil
+}
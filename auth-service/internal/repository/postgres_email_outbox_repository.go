@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type postgresEmailOutboxRepository struct {
+	db dbtx
+}
+
+func NewPostgresEmailOutboxRepository(db *sql.DB) EmailOutboxRepository {
+	return &postgresEmailOutboxRepository{db: db}
+}
+
+const outboxEmailColumns = `id, recipient, locale, template, data, status, attempts, next_attempt_at, last_error, sent_at, created_at, updated_at`
+
+func (r *postgresEmailOutboxRepository) EnqueueEmail(email *domain.OutboxEmail) error {
+	data, err := json.Marshal(email.Data)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s email data: %w", email.Template, err)
+	}
+	if email.Data == nil {
+		data = []byte("{}")
+	}
+
+	now := time.Now()
+	query := `INSERT INTO email_outbox (recipient, locale, template, data, status, next_attempt_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6, $6) RETURNING id`
+
+	err = r.db.QueryRow(query,
+		email.Recipient,
+		email.Locale,
+		email.Template,
+		data,
+		domain.OutboxStatusPending,
+		now,
+	).Scan(&email.ID)
+	if err != nil {
+		return err
+	}
+
+	email.Status = domain.OutboxStatusPending
+	email.NextAttemptAt = now
+	email.CreatedAt = now
+	email.UpdatedAt = now
+	return nil
+}
+
+func (r *postgresEmailOutboxRepository) ClaimDueEmails(now time.Time, lease time.Duration, limit int) ([]*domain.OutboxEmail, error) {
+	// SKIP LOCKED lets several instances poll without claiming the same rows
+	query := `UPDATE email_outbox SET attempts = attempts + 1, next_attempt_at = $2, updated_at = $1
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE status = $3 AND next_attempt_at <= $1
+			ORDER BY next_attempt_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + outboxEmailColumns
+
+	rows, err := r.db.Query(query, now, now.Add(lease), domain.OutboxStatusPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanOutboxEmails(rows)
+}
+
+func (r *postgresEmailOutboxRepository) MarkEmailSent(emailID int64, sentAt time.Time) error {
+	_, err := r.db.Exec(`UPDATE email_outbox SET status = $1, data = '{}', sent_at = $2, last_error = '', updated_at = $2 WHERE id = $3`,
+		domain.OutboxStatusSent, sentAt, emailID,
+	)
+	return err
+}
+
+func (r *postgresEmailOutboxRepository) MarkEmailFailed(emailID int64, lastError string, nextAttemptAt time.Time, dead bool) error {
+	status := domain.OutboxStatusPending
+	if dead {
+		status = domain.OutboxStatusDead
+	}
+	// A dead-lettered email is never sent, so its links are dropped with it
+	_, err := r.db.Exec(`UPDATE email_outbox SET status = $1, last_error = $2, next_attempt_at = $3, updated_at = $4,
+		data = CASE WHEN $1 = $6 THEN '{}'::jsonb ELSE data END
+		WHERE id = $5`,
+		status, lastError, nextAttemptAt, time.Now(), emailID, domain.OutboxStatusDead,
+	)
+	return err
+}
+
+func (r *postgresEmailOutboxRepository) FindEmailByID(emailID int64) (*domain.OutboxEmail, error) {
+	rows, err := r.db.Query(`SELECT `+outboxEmailColumns+` FROM email_outbox WHERE id = $1`, emailID)
+	if err != nil {
+		return nil, err
+	}
+	emails, err := scanOutboxEmails(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(emails) == 0 {
+		return nil, domain.ErrOutboxEmailNotFound
+	}
+	return emails[0], nil
+}
+
+func (r *postgresEmailOutboxRepository) ListEmails(filter domain.OutboxEmailFilter) ([]*domain.OutboxEmail, error) {
+	var conditions []string
+	var args []interface{}
+
+	addCondition := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Status != "" {
+		addCondition("status = $%d", filter.Status)
+	}
+	if filter.Recipient != "" {
+		addCondition("LOWER(recipient) = LOWER($%d)", filter.Recipient)
+	}
+	if filter.Template != "" {
+		addCondition("template = $%d", filter.Template)
+	}
+	if filter.Cursor > 0 {
+		addCondition("id < $%d", filter.Cursor)
+	}
+
+	query := `SELECT ` + outboxEmailColumns + ` FROM email_outbox`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanOutboxEmails(rows)
+}
+
+func scanOutboxEmails(rows *sql.Rows) ([]*domain.OutboxEmail, error) {
+	defer rows.Close()
+
+	var emails []*domain.OutboxEmail
+	for rows.Next() {
+		email := &domain.OutboxEmail{}
+		var data []byte
+		var sentAt sql.NullTime
+		err := rows.Scan(
+			&email.ID,
+			&email.Recipient,
+			&email.Locale,
+			&email.Template,
+			&data,
+			&email.Status,
+			&email.Attempts,
+			&email.NextAttemptAt,
+			&email.LastError,
+			&sentAt,
+			&email.CreatedAt,
+			&email.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &email.Data); err != nil {
+			return nil, fmt.Errorf("failed to decode data of outbox email %d: %w", email.ID, err)
+		}
+		if sentAt.Valid {
+			email.SentAt = &sentAt.Time
+		}
+		emails = append(emails, email)
+	}
+
+	return emails, rows.Err()
+}
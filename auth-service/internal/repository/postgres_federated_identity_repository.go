@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type postgresFederatedIdentityRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresFederatedIdentityRepository(db *sql.DB) FederatedIdentityRepository {
+	return &postgresFederatedIdentityRepository{db: db}
+}
+
+func (r *postgresFederatedIdentityRepository) CreateLoginState(state *domain.FederatedLoginState) error {
+	state.CreatedAt = time.Now()
+	query := `INSERT INTO federated_login_states (state_hash, provider, nonce, code_verifier, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+
+	_, err := r.db.Exec(query, state.StateHash, state.Provider, state.Nonce, state.CodeVerifier, state.ExpiresAt, state.CreatedAt)
+	return err
+}
+
+// ConsumeLoginState deletes the state and returns it, so each state can only
+// complete one login. Expired rows are cleaned up on the way.
+func (r *postgresFederatedIdentityRepository) ConsumeLoginState(stateHash string, now time.Time) (*domain.FederatedLoginState, error) {
+	if _, err := r.db.Exec(`DELETE FROM federated_login_states WHERE expires_at <= $1`, now); err != nil {
+		return nil, err
+	}
+
+	query := `DELETE FROM federated_login_states WHERE state_hash = $1
+		RETURNING state_hash, provider, nonce, code_verifier, expires_at, created_at`
+
+	var state domain.FederatedLoginState
+	err := r.db.QueryRow(query, stateHash).Scan(
+		&state.StateHash,
+		&state.Provider,
+		&state.Nonce,
+		&state.CodeVerifier,
+		&state.ExpiresAt,
+		&state.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrInvalidLoginState
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+const federatedIdentityColumns = `id, user_id, provider, subject, email, created_at, last_login_at`
+
+func (r *postgresFederatedIdentityRepository) FindIdentity(provider, subject string) (*domain.FederatedIdentity, error) {
+	rows, err := r.db.Query(`SELECT `+federatedIdentityColumns+` FROM federated_identities WHERE provider = $1 AND subject = $2`, provider, subject)
+	if err != nil {
+		return nil, err
+	}
+	identities, err := scanFederatedIdentities(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(identities) == 0 {
+		return nil, domain.ErrIdentityNotFound
+	}
+	return identities[0], nil
+}
+
+func (r *postgresFederatedIdentityRepository) CreateIdentity(identity *domain.FederatedIdentity) error {
+	identity.CreatedAt = time.Now()
+	identity.LastLoginAt = &identity.CreatedAt
+	query := `INSERT INTO federated_identities (user_id, provider, subject, email, created_at, last_login_at)
+		VALUES ($1, $2, $3, $4, $5, $5) RETURNING id`
+
+	return r.db.QueryRow(query,
+		identity.UserID,
+		identity.Provider,
+		identity.Subject,
+		sql.NullString{String: identity.Email, Valid: identity.Email != ""},
+		identity.CreatedAt,
+	).Scan(&identity.ID)
+}
+
+// TouchIdentity records a login and the email the provider currently reports
+func (r *postgresFederatedIdentityRepository) TouchIdentity(identityID int64, email string, loginAt time.Time) error {
+	query := `UPDATE federated_identities SET email = COALESCE($1, email), last_login_at = $2 WHERE id = $3`
+	_, err := r.db.Exec(query, sql.NullString{String: email, Valid: email != ""}, loginAt, identityID)
+	return err
+}
+
+func (r *postgresFederatedIdentityRepository) ListIdentitiesByUser(userID int64) ([]*domain.FederatedIdentity, error) {
+	rows, err := r.db.Query(`SELECT `+federatedIdentityColumns+` FROM federated_identities WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanFederatedIdentities(rows)
+}
+
+func scanFederatedIdentities(rows *sql.Rows) ([]*domain.FederatedIdentity, error) {
+	defer rows.Close()
+
+	var identities []*domain.FederatedIdentity
+	for rows.Next() {
+		var identity domain.FederatedIdentity
+		var email sql.NullString
+		var lastLoginAt sql.NullTime
+
+		err := rows.Scan(
+			&identity.ID,
+			&identity.UserID,
+			&identity.Provider,
+			&identity.Subject,
+			&email,
+			&identity.CreatedAt,
+			&lastLoginAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		identity.Email = email.String
+		if lastLoginAt.Valid {
+			identity.LastLoginAt = &lastLoginAt.Time
+		}
+		identities = append(identities, &identity)
+	}
+
+	return identities, rows.Err()
+}
@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type postgresInvitationRepository struct {
+	db dbtx
+}
+
+func NewPostgresInvitationRepository(db *sql.DB) InvitationRepository {
+	return &postgresInvitationRepository{db: db}
+}
+
+const invitationColumns = `i.id, i.org_id, o.name, i.email, i.role, i.token, i.invited_by, i.expires_at, i.accepted_at, i.revoked_at, i.created_at, i.updated_at`
+
+func (r *postgresInvitationRepository) CreateInvitation(invitation *domain.Invitation) error {
+	now := time.Now()
+	query := `INSERT INTO invitations (org_id, email, role, token, invited_by, expires_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7) RETURNING id`
+
+	err := r.db.QueryRow(query,
+		invitation.OrgID,
+		invitation.Email,
+		invitation.Role,
+		invitation.Token,
+		invitation.InvitedBy,
+		invitation.ExpiresAt,
+		now,
+	).Scan(&invitation.ID)
+	if err != nil {
+		return err
+	}
+
+	invitation.CreatedAt = now
+	invitation.UpdatedAt = now
+	return nil
+}
+
+func (r *postgresInvitationRepository) FindInvitationByID(orgID, invitationID int64) (*domain.Invitation, error) {
+	query := `SELECT ` + invitationColumns + `
+		FROM invitations i JOIN organizations o ON o.id = i.org_id
+		WHERE i.org_id = $1 AND i.id = $2`
+
+	return r.findOne(query, orgID, invitationID)
+}
+
+func (r *postgresInvitationRepository) FindInvitationByToken(token string) (*domain.Invitation, error) {
+	query := `SELECT ` + invitationColumns + `
+		FROM invitations i JOIN organizations o ON o.id = i.org_id
+		WHERE i.token = $1`
+
+	return r.findOne(query, token)
+}
+
+// FindPendingInvitation returns the unexpired, unanswered invitation for
+// email in the organization, if there is one
+func (r *postgresInvitationRepository) FindPendingInvitation(orgID int64, email string) (*domain.Invitation, error) {
+	query := `SELECT ` + invitationColumns + `
+		FROM invitations i JOIN organizations o ON o.id = i.org_id
+		WHERE i.org_id = $1 AND LOWER(i.email) = LOWER($2)
+			AND i.accepted_at IS NULL AND i.revoked_at IS NULL AND i.expires_at > $3
+		ORDER BY i.id DESC LIMIT 1`
+
+	return r.findOne(query, orgID, email, time.Now())
+}
+
+func (r *postgresInvitationRepository) ListInvitationsByOrg(orgID int64) ([]*domain.Invitation, error) {
+	query := `SELECT ` + invitationColumns + `
+		FROM invitations i JOIN organizations o ON o.id = i.org_id
+		WHERE i.org_id = $1
+		ORDER BY i.created_at DESC`
+
+	rows, err := r.db.Query(query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	return scanInvitations(rows)
+}
+
+func (r *postgresInvitationRepository) RenewInvitation(invitationID int64, token string, expiresAt time.Time) error {
+	query := `UPDATE invitations SET token = $1, expires_at = $2, updated_at = $3
+		WHERE id = $4 AND accepted_at IS NULL AND revoked_at IS NULL`
+
+	result, err := r.db.Exec(query, token, expiresAt, time.Now(), invitationID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return domain.ErrInvitationNotPending
+	}
+	return nil
+}
+
+func (r *postgresInvitationRepository) RevokeInvitation(invitationID int64) error {
+	now := time.Now()
+	query := `UPDATE invitations SET revoked_at = $1, updated_at = $1
+		WHERE id = $2 AND accepted_at IS NULL AND revoked_at IS NULL`
+
+	result, err := r.db.Exec(query, now, invitationID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return domain.ErrInvitationNotPending
+	}
+	return nil
+}
+
+// AcceptInvitation marks the invitation accepted, failing with
+// ErrInvitationNotPending unless it is still pending
+func (r *postgresInvitationRepository) AcceptInvitation(invitation *domain.Invitation) error {
+	now := time.Now()
+	query := `UPDATE invitations SET accepted_at = $1, updated_at = $1
+		WHERE id = $2 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > $1`
+
+	result, err := r.db.Exec(query, now, invitation.ID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return domain.ErrInvitationNotPending
+	}
+
+	invitation.AcceptedAt = &now
+	return nil
+}
+
+func (r *postgresInvitationRepository) findOne(query string, args ...interface{}) (*domain.Invitation, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	invitations, err := scanInvitations(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(invitations) == 0 {
+		return nil, domain.ErrInvitationNotFound
+	}
+	return invitations[0], nil
+}
+
+func scanInvitations(rows *sql.Rows) ([]*domain.Invitation, error) {
+	defer rows.Close()
+
+	var invitations []*domain.Invitation
+	for rows.Next() {
+		var invitation domain.Invitation
+		var invitedBy sql.NullInt64
+		var acceptedAt sql.NullTime
+		var revokedAt sql.NullTime
+
+		err := rows.Scan(
+			&invitation.ID,
+			&invitation.OrgID,
+			&invitation.OrgName,
+			&invitation.Email,
+			&invitation.Role,
+			&invitation.Token,
+			&invitedBy,
+			&invitation.ExpiresAt,
+			&acceptedAt,
+			&revokedAt,
+			&invitation.CreatedAt,
+			&invitation.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if invitedBy.Valid {
+			invitation.InvitedBy = &invitedBy.Int64
+		}
+		if acceptedAt.Valid {
+			invitation.AcceptedAt = &acceptedAt.Time
+		}
+		if revokedAt.Valid {
+			invitation.RevokedAt = &revokedAt.Time
+		}
+		invitations = append(invitations, &invitation)
+	}
+
+	return invitations, rows.Err()
+}
@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type postgresOAuthAuthorizationRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresOAuthAuthorizationRepository(db *sql.DB) OAuthAuthorizationRepository {
+	return &postgresOAuthAuthorizationRepository{db: db}
+}
+
+func (r *postgresOAuthAuthorizationRepository) CreateAuthorizationCode(code *domain.AuthorizationCode) error {
+	code.CreatedAt = time.Now()
+	query := `INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scopes, nonce,
+		code_challenge, code_challenge_method, auth_time, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+
+	_, err := r.db.Exec(query,
+		code.CodeHash,
+		code.ClientID,
+		code.UserID,
+		code.RedirectURI,
+		pq.Array(code.Scopes),
+		sql.NullString{String: code.Nonce, Valid: code.Nonce != ""},
+		code.CodeChallenge,
+		code.CodeChallengeMethod,
+		code.AuthTime,
+		code.ExpiresAt,
+		code.CreatedAt,
+	)
+	return err
+}
+
+// ConsumeAuthorizationCode marks the code issued to clientID as used and
+// returns it. The update is conditional, so of two concurrent redemptions
+// only one succeeds, and a code presented by another client is left intact.
+// Expired, unknown, already used and other clients' codes are all
+// domain.ErrInvalidGrant.
+func (r *postgresOAuthAuthorizationRepository) ConsumeAuthorizationCode(codeHash, clientID string, now time.Time) (*domain.AuthorizationCode, error) {
+	query := `UPDATE oauth_authorization_codes SET consumed_at = $1
+		WHERE code_hash = $2 AND client_id = $3 AND consumed_at IS NULL AND expires_at > $1
+		RETURNING code_hash, client_id, user_id, redirect_uri, scopes, nonce,
+			code_challenge, code_challenge_method, auth_time, expires_at, consumed_at, created_at`
+
+	var code domain.AuthorizationCode
+	var nonce sql.NullString
+	var consumedAt sql.NullTime
+
+	err := r.db.QueryRow(query, now, codeHash, clientID).Scan(
+		&code.CodeHash,
+		&code.ClientID,
+		&code.UserID,
+		&code.RedirectURI,
+		pq.Array(&code.Scopes),
+		&nonce,
+		&code.CodeChallenge,
+		&code.CodeChallengeMethod,
+		&code.AuthTime,
+		&code.ExpiresAt,
+		&consumedAt,
+		&code.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrInvalidGrant
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	code.Nonce = nonce.String
+	if consumedAt.Valid {
+		code.ConsumedAt = &consumedAt.Time
+	}
+
+	return &code, nil
+}
+
+// SaveConsent creates or replaces the user's consent for the client
+func (r *postgresOAuthAuthorizationRepository) SaveConsent(consent *domain.OAuthConsent) error {
+	now := time.Now()
+	query := `INSERT INTO oauth_consents (user_id, client_id, scopes, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $4)
+		ON CONFLICT (user_id, client_id) DO UPDATE SET scopes = EXCLUDED.scopes, updated_at = EXCLUDED.updated_at
+		RETURNING created_at, updated_at`
+
+	return r.db.QueryRow(query, consent.UserID, consent.ClientID, pq.Array(consent.Scopes), now).
+		Scan(&consent.CreatedAt, &consent.UpdatedAt)
+}
+
+const oauthConsentQuery = `SELECT c.user_id, c.client_id, cl.name, c.scopes, c.created_at, c.updated_at
+	FROM oauth_consents c
+	JOIN oauth_clients cl ON cl.client_id = c.client_id`
+
+func (r *postgresOAuthAuthorizationRepository) FindConsent(userID int64, clientID string) (*domain.OAuthConsent, error) {
+	rows, err := r.db.Query(oauthConsentQuery+` WHERE c.user_id = $1 AND c.client_id = $2`, userID, clientID)
+	if err != nil {
+		return nil, err
+	}
+	consents, err := scanOAuthConsents(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(consents) == 0 {
+		return nil, domain.ErrConsentNotFound
+	}
+	return consents[0], nil
+}
+
+func (r *postgresOAuthAuthorizationRepository) ListConsentsByUser(userID int64) ([]*domain.OAuthConsent, error) {
+	rows, err := r.db.Query(oauthConsentQuery+` WHERE c.user_id = $1 ORDER BY c.updated_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanOAuthConsents(rows)
+}
+
+func (r *postgresOAuthAuthorizationRepository) DeleteConsent(userID int64, clientID string) error {
+	result, err := r.db.Exec(`DELETE FROM oauth_consents WHERE user_id = $1 AND client_id = $2`, userID, clientID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return domain.ErrConsentNotFound
+	}
+	return nil
+}
+
+func scanOAuthConsents(rows *sql.Rows) ([]*domain.OAuthConsent, error) {
+	defer rows.Close()
+
+	var consents []*domain.OAuthConsent
+	for rows.Next() {
+		var consent domain.OAuthConsent
+		err := rows.Scan(
+			&consent.UserID,
+			&consent.ClientID,
+			&consent.ClientName,
+			pq.Array(&consent.Scopes),
+			&consent.CreatedAt,
+			&consent.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		consents = append(consents, &consent)
+	}
+
+	return consents, rows.Err()
+}
@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type postgresOAuthClientRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresOAuthClientRepository(db *sql.DB) OAuthClientRepository {
+	return &postgresOAuthClientRepository{db: db}
+}
+
+const oauthClientColumns = `id, client_id, client_type, redirect_uris, grant_types, client_secret_hash,
+	previous_secret_hash, previous_secret_expires_at, name, org_id, scopes, created_by, secret_rotated_at,
+	revoked_at, created_at, updated_at`
+
+func (r *postgresOAuthClientRepository) CreateOAuthClient(client *domain.OAuthClient) error {
+	client.CreatedAt = time.Now()
+	client.UpdatedAt = client.CreatedAt
+	query := `INSERT INTO oauth_clients (client_id, client_type, redirect_uris, grant_types, client_secret_hash,
+		name, org_id, scopes, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id`
+
+	// Public clients have no secret
+	secretHash := sql.NullString{String: client.SecretHash, Valid: client.SecretHash != ""}
+
+	return r.db.QueryRow(query,
+		client.ClientID,
+		client.Type,
+		pq.Array(client.RedirectURIs),
+		pq.Array(client.GrantTypes),
+		secretHash,
+		client.Name,
+		client.OrgID,
+		pq.Array(client.Scopes),
+		client.CreatedBy,
+		client.CreatedAt,
+		client.UpdatedAt,
+	).Scan(&client.ID)
+}
+
+func (r *postgresOAuthClientRepository) FindOAuthClientByClientID(clientID string) (*domain.OAuthClient, error) {
+	rows, err := r.db.Query(`SELECT `+oauthClientColumns+` FROM oauth_clients WHERE client_id = $1`, clientID)
+	if err != nil {
+		return nil, err
+	}
+	clients, err := scanOAuthClients(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(clients) == 0 {
+		return nil, domain.ErrOAuthClientNotFound
+	}
+	return clients[0], nil
+}
+
+func (r *postgresOAuthClientRepository) ListOAuthClients() ([]*domain.OAuthClient, error) {
+	rows, err := r.db.Query(`SELECT ` + oauthClientColumns + ` FROM oauth_clients ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	return scanOAuthClients(rows)
+}
+
+// RotateOAuthClientSecret installs a new secret hash. The current hash is
+// kept as the previous secret, valid until previousExpiresAt, so callers can
+// roll the new secret out without downtime.
+func (r *postgresOAuthClientRepository) RotateOAuthClientSecret(id int64, secretHash string, previousExpiresAt time.Time) error {
+	now := time.Now()
+	query := `UPDATE oauth_clients SET
+		previous_secret_hash = client_secret_hash,
+		previous_secret_expires_at = $1,
+		client_secret_hash = $2,
+		secret_rotated_at = $3,
+		updated_at = $3
+	WHERE id = $4 AND revoked_at IS NULL`
+
+	result, err := r.db.Exec(query, previousExpiresAt, secretHash, now, id)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return domain.ErrOAuthClientNotFound
+	}
+	return nil
+}
+
+func (r *postgresOAuthClientRepository) RevokeOAuthClient(id int64) error {
+	now := time.Now()
+	result, err := r.db.Exec(`UPDATE oauth_clients SET revoked_at = $1, updated_at = $1 WHERE id = $2 AND revoked_at IS NULL`, now, id)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return domain.ErrOAuthClientNotFound
+	}
+	return nil
+}
+
+func scanOAuthClients(rows *sql.Rows) ([]*domain.OAuthClient, error) {
+	defer rows.Close()
+
+	var clients []*domain.OAuthClient
+	for rows.Next() {
+		var client domain.OAuthClient
+		var secretHash sql.NullString
+		var previousSecretHash sql.NullString
+		var previousExpiresAt sql.NullTime
+		var orgID sql.NullInt64
+		var createdBy sql.NullInt64
+		var rotatedAt sql.NullTime
+		var revokedAt sql.NullTime
+
+		err := rows.Scan(
+			&client.ID,
+			&client.ClientID,
+			&client.Type,
+			pq.Array(&client.RedirectURIs),
+			pq.Array(&client.GrantTypes),
+			&secretHash,
+			&previousSecretHash,
+			&previousExpiresAt,
+			&client.Name,
+			&orgID,
+			pq.Array(&client.Scopes),
+			&createdBy,
+			&rotatedAt,
+			&revokedAt,
+			&client.CreatedAt,
+			&client.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		client.SecretHash = secretHash.String
+		client.PreviousSecretHash = previousSecretHash.String
+		if previousExpiresAt.Valid {
+			client.PreviousSecretExpiresAt = &previousExpiresAt.Time
+		}
+		if orgID.Valid {
+			client.OrgID = &orgID.Int64
+		}
+		if createdBy.Valid {
+			client.CreatedBy = &createdBy.Int64
+		}
+		if rotatedAt.Valid {
+			client.SecretRotatedAt = &rotatedAt.Time
+		}
+		if revokedAt.Valid {
+			client.RevokedAt = &revokedAt.Time
+		}
+		clients = append(clients, &client)
+	}
+
+	return clients, rows.Err()
+}
@@ -0,0 +1,259 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type postgresOrganizationRepository struct {
+	db dbtx
+}
+
+func NewPostgresOrganizationRepository(db *sql.DB) OrganizationRepository {
+	return &postgresOrganizationRepository{db: db}
+}
+
+// CreateOrganization inserts org and makes ownerID its first admin
+func (r *postgresOrganizationRepository) CreateOrganization(org *domain.Organization, ownerID int64) error {
+	return inTx(r.db, func(tx *sql.Tx) error {
+		now := time.Now()
+		err := tx.QueryRow(`INSERT INTO organizations (name, slug, created_at, updated_at)
+			VALUES ($1, $2, $3, $3) RETURNING id`,
+			org.Name, org.Slug, now,
+		).Scan(&org.ID)
+		if isUniqueViolation(err) {
+			return domain.ErrSlugTaken
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO memberships (user_id, org_id, role, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $4)`,
+			ownerID, org.ID, domain.OrgRoleAdmin, now,
+		)
+		if err != nil {
+			return err
+		}
+
+		org.CreatedAt = now
+		org.UpdatedAt = now
+		return nil
+	})
+}
+
+func (r *postgresOrganizationRepository) FindOrganizationByID(orgID int64) (*domain.Organization, error) {
+	var org domain.Organization
+	query := `SELECT id, name, slug, created_at, updated_at FROM organizations WHERE id = $1`
+
+	err := r.db.QueryRow(query, orgID).Scan(
+		&org.ID,
+		&org.Name,
+		&org.Slug,
+		&org.CreatedAt,
+		&org.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrOrganizationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &org, nil
+}
+
+func (r *postgresOrganizationRepository) FindMembership(userID, orgID int64) (*domain.Membership, error) {
+	query := `SELECT m.user_id, m.org_id, m.role, m.manager_id, u.email, o.name, m.created_at, m.updated_at
+		FROM memberships m
+		JOIN users u ON u.id = m.user_id
+		JOIN organizations o ON o.id = m.org_id
+		WHERE m.user_id = $1 AND m.org_id = $2`
+
+	rows, err := r.db.Query(query, userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	memberships, err := scanMemberships(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(memberships) == 0 {
+		return nil, domain.ErrMembershipNotFound
+	}
+
+	return memberships[0], nil
+}
+
+// ListMembershipsByUser returns the user's memberships, oldest first
+func (r *postgresOrganizationRepository) ListMembershipsByUser(userID int64) ([]*domain.Membership, error) {
+	query := `SELECT m.user_id, m.org_id, m.role, m.manager_id, u.email, o.name, m.created_at, m.updated_at
+		FROM memberships m
+		JOIN users u ON u.id = m.user_id
+		JOIN organizations o ON o.id = m.org_id
+		WHERE m.user_id = $1
+		ORDER BY m.created_at, m.org_id`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanMemberships(rows)
+}
+
+func (r *postgresOrganizationRepository) ListMembershipsByOrg(orgID int64) ([]*domain.Membership, error) {
+	query := `SELECT m.user_id, m.org_id, m.role, m.manager_id, u.email, o.name, m.created_at, m.updated_at
+		FROM memberships m
+		JOIN users u ON u.id = m.user_id
+		JOIN organizations o ON o.id = m.org_id
+		WHERE m.org_id = $1
+		ORDER BY u.email`
+
+	rows, err := r.db.Query(query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	return scanMemberships(rows)
+}
+
+func (r *postgresOrganizationRepository) CountMembersWithRole(orgID int64, role string) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM memberships WHERE org_id = $1 AND role = $2`
+	err := r.db.QueryRow(query, orgID, role).Scan(&count)
+	return count, err
+}
+
+func (r *postgresOrganizationRepository) CreateMembership(membership *domain.Membership) error {
+	now := time.Now()
+	query := `INSERT INTO memberships (user_id, org_id, role, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $4)
+		ON CONFLICT (user_id, org_id) DO NOTHING`
+
+	result, err := r.db.Exec(query, membership.UserID, membership.OrgID, membership.Role, now)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return domain.ErrMembershipExists
+	}
+
+	membership.CreatedAt = now
+	membership.UpdatedAt = now
+	return nil
+}
+
+func (r *postgresOrganizationRepository) UpdateMembershipRole(userID, orgID int64, role string) error {
+	query := `UPDATE memberships SET role = $1, updated_at = $2 WHERE user_id = $3 AND org_id = $4`
+	result, err := r.db.Exec(query, role, time.Now(), userID, orgID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return domain.ErrMembershipNotFound
+	}
+	return nil
+}
+
+// DeleteMembership removes the membership and detaches the member's direct
+// reports, who are left without a manager in that organization
+func (r *postgresOrganizationRepository) DeleteMembership(userID, orgID int64) error {
+	return inTx(r.db, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`DELETE FROM memberships WHERE user_id = $1 AND org_id = $2`, userID, orgID)
+		if err != nil {
+			return err
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return domain.ErrMembershipNotFound
+		}
+
+		_, err = tx.Exec(`UPDATE memberships SET manager_id = NULL, updated_at = $1 WHERE org_id = $2 AND manager_id = $3`,
+			time.Now(), orgID, userID)
+		return err
+	})
+}
+
+func (r *postgresOrganizationRepository) SetManager(userID, orgID int64, managerID *int64) error {
+	query := `UPDATE memberships SET manager_id = $1, updated_at = $2 WHERE user_id = $3 AND org_id = $4`
+	result, err := r.db.Exec(query, managerID, time.Now(), userID, orgID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return domain.ErrMembershipNotFound
+	}
+	return nil
+}
+
+// maxReportDepth bounds the recursive walk in case a cycle slips in
+const maxReportDepth = 32
+
+// ListReports returns everyone below managerID in the organization's
+// reporting hierarchy, direct reports first
+func (r *postgresOrganizationRepository) ListReports(orgID, managerID int64) ([]*domain.Report, error) {
+	query := `WITH RECURSIVE reports AS (
+			SELECT m.user_id, m.manager_id, m.role, 1 AS depth
+			FROM memberships m
+			WHERE m.org_id = $1 AND m.manager_id = $2
+		UNION
+			SELECT m.user_id, m.manager_id, m.role, r.depth + 1
+			FROM memberships m
+			JOIN reports r ON m.manager_id = r.user_id
+			WHERE m.org_id = $1 AND r.depth < $3
+		)
+		SELECT r.user_id, u.email, r.role, r.manager_id, MIN(r.depth) AS depth
+		FROM reports r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.user_id <> $2
+		GROUP BY r.user_id, u.email, r.role, r.manager_id
+		ORDER BY depth, u.email`
+
+	rows, err := r.db.Query(query, orgID, managerID, maxReportDepth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []*domain.Report
+	for rows.Next() {
+		var report domain.Report
+		if err := rows.Scan(&report.UserID, &report.Email, &report.Role, &report.ManagerID, &report.Depth); err != nil {
+			return nil, err
+		}
+		reports = append(reports, &report)
+	}
+
+	return reports, rows.Err()
+}
+
+func scanMemberships(rows *sql.Rows) ([]*domain.Membership, error) {
+	defer rows.Close()
+
+	var memberships []*domain.Membership
+	for rows.Next() {
+		var membership domain.Membership
+		var managerID sql.NullInt64
+		err := rows.Scan(
+			&membership.UserID,
+			&membership.OrgID,
+			&membership.Role,
+			&managerID,
+			&membership.Email,
+			&membership.OrgName,
+			&membership.CreatedAt,
+			&membership.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if managerID.Valid {
+			membership.ManagerID = &managerID.Int64
+		}
+		memberships = append(memberships, &membership)
+	}
+
+	return memberships, rows.Err()
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type postgresSAMLRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresSAMLRepository(db *sql.DB) SAMLRepository {
+	return &postgresSAMLRepository{db: db}
+}
+
+func (r *postgresSAMLRepository) FindConfig(orgID int64) (*domain.SAMLConfig, error) {
+	query := `SELECT org_id, idp_entity_id, idp_sso_url, idp_certificates, email_attribute, name_attribute,
+		role_attribute, role_mapping, default_role, jit_provisioning, allow_idp_initiated, enabled, created_at, updated_at
+		FROM saml_configs WHERE org_id = $1`
+
+	var cfg domain.SAMLConfig
+	var roleMapping []byte
+	err := r.db.QueryRow(query, orgID).Scan(
+		&cfg.OrgID,
+		&cfg.IdPEntityID,
+		&cfg.IdPSSOURL,
+		pq.Array(&cfg.IdPCertificates),
+		&cfg.EmailAttribute,
+		&cfg.NameAttribute,
+		&cfg.RoleAttribute,
+		&roleMapping,
+		&cfg.DefaultRole,
+		&cfg.JITProvisioning,
+		&cfg.AllowIdPInitiated,
+		&cfg.Enabled,
+		&cfg.CreatedAt,
+		&cfg.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrSAMLNotConfigured
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(roleMapping, &cfg.RoleMapping); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// SaveConfig creates or replaces the organization's configuration
+func (r *postgresSAMLRepository) SaveConfig(cfg *domain.SAMLConfig) error {
+	roleMapping, err := json.Marshal(cfg.RoleMapping)
+	if err != nil {
+		return err
+	}
+	if cfg.RoleMapping == nil {
+		roleMapping = []byte("{}")
+	}
+
+	query := `INSERT INTO saml_configs (org_id, idp_entity_id, idp_sso_url, idp_certificates, email_attribute,
+			name_attribute, role_attribute, role_mapping, default_role, jit_provisioning, allow_idp_initiated, enabled,
+			created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $13)
+		ON CONFLICT (org_id) DO UPDATE SET
+			idp_entity_id = EXCLUDED.idp_entity_id,
+			idp_sso_url = EXCLUDED.idp_sso_url,
+			idp_certificates = EXCLUDED.idp_certificates,
+			email_attribute = EXCLUDED.email_attribute,
+			name_attribute = EXCLUDED.name_attribute,
+			role_attribute = EXCLUDED.role_attribute,
+			role_mapping = EXCLUDED.role_mapping,
+			default_role = EXCLUDED.default_role,
+			jit_provisioning = EXCLUDED.jit_provisioning,
+			allow_idp_initiated = EXCLUDED.allow_idp_initiated,
+			enabled = EXCLUDED.enabled,
+			updated_at = EXCLUDED.updated_at
+		RETURNING created_at, updated_at`
+
+	return r.db.QueryRow(query,
+		cfg.OrgID,
+		cfg.IdPEntityID,
+		cfg.IdPSSOURL,
+		pq.Array(cfg.IdPCertificates),
+		cfg.EmailAttribute,
+		cfg.NameAttribute,
+		cfg.RoleAttribute,
+		roleMapping,
+		cfg.DefaultRole,
+		cfg.JITProvisioning,
+		cfg.AllowIdPInitiated,
+		cfg.Enabled,
+		time.Now(),
+	).Scan(&cfg.CreatedAt, &cfg.UpdatedAt)
+}
+
+func (r *postgresSAMLRepository) DeleteConfig(orgID int64) error {
+	result, err := r.db.Exec(`DELETE FROM saml_configs WHERE org_id = $1`, orgID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrSAMLNotConfigured
+	}
+	return nil
+}
+
+func (r *postgresSAMLRepository) CreateRequest(orgID int64, requestID string, expiresAt time.Time) error {
+	_, err := r.db.Exec(`INSERT INTO saml_requests (id, org_id, expires_at) VALUES ($1, $2, $3)`, requestID, orgID, expiresAt)
+	return err
+}
+
+// ConsumeRequest deletes an outstanding AuthnRequest so each can be answered
+// once. Expired rows are cleaned up on the way.
+func (r *postgresSAMLRepository) ConsumeRequest(orgID int64, requestID string, now time.Time) error {
+	if _, err := r.db.Exec(`DELETE FROM saml_requests WHERE expires_at <= $1`, now); err != nil {
+		return err
+	}
+
+	result, err := r.db.Exec(`DELETE FROM saml_requests WHERE id = $1 AND org_id = $2`, requestID, orgID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrInvalidSAMLResp
+	}
+	return nil
+}
+
+// RecordAssertion remembers a consumed assertion ID until it expires and
+// fails with ErrSAMLReplay if it has been seen before
+func (r *postgresSAMLRepository) RecordAssertion(orgID int64, assertionID string, expiresAt time.Time) error {
+	if _, err := r.db.Exec(`DELETE FROM saml_assertions WHERE expires_at <= $1`, time.Now()); err != nil {
+		return err
+	}
+
+	_, err := r.db.Exec(`INSERT INTO saml_assertions (assertion_id, org_id, expires_at) VALUES ($1, $2, $3)`, assertionID, orgID, expiresAt)
+	if isUniqueViolation(err) {
+		return domain.ErrSAMLReplay
+	}
+	return err
+}
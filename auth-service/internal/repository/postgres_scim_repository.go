@@ -0,0 +1,328 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type postgresSCIMRepository struct {
+	db dbtx
+}
+
+func NewPostgresSCIMRepository(db *sql.DB) SCIMRepository {
+	return &postgresSCIMRepository{db: db}
+}
+
+const directoryUserQuery = `SELECT u.id, u.email, u.name, u.is_active, m.role, m.external_id,
+		COALESCE(u.provisioned_by_org_id = m.org_id, false), m.created_at, GREATEST(u.updated_at, m.updated_at)
+	FROM memberships m
+	JOIN users u ON u.id = m.user_id
+	WHERE m.org_id = $1 AND u.anonymized_at IS NULL`
+
+// directoryUserColumns maps filterable attributes to their text value
+var directoryUserColumns = map[string]string{
+	domain.DirectoryUserID:         `u.id::text`,
+	domain.DirectoryUserEmail:      `u.email`,
+	domain.DirectoryUserExternalID: `COALESCE(m.external_id, '')`,
+	domain.DirectoryUserName:       `COALESCE(u.name, '')`,
+	domain.DirectoryUserActive:     `u.is_active::text`,
+	domain.DirectoryUserRole:       `m.role`,
+}
+
+func (r *postgresSCIMRepository) ListUsers(orgID int64, filter *domain.DirectoryUserFilter, offset, limit int) ([]*domain.DirectoryUser, int, error) {
+	where, args := "", []interface{}{orgID}
+	if filter != nil {
+		column, ok := directoryUserColumns[filter.Attribute]
+		if !ok {
+			return nil, 0, fmt.Errorf("%w: cannot filter on %q", domain.ErrSCIMInvalidFilter, filter.Attribute)
+		}
+		column = `lower(` + column + `)`
+		switch filter.Operator {
+		case "eq":
+			where = ` AND ` + column + ` = lower($2)`
+		case "ne":
+			where = ` AND ` + column + ` <> lower($2)`
+		case "co":
+			where = ` AND strpos(` + column + `, lower($2)) > 0`
+		case "sw":
+			where = ` AND strpos(` + column + `, lower($2)) = 1`
+		case "ew":
+			where = ` AND right(` + column + `, length($2)) = lower($2)`
+		case "pr":
+			where = ` AND ` + column + ` <> ''`
+		default:
+			return nil, 0, fmt.Errorf("%w: unsupported operator %q", domain.ErrSCIMInvalidFilter, filter.Operator)
+		}
+		if filter.Operator != "pr" {
+			args = append(args, filter.Value)
+		}
+	}
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM (`+directoryUserQuery+where+`) matched`, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	page := fmt.Sprintf(` ORDER BY u.id OFFSET $%d LIMIT $%d`, len(args)+1, len(args)+2)
+	rows, err := r.db.Query(directoryUserQuery+where+page, append(args, offset, limit)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	users, err := scanDirectoryUsers(rows)
+	return users, total, err
+}
+
+func (r *postgresSCIMRepository) FindUser(orgID, userID int64) (*domain.DirectoryUser, error) {
+	rows, err := r.db.Query(directoryUserQuery+` AND u.id = $2`, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	users, err := scanDirectoryUsers(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, domain.ErrSCIMNotFound
+	}
+	return users[0], nil
+}
+
+func scanDirectoryUsers(rows *sql.Rows) ([]*domain.DirectoryUser, error) {
+	defer rows.Close()
+
+	var users []*domain.DirectoryUser
+	for rows.Next() {
+		var user domain.DirectoryUser
+		var name, externalID sql.NullString
+
+		err := rows.Scan(
+			&user.UserID,
+			&user.Email,
+			&name,
+			&user.IsActive,
+			&user.Role,
+			&externalID,
+			&user.Provisioned,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		user.Name = name.String
+		user.ExternalID = externalID.String
+		users = append(users, &user)
+	}
+
+	return users, rows.Err()
+}
+
+func (r *postgresSCIMRepository) SetExternalID(orgID, userID int64, externalID string) error {
+	query := `UPDATE memberships SET external_id = $1, updated_at = $2 WHERE user_id = $3 AND org_id = $4`
+	_, err := r.db.Exec(query, sql.NullString{String: externalID, Valid: externalID != ""}, time.Now(), userID, orgID)
+	if isUniqueViolation(err) {
+		return domain.ErrSCIMUniqueness
+	}
+	return err
+}
+
+func (r *postgresSCIMRepository) ListGroups(orgID int64) ([]*domain.DirectoryGroup, error) {
+	return r.queryGroups(`WHERE org_id = $1 ORDER BY id`, orgID)
+}
+
+func (r *postgresSCIMRepository) FindGroup(orgID, groupID int64) (*domain.DirectoryGroup, error) {
+	groups, err := r.queryGroups(`WHERE org_id = $1 AND id = $2`, orgID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, domain.ErrSCIMNotFound
+	}
+	return groups[0], nil
+}
+
+// queryGroups loads the groups matching where along with their members
+func (r *postgresSCIMRepository) queryGroups(where string, args ...interface{}) ([]*domain.DirectoryGroup, error) {
+	rows, err := r.db.Query(`SELECT id, org_id, display_name, external_id, role, created_at, updated_at
+		FROM scim_groups `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []*domain.DirectoryGroup
+	byID := make(map[int64]*domain.DirectoryGroup)
+	for rows.Next() {
+		var group domain.DirectoryGroup
+		var externalID, role sql.NullString
+
+		err := rows.Scan(
+			&group.ID,
+			&group.OrgID,
+			&group.DisplayName,
+			&externalID,
+			&role,
+			&group.CreatedAt,
+			&group.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		group.ExternalID = externalID.String
+		group.Role = role.String
+		groups = append(groups, &group)
+		byID[group.ID] = &group
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return groups, nil
+	}
+
+	memberRows, err := r.db.Query(`SELECT gm.group_id, u.id, u.email
+		FROM scim_group_members gm
+		JOIN scim_groups g ON g.id = gm.group_id
+		JOIN users u ON u.id = gm.user_id
+		WHERE g.org_id = $1
+		ORDER BY u.id`, groups[0].OrgID)
+	if err != nil {
+		return nil, err
+	}
+	defer memberRows.Close()
+
+	for memberRows.Next() {
+		var groupID int64
+		var member domain.DirectoryGroupMember
+		if err := memberRows.Scan(&groupID, &member.UserID, &member.Email); err != nil {
+			return nil, err
+		}
+		if group, ok := byID[groupID]; ok {
+			group.Members = append(group.Members, member)
+		}
+	}
+
+	return groups, memberRows.Err()
+}
+
+func (r *postgresSCIMRepository) CreateGroup(group *domain.DirectoryGroup) error {
+	return inTx(r.db, func(tx *sql.Tx) error {
+		now := time.Now()
+		query := `INSERT INTO scim_groups (org_id, display_name, external_id, role, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $5) RETURNING id`
+
+		err := tx.QueryRow(query,
+			group.OrgID,
+			group.DisplayName,
+			sql.NullString{String: group.ExternalID, Valid: group.ExternalID != ""},
+			sql.NullString{String: group.Role, Valid: group.Role != ""},
+			now,
+		).Scan(&group.ID)
+		if isUniqueViolation(err) {
+			return domain.ErrSCIMUniqueness
+		}
+		if err != nil {
+			return err
+		}
+		group.CreatedAt = now
+		group.UpdatedAt = now
+
+		return insertGroupMembers(tx, group)
+	})
+}
+
+// UpdateGroup saves the group's attributes and replaces its members
+func (r *postgresSCIMRepository) UpdateGroup(group *domain.DirectoryGroup) error {
+	return inTx(r.db, func(tx *sql.Tx) error {
+		group.UpdatedAt = time.Now()
+		query := `UPDATE scim_groups SET display_name = $1, external_id = $2, role = $3, updated_at = $4
+			WHERE id = $5 AND org_id = $6`
+
+		result, err := tx.Exec(query,
+			group.DisplayName,
+			sql.NullString{String: group.ExternalID, Valid: group.ExternalID != ""},
+			sql.NullString{String: group.Role, Valid: group.Role != ""},
+			group.UpdatedAt,
+			group.ID,
+			group.OrgID,
+		)
+		if isUniqueViolation(err) {
+			return domain.ErrSCIMUniqueness
+		}
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err != nil {
+			return err
+		} else if affected == 0 {
+			return domain.ErrSCIMNotFound
+		}
+
+		if _, err := tx.Exec(`DELETE FROM scim_group_members WHERE group_id = $1`, group.ID); err != nil {
+			return err
+		}
+		return insertGroupMembers(tx, group)
+	})
+}
+
+func insertGroupMembers(tx *sql.Tx, group *domain.DirectoryGroup) error {
+	for _, member := range group.Members {
+		_, err := tx.Exec(`INSERT INTO scim_group_members (group_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, group.ID, member.UserID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *postgresSCIMRepository) DeleteGroup(orgID, groupID int64) error {
+	result, err := r.db.Exec(`DELETE FROM scim_groups WHERE id = $1 AND org_id = $2`, groupID, orgID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrSCIMNotFound
+	}
+	return nil
+}
+
+// ListGroupRoles returns the roles granted to userID by the organization's
+// role groups
+func (r *postgresSCIMRepository) ListGroupRoles(orgID, userID int64) ([]string, error) {
+	query := `SELECT DISTINCT g.role FROM scim_groups g
+		JOIN scim_group_members gm ON gm.group_id = g.id
+		WHERE g.org_id = $1 AND gm.user_id = $2 AND g.role IS NOT NULL`
+
+	rows, err := r.db.Query(query, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []string
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+func (r *postgresSCIMRepository) RemoveUserFromGroups(orgID, userID int64) error {
+	query := `DELETE FROM scim_group_members gm USING scim_groups g
+		WHERE gm.group_id = g.id AND g.org_id = $1 AND gm.user_id = $2`
+	_, err := r.db.Exec(query, orgID, userID)
+	return err
+}
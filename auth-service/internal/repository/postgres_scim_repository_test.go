@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+func TestSCIMListUsers(t *testing.T) {
+	db := openTestDB(t)
+	users := NewPostgresUserRepository(db)
+	organizations := NewPostgresOrganizationRepository(db)
+	scim := NewPostgresSCIMRepository(db)
+
+	run := time.Now().UnixNano()
+	var members []*domain.User
+	for _, name := range []string{"ana", "bo", "cy"} {
+		user := &domain.User{Email: fmt.Sprintf("%s-%d@Corp.example", name, run), Role: "sales_rep", IsVerified: true}
+		if err := users.CreateUser(user); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		members = append(members, user)
+	}
+	org := &domain.Organization{Name: "Corp", Slug: fmt.Sprintf("corp-%d", run)}
+	if err := organizations.CreateOrganization(org, members[0].ID); err != nil {
+		t.Fatalf("CreateOrganization: %v", err)
+	}
+	for _, user := range members[1:] {
+		if err := organizations.CreateMembership(&domain.Membership{UserID: user.ID, OrgID: org.ID, Role: domain.OrgRoleSalesRep}); err != nil {
+			t.Fatalf("CreateMembership: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter *domain.DirectoryUserFilter
+		offset int
+		limit  int
+		want   []int64
+		total  int
+	}{
+		{name: "first page", limit: 2, want: []int64{members[0].ID, members[1].ID}, total: 3},
+		{name: "second page", offset: 2, limit: 2, want: []int64{members[2].ID}, total: 3},
+		{name: "past the end", offset: 5, limit: 2, total: 3},
+		{name: "eq ignores case", filter: &domain.DirectoryUserFilter{Attribute: domain.DirectoryUserEmail, Operator: "eq", Value: fmt.Sprintf("BO-%d@corp.EXAMPLE", run)}, limit: 10, want: []int64{members[1].ID}, total: 1},
+		{name: "ne", filter: &domain.DirectoryUserFilter{Attribute: domain.DirectoryUserRole, Operator: "ne", Value: domain.OrgRoleAdmin}, limit: 10, want: []int64{members[1].ID, members[2].ID}, total: 2},
+		{name: "sw", filter: &domain.DirectoryUserFilter{Attribute: domain.DirectoryUserEmail, Operator: "sw", Value: "CY-"}, limit: 10, want: []int64{members[2].ID}, total: 1},
+		{name: "ew", filter: &domain.DirectoryUserFilter{Attribute: domain.DirectoryUserEmail, Operator: "ew", Value: "corp.example"}, limit: 1, want: []int64{members[0].ID}, total: 3},
+		{name: "co", filter: &domain.DirectoryUserFilter{Attribute: domain.DirectoryUserEmail, Operator: "co", Value: "a-"}, limit: 10, want: []int64{members[0].ID}, total: 1},
+		{name: "pr", filter: &domain.DirectoryUserFilter{Attribute: domain.DirectoryUserExternalID, Operator: "pr"}, limit: 10, total: 0},
+		{name: "active", filter: &domain.DirectoryUserFilter{Attribute: domain.DirectoryUserActive, Operator: "eq", Value: "true"}, limit: 10, want: []int64{members[0].ID, members[1].ID, members[2].ID}, total: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total, err := scim.ListUsers(org.ID, tt.filter, tt.offset, tt.limit)
+			if err != nil {
+				t.Fatalf("ListUsers: %v", err)
+			}
+			var ids []int64
+			for _, user := range got {
+				ids = append(ids, user.UserID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.want) || total != tt.total {
+				t.Errorf("ListUsers = %v (total %d), want %v (total %d)", ids, total, tt.want, tt.total)
+			}
+		})
+	}
+}
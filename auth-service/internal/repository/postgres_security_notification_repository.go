@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type postgresSecurityNotificationRepository struct {
+	db dbtx
+}
+
+func NewPostgresSecurityNotificationRepository(db *sql.DB) SecurityNotificationRepository {
+	return &postgresSecurityNotificationRepository{db: db}
+}
+
+func (r *postgresSecurityNotificationRepository) RecordLoginDevice(userID int64, device string, seenAt time.Time) (bool, error) {
+	// xmax is only zero on a freshly inserted row, so it tells an unseen
+	// device apart from one whose last_seen_at was just updated
+	query := `INSERT INTO user_login_devices (user_id, device, first_seen_at, last_seen_at)
+		VALUES ($1, $2, $3, $3)
+		ON CONFLICT (user_id, device) DO UPDATE SET last_seen_at = EXCLUDED.last_seen_at
+		RETURNING xmax = 0`
+
+	var inserted bool
+	if err := r.db.QueryRow(query, userID, device, seenAt).Scan(&inserted); err != nil {
+		return false, err
+	}
+	return !inserted, nil
+}
+
+func (r *postgresSecurityNotificationRepository) CountLoginDevices(userID int64) (int, error) {
+	var count int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM user_login_devices WHERE user_id = $1`, userID).Scan(&count)
+	return count, err
+}
+
+func (r *postgresSecurityNotificationRepository) ListLoginDevices(userID int64) ([]*domain.LoginDevice, error) {
+	rows, err := r.db.Query(`SELECT device, first_seen_at, last_seen_at FROM user_login_devices
+		WHERE user_id = $1 ORDER BY last_seen_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var devices []*domain.LoginDevice
+	for rows.Next() {
+		device := &domain.LoginDevice{}
+		if err := rows.Scan(&device.Device, &device.FirstSeenAt, &device.LastSeenAt); err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, rows.Err()
+}
+
+func (r *postgresSecurityNotificationRepository) ListOptOuts(userID int64) ([]string, error) {
+	rows, err := r.db.Query(`SELECT notification FROM security_notification_opt_outs WHERE user_id = $1 ORDER BY notification`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []string
+	for rows.Next() {
+		var notification string
+		if err := rows.Scan(&notification); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications, rows.Err()
+}
+
+func (r *postgresSecurityNotificationRepository) IsOptedOut(userID int64, notification string) (bool, error) {
+	var optedOut bool
+	err := r.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM security_notification_opt_outs WHERE user_id = $1 AND notification = $2)`,
+		userID, notification,
+	).Scan(&optedOut)
+	return optedOut, err
+}
+
+func (r *postgresSecurityNotificationRepository) SetOptOut(userID int64, notification string, optOut bool) error {
+	if !optOut {
+		_, err := r.db.Exec(`DELETE FROM security_notification_opt_outs WHERE user_id = $1 AND notification = $2`, userID, notification)
+		return err
+	}
+	_, err := r.db.Exec(`INSERT INTO security_notification_opt_outs (user_id, notification) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		userID, notification,
+	)
+	return err
+}
@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type postgresSMSCodeRepository struct {
+	db dbtx
+}
+
+func NewPostgresSMSCodeRepository(db *sql.DB) SMSCodeRepository {
+	return &postgresSMSCodeRepository{db: db}
+}
+
+const smsCodeColumns = `id, user_id, purpose, phone_number, code_hash, challenge_hash, org_id, attempts, expires_at, consumed_at, created_at`
+
+func (r *postgresSMSCodeRepository) CreateSMSCode(code *domain.SMSCode) error {
+	var challengeHash sql.NullString
+	if code.ChallengeHash != "" {
+		challengeHash = sql.NullString{String: code.ChallengeHash, Valid: true}
+	}
+
+	var orgID sql.NullInt64
+	if code.OrgID != nil {
+		orgID = sql.NullInt64{Int64: *code.OrgID, Valid: true}
+	}
+
+	code.CreatedAt = time.Now()
+	query := `INSERT INTO sms_codes (user_id, purpose, phone_number, code_hash, challenge_hash, org_id, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+
+	return r.db.QueryRow(query,
+		code.UserID,
+		code.Purpose,
+		code.PhoneNumber,
+		code.CodeHash,
+		challengeHash,
+		orgID,
+		code.ExpiresAt,
+		code.CreatedAt,
+	).Scan(&code.ID)
+}
+
+func (r *postgresSMSCodeRepository) FindLatestSMSCode(userID int64, purpose string) (*domain.SMSCode, error) {
+	query := `SELECT ` + smsCodeColumns + ` FROM sms_codes
+		WHERE user_id = $1 AND purpose = $2
+		ORDER BY created_at DESC, id DESC LIMIT 1`
+	return scanSMSCode(r.db.QueryRow(query, userID, purpose))
+}
+
+func (r *postgresSMSCodeRepository) FindSMSCodeByChallenge(challengeHash string) (*domain.SMSCode, error) {
+	query := `SELECT ` + smsCodeColumns + ` FROM sms_codes WHERE challenge_hash = $1`
+	return scanSMSCode(r.db.QueryRow(query, challengeHash))
+}
+
+func (r *postgresSMSCodeRepository) CountSMSCodesSince(userID int64, since time.Time) (int, error) {
+	var count int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM sms_codes WHERE user_id = $1 AND created_at >= $2`, userID, since).Scan(&count)
+	return count, err
+}
+
+// ClaimSMSCodeAttempt counts the attempt in the same statement that checks
+// the code is still usable, so concurrent guesses cannot exceed maxAttempts
+func (r *postgresSMSCodeRepository) ClaimSMSCodeAttempt(codeID int64, maxAttempts int, now time.Time) (string, error) {
+	query := `UPDATE sms_codes SET attempts = attempts + 1
+		WHERE id = $1 AND attempts < $2 AND consumed_at IS NULL AND expires_at > $3
+		RETURNING code_hash`
+
+	var codeHash string
+	err := r.db.QueryRow(query, codeID, maxAttempts, now).Scan(&codeHash)
+	if err == sql.ErrNoRows {
+		return "", domain.ErrInvalidSMSCode
+	}
+	return codeHash, err
+}
+
+func (r *postgresSMSCodeRepository) ConsumeSMSCode(codeID int64, consumedAt time.Time) error {
+	result, err := r.db.Exec(`UPDATE sms_codes SET consumed_at = $1 WHERE id = $2 AND consumed_at IS NULL`, consumedAt, codeID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return domain.ErrInvalidSMSCode
+	}
+	return nil
+}
+
+func scanSMSCode(row *sql.Row) (*domain.SMSCode, error) {
+	var code domain.SMSCode
+	var challengeHash sql.NullString
+	var orgID sql.NullInt64
+	var consumedAt sql.NullTime
+
+	err := row.Scan(
+		&code.ID,
+		&code.UserID,
+		&code.Purpose,
+		&code.PhoneNumber,
+		&code.CodeHash,
+		&challengeHash,
+		&orgID,
+		&code.Attempts,
+		&code.ExpiresAt,
+		&consumedAt,
+		&code.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrInvalidSMSCode
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	code.ChallengeHash = challengeHash.String
+	if orgID.Valid {
+		code.OrgID = &orgID.Int64
+	}
+	if consumedAt.Valid {
+		code.ConsumedAt = &consumedAt.Time
+	}
+	return &code, nil
+}
@@ -5,11 +5,13 @@ import (
 	"errors"
 	"time"
 
+	"github.com/lib/pq"
+
 	"github.com/sales-tracker/auth-service/internal/domain"
 )
 
 type postgresUserRepository struct {
-	db *sql.DB
+	db dbtx
 }
 
 func (r *postgresUserRepository) UpdateUser(user *domain.User) error {
@@ -32,23 +34,35 @@ func (r *postgresUserRepository) UpdateUser(user *domain.User) error {
 	return err
 }
 
+func (r *postgresUserRepository) UpdateUserName(userID int64, name string) error {
+	query := `UPDATE users SET name = $1, updated_at = $2 WHERE id = $3`
+	_, err := r.db.Exec(query, name, time.Now(), userID)
+	return err
+}
+
 func NewPostgresUserRepository(db *sql.DB) UserRepository {
 	return &postgresUserRepository{db: db}
 }
 
 func (r *postgresUserRepository) CreateUser(user *domain.User) error {
-	query := `INSERT INTO users (email, password_hash, role, is_verified, verification_token, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+	query := `INSERT INTO users (email, password_hash, role, is_verified, verification_token, locale, provisioned_by_org_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, is_active`
 
-	return r.db.QueryRow(query,
+	err := r.db.QueryRow(query,
 		user.Email,
 		user.PasswordHash,
 		user.Role,
 		user.IsVerified,
 		user.VerificationToken,
+		user.Locale,
+		user.ProvisionedByOrgID,
 		time.Now(),
 		time.Now(),
-	).Scan(&user.ID)
+	).Scan(&user.ID, &user.IsActive)
+	if isUniqueViolation(err) {
+		return domain.ErrEmailAlreadyInUse
+	}
+	return err
 }
 
 func (r *postgresUserRepository) FindUserByVerificationToken(token string) (*domain.User, error) {
@@ -93,7 +107,15 @@ func (r *postgresUserRepository) FindUserByVerificationToken(token string) (*dom
 
 func (r *postgresUserRepository) FindUserByEmail(email string) (*domain.User, error) {
 	var user domain.User
-	query := `SELECT id, email, password_hash, role, is_verified, created_at, updated_at
+	var name sql.NullString
+	var pendingEmail sql.NullString
+	var undeliverableAt sql.NullTime
+	var phoneVerifiedAt sql.NullTime
+	var provisionedBy sql.NullInt64
+	var deletedAt sql.NullTime
+	var purgeAfter sql.NullTime
+
+	query := `SELECT id, email, password_hash, role, is_verified, is_active, name, locale, pending_email, email_undeliverable_at, email_undeliverable_reason, phone_number, phone_verified_at, sms_mfa_enabled, provisioned_by_org_id, deleted_at, purge_after, created_at, updated_at
 		FROM users WHERE email = $1`
 
 	err := r.db.QueryRow(query, email).Scan(
@@ -102,6 +124,18 @@ func (r *postgresUserRepository) FindUserByEmail(email string) (*domain.User, er
 		&user.PasswordHash,
 		&user.Role,
 		&user.IsVerified,
+		&user.IsActive,
+		&name,
+		&user.Locale,
+		&pendingEmail,
+		&undeliverableAt,
+		&user.EmailUndeliverableReason,
+		&user.PhoneNumber,
+		&phoneVerifiedAt,
+		&user.SMSMFAEnabled,
+		&provisionedBy,
+		&deletedAt,
+		&purgeAfter,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -113,6 +147,24 @@ func (r *postgresUserRepository) FindUserByEmail(email string) (*domain.User, er
 		return nil, err
 	}
 
+	user.Name = name.String
+	user.PendingEmail = pendingEmail.String
+	if undeliverableAt.Valid {
+		user.EmailUndeliverableAt = &undeliverableAt.Time
+	}
+	if phoneVerifiedAt.Valid {
+		user.PhoneVerifiedAt = &phoneVerifiedAt.Time
+	}
+	if provisionedBy.Valid {
+		user.ProvisionedByOrgID = &provisionedBy.Int64
+	}
+	if deletedAt.Valid {
+		user.DeletedAt = &deletedAt.Time
+	}
+	if purgeAfter.Valid {
+		user.PurgeAfter = &purgeAfter.Time
+	}
+
 	return &user, nil
 }
 
@@ -128,9 +180,48 @@ func (r *postgresUserRepository) UpdateUserVerificationStatus(userID int64, isVe
 	return err
 }
 
+// VerifyAndClearPassword marks an unverified account verified for someone
+// who has just proven control of its email some other way. Whoever
+// registered the address chose the password, so it is removed along with
+// any pending reset.
+func (r *postgresUserRepository) VerifyAndClearPassword(userID int64) error {
+	query := `UPDATE users SET
+		is_verified = true,
+		verification_token = NULL,
+		password_hash = '',
+		reset_token = NULL,
+		reset_token_expires_at = NULL,
+		updated_at = $1
+	WHERE id = $2`
+	_, err := r.db.Exec(query, time.Now(), userID)
+	return err
+}
+
+// SetUserLocale stores the language the user's emails are written in
+func (r *postgresUserRepository) SetUserLocale(userID int64, locale string) error {
+	query := `UPDATE users SET locale = $1, updated_at = $2 WHERE id = $3`
+	_, err := r.db.Exec(query, locale, time.Now(), userID)
+	return err
+}
+
+// SetUserActive enables or disables sign-in for the account
+func (r *postgresUserRepository) SetUserActive(userID int64, isActive bool) error {
+	query := `UPDATE users SET is_active = $1, updated_at = $2 WHERE id = $3`
+	_, err := r.db.Exec(query, isActive, time.Now(), userID)
+	return err
+}
+
 func (r *postgresUserRepository) FindUserByID(userID int64) (*domain.User, error) {
 	var user domain.User
-	query := `SELECT id, email, password_hash, role, is_verified, created_at, updated_at
+	var name sql.NullString
+	var pendingEmail sql.NullString
+	var undeliverableAt sql.NullTime
+	var phoneVerifiedAt sql.NullTime
+	var provisionedBy sql.NullInt64
+	var deletedAt sql.NullTime
+	var purgeAfter sql.NullTime
+
+	query := `SELECT id, email, password_hash, role, is_verified, is_active, name, locale, pending_email, email_undeliverable_at, email_undeliverable_reason, phone_number, phone_verified_at, sms_mfa_enabled, provisioned_by_org_id, deleted_at, purge_after, created_at, updated_at
 		FROM users WHERE id = $1`
 
 	err := r.db.QueryRow(query, userID).Scan(
@@ -139,6 +230,18 @@ func (r *postgresUserRepository) FindUserByID(userID int64) (*domain.User, error
 		&user.PasswordHash,
 		&user.Role,
 		&user.IsVerified,
+		&user.IsActive,
+		&name,
+		&user.Locale,
+		&pendingEmail,
+		&undeliverableAt,
+		&user.EmailUndeliverableReason,
+		&user.PhoneNumber,
+		&phoneVerifiedAt,
+		&user.SMSMFAEnabled,
+		&provisionedBy,
+		&deletedAt,
+		&purgeAfter,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -150,6 +253,24 @@ func (r *postgresUserRepository) FindUserByID(userID int64) (*domain.User, error
 		return nil, err
 	}
 
+	user.Name = name.String
+	user.PendingEmail = pendingEmail.String
+	if undeliverableAt.Valid {
+		user.EmailUndeliverableAt = &undeliverableAt.Time
+	}
+	if phoneVerifiedAt.Valid {
+		user.PhoneVerifiedAt = &phoneVerifiedAt.Time
+	}
+	if provisionedBy.Valid {
+		user.ProvisionedByOrgID = &provisionedBy.Int64
+	}
+	if deletedAt.Valid {
+		user.DeletedAt = &deletedAt.Time
+	}
+	if purgeAfter.Valid {
+		user.PurgeAfter = &purgeAfter.Time
+	}
+
 	return &user, nil
 }
 
@@ -188,3 +309,207 @@ func (r *postgresUserRepository) FindUserByResetToken(token string) (*domain.Use
 
 	return &user, nil
 }
+
+func (r *postgresUserRepository) SetPendingEmail(userID int64, email, token string, expiresAt time.Time) error {
+	query := `UPDATE users SET
+		pending_email = $1,
+		email_change_token = $2,
+		email_change_token_expires_at = $3,
+		updated_at = $4
+	WHERE id = $5`
+
+	_, err := r.db.Exec(query, email, token, expiresAt, time.Now(), userID)
+	return err
+}
+
+func (r *postgresUserRepository) FindUserByEmailChangeToken(token string) (*domain.User, error) {
+	var user domain.User
+	var name sql.NullString
+	var pendingEmail sql.NullString
+	var expiresAt sql.NullTime
+
+	query := `SELECT id, email, password_hash, role, is_verified, name, pending_email, email_change_token_expires_at, created_at, updated_at
+		FROM users WHERE email_change_token = $1`
+
+	err := r.db.QueryRow(query, token).Scan(
+		&user.ID,
+		&user.Email,
+		&user.PasswordHash,
+		&user.Role,
+		&user.IsVerified,
+		&name,
+		&pendingEmail,
+		&expiresAt,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("user not found with the given email change token")
+		}
+		return nil, err
+	}
+
+	user.Name = name.String
+	user.PendingEmail = pendingEmail.String
+	user.EmailChangeToken = token
+	if expiresAt.Valid {
+		user.EmailChangeExpiresAt = expiresAt.Time
+	}
+
+	return &user, nil
+}
+
+// ConfirmEmailChange swaps the user's email for the confirmed address and
+// clears the pending change. A unique violation on users.email is reported
+// as domain.ErrEmailAlreadyInUse.
+func (r *postgresUserRepository) ConfirmEmailChange(userID int64, email string) error {
+	query := `UPDATE users SET
+		email = $1,
+		is_verified = true,
+		pending_email = NULL,
+		email_change_token = NULL,
+		email_change_token_expires_at = NULL,
+		email_undeliverable_at = NULL,
+		email_undeliverable_reason = '',
+		updated_at = $2
+	WHERE id = $3`
+
+	_, err := r.db.Exec(query, email, time.Now(), userID)
+	if isUniqueViolation(err) {
+		return domain.ErrEmailAlreadyInUse
+	}
+	return err
+}
+
+// MarkEmailUndeliverable records that mail to the user's current address
+// bounced or drew a complaint. The first report is kept.
+func (r *postgresUserRepository) MarkEmailUndeliverable(userID int64, reason string, at time.Time) error {
+	query := `UPDATE users SET email_undeliverable_at = $1, email_undeliverable_reason = $2, updated_at = $3
+		WHERE id = $4 AND email_undeliverable_at IS NULL`
+	_, err := r.db.Exec(query, at, reason, time.Now(), userID)
+	return err
+}
+
+// SetPhoneNumber stores a verified phone number. An empty phone removes the
+// number along with SMS MFA, which cannot work without it.
+func (r *postgresUserRepository) SetPhoneNumber(userID int64, phone string, verifiedAt *time.Time) error {
+	query := `UPDATE users SET phone_number = $1, phone_verified_at = $2, sms_mfa_enabled = sms_mfa_enabled AND $1 <> '', updated_at = $3
+		WHERE id = $4`
+	_, err := r.db.Exec(query, phone, verifiedAt, time.Now(), userID)
+	return err
+}
+
+// SetSMSMFA turns SMS as a second factor on or off. It is only turned on
+// for users with a phone number.
+func (r *postgresUserRepository) SetSMSMFA(userID int64, enabled bool) error {
+	query := `UPDATE users SET sms_mfa_enabled = $1, updated_at = $2 WHERE id = $3 AND (phone_number <> '' OR NOT $1)`
+	result, err := r.db.Exec(query, enabled, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return domain.ErrNoVerifiedPhone
+	}
+	return nil
+}
+
+// isUniqueViolation reports whether err is a Postgres unique_violation (23505)
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func (r *postgresUserRepository) ScheduleUserDeletion(userID int64, deletedAt, purgeAfter time.Time) error {
+	query := `UPDATE users SET deleted_at = $1, purge_after = $2, updated_at = $1
+		WHERE id = $3 AND anonymized_at IS NULL`
+
+	_, err := r.db.Exec(query, deletedAt, purgeAfter, userID)
+	return err
+}
+
+func (r *postgresUserRepository) CancelUserDeletion(userID int64) error {
+	query := `UPDATE users SET deleted_at = NULL, purge_after = NULL, updated_at = $1
+		WHERE id = $2 AND anonymized_at IS NULL`
+
+	result, err := r.db.Exec(query, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errors.New("user not found")
+	}
+	return nil
+}
+
+// AnonymizeDeletedUsers scrubs personal data from every soft-deleted user
+// whose grace period ended before now. The row itself is kept so that
+// foreign keys and aggregate reporting stay intact. Emails queued or sent
+// to the user's current or pending address are scrubbed too. Links to
+// upstream accounts, SMS codes, login devices and API keys are removed. The
+// anonymized users are returned with the addresses they had before, so that
+// the caller can redact them elsewhere.
+func (r *postgresUserRepository) AnonymizeDeletedUsers(now time.Time) ([]*domain.AnonymizedUser, error) {
+	query := `WITH purged AS (
+		SELECT id, email, pending_email FROM users
+		WHERE deleted_at IS NOT NULL AND purge_after <= $1 AND anonymized_at IS NULL
+		FOR UPDATE
+	), outbox AS (
+		UPDATE email_outbox e SET
+			recipient = 'deleted-' || p.id || '@deleted.invalid',
+			data = '{}',
+			updated_at = $1
+		FROM purged p
+		WHERE e.recipient IN (p.email, p.pending_email)
+	), identities AS (
+		DELETE FROM federated_identities f USING purged p WHERE f.user_id = p.id
+	), sms AS (
+		DELETE FROM sms_codes s USING purged p WHERE s.user_id = p.id
+	), devices AS (
+		DELETE FROM user_login_devices d USING purged p WHERE d.user_id = p.id
+	), keys AS (
+		DELETE FROM api_keys k USING purged p WHERE k.user_id = p.id
+	)
+	UPDATE users u SET
+		email = 'deleted-' || u.id || '@deleted.invalid',
+		password_hash = '',
+		name = NULL,
+		is_verified = false,
+		verification_token = NULL,
+		reset_token = NULL,
+		reset_token_expires_at = NULL,
+		pending_email = NULL,
+		email_change_token = NULL,
+		email_change_token_expires_at = NULL,
+		phone_number = '',
+		phone_verified_at = NULL,
+		sms_mfa_enabled = false,
+		anonymized_at = $1,
+		updated_at = $1
+	FROM purged p
+	WHERE u.id = p.id
+	RETURNING u.id, u.email, p.email, p.pending_email`
+
+	rows, err := r.db.Query(query, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*domain.AnonymizedUser
+	for rows.Next() {
+		var user domain.AnonymizedUser
+		var email string
+		var pendingEmail sql.NullString
+		if err := rows.Scan(&user.ID, &user.Email, &email, &pendingEmail); err != nil {
+			return nil, err
+		}
+		user.FormerAddresses = []string{email}
+		if pendingEmail.Valid {
+			user.FormerAddresses = append(user.FormerAddresses, pendingEmail.String)
+		}
+		users = append(users, &user)
+	}
+	return users, rows.Err()
+}
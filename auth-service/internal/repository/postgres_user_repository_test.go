@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+// openTestDB connects to the scratch database named by TEST_DATABASE_URL
+// and brings it up to the latest migration. Tests using it are skipped
+// when the variable is unset.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		t.Fatalf("create migrations table: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join("..", "..", "migrations", "*.up.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		var version int64
+		if _, err := fmt.Sscanf(filepath.Base(file), "%d_", &version); err != nil {
+			t.Fatalf("invalid migration filename %s", file)
+		}
+		var applied bool
+		if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, version).Scan(&applied); err != nil {
+			t.Fatal(err)
+		}
+		if applied {
+			continue
+		}
+		migration, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(string(migration)); err != nil {
+			t.Fatalf("apply %s: %v", file, err)
+		}
+		if _, err := db.Exec(`INSERT INTO schema_migrations (version) VALUES ($1)`, version); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestAnonymizeDeletedUsers(t *testing.T) {
+	db := openTestDB(t)
+	users := NewPostgresUserRepository(db)
+	audit := NewPostgresAuditRepository(db)
+
+	email := fmt.Sprintf("purged-%d@example.com", time.Now().UnixNano())
+	user := &domain.User{Email: email, PasswordHash: "hash", Role: "sales_rep", IsVerified: true}
+	if err := users.CreateUser(user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	now := time.Now()
+	fixtures := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`INSERT INTO sms_codes (user_id, purpose, phone_number, code_hash, expires_at) VALUES ($1, 'login', '+14155550123', 'hash', $2)`, []interface{}{user.ID, now}},
+		{`INSERT INTO user_login_devices (user_id, device) VALUES ($1, 'Firefox on Linux')`, []interface{}{user.ID}},
+		{`INSERT INTO api_keys (user_id, name, prefix, key_hash) VALUES ($1, 'CRM sync', $2, 'hash')`, []interface{}{user.ID, fmt.Sprintf("stk_%d", now.UnixNano())}},
+	}
+	for _, fixture := range fixtures {
+		if _, err := db.Exec(fixture.query, fixture.args...); err != nil {
+			t.Fatalf("%s: %v", fixture.query, err)
+		}
+	}
+
+	// The failed login is about the user, in another case. The other event
+	// mentions the address without naming the user and is left alone.
+	mention := &domain.AuditEvent{EventType: domain.AuditEventLogin, Outcome: domain.AuditOutcomeFailure, Metadata: map[string]interface{}{"email": email}, CreatedAt: now}
+	login := &domain.AuditEvent{EventType: domain.AuditEventLogin, SubjectID: &user.ID, Outcome: domain.AuditOutcomeFailure, Metadata: map[string]interface{}{"email": "Purged" + email[len("purged"):], "error": "invalid credentials"}, CreatedAt: now}
+	for _, event := range []*domain.AuditEvent{mention, login} {
+		if err := audit.CreateEvent(event); err != nil {
+			t.Fatalf("CreateEvent: %v", err)
+		}
+	}
+
+	if err := users.ScheduleUserDeletion(user.ID, now.Add(-time.Hour), now.Add(-time.Minute)); err != nil {
+		t.Fatalf("ScheduleUserDeletion: %v", err)
+	}
+	anonymized, err := users.AnonymizeDeletedUsers(now)
+	if err != nil {
+		t.Fatalf("AnonymizeDeletedUsers: %v", err)
+	}
+	var purged *domain.AnonymizedUser
+	for _, candidate := range anonymized {
+		if candidate.ID == user.ID {
+			purged = candidate
+		}
+	}
+	want := fmt.Sprintf("deleted-%d@deleted.invalid", user.ID)
+	if purged == nil || purged.Email != want || len(purged.FormerAddresses) != 1 || purged.FormerAddresses[0] != email {
+		t.Fatalf("anonymized users = %+v, want %d with former address %s", anonymized, user.ID, email)
+	}
+
+	for _, table := range []string{"sms_codes", "user_login_devices", "api_keys"} {
+		var count int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE user_id = $1`, user.ID).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Errorf("%s kept %d rows of the purged user", table, count)
+		}
+	}
+
+	// Nothing but a redaction of a purged user's event may change an event
+	if _, err := db.Exec(`UPDATE audit_events SET metadata = '{}', redacted_at = $1 WHERE id = $2`, now, mention.ID); err == nil {
+		t.Error("event not about a purged user was redacted")
+	}
+	if _, err := db.Exec(`UPDATE audit_events SET outcome = 'success', redacted_at = $1 WHERE id = $2`, now, login.ID); err == nil {
+		t.Error("audit event outcome was changed")
+	}
+
+	if err := audit.RedactUserEvents(purged.ID, purged.FormerAddresses, purged.Email, now); err != nil {
+		t.Fatalf("RedactUserEvents: %v", err)
+	}
+
+	events, err := audit.ListChain(mention.ID-1, 3)
+	if err != nil {
+		t.Fatalf("ListChain: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("ListChain returned %d events", len(events))
+	}
+	if got := events[0]; got.RedactedAt != nil || got.Metadata["email"] != email {
+		t.Errorf("event not about the user was redacted: %+v", got)
+	}
+	redacted := events[1]
+	if redacted.RedactedAt == nil || redacted.Metadata["email"] != want || redacted.Metadata["error"] != "invalid credentials" || redacted.Hash != login.Hash || redacted.MetadataHash != login.MetadataHash {
+		t.Errorf("login event = %+v, want email redacted to %s", redacted, want)
+	}
+
+	// The redaction is recorded in the chain, committing to the new metadata
+	record := events[2]
+	metadataHash, err := redacted.ComputeMetadataHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.EventType != domain.AuditEventRedacted || record.SubjectID == nil || *record.SubjectID != user.ID || record.PrevHash != login.Hash {
+		t.Errorf("redaction record = %+v", record)
+	}
+	if got := record.RedactedMetadataHashes()[login.ID]; got != metadataHash {
+		t.Errorf("redaction record commits to %q, want %q", got, metadataHash)
+	}
+}
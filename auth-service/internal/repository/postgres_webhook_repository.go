@@ -0,0 +1,371 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type postgresWebhookRepository struct {
+	db dbtx
+}
+
+func NewPostgresWebhookRepository(db *sql.DB) WebhookRepository {
+	return &postgresWebhookRepository{db: db}
+}
+
+const webhookColumns = `id, url, description, secret, events, active, created_by, created_at, updated_at`
+
+const webhookDeliveryColumns = `id, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+	last_error, last_status_code, replay_of, delivered_at, created_at, updated_at`
+
+func (r *postgresWebhookRepository) CreateWebhook(webhook *domain.Webhook) error {
+	webhook.CreatedAt = time.Now()
+	webhook.UpdatedAt = webhook.CreatedAt
+	query := `INSERT INTO webhooks (url, description, secret, events, active, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+
+	return r.db.QueryRow(query,
+		webhook.URL,
+		webhook.Description,
+		webhook.Secret,
+		pq.Array(webhook.Events),
+		webhook.Active,
+		webhook.CreatedBy,
+		webhook.CreatedAt,
+		webhook.UpdatedAt,
+	).Scan(&webhook.ID)
+}
+
+func (r *postgresWebhookRepository) FindWebhookByID(webhookID int64) (*domain.Webhook, error) {
+	rows, err := r.db.Query(`SELECT `+webhookColumns+` FROM webhooks WHERE id = $1`, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	webhooks, err := scanWebhooks(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(webhooks) == 0 {
+		return nil, domain.ErrWebhookNotFound
+	}
+	return webhooks[0], nil
+}
+
+func (r *postgresWebhookRepository) ListWebhooks() ([]*domain.Webhook, error) {
+	rows, err := r.db.Query(`SELECT ` + webhookColumns + ` FROM webhooks ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhooks(rows)
+}
+
+func (r *postgresWebhookRepository) UpdateWebhook(webhook *domain.Webhook) error {
+	webhook.UpdatedAt = time.Now()
+	result, err := r.db.Exec(`UPDATE webhooks SET url = $1, description = $2, events = $3, active = $4, updated_at = $5 WHERE id = $6`,
+		webhook.URL, webhook.Description, pq.Array(webhook.Events), webhook.Active, webhook.UpdatedAt, webhook.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return domain.ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (r *postgresWebhookRepository) DeleteWebhook(webhookID int64) error {
+	result, err := r.db.Exec(`DELETE FROM webhooks WHERE id = $1`, webhookID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return domain.ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (r *postgresWebhookRepository) RotateWebhookSecret(webhookID int64, secret string) error {
+	result, err := r.db.Exec(`UPDATE webhooks SET secret = $1, updated_at = $2 WHERE id = $3`, secret, time.Now(), webhookID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return domain.ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (r *postgresWebhookRepository) EnqueueWebhookEvent(event *domain.WebhookEvent) (int, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode %s webhook event: %w", event.Type, err)
+	}
+
+	now := time.Now()
+	query := `INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload, status, next_attempt_at, created_at, updated_at)
+		SELECT id, $1, $2, $3, $4, $5, $5, $5 FROM webhooks
+		WHERE active AND ($2 = ANY(events) OR $6 = ANY(events))`
+
+	result, err := r.db.Exec(query, event.ID, event.Type, string(payload), domain.WebhookDeliveryPending, now, domain.WebhookEventAll)
+	if err != nil {
+		return 0, err
+	}
+	queued, err := result.RowsAffected()
+	return int(queued), err
+}
+
+func (r *postgresWebhookRepository) ClaimDueDeliveries(now time.Time, lease time.Duration, limit int) ([]*domain.WebhookDelivery, error) {
+	// Deliveries to disabled webhooks wait, and resume if it is enabled
+	// again. SKIP LOCKED lets several instances poll without claiming the
+	// same rows.
+	query := `UPDATE webhook_deliveries SET attempts = attempts + 1, next_attempt_at = $2, updated_at = $1
+		WHERE id IN (
+			SELECT d.id FROM webhook_deliveries d
+			JOIN webhooks w ON w.id = d.webhook_id
+			WHERE d.status = $3 AND d.next_attempt_at <= $1 AND w.active
+			ORDER BY d.next_attempt_at
+			LIMIT $4
+			FOR UPDATE OF d SKIP LOCKED
+		)
+		RETURNING ` + webhookDeliveryColumns
+
+	rows, err := r.db.Query(query, now, now.Add(lease), domain.WebhookDeliveryPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhookDeliveries(rows)
+}
+
+func (r *postgresWebhookRepository) RecordDeliveryAttempt(attempt *domain.WebhookDeliveryAttempt) error {
+	query := `INSERT INTO webhook_delivery_attempts (delivery_id, status_code, error, response_body, duration_ms, attempted_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+
+	return r.db.QueryRow(query,
+		attempt.DeliveryID,
+		attempt.StatusCode,
+		attempt.Error,
+		attempt.ResponseBody,
+		attempt.DurationMS,
+		attempt.AttemptedAt,
+	).Scan(&attempt.ID)
+}
+
+func (r *postgresWebhookRepository) MarkDeliveryDelivered(deliveryID int64, statusCode int, deliveredAt time.Time) error {
+	_, err := r.db.Exec(`UPDATE webhook_deliveries SET status = $1, last_status_code = $2, last_error = '', delivered_at = $3, updated_at = $3
+		WHERE id = $4`,
+		domain.WebhookDeliveryDelivered, statusCode, deliveredAt, deliveryID,
+	)
+	return err
+}
+
+func (r *postgresWebhookRepository) MarkDeliveryFailed(deliveryID int64, statusCode *int, lastError string, nextAttemptAt time.Time, dead bool) error {
+	status := domain.WebhookDeliveryPending
+	if dead {
+		status = domain.WebhookDeliveryFailed
+	}
+	_, err := r.db.Exec(`UPDATE webhook_deliveries SET status = $1, last_status_code = $2, last_error = $3, next_attempt_at = $4, updated_at = $5
+		WHERE id = $6`,
+		status, statusCode, lastError, nextAttemptAt, time.Now(), deliveryID,
+	)
+	return err
+}
+
+func (r *postgresWebhookRepository) FindDeliveryByID(deliveryID int64) (*domain.WebhookDelivery, error) {
+	rows, err := r.db.Query(`SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries WHERE id = $1`, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := scanWebhookDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return nil, domain.ErrWebhookDeliveryNotFound
+	}
+	return deliveries[0], nil
+}
+
+func (r *postgresWebhookRepository) ListDeliveries(filter domain.WebhookDeliveryFilter) ([]*domain.WebhookDelivery, error) {
+	var conditions []string
+	var args []interface{}
+
+	addCondition := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.WebhookID > 0 {
+		addCondition("webhook_id = $%d", filter.WebhookID)
+	}
+	if filter.Status != "" {
+		addCondition("status = $%d", filter.Status)
+	}
+	if filter.EventType != "" {
+		addCondition("event_type = $%d", filter.EventType)
+	}
+	if filter.Cursor > 0 {
+		addCondition("id < $%d", filter.Cursor)
+	}
+
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhookDeliveries(rows)
+}
+
+func (r *postgresWebhookRepository) ListDeliveryAttempts(deliveryID int64) ([]*domain.WebhookDeliveryAttempt, error) {
+	rows, err := r.db.Query(`SELECT id, delivery_id, status_code, error, response_body, duration_ms, attempted_at
+		FROM webhook_delivery_attempts WHERE delivery_id = $1 ORDER BY id`, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []*domain.WebhookDeliveryAttempt
+	for rows.Next() {
+		attempt := &domain.WebhookDeliveryAttempt{}
+		var statusCode sql.NullInt64
+		if err := rows.Scan(
+			&attempt.ID,
+			&attempt.DeliveryID,
+			&statusCode,
+			&attempt.Error,
+			&attempt.ResponseBody,
+			&attempt.DurationMS,
+			&attempt.AttemptedAt,
+		); err != nil {
+			return nil, err
+		}
+		if statusCode.Valid {
+			code := int(statusCode.Int64)
+			attempt.StatusCode = &code
+		}
+		attempts = append(attempts, attempt)
+	}
+
+	return attempts, rows.Err()
+}
+
+func (r *postgresWebhookRepository) ReplayDelivery(deliveryID int64, now time.Time) (*domain.WebhookDelivery, error) {
+	query := `INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload, status, next_attempt_at, replay_of, created_at, updated_at)
+		SELECT webhook_id, event_id, event_type, payload, $1, $2, id, $2, $2 FROM webhook_deliveries WHERE id = $3
+		RETURNING ` + webhookDeliveryColumns
+
+	rows, err := r.db.Query(query, domain.WebhookDeliveryPending, now, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := scanWebhookDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return nil, domain.ErrWebhookDeliveryNotFound
+	}
+	return deliveries[0], nil
+}
+
+// RedactUserDeliveries matches events by the user they are about, data.user.id,
+// or the user whose login failed, data.user_id
+func (r *postgresWebhookRepository) RedactUserDeliveries(userIDs []int64, now time.Time) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	query := `UPDATE webhook_deliveries
+		SET payload = jsonb_set(payload::jsonb, '{data}', '{"redacted": true}')::text, updated_at = $2
+		WHERE COALESCE(payload::jsonb #>> '{data,user,id}', payload::jsonb #>> '{data,user_id}')::bigint = ANY($1)`
+
+	_, err := r.db.Exec(query, pq.Array(userIDs), now)
+	return err
+}
+
+func scanWebhooks(rows *sql.Rows) ([]*domain.Webhook, error) {
+	defer rows.Close()
+
+	var webhooks []*domain.Webhook
+	for rows.Next() {
+		webhook := &domain.Webhook{}
+		var createdBy sql.NullInt64
+		err := rows.Scan(
+			&webhook.ID,
+			&webhook.URL,
+			&webhook.Description,
+			&webhook.Secret,
+			pq.Array(&webhook.Events),
+			&webhook.Active,
+			&createdBy,
+			&webhook.CreatedAt,
+			&webhook.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if createdBy.Valid {
+			webhook.CreatedBy = &createdBy.Int64
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+func scanWebhookDeliveries(rows *sql.Rows) ([]*domain.WebhookDelivery, error) {
+	defer rows.Close()
+
+	var deliveries []*domain.WebhookDelivery
+	for rows.Next() {
+		delivery := &domain.WebhookDelivery{}
+		var payload string
+		var statusCode, replayOf sql.NullInt64
+		var deliveredAt sql.NullTime
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.WebhookID,
+			&delivery.EventID,
+			&delivery.EventType,
+			&payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&delivery.LastError,
+			&statusCode,
+			&replayOf,
+			&deliveredAt,
+			&delivery.CreatedAt,
+			&delivery.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = json.RawMessage(payload)
+		if statusCode.Valid {
+			code := int(statusCode.Int64)
+			delivery.LastStatusCode = &code
+		}
+		if replayOf.Valid {
+			delivery.ReplayOf = &replayOf.Int64
+		}
+		if deliveredAt.Valid {
+			delivery.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type SAMLRepository interface {
+	FindConfig(orgID int64) (*domain.SAMLConfig, error)
+	SaveConfig(cfg *domain.SAMLConfig) error
+	DeleteConfig(orgID int64) error
+	CreateRequest(orgID int64, requestID string, expiresAt time.Time) error
+	ConsumeRequest(orgID int64, requestID string, now time.Time) error
+	RecordAssertion(orgID int64, assertionID string, expiresAt time.Time) error
+}
@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type SCIMRepository interface {
+	// ListUsers returns the limit members matching filter, if any, after
+	// skipping offset, along with the total number of matches
+	ListUsers(orgID int64, filter *domain.DirectoryUserFilter, offset, limit int) ([]*domain.DirectoryUser, int, error)
+	FindUser(orgID, userID int64) (*domain.DirectoryUser, error)
+	SetExternalID(orgID, userID int64, externalID string) error
+	ListGroups(orgID int64) ([]*domain.DirectoryGroup, error)
+	FindGroup(orgID, groupID int64) (*domain.DirectoryGroup, error)
+	CreateGroup(group *domain.DirectoryGroup) error
+	UpdateGroup(group *domain.DirectoryGroup) error
+	DeleteGroup(orgID, groupID int64) error
+	ListGroupRoles(orgID, userID int64) ([]string, error)
+	RemoveUserFromGroups(orgID, userID int64) error
+}
@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type SecurityNotificationRepository interface {
+	// RecordLoginDevice notes a login by the user from device at seenAt and
+	// reports whether the user had logged in from it before
+	RecordLoginDevice(userID int64, device string, seenAt time.Time) (known bool, err error)
+	CountLoginDevices(userID int64) (int, error)
+	ListLoginDevices(userID int64) ([]*domain.LoginDevice, error)
+	ListOptOuts(userID int64) ([]string, error)
+	IsOptedOut(userID int64, notification string) (bool, error)
+	SetOptOut(userID int64, notification string, optOut bool) error
+}
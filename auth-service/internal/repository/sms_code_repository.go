@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type SMSCodeRepository interface {
+	CreateSMSCode(code *domain.SMSCode) error
+	// FindLatestSMSCode returns the code last sent to the user for purpose,
+	// whether or not it is still usable
+	FindLatestSMSCode(userID int64, purpose string) (*domain.SMSCode, error)
+	FindSMSCodeByChallenge(challengeHash string) (*domain.SMSCode, error)
+	// CountSMSCodesSince counts the codes sent to the user for any purpose
+	// since the given time
+	CountSMSCodesSince(userID int64, since time.Time) (int, error)
+	// ClaimSMSCodeAttempt counts an attempt against the code and returns its
+	// hash to compare with, failing with domain.ErrInvalidSMSCode if the
+	// code is used, expired at now or out of its maxAttempts
+	ClaimSMSCodeAttempt(codeID int64, maxAttempts int, now time.Time) (string, error)
+	// ConsumeSMSCode marks the code used at consumedAt, failing with
+	// domain.ErrInvalidSMSCode if it already was
+	ConsumeSMSCode(codeID int64, consumedAt time.Time) error
+}
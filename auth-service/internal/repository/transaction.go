@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// dbtx is the part of *sql.DB and *sql.Tx the repositories use, so that a
+// repository can be bound to a transaction
+type dbtx interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// TxRepositories are the repositories bound to a transaction. Writes through
+// them only become visible if the transaction commits.
+type TxRepositories struct {
+	Users         UserRepository
+	Invitations   InvitationRepository
+	EmailOutbox   EmailOutboxRepository
+	Webhooks      WebhookRepository
+	Organizations OrganizationRepository
+	SCIM          SCIMRepository
+	Audit         AuditRepository
+}
+
+// Transactor runs work that must succeed or fail as a whole, such as a user
+// change together with the email announcing it
+type Transactor interface {
+	// WithinTransaction calls fn with repositories bound to a new
+	// transaction, committing it if fn returns nil and rolling it back
+	// otherwise
+	WithinTransaction(fn func(repos TxRepositories) error) error
+}
+
+type postgresTransactor struct {
+	db *sql.DB
+}
+
+func NewPostgresTransactor(db *sql.DB) Transactor {
+	return &postgresTransactor{db: db}
+}
+
+func (t *postgresTransactor) WithinTransaction(fn func(repos TxRepositories) error) error {
+	return inTx(t.db, func(tx *sql.Tx) error {
+		return fn(TxRepositories{
+			Users:         &postgresUserRepository{db: tx},
+			Invitations:   &postgresInvitationRepository{db: tx},
+			EmailOutbox:   &postgresEmailOutboxRepository{db: tx},
+			Webhooks:      &postgresWebhookRepository{db: tx},
+			Organizations: &postgresOrganizationRepository{db: tx},
+			SCIM:          &postgresSCIMRepository{db: tx},
+			Audit:         &postgresAuditRepository{db: tx},
+		})
+	})
+}
+
+// inTx runs fn in a transaction on db. A repository already bound to a
+// transaction runs fn in it and leaves the commit to whoever began it.
+func inTx(db dbtx, fn func(tx *sql.Tx) error) error {
+	if tx, ok := db.(*sql.Tx); ok {
+		return fn(tx)
+	}
+
+	tx, err := db.(*sql.DB).Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
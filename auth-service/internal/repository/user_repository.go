@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/sales-tracker/auth-service/internal/domain"
 )
 
@@ -11,6 +13,19 @@ type UserRepository interface {
 	FindUserByResetToken(token string) (*domain.User, error)
 	UpdateUserPassword(userID int64, passwordHash string) error
 	UpdateUserVerificationStatus(userID int64, isVerified bool) error
+	VerifyAndClearPassword(userID int64) error
+	SetUserActive(userID int64, isActive bool) error
 	FindUserByID(userID int64) (*domain.User, error)
 	UpdateUser(user *domain.User) error
+	UpdateUserName(userID int64, name string) error
+	SetUserLocale(userID int64, locale string) error
+	SetPendingEmail(userID int64, email, token string, expiresAt time.Time) error
+	FindUserByEmailChangeToken(token string) (*domain.User, error)
+	ConfirmEmailChange(userID int64, email string) error
+	MarkEmailUndeliverable(userID int64, reason string, at time.Time) error
+	SetPhoneNumber(userID int64, phone string, verifiedAt *time.Time) error
+	SetSMSMFA(userID int64, enabled bool) error
+	ScheduleUserDeletion(userID int64, deletedAt, purgeAfter time.Time) error
+	CancelUserDeletion(userID int64) error
+	AnonymizeDeletedUsers(now time.Time) ([]*domain.AnonymizedUser, error)
 }
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+type WebhookRepository interface {
+	CreateWebhook(webhook *domain.Webhook) error
+	FindWebhookByID(webhookID int64) (*domain.Webhook, error)
+	ListWebhooks() ([]*domain.Webhook, error)
+	UpdateWebhook(webhook *domain.Webhook) error
+	// DeleteWebhook removes the webhook along with its deliveries
+	DeleteWebhook(webhookID int64) error
+	RotateWebhookSecret(webhookID int64, secret string) error
+
+	// EnqueueWebhookEvent queues a delivery of event to every active
+	// webhook subscribed to it and returns how many were queued
+	EnqueueWebhookEvent(event *domain.WebhookEvent) (int, error)
+	// ClaimDueDeliveries takes up to limit pending deliveries to active
+	// webhooks due at now, counting the attempt and hiding them from other
+	// workers until now+lease, after which an unfinished attempt is retried
+	ClaimDueDeliveries(now time.Time, lease time.Duration, limit int) ([]*domain.WebhookDelivery, error)
+	RecordDeliveryAttempt(attempt *domain.WebhookDeliveryAttempt) error
+	MarkDeliveryDelivered(deliveryID int64, statusCode int, deliveredAt time.Time) error
+	// MarkDeliveryFailed records a failed attempt. Deliveries are retried at
+	// nextAttemptAt, or given up on when dead is set.
+	MarkDeliveryFailed(deliveryID int64, statusCode *int, lastError string, nextAttemptAt time.Time, dead bool) error
+	FindDeliveryByID(deliveryID int64) (*domain.WebhookDelivery, error)
+	ListDeliveries(filter domain.WebhookDeliveryFilter) ([]*domain.WebhookDelivery, error)
+	ListDeliveryAttempts(deliveryID int64) ([]*domain.WebhookDeliveryAttempt, error)
+	// ReplayDelivery queues a new delivery of the payload of deliveryID to
+	// the same webhook
+	ReplayDelivery(deliveryID int64, now time.Time) (*domain.WebhookDelivery, error)
+	// RedactUserDeliveries replaces the data of every delivered or queued
+	// event about one of the users, keeping its ID and type
+	RedactUserDeliveries(userIDs []int64, now time.Time) error
+}
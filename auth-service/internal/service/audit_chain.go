@@ -0,0 +1,269 @@
+package service
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/repository"
+)
+
+const auditChainBatchSize = 1000
+
+// AuditChainReport summarizes a walk over the audit hash chain. BrokenAt is
+// set to the first event that fails verification, with Reason explaining why.
+// Redacted counts the verified events whose metadata was redacted.
+type AuditChainReport struct {
+	Verified  int64
+	Unchained int64
+	Redacted  int64
+	Head      *domain.AuditEvent
+	BrokenAt  *domain.AuditEvent
+	Reason    string
+}
+
+// VerifyAuditChain walks every audit event in ID order, recomputing hashes
+// and links. Events recorded before hashing was introduced are counted as
+// unchained as long as they precede the first hashed event. The metadata of
+// a redacted event must match what a later audit.redacted event about the
+// same user committed to. Each checkpoint must match the hash of the event
+// it names.
+func VerifyAuditChain(auditRepository repository.AuditRepository, checkpoints []*domain.AuditCheckpoint) (*AuditChainReport, error) {
+	report := &AuditChainReport{}
+
+	// Redacted events and the redaction records accounting for them, checked
+	// against each other once the whole chain was read
+	var redacted []*domain.AuditEvent
+	redactions := make(map[int64]*domain.AuditEvent)
+
+	pending := make(map[int64]*domain.AuditCheckpoint, len(checkpoints))
+	for _, checkpoint := range checkpoints {
+		pending[checkpoint.EventID] = checkpoint
+	}
+
+	var prevHash string
+	var afterID int64
+	chained := false
+	for {
+		events, err := auditRepository.ListChain(afterID, auditChainBatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit events after %d: %w", afterID, err)
+		}
+
+		for _, event := range events {
+			afterID = event.ID
+
+			if event.Hash == "" {
+				if chained {
+					return report.broken(event, "event has no hash"), nil
+				}
+				report.Unchained++
+				continue
+			}
+			chained = true
+
+			if event.PrevHash != prevHash {
+				return report.broken(event, "prev_hash does not match the preceding event"), nil
+			}
+
+			hash, err := event.ComputeHash()
+			if err != nil {
+				return nil, fmt.Errorf("failed to hash audit event %d: %w", event.ID, err)
+			}
+			if hash != event.Hash {
+				return report.broken(event, "stored hash does not match event content"), nil
+			}
+
+			if event.MetadataHash != "" {
+				metadataHash, err := event.ComputeMetadataHash()
+				if err != nil {
+					return nil, fmt.Errorf("failed to hash metadata of audit event %d: %w", event.ID, err)
+				}
+				if event.RedactedAt == nil && metadataHash != event.MetadataHash {
+					return report.broken(event, "stored metadata_hash does not match event metadata"), nil
+				}
+			} else if event.RedactedAt != nil {
+				return report.broken(event, "redacted event has no metadata_hash"), nil
+			}
+			if event.RedactedAt != nil {
+				redacted = append(redacted, event)
+			}
+			for id := range event.RedactedMetadataHashes() {
+				redactions[id] = event
+			}
+
+			if checkpoint, ok := pending[event.ID]; ok {
+				if checkpoint.Hash != event.Hash {
+					return report.broken(event, "hash does not match signed checkpoint"), nil
+				}
+				delete(pending, event.ID)
+			}
+
+			prevHash = event.Hash
+			report.Verified++
+			report.Head = event
+		}
+
+		if len(events) < auditChainBatchSize {
+			break
+		}
+	}
+
+	for _, event := range redacted {
+		if reason := checkRedaction(event, redactions[event.ID]); reason != "" {
+			return report.broken(event, reason), nil
+		}
+		report.Redacted++
+	}
+
+	// Checkpoints naming events that no longer exist mean the tail was removed
+	for _, checkpoint := range checkpoints {
+		if _, missing := pending[checkpoint.EventID]; missing {
+			report.Reason = fmt.Sprintf("signed checkpoint references missing event %d", checkpoint.EventID)
+			report.BrokenAt = &domain.AuditEvent{ID: checkpoint.EventID, Hash: checkpoint.Hash}
+			return report, nil
+		}
+	}
+
+	return report, nil
+}
+
+// checkRedaction returns why redaction does not account for the redacted
+// event, or "" if it does
+func checkRedaction(event, redaction *domain.AuditEvent) string {
+	if redaction == nil || redaction.ID < event.ID {
+		return "redacted event is not accounted for by a later audit.redacted event"
+	}
+
+	if redaction.SubjectID == nil ||
+		!sameUser(event.SubjectID, *redaction.SubjectID) && !sameUser(event.ActorID, *redaction.SubjectID) {
+		return fmt.Sprintf("audit.redacted event %d is not about a user of the redacted event", redaction.ID)
+	}
+
+	metadataHash, err := event.ComputeMetadataHash()
+	if err != nil || metadataHash != redaction.RedactedMetadataHashes()[event.ID] {
+		return fmt.Sprintf("redacted metadata does not match audit.redacted event %d", redaction.ID)
+	}
+	return ""
+}
+
+func sameUser(userID *int64, other int64) bool {
+	return userID != nil && *userID == other
+}
+
+func (r *AuditChainReport) broken(event *domain.AuditEvent, reason string) *AuditChainReport {
+	r.BrokenAt = event
+	r.Reason = reason
+	return r
+}
+
+// AuditCheckpointer periodically signs the audit chain head and appends the
+// checkpoint as a JSON line to a file kept outside the database
+type AuditCheckpointer struct {
+	auditRepository repository.AuditRepository
+	privateKey      ed25519.PrivateKey
+	file            string
+}
+
+func NewAuditCheckpointer(auditRepository repository.AuditRepository, cfg config.AuditConfig) (*AuditCheckpointer, error) {
+	privateKey, err := ParseAuditCheckpointKey(cfg.CheckpointKey)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.CheckpointFile == "" {
+		return nil, errors.New("audit checkpoint file is not configured")
+	}
+
+	return &AuditCheckpointer{
+		auditRepository: auditRepository,
+		privateKey:      privateKey,
+		file:            cfg.CheckpointFile,
+	}, nil
+}
+
+// ParseAuditCheckpointKey decodes a base64 Ed25519 seed into a signing key
+func ParseAuditCheckpointKey(encoded string) (ed25519.PrivateKey, error) {
+	seed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid audit checkpoint key: %w", err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid audit checkpoint key: expected %d byte seed, got %d", ed25519.SeedSize, len(seed))
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// WriteCheckpoint signs the current chain head and appends it to the
+// checkpoint file. It returns nil without writing if the chain is empty.
+func (c *AuditCheckpointer) WriteCheckpoint() (*domain.AuditCheckpoint, error) {
+	head, err := c.auditRepository.LatestChainHead()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit chain head: %w", err)
+	}
+	if head == nil {
+		return nil, nil
+	}
+
+	checkpoint := &domain.AuditCheckpoint{
+		EventID:   head.ID,
+		Hash:      head.Hash,
+		CreatedAt: time.Now().UTC(),
+	}
+	checkpoint.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(c.privateKey, checkpoint.SigningPayload()))
+
+	line, err := json.Marshal(checkpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(c.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return nil, fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+
+	return checkpoint, file.Sync()
+}
+
+// ReadAuditCheckpoints loads a checkpoint file and checks every signature
+// against publicKey
+func ReadAuditCheckpoints(path string, publicKey ed25519.PublicKey) ([]*domain.AuditCheckpoint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint file: %w", err)
+	}
+	defer file.Close()
+
+	var checkpoints []*domain.AuditCheckpoint
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var checkpoint domain.AuditCheckpoint
+		if err := json.Unmarshal(scanner.Bytes(), &checkpoint); err != nil {
+			return nil, fmt.Errorf("invalid checkpoint on line %d: %w", line, err)
+		}
+
+		signature, err := base64.StdEncoding.DecodeString(checkpoint.Signature)
+		if err != nil || !ed25519.Verify(publicKey, checkpoint.SigningPayload(), signature) {
+			return nil, fmt.Errorf("invalid checkpoint signature on line %d", line)
+		}
+
+		checkpoints = append(checkpoints, &checkpoint)
+	}
+
+	return checkpoints, scanner.Err()
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/repository"
+)
+
+type fakeAuditChain struct {
+	repository.AuditRepository
+	events []*domain.AuditEvent
+}
+
+func (r *fakeAuditChain) ListChain(afterID int64, limit int) ([]*domain.AuditEvent, error) {
+	var events []*domain.AuditEvent
+	for _, event := range r.events {
+		if event.ID > afterID && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func newAuditChain(t *testing.T, emails ...string) *fakeAuditChain {
+	t.Helper()
+	chain := &fakeAuditChain{}
+	for i, email := range emails {
+		userID := int64(i + 1)
+		chain.append(t, &domain.AuditEvent{
+			EventType: domain.AuditEventLogin,
+			SubjectID: &userID,
+			Outcome:   domain.AuditOutcomeSuccess,
+			Metadata:  map[string]interface{}{"email": email},
+			CreatedAt: time.Date(2026, 1, 1, 0, i, 0, 0, time.UTC),
+		})
+	}
+	return chain
+}
+
+// append links event to the chain the way the repository does
+func (r *fakeAuditChain) append(t *testing.T, event *domain.AuditEvent) {
+	t.Helper()
+	event.ID = int64(len(r.events) + 1)
+	if len(r.events) > 0 {
+		event.PrevHash = r.events[len(r.events)-1].Hash
+	}
+
+	var err error
+	if event.MetadataHash, err = event.ComputeMetadataHash(); err != nil {
+		t.Fatal(err)
+	}
+	if event.Hash, err = event.ComputeHash(); err != nil {
+		t.Fatal(err)
+	}
+	r.events = append(r.events, event)
+}
+
+// redact replaces the email of the event with the given ID and appends the
+// audit.redacted event for userID accounting for it
+func (r *fakeAuditChain) redact(t *testing.T, eventID, userID int64) {
+	t.Helper()
+	event := r.events[eventID-1]
+	redactedAt := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	event.Metadata["email"] = "deleted@deleted.invalid"
+	event.RedactedAt = &redactedAt
+
+	metadataHash, err := event.ComputeMetadataHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.append(t, domain.NewAuditRedactionEvent(userID, map[int64]string{eventID: metadataHash}, redactedAt))
+}
+
+func TestVerifyAuditChainRedactedEvents(t *testing.T) {
+	chain := newAuditChain(t, "ana@example.com", "bo@example.com", "cy@example.com")
+	chain.redact(t, 2, 2)
+
+	report, err := VerifyAuditChain(chain, nil)
+	if err != nil {
+		t.Fatalf("VerifyAuditChain: %v", err)
+	}
+	if report.BrokenAt != nil {
+		t.Fatalf("chain broken at event %d: %s", report.BrokenAt.ID, report.Reason)
+	}
+	if report.Verified != 4 || report.Redacted != 1 {
+		t.Errorf("verified %d events, %d redacted; want 4 and 1", report.Verified, report.Redacted)
+	}
+}
+
+func TestVerifyAuditChainRejectsUnaccountedRedaction(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, chain *fakeAuditChain)
+		want   int64
+	}{
+		{
+			name: "changed metadata",
+			tamper: func(t *testing.T, chain *fakeAuditChain) {
+				chain.events[2].Metadata["email"] = "someone@example.com"
+			},
+			want: 3,
+		},
+		{
+			name: "redaction without a record",
+			tamper: func(t *testing.T, chain *fakeAuditChain) {
+				redactedAt := time.Now()
+				chain.events[1].Metadata["email"] = "deleted@deleted.invalid"
+				chain.events[1].RedactedAt = &redactedAt
+			},
+			want: 2,
+		},
+		{
+			name: "metadata changed after redaction",
+			tamper: func(t *testing.T, chain *fakeAuditChain) {
+				chain.redact(t, 2, 2)
+				chain.events[1].Metadata["email"] = "someone@example.com"
+			},
+			want: 2,
+		},
+		{
+			name: "record about another user",
+			tamper: func(t *testing.T, chain *fakeAuditChain) {
+				chain.redact(t, 2, 3)
+			},
+			want: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := newAuditChain(t, "ana@example.com", "bo@example.com", "cy@example.com")
+			tt.tamper(t, chain)
+
+			report, err := VerifyAuditChain(chain, nil)
+			if err != nil {
+				t.Fatalf("VerifyAuditChain: %v", err)
+			}
+			if report.BrokenAt == nil || report.BrokenAt.ID != tt.want {
+				t.Errorf("want chain broken at event %d, got %+v", tt.want, report)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/repository"
+)
+
+// AuditLogger records security-relevant events
+type AuditLogger interface {
+	Log(event *domain.AuditEvent)
+}
+
+type AuditService struct {
+	auditRepository repository.AuditRepository
+	logger          *logrus.Logger
+}
+
+func NewAuditService(auditRepository repository.AuditRepository) *AuditService {
+	return &AuditService{
+		auditRepository: auditRepository,
+		logger:          logrus.New(),
+	}
+}
+
+// Log persists the event. Failures are logged rather than returned so that
+// an audit outage never blocks the action being audited.
+func (s *AuditService) Log(event *domain.AuditEvent) {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+
+	if err := s.auditRepository.CreateEvent(event); err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"event_type": event.EventType,
+			"outcome":    event.Outcome,
+		}).Errorf("Failed to write audit event: %v", err)
+	}
+}
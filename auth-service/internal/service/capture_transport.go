@@ -0,0 +1,126 @@
+package service
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCapturedEmails bounds the memory used by the capture transport; the
+// oldest messages are dropped first
+const maxCapturedEmails = 1000
+
+// CapturedEmail is a message kept by the capture transport
+type CapturedEmail struct {
+	ID        int64     `json:"id"`
+	From      string    `json:"from"`
+	To        []string  `json:"to"`
+	Subject   string    `json:"subject"`
+	Text      string    `json:"text"`
+	HTML      string    `json:"html,omitempty"`
+	MessageID string    `json:"message_id"`
+	Date      time.Time `json:"date"`
+	Raw       string    `json:"raw"`
+}
+
+// CaptureFilter narrows a query of captured emails. Zero values are
+// ignored; To matches any recipient and Subject any part of the subject,
+// both case-insensitively.
+type CaptureFilter struct {
+	To      string
+	Subject string
+	AfterID int64
+}
+
+func (f CaptureFilter) matches(email *CapturedEmail) bool {
+	if email.ID <= f.AfterID {
+		return false
+	}
+	if f.Subject != "" && !strings.Contains(strings.ToLower(email.Subject), strings.ToLower(f.Subject)) {
+		return false
+	}
+	if f.To == "" {
+		return true
+	}
+	for _, recipient := range email.To {
+		if strings.EqualFold(recipient, f.To) {
+			return true
+		}
+	}
+	return false
+}
+
+// CaptureTransport keeps messages in memory so integration tests can read
+// the links they carry
+type CaptureTransport struct {
+	mu     sync.Mutex
+	nextID int64
+	emails []*CapturedEmail
+}
+
+func NewCaptureTransport() *CaptureTransport {
+	return &CaptureTransport{}
+}
+
+func (t *CaptureTransport) Deliver(msg *MailMessage) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.nextID++
+	t.emails = append(t.emails, &CapturedEmail{
+		ID:        t.nextID,
+		From:      msg.From.Address,
+		To:        msg.Recipients(),
+		Subject:   msg.Subject,
+		Text:      msg.Text,
+		HTML:      msg.HTML,
+		MessageID: msg.MessageID,
+		Date:      msg.Date,
+		Raw:       string(data),
+	})
+	if len(t.emails) > maxCapturedEmails {
+		t.emails = t.emails[len(t.emails)-maxCapturedEmails:]
+	}
+	return nil
+}
+
+// Emails returns the captured emails matching filter, oldest first
+func (t *CaptureTransport) Emails(filter CaptureFilter) []*CapturedEmail {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	emails := []*CapturedEmail{}
+	for _, email := range t.emails {
+		if filter.matches(email) {
+			emails = append(emails, email)
+		}
+	}
+	return emails
+}
+
+// Latest returns the most recent captured email matching filter, or nil
+func (t *CaptureTransport) Latest(filter CaptureFilter) *CapturedEmail {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i := len(t.emails) - 1; i >= 0; i-- {
+		if filter.matches(t.emails[i]) {
+			return t.emails[i]
+		}
+	}
+	return nil
+}
+
+// Clear forgets every captured email. IDs keep increasing, so a test can
+// still use AfterID across a clear.
+func (t *CaptureTransport) Clear() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.emails = nil
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/emersion/go-msgauth/dkim"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+)
+
+const (
+	dkimTestDomain   = "sales-tracker.example"
+	dkimTestSelector = "mail2024"
+)
+
+// newTestDKIMSigner writes a freshly generated key where NewDKIMSigner
+// loads it from and returns the signer with a TXT lookup publishing the
+// public half
+func newTestDKIMSigner(t *testing.T) (*DKIMSigner, func(string) ([]string, error)) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate DKIM key: %v", err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "dkim.pem")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := NewDKIMSigner(config.DKIMConfig{
+		Domain:         dkimTestDomain,
+		Selector:       dkimTestSelector,
+		PrivateKeyFile: keyFile,
+	})
+	if err != nil {
+		t.Fatalf("NewDKIMSigner: %v", err)
+	}
+
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(publicKey)
+	lookupTXT := func(name string) ([]string, error) {
+		if name != dkimTestSelector+"._domainkey."+dkimTestDomain {
+			return nil, fmt.Errorf("no TXT record for %s", name)
+		}
+		return []string{record}, nil
+	}
+	return signer, lookupTXT
+}
+
+func verifyDKIM(t *testing.T, message []byte, lookupTXT func(string) ([]string, error)) *dkim.Verification {
+	t.Helper()
+
+	verifications, err := dkim.VerifyWithOptions(bytes.NewReader(message), &dkim.VerifyOptions{LookupTXT: lookupTXT})
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if len(verifications) != 1 {
+		t.Fatalf("found %d signatures, want 1", len(verifications))
+	}
+	return verifications[0]
+}
+
+func TestDKIMSignerSignsMailMessages(t *testing.T) {
+	signer, lookupTXT := newTestDKIMSigner(t)
+
+	tests := []struct {
+		name    string
+		content *EmailContent
+	}{
+		{
+			name:    "plain text",
+			content: &EmailContent{Subject: "Verify your email", Text: "Open the link to verify your email.\n"},
+		},
+		{
+			name: "multipart",
+			content: &EmailContent{
+				Subject: "Redefinição de senha",
+				Text:    "Olá,\n\nUse o link abaixo.\n",
+				HTML:    "<p>Olá,</p><p>Use o link abaixo.</p>\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := fixedMailMessage(t, []string{"Ana Lima <ana@example.com>"}, tt.content)
+			msg.DKIM = signer
+			signed, err := msg.Bytes()
+			if err != nil {
+				t.Fatalf("Bytes: %v", err)
+			}
+			if !bytes.HasPrefix(signed, []byte("DKIM-Signature:")) {
+				t.Fatalf("message does not start with a DKIM-Signature header:\n%s", signed)
+			}
+
+			verification := verifyDKIM(t, signed, lookupTXT)
+			if verification.Err != nil {
+				t.Fatalf("signature does not verify: %v", verification.Err)
+			}
+			if verification.Domain != dkimTestDomain {
+				t.Errorf("signing domain = %q, want %q", verification.Domain, dkimTestDomain)
+			}
+			signedHeaders := make(map[string]bool)
+			for _, key := range verification.HeaderKeys {
+				signedHeaders[key] = true
+			}
+			for _, key := range []string{"From", "To", "Subject", "Date", "Message-ID"} {
+				if !signedHeaders[key] {
+					t.Errorf("%s is not signed; signed headers are %v", key, verification.HeaderKeys)
+				}
+			}
+		})
+	}
+}
+
+func TestDKIMSignatureCoversContent(t *testing.T) {
+	signer, lookupTXT := newTestDKIMSigner(t)
+	msg := fixedMailMessage(t, []string{"ana@example.com"}, &EmailContent{
+		Subject: "Reset your password",
+		Text:    "Open https://app.example.com/reset?token=abc to reset your password.\n",
+		HTML:    "<p>Open the link to reset your password.</p>\n",
+	})
+	msg.DKIM = signer
+	signed, err := msg.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+
+	tampered := map[string][]byte{
+		"subject": bytes.Replace(signed, []byte("Subject: Reset your password"), []byte("Subject: Reset your account"), 1),
+		"body":    bytes.Replace(signed, []byte("token=3Dabc"), []byte("token=3Dxyz"), 1),
+		// Headers a signature lists but the message lacks, here the
+		// transfer encoding of a multipart message, cannot be added
+		"added header": bytes.Replace(signed, []byte("MIME-Version: 1.0\r\n"), []byte("MIME-Version: 1.0\r\nContent-Transfer-Encoding: 8bit\r\n"), 1),
+	}
+	for name, message := range tampered {
+		t.Run(name, func(t *testing.T) {
+			if bytes.Equal(message, signed) {
+				t.Fatal("tampering did not change the message")
+			}
+			if verification := verifyDKIM(t, message, lookupTXT); verification.Err == nil {
+				t.Error("tampered message still verifies")
+			}
+		})
+	}
+}
+
+func TestNewDKIMSignerConfig(t *testing.T) {
+	signer, err := NewDKIMSigner(config.DKIMConfig{Domain: dkimTestDomain, Selector: dkimTestSelector})
+	if err != nil || signer != nil {
+		t.Errorf("NewDKIMSigner without a key file = %v, %v; want no signer", signer, err)
+	}
+
+	if _, err := NewDKIMSigner(config.DKIMConfig{Selector: dkimTestSelector, PrivateKeyFile: "dkim.pem"}); err == nil {
+		t.Error("NewDKIMSigner accepted a key without a domain")
+	}
+	if _, err := NewDKIMSigner(config.DKIMConfig{Domain: dkimTestDomain, Selector: dkimTestSelector, PrivateKeyFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Error("NewDKIMSigner accepted a missing key file")
+	}
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+// EmailLinks builds the single-use links put in emails. Each link opens a
+// page of the frontend client chosen by the request's LinkHint, with the
+// token added to the page's query string.
+type EmailLinks struct {
+	config *config.Config
+}
+
+// NewEmailLinks checks that the configured frontend pages and redirects are
+// absolute URLs
+func NewEmailLinks(config *config.Config) (*EmailLinks, error) {
+	for clientID, client := range config.Frontend.Clients {
+		pages := []string{client.PasswordResetURL, client.VerificationURL, client.EmailChangeURL, client.InvitationURL}
+		for _, page := range append(pages, client.AllowedRedirects...) {
+			if page == "" {
+				continue
+			}
+			if u, err := url.Parse(page); err != nil || u.Scheme == "" {
+				return nil, fmt.Errorf("frontend client %s: %q is not an absolute URL", clientID, page)
+			}
+		}
+	}
+
+	return &EmailLinks{
+		config: config,
+	}, nil
+}
+
+// Check reports whether hint names a configured client and, if it asks for
+// a redirect, whether the client allows it
+func (l *EmailLinks) Check(hint domain.LinkHint) error {
+	_, err := l.resolve(hint)
+	return err
+}
+
+func (l *EmailLinks) Verification(hint domain.LinkHint, token string) string {
+	return l.link(hint, func(c config.FrontendClientConfig) string { return c.VerificationURL }, l.config.Verification, token)
+}
+
+// PasswordReset links to the page that posts the new password back
+func (l *EmailLinks) PasswordReset(hint domain.LinkHint, token string) string {
+	return l.link(hint, func(c config.FrontendClientConfig) string { return c.PasswordResetURL }, l.config.PasswordReset, token)
+}
+
+func (l *EmailLinks) EmailChange(hint domain.LinkHint, token string) string {
+	return l.link(hint, func(c config.FrontendClientConfig) string { return c.EmailChangeURL }, l.config.EmailChange, token)
+}
+
+func (l *EmailLinks) Invitation(hint domain.LinkHint, token string) string {
+	return l.link(hint, func(c config.FrontendClientConfig) string { return c.InvitationURL }, l.config.Invitation, token)
+}
+
+// link adds token to the page opened for hint: its redirect, else the
+// client's page, else fallbackPath under base_url. A hint that fails Check
+// is ignored in favor of the default client.
+func (l *EmailLinks) link(hint domain.LinkHint, page func(config.FrontendClientConfig) string, fallbackPath, token string) string {
+	target, err := l.resolve(hint)
+	if err != nil {
+		target, _ = l.resolve(domain.LinkHint{})
+	}
+
+	pageURL := target.redirect
+	if pageURL == "" {
+		pageURL = page(target.client)
+	}
+	if pageURL == "" {
+		pageURL = l.config.BaseURL + fallbackPath
+	}
+
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return fmt.Sprintf("%s?token=%s", pageURL, url.QueryEscape(token))
+	}
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+type linkTarget struct {
+	client   config.FrontendClientConfig
+	redirect string
+}
+
+func (l *EmailLinks) resolve(hint domain.LinkHint) (linkTarget, error) {
+	clientID := strings.ToLower(hint.ClientID)
+	if clientID == "" {
+		clientID = strings.ToLower(l.config.Frontend.DefaultClient)
+	}
+
+	// The default client needs no configuration; its links then open the
+	// service's own endpoints
+	client, ok := l.config.Frontend.Clients[clientID]
+	if !ok && hint.ClientID != "" {
+		return linkTarget{}, domain.ErrUnknownFrontendClient
+	}
+
+	if hint.Redirect != "" && !redirectAllowed(client.AllowedRedirects, hint.Redirect) {
+		return linkTarget{}, domain.ErrRedirectNotAllowed
+	}
+	return linkTarget{client: client, redirect: hint.Redirect}, nil
+}
+
+// redirectAllowed matches redirect against allowed exactly or, for entries
+// ending in "/", by prefix. Redirects climbing out of a prefix with ".."
+// never match.
+func redirectAllowed(allowed []string, redirect string) bool {
+	u, err := url.Parse(redirect)
+	if err != nil || u.Scheme == "" || u.Fragment != "" || strings.Contains(u.Path, "..") {
+		return false
+	}
+	for _, entry := range allowed {
+		if redirect == entry || strings.HasSuffix(entry, "/") && strings.HasPrefix(redirect, entry) {
+			return true
+		}
+	}
+	return false
+}
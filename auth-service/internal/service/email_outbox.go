@@ -0,0 +1,88 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/repository"
+)
+
+// EmailOutbox delivers the emails queued in the outbox through an
+// EmailService, retrying failures with exponential backoff
+type EmailOutbox struct {
+	outboxRepository repository.EmailOutboxRepository
+	emailService     EmailService
+	config           config.EmailOutboxConfig
+	logger           *logrus.Logger
+}
+
+func NewEmailOutbox(outboxRepository repository.EmailOutboxRepository, emailService EmailService, config config.EmailOutboxConfig) *EmailOutbox {
+	return &EmailOutbox{
+		outboxRepository: outboxRepository,
+		emailService:     emailService,
+		config:           config,
+		logger:           logrus.New(),
+	}
+}
+
+// DeliverDue makes one attempt at up to a batch of due emails and returns
+// how many were claimed. Delivery failures are recorded on the email rather
+// than returned.
+func (o *EmailOutbox) DeliverDue() (int, error) {
+	emails, err := o.outboxRepository.ClaimDueEmails(time.Now(), o.config.SendTimeout, o.config.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, email := range emails {
+		sendErr := o.emailService.Send(email)
+		if sendErr == nil {
+			err = o.outboxRepository.MarkEmailSent(email.ID, time.Now())
+		} else {
+			err = o.recordFailure(email, sendErr)
+		}
+		if err != nil {
+			// The attempt is retried once its send timeout has passed
+			o.logger.Errorf("Failed to record delivery of outbox email %d: %v", email.ID, err)
+		}
+	}
+
+	return len(emails), nil
+}
+
+// recordFailure schedules the next attempt, or dead-letters the email when
+// it is out of attempts or can never be delivered
+func (o *EmailOutbox) recordFailure(email *domain.OutboxEmail, sendErr error) error {
+	dead := email.Attempts >= o.config.MaxAttempts ||
+		errors.Is(sendErr, domain.ErrInvalidEmailAddress) ||
+		errors.Is(sendErr, domain.ErrEmailUndeliverable)
+	fields := logrus.Fields{
+		"email_id": email.ID,
+		"template": email.Template,
+		"attempt":  email.Attempts,
+	}
+	if dead {
+		o.logger.WithFields(fields).Errorf("Dead-lettering email: %v", sendErr)
+	} else {
+		o.logger.WithFields(fields).Warnf("Failed to send email: %v", sendErr)
+	}
+
+	return o.outboxRepository.MarkEmailFailed(email.ID, sendErr.Error(), time.Now().Add(o.retryDelay(email.Attempts)), dead)
+}
+
+// retryDelay is the wait after the given number of failed attempts: the
+// configured retry delay, doubled for every attempt after the first
+func (o *EmailOutbox) retryDelay(attempts int) time.Duration {
+	delay := o.config.RetryDelay
+	for i := 1; i < attempts && delay < o.config.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > o.config.MaxRetryDelay {
+		delay = o.config.MaxRetryDelay
+	}
+	return delay
+}
@@ -2,92 +2,50 @@ package service
 
 import (
 	"fmt"
-	"log"
-	"net/smtp"
+
 	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
 )
 
+// EmailService renders a queued email's template in its locale and
+// delivers it to the recipient
 type EmailService interface {
-	SendVerificationEmail(to string, verificationURL string) error
-	SendPasswordResetEmail(to string, resetURL string) error
+	Send(email *domain.OutboxEmail) error
 }
 
-type SMTPService struct {
-	config *config.Config
+// Mailer is the EmailService that renders templates into messages and hands
+// them to the configured MailTransport
+type Mailer struct {
+	config    *config.Config
+	templates *EmailTemplates
+	transport MailTransport
+	dkim      *DKIMSigner
 }
 
-func NewSMTPService(config *config.Config) *SMTPService {
-	return &SMTPService{
-		config: config,
+// NewMailer returns a Mailer sending through transport. Messages are DKIM
+// signed when dkim is non-nil.
+func NewMailer(config *config.Config, templates *EmailTemplates, transport MailTransport, dkim *DKIMSigner) *Mailer {
+	return &Mailer{
+		config:    config,
+		templates: templates,
+		transport: transport,
+		dkim:      dkim,
 	}
 }
 
-func (s *SMTPService) SendVerificationEmail(to string, verificationURL string) error {
-	from := s.config.SMTP.From
-	fromName := s.config.SMTP.FromName
-	subject := "Verify Your Email Address"
-	body := fmt.Sprintf(`
-Dear user,
-
-Please verify your email address by clicking on the link below:
-
-%s
-
-If you didn't create an account, please ignore this email.
-
-Best regards,
-The Sales Tracker Team
-`, verificationURL)
-
-	return s.sendEmail(to, from, fromName, subject, body)
-}
-
-func (s *SMTPService) SendPasswordResetEmail(to string, resetURL string) error {
-	from := s.config.SMTP.From
-	fromName := s.config.SMTP.FromName
-	subject := "Password Reset Request"
-	body := fmt.Sprintf(`
-Dear user,
-
-We received a request to reset your password. Click the link below to set a new password:
-
-%s
-
-This link will expire in 24 hours.
-
-If you didn't request a password reset, please ignore this email or contact support if you have any concerns.
-
-Best regards,
-The Sales Tracker Team
-`, resetURL)
-
-	return s.sendEmail(to, from, fromName, subject, body)
-}
-
-func (s *SMTPService) sendEmail(to, from, fromName, subject, body string) error {
-	// Log SMTP configuration for debugging
-	log.Printf("Sending email to %s via %s:%s\n", to, s.config.SMTP.Host, s.config.SMTP.Port)
-
-	msg := []byte(fmt.Sprintf("From: %s <%s>\r\nTo: %s\r\nSubject: %s\r\n\r\n%s",
-		fromName,
-		from,
-		to,
-		subject,
-		body))
-
-
-	auth := smtp.PlainAuth(
-		"",
-		s.config.SMTP.User,
-		s.config.SMTP.Pass,
-		s.config.SMTP.Host,
-	)
+func (m *Mailer) Send(email *domain.OutboxEmail) error {
+	content, err := m.templates.Render(email.Template, email.Locale, email.Data)
+	if err != nil {
+		return fmt.Errorf("rendering %s email: %w", email.Template, err)
+	}
 
-	return smtp.SendMail(
-		fmt.Sprintf("%s:%s", s.config.SMTP.Host, s.config.SMTP.Port),
-		auth,
-		from,
-		[]string{to},
-		msg,
-	)
+	msg, err := NewMailMessage(m.config.SMTP.FromName, m.config.SMTP.From, []string{email.Recipient}, content)
+	if err != nil {
+		return err
+	}
+	// Every attempt at an outbox email carries the same key, so providers
+	// that honor it send the email once however often it is retried
+	msg.IdempotencyKey = fmt.Sprintf("email-outbox-%d", email.ID)
+	msg.DKIM = m.dkim
+	return m.transport.Deliver(msg)
 }
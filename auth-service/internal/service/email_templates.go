@@ -0,0 +1,245 @@
+package service
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+// Names of the email templates. Each is a <locale>/<name>.txt text/template
+// that defines "subject" and whose body is the plain-text part, plus an
+// optional <locale>/<name>.html html/template defining "content", which is
+// rendered inside layout.html. <locale>/partials.txt and partials.html hold
+// definitions shared by a locale's templates.
+const (
+	EmailTemplateVerification            = "verification"
+	EmailTemplatePasswordReset           = "password_reset"
+	EmailTemplateEmailChangeConfirmation = "email_change_confirmation"
+	EmailTemplateEmailChangeNotice       = "email_change_notice"
+	EmailTemplateInvitation              = "invitation"
+	EmailTemplateSecurityAlert           = "security_alert"
+)
+
+const (
+	emailLayoutFile   = "layout.html"
+	emailPartialsName = "partials"
+)
+
+//go:embed templates/email
+var embeddedEmailTemplates embed.FS
+
+// EmailContent is a rendered email. HTML is empty for text-only templates.
+type EmailContent struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// EmailTemplates renders transactional emails in the recipient's language.
+// A template is looked up from the most to the least specific form of the
+// locale ("pt-br", then "pt") before falling back to the default locale.
+type EmailTemplates struct {
+	brand         config.BrandConfig
+	defaultLocale string
+	templates     map[string]map[string]*emailTemplate // by locale, then name
+}
+
+var emailTemplateFuncs = map[string]interface{}{
+	"humanize": func(s string) string {
+		return strings.ReplaceAll(s, "_", " ")
+	},
+	// action passes the template data on to the "action" button partial
+	// together with its label
+	"action": func(data map[string]interface{}, label string) map[string]interface{} {
+		values := make(map[string]interface{}, len(data)+1)
+		for key, value := range data {
+			values[key] = value
+		}
+		values["Label"] = label
+		return values
+	},
+}
+
+// LoadEmailTemplates parses the embedded templates and those in
+// cfg.TemplateDir, whose files replace embedded files with the same path
+// and may add locales and templates
+func LoadEmailTemplates(cfg config.EmailConfig) (*EmailTemplates, error) {
+	files := make(map[string]string)
+	embedded, err := fs.Sub(embeddedEmailTemplates, "templates/email")
+	if err != nil {
+		return nil, err
+	}
+	if err := readEmailTemplateFiles(embedded, files); err != nil {
+		return nil, err
+	}
+	if cfg.TemplateDir != "" {
+		if err := readEmailTemplateFiles(os.DirFS(cfg.TemplateDir), files); err != nil {
+			return nil, fmt.Errorf("reading email templates from %s: %w", cfg.TemplateDir, err)
+		}
+	}
+
+	t := &EmailTemplates{
+		brand:         cfg.Brand,
+		defaultLocale: domain.NormalizeLocale(cfg.DefaultLocale),
+		templates:     make(map[string]map[string]*emailTemplate),
+	}
+	if t.defaultLocale == "" {
+		t.defaultLocale = "en"
+	}
+
+	for file, source := range files {
+		locale, name := path.Split(file)
+		locale = strings.TrimSuffix(locale, "/")
+		if locale == "" || strings.Contains(locale, "/") || path.Ext(name) != ".txt" {
+			continue
+		}
+		name = strings.TrimSuffix(name, ".txt")
+		if name == emailPartialsName {
+			continue
+		}
+		if domain.NormalizeLocale(locale) != locale {
+			return nil, fmt.Errorf("email template %s: locale directory must be a lower-case language tag", file)
+		}
+
+		tmpl, err := parseEmailTemplate(files, locale, t.defaultLocale, name, source)
+		if err != nil {
+			return nil, fmt.Errorf("email template %s: %w", file, err)
+		}
+		if t.templates[locale] == nil {
+			t.templates[locale] = make(map[string]*emailTemplate)
+		}
+		t.templates[locale][name] = tmpl
+	}
+
+	if len(t.templates[t.defaultLocale]) == 0 {
+		return nil, fmt.Errorf("no email templates for default locale %q", t.defaultLocale)
+	}
+	return t, nil
+}
+
+func readEmailTemplateFiles(fsys fs.FS, files map[string]string) error {
+	return fs.WalkDir(fsys, ".", func(file string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		if ext := path.Ext(file); ext != ".txt" && ext != ".html" {
+			return nil
+		}
+		source, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		files[file] = string(source)
+		return nil
+	})
+}
+
+// parseEmailTemplate parses a template with its locale's partials, or the
+// default locale's when the locale has none
+func parseEmailTemplate(files map[string]string, locale, defaultLocale, name, textSource string) (*emailTemplate, error) {
+	partials := func(ext string) string {
+		if source, ok := files[path.Join(locale, emailPartialsName+ext)]; ok {
+			return source
+		}
+		return files[path.Join(defaultLocale, emailPartialsName+ext)]
+	}
+
+	text, err := texttemplate.New(name).Funcs(emailTemplateFuncs).Parse(textSource)
+	if err == nil {
+		_, err = text.New(emailPartialsName).Parse(partials(".txt"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if text.Lookup("subject") == nil {
+		return nil, fmt.Errorf("no subject defined")
+	}
+	tmpl := &emailTemplate{text: text}
+
+	htmlSource, ok := files[path.Join(locale, name+".html")]
+	if !ok {
+		return tmpl, nil
+	}
+	tmpl.html, err = htmltemplate.New(emailLayoutFile).Funcs(emailTemplateFuncs).Parse(files[emailLayoutFile])
+	if err == nil {
+		_, err = tmpl.html.New(emailPartialsName).Parse(partials(".html"))
+	}
+	if err == nil {
+		_, err = tmpl.html.New(name).Parse(htmlSource)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tmpl.html.Lookup("content") == nil {
+		return nil, fmt.Errorf("%s.html defines no content", name)
+	}
+	return tmpl, nil
+}
+
+// Render renders the named template for locale with data, which templates
+// see alongside .Brand and .Locale
+func (t *EmailTemplates) Render(name, locale string, data map[string]interface{}) (*EmailContent, error) {
+	tmpl, locale := t.lookup(name, locale)
+	if tmpl == nil {
+		return nil, fmt.Errorf("email template %q not found", name)
+	}
+
+	values := make(map[string]interface{}, len(data)+3)
+	for key, value := range data {
+		values[key] = value
+	}
+	values["Brand"] = t.brand
+	values["Locale"] = locale
+
+	var subject, text bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", values); err != nil {
+		return nil, err
+	}
+	if err := tmpl.text.Execute(&text, values); err != nil {
+		return nil, err
+	}
+	content := &EmailContent{
+		// Subjects become a header line, so any line breaks are folded away
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+	}
+
+	if tmpl.html != nil {
+		values["Subject"] = content.Subject
+		var html bytes.Buffer
+		if err := tmpl.html.ExecuteTemplate(&html, emailLayoutFile, values); err != nil {
+			return nil, err
+		}
+		content.HTML = html.String()
+	}
+
+	return content, nil
+}
+
+func (t *EmailTemplates) lookup(name, locale string) (*emailTemplate, string) {
+	for tag := domain.NormalizeLocale(locale); tag != ""; {
+		if tmpl, ok := t.templates[tag][name]; ok {
+			return tmpl, tag
+		}
+		i := strings.LastIndex(tag, "-")
+		if i < 0 {
+			break
+		}
+		tag = tag[:i]
+	}
+	return t.templates[t.defaultLocale][name], t.defaultLocale
+}
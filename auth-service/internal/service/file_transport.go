@@ -0,0 +1,86 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+)
+
+// FileTransport writes every message to disk instead of sending it, as a
+// .eml file or into a maildir that a mail client can open
+type FileTransport struct {
+	dir     string
+	maildir bool
+}
+
+func NewFileTransport(config config.FileTransportConfig) (*FileTransport, error) {
+	if config.Dir == "" {
+		return nil, fmt.Errorf("email.file.dir is required for the file transport")
+	}
+
+	t := &FileTransport{dir: config.Dir}
+	switch config.Format {
+	case "", "eml":
+		if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+			return nil, err
+		}
+	case "maildir":
+		t.maildir = true
+		for _, sub := range []string{"tmp", "new", "cur"} {
+			if err := os.MkdirAll(filepath.Join(config.Dir, sub), 0o755); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown email.file.format %q", config.Format)
+	}
+	return t, nil
+}
+
+func (t *FileTransport) Deliver(msg *MailMessage) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	name, err := uniqueMailFileName()
+	if err != nil {
+		return err
+	}
+
+	if !t.maildir {
+		return os.WriteFile(filepath.Join(t.dir, name+".eml"), data, 0o644)
+	}
+
+	// Maildir readers only look at new/, so the message is written to tmp/
+	// first and moved over once complete
+	tmpPath := filepath.Join(t.dir, "tmp", name)
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, filepath.Join(t.dir, "new", name)); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// uniqueMailFileName returns a name that sorts by delivery time and is
+// unique across processes, in the form maildir uses: time.random.host
+func uniqueMailFileName() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "localhost"
+	}
+	now := time.Now()
+	return fmt.Sprintf("%d.%09d_%s.%s", now.Unix(), now.Nanosecond(), hex.EncodeToString(b), host), nil
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+// mailProvider maps messages and webhooks to and from one provider's API
+type mailProvider interface {
+	defaultEndpoint() string
+	// newRequest builds the send request for msg, without authentication
+	newRequest(endpoint string, msg *MailMessage) (*http.Request, error)
+	authenticate(req *http.Request)
+	// checkResponse turns a non-success response into an error, wrapping
+	// domain.ErrEmailUndeliverable when the recipient is refused for good
+	checkResponse(status int, body []byte) error
+	// parseWebhook extracts the hard bounces and complaints from a
+	// webhook payload, ignoring every other kind of event
+	parseWebhook(body []byte) ([]domain.EmailDeliveryEvent, error)
+}
+
+func newMailProvider(cfg config.HTTPMailConfig) (mailProvider, error) {
+	switch cfg.Provider {
+	case "postmark":
+		return &postmarkProvider{apiKey: cfg.APIKey, messageStream: cfg.MessageStream}, nil
+	case "sendgrid":
+		return &sendGridProvider{apiKey: cfg.APIKey}, nil
+	}
+	return nil, fmt.Errorf("unknown email.http.provider %q", cfg.Provider)
+}
+
+// HTTPMailTransport sends messages through a transactional email
+// provider's HTTP API
+type HTTPMailTransport struct {
+	provider mailProvider
+	endpoint string
+	client   *http.Client
+}
+
+func NewHTTPMailTransport(cfg config.HTTPMailConfig) (*HTTPMailTransport, error) {
+	provider, err := newMailProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("email.http.api_key is required for the http transport")
+	}
+
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = provider.defaultEndpoint()
+	}
+	return &HTTPMailTransport{
+		provider: provider,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: cfg.Timeout},
+	}, nil
+}
+
+func (t *HTTPMailTransport) Deliver(msg *MailMessage) error {
+	req, err := t.provider.newRequest(t.endpoint, msg)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if msg.IdempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", msg.IdempotencyKey)
+	}
+	t.provider.authenticate(req)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProviderResponse))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	return t.provider.checkResponse(resp.StatusCode, body)
+}
+
+// ParseEmailWebhook extracts the hard bounces and spam complaints from a
+// webhook payload sent by the configured provider
+func ParseEmailWebhook(cfg config.HTTPMailConfig, body []byte) ([]domain.EmailDeliveryEvent, error) {
+	provider, err := newMailProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return provider.parseWebhook(body)
+}
+
+func newJSONRequest(endpoint string, payload []byte) (*http.Request, error) {
+	return http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(payload))
+}
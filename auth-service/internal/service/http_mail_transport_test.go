@@ -0,0 +1,337 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+// providerStub stands in for a provider's send endpoint, recording the last
+// request and answering with status and body
+type providerStub struct {
+	server  *httptest.Server
+	request *http.Request
+	payload map[string]interface{}
+	status  int
+	body    string
+}
+
+func newProviderStub(t *testing.T) *providerStub {
+	t.Helper()
+
+	stub := &providerStub{status: http.StatusOK, body: "{}"}
+	stub.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		stub.request = r
+		stub.payload = nil
+		if err := json.Unmarshal(body, &stub.payload); err != nil {
+			t.Errorf("request body is not JSON: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(stub.status)
+		io.WriteString(w, stub.body)
+	}))
+	t.Cleanup(stub.server.Close)
+	return stub
+}
+
+func (s *providerStub) transport(t *testing.T, provider string) *HTTPMailTransport {
+	t.Helper()
+
+	transport, err := NewHTTPMailTransport(config.HTTPMailConfig{
+		Provider:      provider,
+		Endpoint:      s.server.URL + "/send",
+		APIKey:        "api-key",
+		Timeout:       5 * time.Second,
+		MessageStream: "outbound",
+	})
+	if err != nil {
+		t.Fatalf("NewHTTPMailTransport: %v", err)
+	}
+	return transport
+}
+
+func providerTestMessage(t *testing.T, html string) *MailMessage {
+	t.Helper()
+
+	msg, err := NewMailMessage("Sales Tracker", "no-reply@sales-tracker.example", []string{"Ana Lima <ana@example.com>", "bob@example.com"}, &EmailContent{
+		Subject: "Reset your password",
+		Text:    "Open the link to reset your password.",
+		HTML:    html,
+	})
+	if err != nil {
+		t.Fatalf("NewMailMessage: %v", err)
+	}
+	return msg
+}
+
+func TestHTTPMailTransportPayloads(t *testing.T) {
+	tests := []struct {
+		provider   string
+		html       string
+		authHeader string
+		authValue  string
+		want       string
+	}{
+		{
+			provider:   "postmark",
+			html:       "<p>Open the link to reset your password.</p>",
+			authHeader: "X-Postmark-Server-Token",
+			authValue:  "api-key",
+			want: `{
+				"From": "\"Sales Tracker\" <no-reply@sales-tracker.example>",
+				"To": "\"Ana Lima\" <ana@example.com>, <bob@example.com>",
+				"Subject": "Reset your password",
+				"TextBody": "Open the link to reset your password.",
+				"HtmlBody": "<p>Open the link to reset your password.</p>",
+				"MessageStream": "outbound",
+				"Metadata": {"idempotency_key": "outbox-42"}
+			}`,
+		},
+		{
+			provider:   "sendgrid",
+			html:       "<p>Open the link to reset your password.</p>",
+			authHeader: "Authorization",
+			authValue:  "Bearer api-key",
+			want: `{
+				"personalizations": [{
+					"to": [{"email": "ana@example.com", "name": "Ana Lima"}, {"email": "bob@example.com"}],
+					"custom_args": {"idempotency_key": "outbox-42"}
+				}],
+				"from": {"email": "no-reply@sales-tracker.example", "name": "Sales Tracker"},
+				"subject": "Reset your password",
+				"content": [
+					{"type": "text/plain", "value": "Open the link to reset your password."},
+					{"type": "text/html", "value": "<p>Open the link to reset your password.</p>"}
+				]
+			}`,
+		},
+		{
+			provider:   "sendgrid",
+			authHeader: "Authorization",
+			authValue:  "Bearer api-key",
+			want: `{
+				"personalizations": [{
+					"to": [{"email": "ana@example.com", "name": "Ana Lima"}, {"email": "bob@example.com"}],
+					"custom_args": {"idempotency_key": "outbox-42"}
+				}],
+				"from": {"email": "no-reply@sales-tracker.example", "name": "Sales Tracker"},
+				"subject": "Reset your password",
+				"content": [{"type": "text/plain", "value": "Open the link to reset your password."}]
+			}`,
+		},
+	}
+
+	for _, tt := range tests {
+		name := tt.provider
+		if tt.html == "" {
+			name += " text only"
+		}
+		t.Run(name, func(t *testing.T) {
+			stub := newProviderStub(t)
+			msg := providerTestMessage(t, tt.html)
+			msg.IdempotencyKey = "outbox-42"
+
+			if err := stub.transport(t, tt.provider).Deliver(msg); err != nil {
+				t.Fatalf("Deliver: %v", err)
+			}
+
+			req := stub.request
+			if req.Method != http.MethodPost || req.URL.Path != "/send" {
+				t.Errorf("request = %s %s, want POST /send", req.Method, req.URL.Path)
+			}
+			if got := req.Header.Get(tt.authHeader); got != tt.authValue {
+				t.Errorf("%s = %q, want %q", tt.authHeader, got, tt.authValue)
+			}
+			if got := req.Header.Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+			if got := req.Header.Get("Idempotency-Key"); got != "outbox-42" {
+				t.Errorf("Idempotency-Key = %q, want outbox-42", got)
+			}
+
+			var want map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatalf("invalid expected payload: %v", err)
+			}
+			if !reflect.DeepEqual(stub.payload, want) {
+				got, _ := json.MarshalIndent(stub.payload, "", "  ")
+				t.Errorf("payload = %s", got)
+			}
+		})
+	}
+}
+
+func TestHTTPMailTransportWithoutIdempotencyKey(t *testing.T) {
+	for _, provider := range []string{"postmark", "sendgrid"} {
+		t.Run(provider, func(t *testing.T) {
+			stub := newProviderStub(t)
+			if err := stub.transport(t, provider).Deliver(providerTestMessage(t, "")); err != nil {
+				t.Fatalf("Deliver: %v", err)
+			}
+
+			if _, ok := stub.request.Header["Idempotency-Key"]; ok {
+				t.Error("Idempotency-Key header sent without a key")
+			}
+			if _, ok := stub.payload["Metadata"]; ok {
+				t.Error("postmark metadata sent without a key")
+			}
+			if personalizations, ok := stub.payload["personalizations"].([]interface{}); ok {
+				if _, ok := personalizations[0].(map[string]interface{})["custom_args"]; ok {
+					t.Error("sendgrid custom_args sent without a key")
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPMailTransportErrors(t *testing.T) {
+	tests := []struct {
+		name              string
+		provider          string
+		status            int
+		body              string
+		wantUndeliverable bool
+	}{
+		{name: "postmark invalid address", provider: "postmark", status: 422, body: `{"ErrorCode": 300, "Message": "Invalid 'To' address"}`, wantUndeliverable: true},
+		{name: "postmark inactive recipient", provider: "postmark", status: 422, body: `{"ErrorCode": 406, "Message": "You tried to send to a recipient that has been marked as inactive."}`, wantUndeliverable: true},
+		{name: "postmark bad token", provider: "postmark", status: 401, body: `{"ErrorCode": 10, "Message": "Bad or missing API token"}`},
+		{name: "postmark outage", provider: "postmark", status: 503, body: `<html>unavailable</html>`},
+		{name: "sendgrid bad request", provider: "sendgrid", status: 400, body: `{"errors": [{"message": "Does not contain a valid address."}]}`},
+		{name: "sendgrid outage", provider: "sendgrid", status: 500, body: ``},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newProviderStub(t)
+			stub.status = tt.status
+			stub.body = tt.body
+
+			err := stub.transport(t, tt.provider).Deliver(providerTestMessage(t, ""))
+			if err == nil {
+				t.Fatal("Deliver succeeded, want an error")
+			}
+			if undeliverable := errors.Is(err, domain.ErrEmailUndeliverable); undeliverable != tt.wantUndeliverable {
+				t.Errorf("Deliver error = %v, undeliverable = %v, want %v", err, undeliverable, tt.wantUndeliverable)
+			}
+		})
+	}
+}
+
+func TestNewHTTPMailTransportValidatesConfig(t *testing.T) {
+	if _, err := NewHTTPMailTransport(config.HTTPMailConfig{Provider: "mailgun", APIKey: "api-key"}); err == nil {
+		t.Error("unknown provider accepted")
+	}
+	if _, err := NewHTTPMailTransport(config.HTTPMailConfig{Provider: "postmark"}); err == nil {
+		t.Error("missing API key accepted")
+	}
+}
+
+func TestParseEmailWebhook(t *testing.T) {
+	bouncedAt := time.Date(2024, time.March, 5, 17, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		provider string
+		body     string
+		want     []domain.EmailDeliveryEvent
+	}{
+		{
+			name:     "postmark hard bounce",
+			provider: "postmark",
+			body:     `{"RecordType": "Bounce", "Type": "HardBounce", "Email": "ana@example.com", "Description": "The server was unable to deliver your message", "BouncedAt": "2024-03-05T17:30:00Z"}`,
+			want: []domain.EmailDeliveryEvent{{
+				Type:       domain.EmailEventBounce,
+				Address:    "ana@example.com",
+				Reason:     "The server was unable to deliver your message",
+				OccurredAt: bouncedAt,
+			}},
+		},
+		{
+			name:     "postmark soft bounce",
+			provider: "postmark",
+			body:     `{"RecordType": "Bounce", "Type": "SoftBounce", "Email": "ana@example.com", "BouncedAt": "2024-03-05T17:30:00Z"}`,
+		},
+		{
+			name:     "postmark spam complaint",
+			provider: "postmark",
+			body:     `{"RecordType": "SpamComplaint", "Type": "SpamComplaint", "Email": "ana@example.com", "BouncedAt": "2024-03-05T17:30:00Z"}`,
+			want: []domain.EmailDeliveryEvent{{
+				Type:       domain.EmailEventComplaint,
+				Address:    "ana@example.com",
+				OccurredAt: bouncedAt,
+			}},
+		},
+		{
+			name:     "postmark delivery",
+			provider: "postmark",
+			body:     `{"RecordType": "Delivery", "Recipient": "ana@example.com"}`,
+		},
+		{
+			name:     "sendgrid batch",
+			provider: "sendgrid",
+			body: `[
+				{"email": "ana@example.com", "event": "bounce", "type": "bounce", "reason": "550 5.1.1 unknown user", "timestamp": 1709659800},
+				{"email": "bob@example.com", "event": "bounce", "type": "blocked", "reason": "550 blocked", "timestamp": 1709659800},
+				{"email": "cid@example.com", "event": "spamreport", "timestamp": 1709659800},
+				{"email": "dee@example.com", "event": "delivered", "timestamp": 1709659800}
+			]`,
+			want: []domain.EmailDeliveryEvent{
+				{
+					Type:       domain.EmailEventBounce,
+					Address:    "ana@example.com",
+					Reason:     "550 5.1.1 unknown user",
+					OccurredAt: time.Unix(1709659800, 0),
+				},
+				{
+					Type:       domain.EmailEventComplaint,
+					Address:    "cid@example.com",
+					OccurredAt: time.Unix(1709659800, 0),
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := ParseEmailWebhook(config.HTTPMailConfig{Provider: tt.provider}, []byte(tt.body))
+			if err != nil {
+				t.Fatalf("ParseEmailWebhook: %v", err)
+			}
+			if len(events) != len(tt.want) {
+				t.Fatalf("events = %+v, want %+v", events, tt.want)
+			}
+			for i := range events {
+				if events[i].Type != tt.want[i].Type || events[i].Address != tt.want[i].Address ||
+					events[i].Reason != tt.want[i].Reason || !events[i].OccurredAt.Equal(tt.want[i].OccurredAt) {
+					t.Errorf("event %d = %+v, want %+v", i, events[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseEmailWebhookRejectsMalformedPayloads(t *testing.T) {
+	tests := []struct {
+		provider string
+		body     string
+	}{
+		{provider: "postmark", body: `not json`},
+		{provider: "postmark", body: `[{"RecordType": "Bounce"}]`},
+		{provider: "sendgrid", body: `{"email": "ana@example.com", "event": "bounce"}`},
+	}
+
+	for _, tt := range tests {
+		if _, err := ParseEmailWebhook(config.HTTPMailConfig{Provider: tt.provider}, []byte(tt.body)); err == nil {
+			t.Errorf("ParseEmailWebhook(%s, %s) succeeded, want an error", tt.provider, tt.body)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+// Provider error codes for numbers that can never receive a text
+var undeliverableSMSErrors = map[int]bool{
+	21211: true, // invalid To number
+	21214: true, // To number cannot be reached
+	21408: true, // region not enabled
+	21610: true, // recipient unsubscribed
+	21614: true, // not a mobile number
+}
+
+// HTTPSMSSender sends messages through a Twilio-compatible REST API
+type HTTPSMSSender struct {
+	endpoint   string
+	accountSID string
+	authToken  string
+	from       string
+	client     *http.Client
+}
+
+func NewHTTPSMSSender(cfg config.HTTPSMSConfig) (*HTTPSMSSender, error) {
+	if cfg.AccountSID == "" || cfg.AuthToken == "" || cfg.From == "" {
+		return nil, fmt.Errorf("sms.http.account_sid, auth_token and from are required for the http sender")
+	}
+
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://api.twilio.com/2010-04-01/Accounts/%s/Messages.json", url.PathEscape(cfg.AccountSID))
+	}
+	return &HTTPSMSSender{
+		endpoint:   endpoint,
+		accountSID: cfg.AccountSID,
+		authToken:  cfg.AuthToken,
+		from:       cfg.From,
+		client:     &http.Client{Timeout: cfg.Timeout},
+	}, nil
+}
+
+func (s *HTTPSMSSender) SendSMS(to, body string) error {
+	form := url.Values{
+		"To":   {to},
+		"From": {s.from},
+		"Body": {body},
+	}
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(s.accountSID, s.authToken)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxProviderResponse))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	var result struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil || result.Message == "" {
+		return fmt.Errorf("sms provider returned %d", resp.StatusCode)
+	}
+	if undeliverableSMSErrors[result.Code] {
+		return fmt.Errorf("%w: %s", domain.ErrInvalidPhoneNumber, result.Message)
+	}
+	return fmt.Errorf("sms provider returned %d: %s (code %d)", resp.StatusCode, result.Message, result.Code)
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+// IDTokenSigner signs OpenID Connect ID tokens with RS256 so relying parties
+// can verify them against the published JWKS without sharing a secret
+type IDTokenSigner struct {
+	key   *rsa.PrivateKey
+	keyID string
+}
+
+// NewIDTokenSigner loads the RSA signing key from cfg.SigningKeyFile. When
+// no file is configured a temporary 2048-bit key is generated.
+func NewIDTokenSigner(cfg config.OAuthConfig) (*IDTokenSigner, error) {
+	var key *rsa.PrivateKey
+	if cfg.SigningKeyFile == "" {
+		generated, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		key = generated
+	} else {
+		data, err := os.ReadFile(cfg.SigningKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key: %w", err)
+		}
+		key, err = parseRSAPrivateKey(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &IDTokenSigner{key: key, keyID: jwkThumbprint(&key.PublicKey)}, nil
+}
+
+func (s *IDTokenSigner) Sign(claims *domain.IDTokenClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.keyID
+	return token.SignedString(s.key)
+}
+
+// KeySet returns the public signing key as a JWKS document
+func (s *IDTokenSigner) KeySet() domain.JSONWebKeySet {
+	n, e := jwkComponents(&s.key.PublicKey)
+	return domain.JSONWebKeySet{Keys: []domain.JSONWebKey{{
+		KeyType:   "RSA",
+		Use:       "sig",
+		Algorithm: "RS256",
+		KeyID:     s.keyID,
+		Modulus:   n,
+		Exponent:  e,
+	}}}
+}
+
+// parseRSAPrivateKey accepts PKCS#1 and PKCS#8 PEM encoded RSA keys
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("signing key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("signing key is not an RSA key")
+	}
+	return key, nil
+}
+
+func jwkComponents(key *rsa.PublicKey) (string, string) {
+	n := base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+	e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+	return n, e
+}
+
+// jwkThumbprint derives the key ID from the RFC 7638 thumbprint, so it only
+// changes when the key does
+func jwkThumbprint(key *rsa.PublicKey) string {
+	n, e := jwkComponents(key)
+	sum := sha256.Sum256([]byte(`{"e":"` + e + `","kty":"RSA","n":"` + n + `"}`))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+// Directory checks a user's password against an external directory and
+// returns their entry
+type Directory interface {
+	Authenticate(email, password string) (*domain.DirectoryIdentity, error)
+}
+
+// LDAPDirectory authenticates users against an LDAP or Active Directory
+// server. Each login opens its own connection: the service account looks
+// the user up by email, then the connection is rebound as the user's DN
+// with the password they entered.
+type LDAPDirectory struct {
+	name   string
+	config config.LDAPDirectoryConfig
+}
+
+// NewLDAPDirectory creates a client for the directory configured as name,
+// filling in Active Directory defaults for unset attributes
+func NewLDAPDirectory(name string, cfg config.LDAPDirectoryConfig) *LDAPDirectory {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(&(objectClass=person)(mail=%s))"
+	}
+	if cfg.EmailAttribute == "" {
+		cfg.EmailAttribute = "mail"
+	}
+	if cfg.NameAttribute == "" {
+		cfg.NameAttribute = "displayName"
+	}
+	if cfg.GroupAttribute == "" && cfg.GroupFilter == "" {
+		cfg.GroupAttribute = "memberOf"
+	}
+	return &LDAPDirectory{name: name, config: cfg}
+}
+
+// Authenticate binds as the user with email and password and returns their
+// entry. Unknown users, ambiguous matches and rejected passwords are all
+// reported as domain.ErrInvalidCredentials; connection and service account
+// failures as domain.ErrDirectoryUnavailable.
+func (d *LDAPDirectory) Authenticate(email, password string) (*domain.DirectoryIdentity, error) {
+	// Most servers treat a bind with an empty password as an anonymous bind
+	// that succeeds for any DN
+	if email == "" || password == "" {
+		return nil, domain.ErrInvalidCredentials
+	}
+
+	conn, err := d.connect()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrDirectoryUnavailable, err)
+	}
+	defer conn.Close()
+
+	if d.config.BindDN != "" {
+		err = conn.Bind(d.config.BindDN, d.config.BindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: service account bind: %v", domain.ErrDirectoryUnavailable, err)
+	}
+
+	attributes := []string{d.config.EmailAttribute, d.config.NameAttribute}
+	if d.config.GroupAttribute != "" {
+		attributes = append(attributes, d.config.GroupAttribute)
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		d.config.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2, // one match is expected, a second means the filter is ambiguous
+		int(d.config.Timeout/time.Second),
+		false,
+		fmt.Sprintf(d.config.UserFilter, ldap.EscapeFilter(email)),
+		attributes,
+		nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("%w: user search: %v", domain.ErrDirectoryUnavailable, err)
+	}
+	if result == nil || len(result.Entries) != 1 {
+		return nil, domain.ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, domain.ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("%w: user bind: %v", domain.ErrDirectoryUnavailable, err)
+	}
+
+	identity := &domain.DirectoryIdentity{
+		DN:    entry.DN,
+		Email: entry.GetAttributeValue(d.config.EmailAttribute),
+		Name:  entry.GetAttributeValue(d.config.NameAttribute),
+	}
+	if identity.Email == "" {
+		identity.Email = email
+	}
+	if d.config.GroupAttribute != "" {
+		identity.Groups = entry.GetAttributeValues(d.config.GroupAttribute)
+	}
+
+	if d.config.GroupFilter != "" {
+		// Group searches run as the user, who can normally read their own
+		// groups; rebind as the service account when it is configured
+		if d.config.BindDN != "" {
+			if err := conn.Bind(d.config.BindDN, d.config.BindPassword); err != nil {
+				return nil, fmt.Errorf("%w: service account bind: %v", domain.ErrDirectoryUnavailable, err)
+			}
+		}
+		groups, err := d.searchGroups(conn, entry.DN)
+		if err != nil {
+			return nil, fmt.Errorf("%w: group search: %v", domain.ErrDirectoryUnavailable, err)
+		}
+		identity.Groups = append(identity.Groups, groups...)
+	}
+
+	return identity, nil
+}
+
+func (d *LDAPDirectory) connect() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: d.config.InsecureSkipVerify}
+	conn, err := ldap.DialURL(d.config.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: d.config.Timeout}),
+		ldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(d.config.Timeout)
+
+	if d.config.StartTLS {
+		if u, err := url.Parse(d.config.URL); err == nil {
+			tlsConfig.ServerName = u.Hostname()
+		}
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+func (d *LDAPDirectory) searchGroups(conn *ldap.Conn, userDN string) ([]string, error) {
+	baseDN := d.config.GroupBaseDN
+	if baseDN == "" {
+		baseDN = d.config.BaseDN
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		baseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		0,
+		int(d.config.Timeout/time.Second),
+		false,
+		fmt.Sprintf(d.config.GroupFilter, ldap.EscapeFilter(userDN)),
+		[]string{"dn"},
+		nil,
+	))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	groups := make([]string, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		groups = append(groups, entry.DN)
+	}
+	return groups, nil
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/service/ldaptest"
+)
+
+const (
+	ldapBaseDN      = "dc=example,dc=com"
+	ldapServiceDN   = "cn=svc,ou=services,dc=example,dc=com"
+	ldapServicePass = "service-secret"
+	ldapAnaDN       = "cn=Ana,ou=people,dc=example,dc=com"
+	ldapSalesDN     = "cn=Sales,ou=groups,dc=example,dc=com"
+	ldapManagersDN  = "cn=Managers,ou=groups,dc=example,dc=com"
+)
+
+func ldapDirectoryEntries() []*ldaptest.Entry {
+	return []*ldaptest.Entry{
+		{
+			DN:       ldapServiceDN,
+			Password: ldapServicePass,
+		},
+		{
+			DN:       ldapAnaDN,
+			Password: "ana-secret",
+			Attributes: map[string][]string{
+				"objectClass": {"person"},
+				"mail":        {"ana@example.com"},
+				"displayName": {"Ana Lima"},
+				"memberOf":    {ldapSalesDN},
+			},
+		},
+		{
+			DN: ldapSalesDN,
+			Attributes: map[string][]string{
+				"objectClass": {"group"},
+				"member":      {ldapAnaDN},
+			},
+		},
+		{
+			DN: ldapManagersDN,
+			Attributes: map[string][]string{
+				"objectClass": {"group"},
+				"member":      {ldapAnaDN},
+			},
+		},
+	}
+}
+
+func ldapDirectoryConfig(server *ldaptest.Server) config.LDAPDirectoryConfig {
+	return config.LDAPDirectoryConfig{
+		URL:          server.URL(),
+		Timeout:      5 * time.Second,
+		BindDN:       ldapServiceDN,
+		BindPassword: ldapServicePass,
+		BaseDN:       ldapBaseDN,
+	}
+}
+
+func TestLDAPDirectoryAuthenticate(t *testing.T) {
+	server := ldaptest.NewServer(t, ldapDirectoryEntries()...)
+	directory := NewLDAPDirectory("corp", ldapDirectoryConfig(server))
+
+	identity, err := directory.Authenticate("ana@example.com", "ana-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	want := &domain.DirectoryIdentity{
+		DN:     ldapAnaDN,
+		Email:  "ana@example.com",
+		Name:   "Ana Lima",
+		Groups: []string{ldapSalesDN},
+	}
+	if !reflect.DeepEqual(identity, want) {
+		t.Errorf("identity = %+v, want %+v", identity, want)
+	}
+
+	// The service account looks the user up, then the connection is rebound
+	// as the user to check the password
+	if binds := server.Binds(); !reflect.DeepEqual(binds, []string{ldapServiceDN, ldapAnaDN}) {
+		t.Errorf("binds = %q", binds)
+	}
+}
+
+func TestLDAPDirectoryRejectsCredentials(t *testing.T) {
+	entries := ldapDirectoryEntries()
+	// Two entries with the same address make the user filter ambiguous
+	entries = append(entries, &ldaptest.Entry{
+		DN:       "cn=Ana Shared,ou=people,dc=example,dc=com",
+		Password: "shared-secret",
+		Attributes: map[string][]string{
+			"objectClass": {"person"},
+			"mail":        {"shared@example.com"},
+		},
+	}, &ldaptest.Entry{
+		DN:       "cn=Ana Copy,ou=people,dc=example,dc=com",
+		Password: "shared-secret",
+		Attributes: map[string][]string{
+			"objectClass": {"person"},
+			"mail":        {"shared@example.com"},
+		},
+	})
+	server := ldaptest.NewServer(t, entries...)
+	directory := NewLDAPDirectory("corp", ldapDirectoryConfig(server))
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+	}{
+		{name: "empty password", email: "ana@example.com", password: ""},
+		{name: "empty email", email: "", password: "ana-secret"},
+		{name: "wrong password", email: "ana@example.com", password: "wrong"},
+		{name: "unknown user", email: "bob@example.com", password: "ana-secret"},
+		{name: "ambiguous match", email: "shared@example.com", password: "shared-secret"},
+		{name: "filter wildcard", email: "*", password: "ana-secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := directory.Authenticate(tt.email, tt.password)
+			if !errors.Is(err, domain.ErrInvalidCredentials) {
+				t.Fatalf("Authenticate = %+v, %v; want %v", identity, err, domain.ErrInvalidCredentials)
+			}
+		})
+	}
+
+	for _, filter := range server.Filters() {
+		if filter == "(&(objectClass=person)(mail=*))" {
+			t.Errorf("email was not escaped in filter %q", filter)
+		}
+	}
+}
+
+func TestLDAPDirectoryEmptyPasswordNeverBinds(t *testing.T) {
+	server := ldaptest.NewServer(t, ldapDirectoryEntries()...)
+	directory := NewLDAPDirectory("corp", ldapDirectoryConfig(server))
+
+	if _, err := directory.Authenticate("ana@example.com", ""); !errors.Is(err, domain.ErrInvalidCredentials) {
+		t.Fatalf("Authenticate error = %v, want %v", err, domain.ErrInvalidCredentials)
+	}
+	if binds := server.Binds(); len(binds) != 0 {
+		t.Errorf("binds = %q, want none", binds)
+	}
+}
+
+func TestLDAPDirectoryGroupSearch(t *testing.T) {
+	server := ldaptest.NewServer(t, ldapDirectoryEntries()...)
+	cfg := ldapDirectoryConfig(server)
+	cfg.GroupBaseDN = "ou=groups," + ldapBaseDN
+	cfg.GroupFilter = "(&(objectClass=group)(member=%s))"
+	directory := NewLDAPDirectory("corp", cfg)
+
+	identity, err := directory.Authenticate("ana@example.com", "ana-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if want := []string{ldapSalesDN, ldapManagersDN}; !reflect.DeepEqual(identity.Groups, want) {
+		t.Errorf("groups = %q, want %q", identity.Groups, want)
+	}
+
+	// Groups are searched as the service account again, not as the user
+	if binds := server.Binds(); !reflect.DeepEqual(binds, []string{ldapServiceDN, ldapAnaDN, ldapServiceDN}) {
+		t.Errorf("binds = %q", binds)
+	}
+}
+
+func TestLDAPDirectoryUnavailable(t *testing.T) {
+	server := ldaptest.NewServer(t, ldapDirectoryEntries()...)
+
+	t.Run("service account rejected", func(t *testing.T) {
+		cfg := ldapDirectoryConfig(server)
+		cfg.BindPassword = "wrong"
+		_, err := NewLDAPDirectory("corp", cfg).Authenticate("ana@example.com", "ana-secret")
+		if !errors.Is(err, domain.ErrDirectoryUnavailable) {
+			t.Fatalf("Authenticate error = %v, want %v", err, domain.ErrDirectoryUnavailable)
+		}
+	})
+
+	t.Run("server down", func(t *testing.T) {
+		cfg := ldapDirectoryConfig(server)
+		cfg.URL = "ldap://127.0.0.1:1"
+		_, err := NewLDAPDirectory("corp", cfg).Authenticate("ana@example.com", "ana-secret")
+		if !errors.Is(err, domain.ErrDirectoryUnavailable) {
+			t.Fatalf("Authenticate error = %v, want %v", err, domain.ErrDirectoryUnavailable)
+		}
+	})
+}
@@ -0,0 +1,275 @@
+// Package ldaptest runs an in-process LDAP server for tests of directory
+// logins. It answers simple binds and searches over a fixed set of entries,
+// evaluating the equality, presence and boolean filters logins use.
+package ldaptest
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Entry is a directory entry. A bind as DN succeeds with Password, or with
+// no password at all: like most servers, the stub treats a simple bind with
+// an empty password as an unauthenticated bind.
+type Entry struct {
+	DN         string
+	Password   string
+	Attributes map[string][]string
+}
+
+// Server is a stub LDAP server listening on localhost
+type Server struct {
+	listener net.Listener
+	entries  []*Entry
+
+	mu      sync.Mutex
+	binds   []string
+	filters []string
+}
+
+// NewServer starts a server holding entries, shut down when the test ends
+func NewServer(t testing.TB, entries ...*Entry) *Server {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &Server{listener: listener, entries: entries}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+// URL is the ldap:// URL of the server
+func (s *Server) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+// Binds returns the DNs bound as so far, in order; anonymous binds are ""
+func (s *Server) Binds() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.binds...)
+}
+
+// Filters returns the search filters received so far, in order
+func (s *Server) Filters() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.filters...)
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		if len(packet.Children) < 2 {
+			return
+		}
+		messageID, _ := packet.Children[0].Value.(int64)
+		request := packet.Children[1]
+
+		var responses []*ber.Packet
+		switch request.Tag {
+		case ldap.ApplicationBindRequest:
+			responses = []*ber.Packet{s.bind(request)}
+		case ldap.ApplicationSearchRequest:
+			responses = s.search(request)
+		case ldap.ApplicationUnbindRequest:
+			return
+		default:
+			continue
+		}
+
+		for _, response := range responses {
+			envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+			envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+			envelope.AppendChild(response)
+			if _, err := conn.Write(envelope.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// bind answers a simple bind: version, name, then the password as a
+// context-specific primitive
+func (s *Server) bind(request *ber.Packet) *ber.Packet {
+	if len(request.Children) < 3 || request.Children[2].Tag != 0 {
+		return result(ldap.ApplicationBindResponse, ldap.LDAPResultAuthMethodNotSupported, "only simple binds are supported")
+	}
+	dn := request.Children[1].Data.String()
+	password := request.Children[2].Data.String()
+
+	s.mu.Lock()
+	s.binds = append(s.binds, dn)
+	s.mu.Unlock()
+
+	if password == "" {
+		return result(ldap.ApplicationBindResponse, ldap.LDAPResultSuccess, "")
+	}
+	for _, entry := range s.entries {
+		if strings.EqualFold(entry.DN, dn) && entry.Password != "" && entry.Password == password {
+			return result(ldap.ApplicationBindResponse, ldap.LDAPResultSuccess, "")
+		}
+	}
+	return result(ldap.ApplicationBindResponse, ldap.LDAPResultInvalidCredentials, "invalid credentials")
+}
+
+// search returns the entries under the base DN that match the filter,
+// stopping with sizeLimitExceeded after the size limit
+func (s *Server) search(request *ber.Packet) []*ber.Packet {
+	if len(request.Children) < 8 {
+		return []*ber.Packet{result(ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError, "malformed search")}
+	}
+	baseDN := request.Children[0].Data.String()
+	sizeLimit, _ := request.Children[3].Value.(int64)
+	filter := request.Children[6]
+	var attributes []string
+	for _, attribute := range request.Children[7].Children {
+		attributes = append(attributes, attribute.Data.String())
+	}
+
+	decompiled, _ := ldap.DecompileFilter(filter)
+	s.mu.Lock()
+	s.filters = append(s.filters, decompiled)
+	s.mu.Unlock()
+
+	var responses []*ber.Packet
+	for _, entry := range s.entries {
+		if !underBase(entry.DN, baseDN) {
+			continue
+		}
+		ok, err := matches(entry, filter)
+		if err != nil {
+			return []*ber.Packet{result(ldap.ApplicationSearchResultDone, ldap.LDAPResultUnwillingToPerform, err.Error())}
+		}
+		if !ok {
+			continue
+		}
+		if sizeLimit > 0 && int64(len(responses)) == sizeLimit {
+			return append(responses, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSizeLimitExceeded, "size limit exceeded"))
+		}
+		responses = append(responses, searchEntry(entry, attributes))
+	}
+	return append(responses, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess, ""))
+}
+
+func underBase(dn, baseDN string) bool {
+	dn, baseDN = strings.ToLower(dn), strings.ToLower(baseDN)
+	return baseDN == "" || dn == baseDN || strings.HasSuffix(dn, ","+baseDN)
+}
+
+func matches(entry *Entry, filter *ber.Packet) (bool, error) {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if ok, err := matches(entry, child); err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if ok, err := matches(entry, child); err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	case ldap.FilterNot:
+		if len(filter.Children) != 1 {
+			return false, errors.New("malformed not filter")
+		}
+		ok, err := matches(entry, filter.Children[0])
+		return !ok, err
+	case ldap.FilterEqualityMatch:
+		if len(filter.Children) != 2 {
+			return false, errors.New("malformed equality filter")
+		}
+		value := filter.Children[1].Data.String()
+		for _, v := range attributeValues(entry, filter.Children[0].Data.String()) {
+			if strings.EqualFold(v, value) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case ldap.FilterPresent:
+		return len(attributeValues(entry, filter.Data.String())) > 0, nil
+	default:
+		return false, errors.New("unsupported filter " + ldap.FilterMap[uint64(filter.Tag)])
+	}
+}
+
+// attributeValues returns the values of the named attribute, matched
+// case-insensitively; the DN is available as the "dn" attribute
+func attributeValues(entry *Entry, name string) []string {
+	if strings.EqualFold(name, "dn") {
+		return []string{entry.DN}
+	}
+	for attribute, values := range entry.Attributes {
+		if strings.EqualFold(attribute, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+func searchEntry(entry *Entry, attributes []string) *ber.Packet {
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "objectName"))
+
+	list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for name, values := range entry.Attributes {
+		if len(attributes) > 0 && !requested(attributes, name) {
+			continue
+		}
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "value"))
+		}
+		attribute.AppendChild(set)
+		list.AppendChild(attribute)
+	}
+	response.AppendChild(list)
+	return response
+}
+
+func requested(attributes []string, name string) bool {
+	for _, attribute := range attributes {
+		if strings.EqualFold(attribute, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func result(tag ber.Tag, code uint16, message string) *ber.Packet {
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, ldap.ApplicationMap[uint8(tag)])
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "diagnosticMessage"))
+	return response
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// LogTransport prints every message to a writer, normally stdout, instead
+// of sending it
+type LogTransport struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func NewLogTransport(out io.Writer) *LogTransport {
+	return &LogTransport{out: out}
+}
+
+func (t *LogTransport) Deliver(msg *MailMessage) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Messages use CRLF line endings; print them the way a terminal expects
+	_, err = fmt.Fprintf(t.out, "----- email to %s -----\n%s\n----- end of email -----\n",
+		strings.Join(msg.Recipients(), ", "),
+		strings.ReplaceAll(string(data), "\r\n", "\n"),
+	)
+	return err
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+// maxHeaderLine is the line length headers are folded at (RFC 5322 section 2.1.1)
+const maxHeaderLine = 78
+
+// MailMessage is an outgoing email. Bytes renders it as an RFC 5322
+// message with RFC 2047 encoded headers; a zero Date, MessageID or Boundary
+// is filled in with the current time or a random value, so setting them
+// makes the output reproducible. When DKIM is set the output is signed.
+// IdempotencyKey is not part of the message; transports that support it
+// pass it to the provider.
+type MailMessage struct {
+	From           *mail.Address
+	To             []*mail.Address
+	Subject        string
+	Text           string
+	HTML           string
+	Date           time.Time
+	MessageID      string
+	Boundary       string
+	DKIM           *DKIMSigner
+	IdempotencyKey string
+}
+
+// NewMailMessage validates the sender and recipients and returns a message
+// carrying content
+func NewMailMessage(fromName, from string, to []string, content *EmailContent) (*MailMessage, error) {
+	sender, err := ParseMailAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("sender: %w", err)
+	}
+	sender.Name = fromName
+
+	if len(to) == 0 {
+		return nil, fmt.Errorf("%w: no recipients", domain.ErrInvalidEmailAddress)
+	}
+	recipients := make([]*mail.Address, 0, len(to))
+	for _, address := range to {
+		recipient, err := ParseMailAddress(address)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	return &MailMessage{
+		From:    sender,
+		To:      recipients,
+		Subject: content.Subject,
+		Text:    content.Text,
+		HTML:    content.HTML,
+	}, nil
+}
+
+// ParseMailAddress parses a single RFC 5322 address, such as
+// "jane@example.com" or "Jane <jane@example.com>". Line breaks, which could
+// smuggle extra headers into a message, are rejected outright.
+func ParseMailAddress(address string) (*mail.Address, error) {
+	if strings.ContainsAny(address, "\r\n") {
+		return nil, fmt.Errorf("%w: contains a line break", domain.ErrInvalidEmailAddress)
+	}
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrInvalidEmailAddress, err)
+	}
+	return parsed, nil
+}
+
+// Recipients returns the bare addresses for the SMTP envelope
+func (m *MailMessage) Recipients() []string {
+	recipients := make([]string, len(m.To))
+	for i, recipient := range m.To {
+		recipients[i] = recipient.Address
+	}
+	return recipients
+}
+
+func (m *MailMessage) Bytes() ([]byte, error) {
+	data, err := m.unsignedBytes()
+	if err != nil || m.DKIM == nil {
+		return data, err
+	}
+	return m.DKIM.Sign(data)
+}
+
+func (m *MailMessage) unsignedBytes() ([]byte, error) {
+	if m.Date.IsZero() {
+		m.Date = time.Now()
+	}
+	if m.MessageID == "" {
+		messageID, err := newMessageID(m.From.Address)
+		if err != nil {
+			return nil, err
+		}
+		m.MessageID = messageID
+	}
+
+	to := make([]string, len(m.To))
+	for i, recipient := range m.To {
+		to[i] = recipient.String()
+	}
+	// Subjects are a single line; anything else would end the header
+	subject := strings.Join(strings.Fields(m.Subject), " ")
+
+	var buf bytes.Buffer
+	writeHeader(&buf, "From", m.From.String())
+	writeHeader(&buf, "To", strings.Join(to, ", "))
+	writeHeader(&buf, "Subject", mime.QEncoding.Encode("utf-8", subject))
+	writeHeader(&buf, "Date", m.Date.Format(time.RFC1123Z))
+	writeHeader(&buf, "Message-ID", m.MessageID)
+	writeHeader(&buf, "MIME-Version", "1.0")
+
+	if m.HTML == "" {
+		writeHeader(&buf, "Content-Type", "text/plain; charset=UTF-8")
+		writeHeader(&buf, "Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, m.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	// The plain-text part goes first so clients that can show HTML prefer it
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	if m.Boundary != "" {
+		if err := writer.SetBoundary(m.Boundary); err != nil {
+			return nil, err
+		}
+	}
+	parts := []struct{ contentType, body string }{
+		{"text/plain; charset=UTF-8", m.Text},
+		{"text/html; charset=UTF-8", m.HTML},
+	}
+	for _, part := range parts {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.contentType)
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		w, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	writeHeader(&buf, "Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": writer.Boundary()}))
+	buf.WriteString("\r\n")
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
+
+// writeHeader writes a header field, folding it at spaces to keep lines
+// within maxHeaderLine where the value allows
+func writeHeader(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	buf.WriteString(":")
+	lineLen := len(name) + 1
+	for _, word := range strings.Split(value, " ") {
+		if word != "" && lineLen > len(name)+1 && lineLen+1+len(word) > maxHeaderLine {
+			buf.WriteString("\r\n")
+			lineLen = 0
+		}
+		buf.WriteString(" ")
+		buf.WriteString(word)
+		lineLen += 1 + len(word)
+	}
+	buf.WriteString("\r\n")
+}
+
+func writeQuotedPrintable(w io.Writer, s string) error {
+	qp := quotedprintable.NewWriter(w)
+	// Normalize line endings so the encoder emits CRLF throughout
+	if _, err := qp.Write([]byte(strings.ReplaceAll(s, "\r\n", "\n"))); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// newMessageID returns a unique Message-ID in the sender's domain
+func newMessageID(sender string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	domainPart := "localhost"
+	if at := strings.LastIndex(sender, "@"); at >= 0 && at < len(sender)-1 {
+		domainPart = sender[at+1:]
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domainPart), nil
+}
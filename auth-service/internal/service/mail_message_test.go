@@ -0,0 +1,175 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// checkGolden compares got with testdata/name, rewriting the file instead
+// when the tests run with -update
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden file: %v (run the tests with -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+// fixedMailMessage builds a message whose Date, Message-ID and boundary do
+// not change between runs
+func fixedMailMessage(t *testing.T, to []string, content *EmailContent) *MailMessage {
+	t.Helper()
+
+	msg, err := NewMailMessage("Sales Tracker", "no-reply@sales-tracker.example", to, content)
+	if err != nil {
+		t.Fatalf("NewMailMessage: %v", err)
+	}
+	msg.Date = time.Date(2024, time.March, 5, 14, 30, 0, 0, time.FixedZone("", -3*60*60))
+	msg.MessageID = "<0123456789abcdef@sales-tracker.example>"
+	msg.Boundary = "sales-tracker-boundary"
+	return msg
+}
+
+func TestMailMessageGolden(t *testing.T) {
+	tests := []struct {
+		name    string
+		to      []string
+		content *EmailContent
+	}{
+		{
+			name: "plain.golden",
+			to:   []string{"ana@example.com"},
+			content: &EmailContent{
+				Subject: "Verify your email",
+				Text:    "Hello,\r\n\r\nOpen https://app.example.com/verify?token=abc to verify your email.\n",
+			},
+		},
+		{
+			name: "multipart_utf8.golden",
+			to:   []string{"José Álvares <jose@example.com>"},
+			content: &EmailContent{
+				Subject: "Redefinição de senha — Sales Tracker ✓",
+				Text:    "Olá José,\n\nUse o link abaixo para redefinir sua senha.\n",
+				HTML:    "<p>Olá José,</p>\n<p>Use o link abaixo para <a href=\"https://app.example.com/reset?token=abc\">redefinir sua senha</a>.</p>\n",
+			},
+		},
+		{
+			name: "folded_headers.golden",
+			to: []string{
+				"First Recipient <first@example.com>",
+				"Second Recipient <second@example.com>",
+				"Third Recipient <third@example.com>",
+			},
+			content: &EmailContent{
+				Subject: "A subject long enough that the Subject header has to be folded over more than one line",
+				Text:    strings.Repeat("A body line longer than quoted-printable allows. ", 3) + "\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := fixedMailMessage(t, tt.to, tt.content).Bytes()
+			if err != nil {
+				t.Fatalf("Bytes: %v", err)
+			}
+			checkGolden(t, filepath.Join("mail_message", tt.name), data)
+
+			header, _, _ := bytes.Cut(data, []byte("\r\n\r\n"))
+			for _, line := range strings.Split(string(header), "\r\n") {
+				if len(line) > maxHeaderLine {
+					t.Errorf("header line longer than %d characters: %q", maxHeaderLine, line)
+				}
+			}
+
+			parsed, err := mail.ReadMessage(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("ReadMessage: %v", err)
+			}
+			subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+			if err != nil {
+				t.Fatalf("decode subject: %v", err)
+			}
+			if subject != tt.content.Subject {
+				t.Errorf("subject = %q, want %q", subject, tt.content.Subject)
+			}
+			recipients, err := parsed.Header.AddressList("To")
+			if err != nil {
+				t.Fatalf("parse To: %v", err)
+			}
+			if len(recipients) != len(tt.to) {
+				t.Errorf("To has %d addresses, want %d", len(recipients), len(tt.to))
+			}
+		})
+	}
+}
+
+func TestMailMessageSubjectIsOneLine(t *testing.T) {
+	data, err := fixedMailMessage(t, []string{"ana@example.com"}, &EmailContent{
+		Subject: "Hello\r\nBcc: attacker@example.com",
+		Text:    "Hello",
+	}).Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	if bcc := parsed.Header.Get("Bcc"); bcc != "" {
+		t.Errorf("subject injected a Bcc header: %q", bcc)
+	}
+}
+
+func TestMailMessageRejectsLineBreaksInAddresses(t *testing.T) {
+	content := &EmailContent{Subject: "Hello", Text: "Hello"}
+	addresses := []string{
+		"ana@example.com\r\nBcc: attacker@example.com",
+		"ana@example.com\nBcc: attacker@example.com",
+		"Ana\r <ana@example.com>",
+	}
+
+	for _, address := range addresses {
+		if _, err := ParseMailAddress(address); !errors.Is(err, domain.ErrInvalidEmailAddress) {
+			t.Errorf("ParseMailAddress(%q) error = %v, want %v", address, err, domain.ErrInvalidEmailAddress)
+		}
+		if _, err := NewMailMessage("Sales Tracker", "no-reply@sales-tracker.example", []string{address}, content); !errors.Is(err, domain.ErrInvalidEmailAddress) {
+			t.Errorf("NewMailMessage to %q error = %v, want %v", address, err, domain.ErrInvalidEmailAddress)
+		}
+		if _, err := NewMailMessage("Sales Tracker", address, []string{"ana@example.com"}, content); !errors.Is(err, domain.ErrInvalidEmailAddress) {
+			t.Errorf("NewMailMessage from %q error = %v, want %v", address, err, domain.ErrInvalidEmailAddress)
+		}
+	}
+
+	if _, err := NewMailMessage("Sales Tracker", "no-reply@sales-tracker.example", nil, content); !errors.Is(err, domain.ErrInvalidEmailAddress) {
+		t.Errorf("NewMailMessage without recipients error = %v, want %v", err, domain.ErrInvalidEmailAddress)
+	}
+}
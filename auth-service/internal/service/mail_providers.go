@@ -0,0 +1,220 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+// postmarkProvider speaks the Postmark API (https://postmarkapp.com/developer)
+type postmarkProvider struct {
+	apiKey        string
+	messageStream string
+}
+
+type postmarkEmail struct {
+	From          string            `json:"From"`
+	To            string            `json:"To"`
+	Subject       string            `json:"Subject"`
+	TextBody      string            `json:"TextBody"`
+	HTMLBody      string            `json:"HtmlBody,omitempty"`
+	MessageStream string            `json:"MessageStream,omitempty"`
+	Metadata      map[string]string `json:"Metadata,omitempty"`
+}
+
+// Postmark error codes that refuse the recipient rather than the request:
+// 300 is an invalid address, 406 an address it has deactivated after a
+// bounce or complaint
+var postmarkUndeliverableCodes = map[int]bool{300: true, 406: true}
+
+func (p *postmarkProvider) defaultEndpoint() string {
+	return "https://api.postmarkapp.com/email"
+}
+
+func (p *postmarkProvider) newRequest(endpoint string, msg *MailMessage) (*http.Request, error) {
+	to := make([]string, len(msg.To))
+	for i, recipient := range msg.To {
+		to[i] = recipient.String()
+	}
+	email := postmarkEmail{
+		From:          msg.From.String(),
+		To:            strings.Join(to, ", "),
+		Subject:       msg.Subject,
+		TextBody:      msg.Text,
+		HTMLBody:      msg.HTML,
+		MessageStream: p.messageStream,
+	}
+	if msg.IdempotencyKey != "" {
+		email.Metadata = map[string]string{"idempotency_key": msg.IdempotencyKey}
+	}
+
+	payload, err := json.Marshal(email)
+	if err != nil {
+		return nil, err
+	}
+	return newJSONRequest(endpoint, payload)
+}
+
+func (p *postmarkProvider) authenticate(req *http.Request) {
+	req.Header.Set("X-Postmark-Server-Token", p.apiKey)
+}
+
+func (p *postmarkProvider) checkResponse(status int, body []byte) error {
+	var result struct {
+		ErrorCode int    `json:"ErrorCode"`
+		Message   string `json:"Message"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || result.ErrorCode == 0 {
+		return fmt.Errorf("postmark returned status %d", status)
+	}
+	if postmarkUndeliverableCodes[result.ErrorCode] {
+		return fmt.Errorf("%w: postmark error %d: %s", domain.ErrEmailUndeliverable, result.ErrorCode, result.Message)
+	}
+	return fmt.Errorf("postmark returned status %d, error %d: %s", status, result.ErrorCode, result.Message)
+}
+
+// Postmark posts one record per webhook call
+func (p *postmarkProvider) parseWebhook(body []byte) ([]domain.EmailDeliveryEvent, error) {
+	var record struct {
+		RecordType  string    `json:"RecordType"`
+		Type        string    `json:"Type"`
+		Email       string    `json:"Email"`
+		Description string    `json:"Description"`
+		BouncedAt   time.Time `json:"BouncedAt"`
+	}
+	if err := json.Unmarshal(body, &record); err != nil {
+		return nil, fmt.Errorf("invalid postmark webhook payload: %w", err)
+	}
+
+	event := domain.EmailDeliveryEvent{
+		Address:    record.Email,
+		Reason:     record.Description,
+		OccurredAt: record.BouncedAt,
+	}
+	switch {
+	case record.RecordType == "Bounce" && record.Type == "HardBounce":
+		event.Type = domain.EmailEventBounce
+	case record.RecordType == "SpamComplaint":
+		event.Type = domain.EmailEventComplaint
+	default:
+		return nil, nil
+	}
+	return []domain.EmailDeliveryEvent{event}, nil
+}
+
+// sendGridProvider speaks the SendGrid v3 API (https://docs.sendgrid.com/api-reference)
+type sendGridProvider struct {
+	apiKey string
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendGridPersonalization struct {
+	To         []sendGridAddress `json:"to"`
+	CustomArgs map[string]string `json:"custom_args,omitempty"`
+}
+
+type sendGridEmail struct {
+	Personalizations []sendGridPersonalization `json:"personalizations"`
+	From             sendGridAddress           `json:"from"`
+	Subject          string                    `json:"subject"`
+	Content          []sendGridContent         `json:"content"`
+}
+
+func (p *sendGridProvider) defaultEndpoint() string {
+	return "https://api.sendgrid.com/v3/mail/send"
+}
+
+func (p *sendGridProvider) newRequest(endpoint string, msg *MailMessage) (*http.Request, error) {
+	personalization := sendGridPersonalization{}
+	for _, recipient := range msg.To {
+		personalization.To = append(personalization.To, sendGridAddress{Email: recipient.Address, Name: recipient.Name})
+	}
+	if msg.IdempotencyKey != "" {
+		personalization.CustomArgs = map[string]string{"idempotency_key": msg.IdempotencyKey}
+	}
+
+	// SendGrid requires the plain-text part to come first
+	content := []sendGridContent{{Type: "text/plain", Value: msg.Text}}
+	if msg.HTML != "" {
+		content = append(content, sendGridContent{Type: "text/html", Value: msg.HTML})
+	}
+
+	payload, err := json.Marshal(sendGridEmail{
+		Personalizations: []sendGridPersonalization{personalization},
+		From:             sendGridAddress{Email: msg.From.Address, Name: msg.From.Name},
+		Subject:          msg.Subject,
+		Content:          content,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newJSONRequest(endpoint, payload)
+}
+
+func (p *sendGridProvider) authenticate(req *http.Request) {
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+}
+
+func (p *sendGridProvider) checkResponse(status int, body []byte) error {
+	var result struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || len(result.Errors) == 0 {
+		return fmt.Errorf("sendgrid returned status %d", status)
+	}
+	messages := make([]string, len(result.Errors))
+	for i, e := range result.Errors {
+		messages[i] = e.Message
+	}
+	return fmt.Errorf("sendgrid returned status %d: %s", status, strings.Join(messages, "; "))
+}
+
+// SendGrid batches events into an array per webhook call. Blocked messages
+// are bounces caused by the receiving server, not the address, so they are
+// not counted.
+func (p *sendGridProvider) parseWebhook(body []byte) ([]domain.EmailDeliveryEvent, error) {
+	var records []struct {
+		Email     string `json:"email"`
+		Event     string `json:"event"`
+		Type      string `json:"type"`
+		Reason    string `json:"reason"`
+		Timestamp int64  `json:"timestamp"`
+	}
+	if err := json.Unmarshal(body, &records); err != nil {
+		return nil, fmt.Errorf("invalid sendgrid webhook payload: %w", err)
+	}
+
+	var events []domain.EmailDeliveryEvent
+	for _, record := range records {
+		event := domain.EmailDeliveryEvent{
+			Address:    record.Email,
+			Reason:     record.Reason,
+			OccurredAt: time.Unix(record.Timestamp, 0),
+		}
+		switch {
+		case record.Event == "bounce" && record.Type != "blocked":
+			event.Type = domain.EmailEventBounce
+		case record.Event == "spamreport":
+			event.Type = domain.EmailEventComplaint
+		default:
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
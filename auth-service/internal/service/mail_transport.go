@@ -0,0 +1,31 @@
+package service
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+)
+
+// MailTransport carries a finished message to its recipients, or wherever
+// else the environment wants mail to go
+type MailTransport interface {
+	Deliver(msg *MailMessage) error
+}
+
+// NewMailTransport returns the transport selected by email.transport
+func NewMailTransport(cfg *config.Config) (MailTransport, error) {
+	switch cfg.Email.Transport {
+	case "", "smtp":
+		return NewSMTPTransport(cfg.SMTP)
+	case "http":
+		return NewHTTPMailTransport(cfg.Email.HTTP)
+	case "file":
+		return NewFileTransport(cfg.Email.File)
+	case "log":
+		return NewLogTransport(os.Stdout), nil
+	case "capture":
+		return NewCaptureTransport(), nil
+	}
+	return nil, fmt.Errorf("unknown email transport %q", cfg.Email.Transport)
+}
@@ -0,0 +1,409 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+const (
+	// maxProviderResponse bounds how much of a provider response is read
+	maxProviderResponse = 1 << 20
+	// jwksRefreshInterval limits refetching the key set when a token
+	// names an unknown key ID
+	jwksRefreshInterval = time.Minute
+	// clockSkew is tolerated when checking upstream token times
+	clockSkew = time.Minute
+)
+
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCProvider is a client for an upstream OpenID Connect provider. The
+// discovery document and signing keys are fetched on first use and cached.
+type OIDCProvider struct {
+	name        string
+	config      config.OIDCProviderConfig
+	redirectURL string
+	httpClient  *http.Client
+
+	mu            sync.Mutex
+	metadata      *oidcMetadata
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+// NewOIDCProvider creates a client for the provider configured as name.
+// redirectURL must be registered with the provider. A nil httpClient uses a
+// client with a 10 second timeout.
+func NewOIDCProvider(name string, cfg config.OIDCProviderConfig, redirectURL string, httpClient *http.Client) *OIDCProvider {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	if cfg.DefaultRole == "" {
+		cfg.DefaultRole = "client"
+	}
+	return &OIDCProvider{
+		name:        name,
+		config:      cfg,
+		redirectURL: redirectURL,
+		httpClient:  httpClient,
+	}
+}
+
+func (p *OIDCProvider) Name() string {
+	return p.name
+}
+
+func (p *OIDCProvider) Config() config.OIDCProviderConfig {
+	return p.config
+}
+
+// AuthCodeURL returns the provider URL the user is sent to for sign-in
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	target, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	query := target.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.redirectURL)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", domain.CodeChallengeMethodS256)
+	target.RawQuery = query.Encode()
+
+	return target.String(), nil
+}
+
+// Exchange redeems an authorization code and returns the claims of the
+// validated ID token. The token must carry nonce.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*domain.UpstreamClaims, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {domain.GrantTypeAuthorizationCode},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL},
+		"client_id":     {p.config.ClientID},
+		"client_secret": {p.config.ClientSecret},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var response struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := p.doJSON(req, &response); err != nil {
+		if response.Error != "" {
+			return nil, fmt.Errorf("token request failed: %s: %s", response.Error, response.ErrorDescription)
+		}
+		return nil, err
+	}
+	if response.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	return p.verifyIDToken(ctx, metadata, response.IDToken, nonce)
+}
+
+// verifyIDToken checks the signature, issuer, audience, lifetime and nonce
+// of an ID token (OpenID Connect Core section 3.1.3.7)
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, metadata *oidcMetadata, raw, nonce string) (*domain.UpstreamClaims, error) {
+	// Time claims are checked below, allowing for clock skew
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.Alg() {
+		case "RS256", "ES256":
+		default:
+			return nil, fmt.Errorf("unexpected signing algorithm %s", token.Method.Alg())
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.signingKey(ctx, metadata, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if !claims.VerifyExpiresAt(now.Add(-clockSkew).Unix(), true) {
+		return nil, errors.New("ID token has expired")
+	}
+	if !claims.VerifyNotBefore(now.Add(clockSkew).Unix(), false) || !claims.VerifyIssuedAt(now.Add(clockSkew).Unix(), false) {
+		return nil, errors.New("ID token is not valid yet")
+	}
+
+	// Multi-tenant issuers are templated in the discovery document. Every
+	// tenant of the provider can sign tokens for it, so only the configured
+	// tenants are accepted.
+	issuer := metadata.Issuer
+	tenantID := ""
+	if strings.Contains(issuer, "{tenantid}") {
+		tenantID, _ = claims["tid"].(string)
+		if tenantID == "" || !containsValue(p.config.AllowedTenants, tenantID) {
+			return nil, fmt.Errorf("tenant %q is not allowed", tenantID)
+		}
+		issuer = strings.ReplaceAll(issuer, "{tenantid}", tenantID)
+	}
+	if iss, _ := claims["iss"].(string); iss != issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", iss)
+	}
+
+	audiences := claimStrings(claims["aud"])
+	if !containsValue(audiences, p.config.ClientID) {
+		return nil, errors.New("ID token is not issued for this client")
+	}
+	if len(audiences) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.config.ClientID {
+			return nil, errors.New("ID token authorized party does not match")
+		}
+	}
+
+	tokenNonce, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, errors.New("ID token nonce does not match")
+	}
+
+	upstream := &domain.UpstreamClaims{TenantID: tenantID}
+	upstream.Subject, _ = claims["sub"].(string)
+	upstream.Email, _ = claims["email"].(string)
+	upstream.Name, _ = claims["name"].(string)
+	if upstream.Subject == "" {
+		return nil, errors.New("ID token has no subject")
+	}
+
+	// Some providers send email_verified as a string
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		upstream.EmailVerified = verified
+	case string:
+		upstream.EmailVerified = verified == "true"
+	}
+
+	return upstream, nil
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.config.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata oidcMetadata
+	if err := p.doJSON(req, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to fetch discovery document: %w", err)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, errors.New("discovery document is incomplete")
+	}
+	if !strings.Contains(metadata.Issuer, "{tenantid}") && metadata.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("discovery document issuer %q does not match %q", metadata.Issuer, p.config.Issuer)
+	}
+
+	p.metadata = &metadata
+	return p.metadata, nil
+}
+
+// signingKey returns the provider key with the given ID, refetching the key
+// set if the key is unknown, e.g. after the provider rotated its keys
+func (p *OIDCProvider) signingKey(ctx context.Context, metadata *oidcMetadata, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadata.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var keySet struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			KeyID   string `json:"kid"`
+			Use     string `json:"use"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+			Curve   string `json:"crv"`
+			X       string `json:"x"`
+			Y       string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := p.doJSON(req, &keySet); err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(keySet.Keys))
+	for _, jwk := range keySet.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch jwk.KeyType {
+		case "RSA":
+			if key, err := parseRSAJWK(jwk.N, jwk.E); err == nil {
+				keys[jwk.KeyID] = key
+			}
+		case "EC":
+			if key, err := parseECJWK(jwk.Curve, jwk.X, jwk.Y); err == nil {
+				keys[jwk.KeyID] = key
+			}
+		}
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey finds a key by ID. Tokens without a key ID are accepted only
+// when the provider publishes a single key.
+func (p *OIDCProvider) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *OIDCProvider) doJSON(req *http.Request, v interface{}) error {
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProviderResponse))
+	if err != nil {
+		return err
+	}
+	// Error responses are decoded too, so callers can report them
+	decodeErr := json.Unmarshal(body, v)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", req.URL.Host, resp.StatusCode)
+	}
+	return decodeErr
+}
+
+func parseRSAJWK(n, e string) (*rsa.PublicKey, error) {
+	modulus, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, err
+	}
+	exponent, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, err
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(modulus),
+		E: int(new(big.Int).SetBytes(exponent).Int64()),
+	}, nil
+}
+
+func parseECJWK(curve, x, y string) (*ecdsa.PublicKey, error) {
+	if curve != "P-256" {
+		return nil, fmt.Errorf("unsupported curve %s", curve)
+	}
+	xBytes, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil {
+		return nil, err
+	}
+	yBytes, err := base64.RawURLEncoding.DecodeString(y)
+	if err != nil {
+		return nil, err
+	}
+	key := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(xBytes),
+		Y:     new(big.Int).SetBytes(yBytes),
+	}
+	if !key.Curve.IsOnCurve(key.X, key.Y) {
+		return nil, errors.New("EC key is not on the curve")
+	}
+	return key, nil
+}
+
+// claimStrings reads a claim that may be a string or an array of strings
+func claimStrings(claim interface{}) []string {
+	switch v := claim.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/service/oidctest"
+)
+
+const (
+	testClientID     = "sales-tracker"
+	testClientSecret = "client-secret"
+	testNonce        = "nonce-1"
+	testVerifier     = "code-verifier-1"
+)
+
+// signIn runs an authorization code flow against upstream, whose ID token
+// carries claims, and returns the result of redeeming the code with nonce
+func signIn(t *testing.T, upstream *oidctest.Provider, cfg config.OIDCProviderConfig, nonce string, claims map[string]interface{}) (*domain.UpstreamClaims, error) {
+	t.Helper()
+
+	provider := NewOIDCProvider("test", cfg, "https://auth.example.com/callback", nil)
+	challenge := sha256.Sum256([]byte(testVerifier))
+	authURL, err := provider.AuthCodeURL(context.Background(), "state-1", testNonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+
+	code := upstream.Authorize(t, authURL, claims)
+	return provider.Exchange(context.Background(), code, testVerifier, nonce)
+}
+
+func providerConfig(upstream *oidctest.Provider) config.OIDCProviderConfig {
+	return config.OIDCProviderConfig{
+		Issuer:       upstream.Issuer(),
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+	}
+}
+
+func TestOIDCProviderExchange(t *testing.T) {
+	upstream := oidctest.NewProvider(t, testClientID, testClientSecret)
+
+	claims, err := signIn(t, upstream, providerConfig(upstream), testNonce, map[string]interface{}{
+		"sub":            "user-42",
+		"email":          "ana@example.com",
+		"email_verified": true,
+		"name":           "Ana",
+	})
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if claims.Subject != "user-42" || claims.Email != "ana@example.com" || claims.Name != "Ana" {
+		t.Errorf("claims = %+v", claims)
+	}
+	if !claims.EmailVerified {
+		t.Error("EmailVerified = false, want true")
+	}
+	if claims.TenantID != "" {
+		t.Errorf("TenantID = %q, want none", claims.TenantID)
+	}
+}
+
+func TestOIDCProviderExchangeRejectsInvalidTokens(t *testing.T) {
+	upstream := oidctest.NewProvider(t, testClientID, testClientSecret)
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		nonce  string
+		claims map[string]interface{}
+		want   string
+	}{
+		{
+			name:  "nonce from another login",
+			nonce: "nonce-2",
+			want:  "nonce",
+		},
+		{
+			name:   "missing nonce",
+			nonce:  testNonce,
+			claims: map[string]interface{}{"nonce": nil},
+			want:   "nonce",
+		},
+		{
+			name:   "other audience",
+			nonce:  testNonce,
+			claims: map[string]interface{}{"aud": "another-client"},
+			want:   "not issued for this client",
+		},
+		{
+			name:   "multiple audiences without azp",
+			nonce:  testNonce,
+			claims: map[string]interface{}{"aud": []string{testClientID, "another-client"}},
+			want:   "authorized party",
+		},
+		{
+			name:   "other issuer",
+			nonce:  testNonce,
+			claims: map[string]interface{}{"iss": "https://issuer.example.com"},
+			want:   "unexpected issuer",
+		},
+		{
+			name:   "expired",
+			nonce:  testNonce,
+			claims: map[string]interface{}{"exp": now.Add(-time.Hour).Unix()},
+			want:   "expired",
+		},
+		{
+			name:   "no subject",
+			nonce:  testNonce,
+			claims: map[string]interface{}{"sub": nil},
+			want:   "no subject",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := signIn(t, upstream, providerConfig(upstream), tt.nonce, tt.claims)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Exchange error = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOIDCProviderExchangeAcceptsAuthorizedParty(t *testing.T) {
+	upstream := oidctest.NewProvider(t, testClientID, testClientSecret)
+
+	_, err := signIn(t, upstream, providerConfig(upstream), testNonce, map[string]interface{}{
+		"aud": []string{testClientID, "another-client"},
+		"azp": testClientID,
+	})
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+}
+
+func TestOIDCProviderEmailVerified(t *testing.T) {
+	upstream := oidctest.NewProvider(t, testClientID, testClientSecret)
+
+	tests := []struct {
+		name     string
+		verified interface{}
+		want     bool
+	}{
+		{name: "bool true", verified: true, want: true},
+		{name: "bool false", verified: false, want: false},
+		{name: "string true", verified: "true", want: true},
+		{name: "string false", verified: "false", want: false},
+		{name: "missing", verified: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := signIn(t, upstream, providerConfig(upstream), testNonce, map[string]interface{}{
+				"email":          "ana@example.com",
+				"email_verified": tt.verified,
+			})
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+			if claims.EmailVerified != tt.want {
+				t.Errorf("EmailVerified = %v, want %v", claims.EmailVerified, tt.want)
+			}
+		})
+	}
+}
+
+func TestOIDCProviderMultiTenantIssuer(t *testing.T) {
+	upstream := oidctest.NewMultiTenantProvider(t, testClientID, testClientSecret)
+	cfg := providerConfig(upstream)
+	cfg.AllowedTenants = []string{"tenant-a"}
+
+	t.Run("allowed tenant", func(t *testing.T) {
+		claims, err := signIn(t, upstream, cfg, testNonce, map[string]interface{}{"tid": "tenant-a"})
+		if err != nil {
+			t.Fatalf("Exchange: %v", err)
+		}
+		if claims.TenantID != "tenant-a" {
+			t.Errorf("TenantID = %q, want tenant-a", claims.TenantID)
+		}
+	})
+
+	t.Run("other tenant", func(t *testing.T) {
+		_, err := signIn(t, upstream, cfg, testNonce, map[string]interface{}{"tid": "tenant-b"})
+		if err == nil || !strings.Contains(err.Error(), "not allowed") {
+			t.Fatalf("Exchange error = %v, want tenant rejected", err)
+		}
+	})
+
+	t.Run("no tenant", func(t *testing.T) {
+		_, err := signIn(t, upstream, cfg, testNonce, nil)
+		if err == nil || !strings.Contains(err.Error(), "not allowed") {
+			t.Fatalf("Exchange error = %v, want tenant rejected", err)
+		}
+	})
+
+	t.Run("issuer of another tenant", func(t *testing.T) {
+		_, err := signIn(t, upstream, cfg, testNonce, map[string]interface{}{
+			"tid": "tenant-a",
+			"iss": upstream.TenantIssuer("tenant-b"),
+		})
+		if err == nil || !strings.Contains(err.Error(), "unexpected issuer") {
+			t.Fatalf("Exchange error = %v, want issuer rejected", err)
+		}
+	})
+
+	t.Run("empty allow-list", func(t *testing.T) {
+		open := cfg
+		open.AllowedTenants = nil
+		_, err := signIn(t, upstream, open, testNonce, map[string]interface{}{"tid": "tenant-a"})
+		if err == nil || !strings.Contains(err.Error(), "not allowed") {
+			t.Fatalf("Exchange error = %v, want tenant rejected", err)
+		}
+	})
+}
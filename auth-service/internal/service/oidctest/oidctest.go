@@ -0,0 +1,225 @@
+// Package oidctest runs an in-process OpenID Connect provider for tests of
+// social login: it serves discovery, a key set and a token endpoint, and
+// signs ID tokens carrying whatever claims a test hands it.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const keyID = "test-key"
+
+// Provider is a stub OIDC provider. Its issuer is the server URL or, when
+// created with NewMultiTenantProvider, the server URL followed by a
+// {tenantid} template, as multi-tenant providers publish it.
+type Provider struct {
+	ClientID     string
+	ClientSecret string
+
+	server      *httptest.Server
+	key         *rsa.PrivateKey
+	multiTenant bool
+
+	mu     sync.Mutex
+	grants map[string]grant
+}
+
+type grant struct {
+	codeChallenge string
+	claims        map[string]interface{}
+}
+
+// NewProvider starts a provider for clientID, shut down when the test ends
+func NewProvider(t testing.TB, clientID, clientSecret string) *Provider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate provider key: %v", err)
+	}
+
+	p := &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		key:          key,
+		grants:       make(map[string]grant),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "tests call Authorize instead", http.StatusNotImplemented)
+	})
+	mux.HandleFunc("/jwks", p.jwks)
+	mux.HandleFunc("/token", p.token)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+
+	return p
+}
+
+// NewMultiTenantProvider starts a provider whose issuer is templated with
+// {tenantid}; ID tokens are issued by the tenant in their tid claim
+func NewMultiTenantProvider(t testing.TB, clientID, clientSecret string) *Provider {
+	t.Helper()
+	p := NewProvider(t, clientID, clientSecret)
+	p.multiTenant = true
+	return p
+}
+
+// Issuer is the issuer to configure the provider with
+func (p *Provider) Issuer() string {
+	return p.server.URL
+}
+
+// TenantIssuer is the issuer of tokens from tenantID
+func (p *Provider) TenantIssuer(tenantID string) string {
+	return p.server.URL + "/" + tenantID
+}
+
+// Authorize plays the user signing in at authURL, as returned by the
+// client, and returns the authorization code to redeem. The ID token issued
+// for the code carries the request's nonce, the provider's issuer and the
+// client as audience, overridden by claims; a nil claim value leaves the
+// claim out.
+func (p *Provider) Authorize(t testing.TB, authURL string, claims map[string]interface{}) string {
+	t.Helper()
+
+	target, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse authorization URL: %v", err)
+	}
+	query := target.Query()
+	if query.Get("client_id") != p.ClientID {
+		t.Fatalf("authorization request for client %q, want %q", query.Get("client_id"), p.ClientID)
+	}
+	if query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("authorization request uses code_challenge_method %q, want S256", query.Get("code_challenge_method"))
+	}
+
+	now := time.Now()
+	idClaims := map[string]interface{}{
+		"iss":   p.server.URL,
+		"aud":   p.ClientID,
+		"sub":   "subject-1",
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": query.Get("nonce"),
+	}
+	if tenantID, ok := claims["tid"].(string); ok && p.multiTenant {
+		idClaims["iss"] = p.TenantIssuer(tenantID)
+	}
+	for name, value := range claims {
+		if value == nil {
+			delete(idClaims, name)
+			continue
+		}
+		idClaims[name] = value
+	}
+
+	code := randomString(t)
+	p.mu.Lock()
+	p.grants[code] = grant{codeChallenge: query.Get("code_challenge"), claims: idClaims}
+	p.mu.Unlock()
+	return code
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	issuer := p.server.URL
+	if p.multiTenant {
+		issuer += "/{tenantid}"
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                 issuer,
+		"authorization_endpoint": p.server.URL + "/authorize",
+		"token_endpoint":         p.server.URL + "/token",
+		"jwks_uri":               p.server.URL + "/jwks",
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+// token redeems a code once, checking the client credentials and the PKCE
+// verifier against the challenge of the authorization request
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request")
+		return
+	}
+	if r.PostForm.Get("client_id") != p.ClientID || r.PostForm.Get("client_secret") != p.ClientSecret {
+		tokenError(w, "invalid_client")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	g, ok := p.grants[code]
+	delete(p.grants, code)
+	p.mu.Unlock()
+	if !ok {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(challenge[:]) != g.codeChallenge {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims(g.claims))
+	token.Header["kid"] = keyID
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "access-" + code,
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code, "error_description": strings.ReplaceAll(code, "_", " ")})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString(t testing.TB) string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("generate code: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
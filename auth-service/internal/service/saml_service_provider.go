@@ -0,0 +1,461 @@
+package service
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+const (
+	samlProtocolNS   = "urn:oasis:names:tc:SAML:2.0:protocol"
+	samlAssertionNS  = "urn:oasis:names:tc:SAML:2.0:assertion"
+	samlMetadataNS   = "urn:oasis:names:tc:SAML:2.0:metadata"
+	samlBindingPOST  = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	samlBindingRedir = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	samlStatusOK     = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlBearer       = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	samlNameIDEmail  = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+
+	// samlClockSkew is tolerated between the IdP's clock and ours
+	samlClockSkew = 3 * time.Minute
+)
+
+// SAMLServiceProvider implements the service provider side of SAML 2.0 Web
+// Browser SSO: SP-initiated requests over the HTTP-Redirect binding and
+// signed responses over the HTTP-POST binding. Each organization is its own
+// service provider, so IdPs can tell tenants apart.
+type SAMLServiceProvider struct {
+	baseURL string
+}
+
+func NewSAMLServiceProvider(baseURL string) *SAMLServiceProvider {
+	return &SAMLServiceProvider{baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// EntityID is the SP entity ID for orgID, which is also its metadata URL
+func (sp *SAMLServiceProvider) EntityID(orgID int64) string {
+	return fmt.Sprintf("%s/auth/saml/%d/metadata", sp.baseURL, orgID)
+}
+
+func (sp *SAMLServiceProvider) ACSURL(orgID int64) string {
+	return fmt.Sprintf("%s/auth/saml/%d/acs", sp.baseURL, orgID)
+}
+
+type spMetadata struct {
+	XMLName  xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID string   `xml:"entityID,attr"`
+	SPSSO    struct {
+		AuthnRequestsSigned  bool   `xml:"AuthnRequestsSigned,attr"`
+		WantAssertionsSigned bool   `xml:"WantAssertionsSigned,attr"`
+		Protocols            string `xml:"protocolSupportEnumeration,attr"`
+		NameIDFormat         string `xml:"NameIDFormat"`
+		ACS                  struct {
+			Binding   string `xml:"Binding,attr"`
+			Location  string `xml:"Location,attr"`
+			Index     int    `xml:"index,attr"`
+			IsDefault bool   `xml:"isDefault,attr"`
+		} `xml:"AssertionConsumerService"`
+	} `xml:"SPSSODescriptor"`
+}
+
+// Metadata returns the SP metadata document for orgID
+func (sp *SAMLServiceProvider) Metadata(orgID int64) ([]byte, error) {
+	var metadata spMetadata
+	metadata.EntityID = sp.EntityID(orgID)
+	metadata.SPSSO.WantAssertionsSigned = true
+	metadata.SPSSO.Protocols = samlProtocolNS
+	metadata.SPSSO.NameIDFormat = samlNameIDEmail
+	metadata.SPSSO.ACS.Binding = samlBindingPOST
+	metadata.SPSSO.ACS.Location = sp.ACSURL(orgID)
+	metadata.SPSSO.ACS.IsDefault = true
+
+	out, err := xml.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+type authnRequest struct {
+	XMLName                     xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                          string   `xml:"ID,attr"`
+	Version                     string   `xml:"Version,attr"`
+	IssueInstant                string   `xml:"IssueInstant,attr"`
+	Destination                 string   `xml:"Destination,attr"`
+	AssertionConsumerServiceURL string   `xml:"AssertionConsumerServiceURL,attr"`
+	ProtocolBinding             string   `xml:"ProtocolBinding,attr"`
+	Issuer                      struct {
+		XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+		Value   string   `xml:",chardata"`
+	}
+	NameIDPolicy struct {
+		AllowCreate bool `xml:"AllowCreate,attr"`
+	} `xml:"NameIDPolicy"`
+}
+
+// AuthnRequestURL returns the IdP URL that starts SP-initiated login, with
+// the request encoded for the HTTP-Redirect binding
+func (sp *SAMLServiceProvider) AuthnRequestURL(cfg *domain.SAMLConfig, requestID, relayState string) (string, error) {
+	req := authnRequest{
+		ID:                          requestID,
+		Version:                     "2.0",
+		IssueInstant:                time.Now().UTC().Format(time.RFC3339),
+		Destination:                 cfg.IdPSSOURL,
+		AssertionConsumerServiceURL: sp.ACSURL(cfg.OrgID),
+		ProtocolBinding:             samlBindingPOST,
+	}
+	req.Issuer.Value = sp.EntityID(cfg.OrgID)
+	req.NameIDPolicy.AllowCreate = true
+
+	out, err := xml.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	var deflated bytes.Buffer
+	writer, err := flate.NewWriter(&deflated, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := writer.Write(out); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	target, err := url.Parse(cfg.IdPSSOURL)
+	if err != nil {
+		return "", err
+	}
+	query := target.Query()
+	query.Set("SAMLRequest", base64.StdEncoding.EncodeToString(deflated.Bytes()))
+	if relayState != "" {
+		query.Set("RelayState", relayState)
+	}
+	target.RawQuery = query.Encode()
+
+	return target.String(), nil
+}
+
+type idpMetadata struct {
+	EntityID string `xml:"entityID,attr"`
+	IDPSSO   *struct {
+		KeyDescriptors []struct {
+			Use          string   `xml:"use,attr"`
+			Certificates []string `xml:"KeyInfo>X509Data>X509Certificate"`
+		} `xml:"KeyDescriptor"`
+		SSOServices []struct {
+			Binding  string `xml:"Binding,attr"`
+			Location string `xml:"Location,attr"`
+		} `xml:"SingleSignOnService"`
+	} `xml:"IDPSSODescriptor"`
+}
+
+// ParseIdPMetadata extracts the entity ID, HTTP-Redirect SSO URL and
+// signing certificates (as PEM) from IdP metadata. An EntitiesDescriptor
+// is accepted if it holds a single IdP.
+func ParseIdPMetadata(data []byte) (entityID, ssoURL string, certificates []string, err error) {
+	var descriptors []idpMetadata
+	var root struct {
+		XMLName xml.Name
+		idpMetadata
+		Entities []idpMetadata `xml:"EntityDescriptor"`
+	}
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return "", "", nil, fmt.Errorf("failed to parse IdP metadata: %w", err)
+	}
+	switch root.XMLName.Local {
+	case "EntityDescriptor":
+		descriptors = []idpMetadata{root.idpMetadata}
+	case "EntitiesDescriptor":
+		descriptors = root.Entities
+	default:
+		return "", "", nil, errors.New("IdP metadata has no EntityDescriptor")
+	}
+
+	var idp *idpMetadata
+	for i := range descriptors {
+		if descriptors[i].IDPSSO != nil {
+			if idp != nil {
+				return "", "", nil, errors.New("IdP metadata describes more than one IdP")
+			}
+			idp = &descriptors[i]
+		}
+	}
+	if idp == nil {
+		return "", "", nil, errors.New("IdP metadata has no IDPSSODescriptor")
+	}
+
+	for _, service := range idp.IDPSSO.SSOServices {
+		if service.Binding == samlBindingRedir {
+			ssoURL = service.Location
+		}
+	}
+	for _, key := range idp.IDPSSO.KeyDescriptors {
+		if key.Use != "" && key.Use != "signing" {
+			continue
+		}
+		for _, cert := range key.Certificates {
+			certificates = append(certificates, certificateToPEM(cert))
+		}
+	}
+
+	return idp.EntityID, ssoURL, certificates, nil
+}
+
+// ParseSAMLCertificates decodes PEM certificates, failing on any invalid one
+func ParseSAMLCertificates(pemCerts []string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for _, pemCert := range pemCerts {
+		block, _ := pem.Decode([]byte(pemCert))
+		if block == nil {
+			return nil, errors.New("certificate is not PEM encoded")
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+type samlResponseXML struct {
+	Issuer       string `xml:"Issuer"`
+	Destination  string `xml:"Destination,attr"`
+	InResponseTo string `xml:"InResponseTo,attr"`
+	StatusCode   struct {
+		Value string `xml:"Value,attr"`
+	} `xml:"Status>StatusCode"`
+}
+
+type samlAssertionXML struct {
+	ID      string `xml:"ID,attr"`
+	Issuer  string `xml:"Issuer"`
+	Subject struct {
+		NameID struct {
+			Format string `xml:"Format,attr"`
+			Value  string `xml:",chardata"`
+		} `xml:"NameID"`
+		Confirmations []struct {
+			Method string `xml:"Method,attr"`
+			Data   struct {
+				InResponseTo string `xml:"InResponseTo,attr"`
+				Recipient    string `xml:"Recipient,attr"`
+				NotOnOrAfter string `xml:"NotOnOrAfter,attr"`
+			} `xml:"SubjectConfirmationData"`
+		} `xml:"SubjectConfirmation"`
+	} `xml:"Subject"`
+	Conditions struct {
+		NotBefore    string `xml:"NotBefore,attr"`
+		NotOnOrAfter string `xml:"NotOnOrAfter,attr"`
+		Restrictions []struct {
+			Audiences []string `xml:"Audience"`
+		} `xml:"AudienceRestriction"`
+	} `xml:"Conditions"`
+	AuthnStatement struct {
+		SessionIndex string `xml:"SessionIndex,attr"`
+	} `xml:"AuthnStatement"`
+	Attributes []struct {
+		Name         string   `xml:"Name,attr"`
+		FriendlyName string   `xml:"FriendlyName,attr"`
+		Values       []string `xml:"AttributeValue"`
+	} `xml:"AttributeStatement>Attribute"`
+}
+
+// ParseResponse validates a base64 SAMLResponse posted to the ACS of
+// cfg.OrgID and returns its assertion. Either the response or the assertion
+// must carry a valid signature from one of the IdP's certificates, and only
+// the signed XML is read, so unsigned content wrapped around it is ignored.
+func (sp *SAMLServiceProvider) ParseResponse(cfg *domain.SAMLConfig, encoded string, now time.Time) (*domain.SAMLAssertion, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+	if err != nil {
+		return nil, errors.New("SAMLResponse is not base64 encoded")
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(raw); err != nil {
+		return nil, fmt.Errorf("SAMLResponse is not valid XML: %w", err)
+	}
+	for _, token := range doc.Child {
+		if _, ok := token.(*etree.Directive); ok {
+			return nil, errors.New("SAMLResponse must not contain a DTD")
+		}
+	}
+	response := doc.Root()
+	if response == nil || response.Tag != "Response" || response.NamespaceURI() != samlProtocolNS {
+		return nil, errors.New("SAMLResponse has no Response element")
+	}
+
+	certs, err := ParseSAMLCertificates(cfg.IdPCertificates)
+	if err != nil || len(certs) == 0 {
+		return nil, errors.New("IdP certificates are not configured")
+	}
+	validator := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: certs})
+
+	responseSigned := false
+	if response.SelectElement("Signature") != nil {
+		if response, err = validator.Validate(response); err != nil {
+			return nil, fmt.Errorf("response signature is invalid: %w", err)
+		}
+		responseSigned = true
+	}
+
+	var parsedResponse samlResponseXML
+	if err := unmarshalElement(response, &parsedResponse); err != nil {
+		return nil, err
+	}
+	if parsedResponse.StatusCode.Value != samlStatusOK {
+		return nil, fmt.Errorf("IdP returned status %s", parsedResponse.StatusCode.Value)
+	}
+	if parsedResponse.Destination != "" && parsedResponse.Destination != sp.ACSURL(cfg.OrgID) {
+		return nil, errors.New("response destination does not match")
+	}
+	if parsedResponse.Issuer != "" && parsedResponse.Issuer != cfg.IdPEntityID {
+		return nil, errors.New("response issuer does not match")
+	}
+
+	if response.SelectElement("EncryptedAssertion") != nil {
+		return nil, errors.New("encrypted assertions are not supported")
+	}
+	assertions := response.SelectElements("Assertion")
+	if len(assertions) != 1 {
+		return nil, errors.New("response must contain exactly one assertion")
+	}
+	assertionEl := assertions[0]
+	if !responseSigned {
+		if assertionEl.SelectElement("Signature") == nil {
+			return nil, errors.New("neither the response nor the assertion is signed")
+		}
+		if assertionEl, err = validator.Validate(assertionEl); err != nil {
+			return nil, fmt.Errorf("assertion signature is invalid: %w", err)
+		}
+	}
+
+	var parsed samlAssertionXML
+	if err := unmarshalElement(assertionEl, &parsed); err != nil {
+		return nil, err
+	}
+
+	return sp.checkAssertion(cfg, &parsed, parsedResponse.InResponseTo, now)
+}
+
+// checkAssertion applies the SAML profile's processing rules to a signed
+// assertion (SAML Profiles section 4.1.4.3)
+func (sp *SAMLServiceProvider) checkAssertion(cfg *domain.SAMLConfig, parsed *samlAssertionXML, inResponseTo string, now time.Time) (*domain.SAMLAssertion, error) {
+	if parsed.ID == "" {
+		return nil, errors.New("assertion has no ID")
+	}
+	if parsed.Issuer != cfg.IdPEntityID {
+		return nil, errors.New("assertion issuer does not match")
+	}
+
+	acsURL := sp.ACSURL(cfg.OrgID)
+	var expiresAt time.Time
+	confirmed := false
+	for _, confirmation := range parsed.Subject.Confirmations {
+		if confirmation.Method != samlBearer || confirmation.Data.Recipient != acsURL {
+			continue
+		}
+		notOnOrAfter, err := time.Parse(time.RFC3339Nano, confirmation.Data.NotOnOrAfter)
+		if err != nil || !now.Before(notOnOrAfter.Add(samlClockSkew)) {
+			continue
+		}
+		if inResponseTo != "" && confirmation.Data.InResponseTo != "" && confirmation.Data.InResponseTo != inResponseTo {
+			continue
+		}
+		if confirmation.Data.InResponseTo != "" {
+			inResponseTo = confirmation.Data.InResponseTo
+		}
+		expiresAt = notOnOrAfter
+		confirmed = true
+		break
+	}
+	if !confirmed {
+		return nil, errors.New("assertion has no valid bearer subject confirmation")
+	}
+
+	if parsed.Conditions.NotBefore != "" {
+		notBefore, err := time.Parse(time.RFC3339Nano, parsed.Conditions.NotBefore)
+		if err != nil || now.Add(samlClockSkew).Before(notBefore) {
+			return nil, errors.New("assertion is not valid yet")
+		}
+	}
+	if parsed.Conditions.NotOnOrAfter != "" {
+		notOnOrAfter, err := time.Parse(time.RFC3339Nano, parsed.Conditions.NotOnOrAfter)
+		if err != nil || !now.Before(notOnOrAfter.Add(samlClockSkew)) {
+			return nil, errors.New("assertion has expired")
+		}
+		if notOnOrAfter.Before(expiresAt) {
+			expiresAt = notOnOrAfter
+		}
+	}
+
+	// Every audience restriction must name this service provider
+	entityID := sp.EntityID(cfg.OrgID)
+	for _, restriction := range parsed.Conditions.Restrictions {
+		if !containsValue(restriction.Audiences, entityID) {
+			return nil, errors.New("assertion is not intended for this service provider")
+		}
+	}
+
+	assertion := &domain.SAMLAssertion{
+		ID:           parsed.ID,
+		Issuer:       parsed.Issuer,
+		NameID:       strings.TrimSpace(parsed.Subject.NameID.Value),
+		NameIDFormat: parsed.Subject.NameID.Format,
+		InResponseTo: inResponseTo,
+		SessionIndex: parsed.AuthnStatement.SessionIndex,
+		NotOnOrAfter: expiresAt.Add(samlClockSkew),
+		Attributes:   make(map[string][]string),
+	}
+	for _, attribute := range parsed.Attributes {
+		values := make([]string, 0, len(attribute.Values))
+		for _, value := range attribute.Values {
+			values = append(values, strings.TrimSpace(value))
+		}
+		assertion.Attributes[attribute.Name] = append(assertion.Attributes[attribute.Name], values...)
+		if attribute.FriendlyName != "" {
+			assertion.Attributes[attribute.FriendlyName] = append(assertion.Attributes[attribute.FriendlyName], values...)
+		}
+	}
+
+	return assertion, nil
+}
+
+// unmarshalElement decodes a (validated) etree element with encoding/xml
+func unmarshalElement(el *etree.Element, v interface{}) error {
+	doc := etree.NewDocument()
+	doc.SetRoot(el.Copy())
+	data, err := doc.WriteToBytes()
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(data, v)
+}
+
+func certificateToPEM(base64DER string) string {
+	der := strings.Join(strings.Fields(base64DER), "")
+	var b strings.Builder
+	b.WriteString("-----BEGIN CERTIFICATE-----\n")
+	for len(der) > 64 {
+		b.WriteString(der[:64] + "\n")
+		der = der[64:]
+	}
+	b.WriteString(der + "\n-----END CERTIFICATE-----\n")
+	return b.String()
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/service/samltest"
+)
+
+const (
+	testSAMLOrgID   = 7
+	testIdPEntityID = "https://idp.example.com/metadata"
+)
+
+type samlTest struct {
+	sp  *SAMLServiceProvider
+	idp *samltest.IdP
+	cfg *domain.SAMLConfig
+	now time.Time
+}
+
+func newSAMLTest(t *testing.T) *samlTest {
+	idp := samltest.NewIdP(t, testIdPEntityID)
+	return &samlTest{
+		sp:  NewSAMLServiceProvider("https://auth.example.com"),
+		idp: idp,
+		cfg: &domain.SAMLConfig{
+			OrgID:           testSAMLOrgID,
+			IdPEntityID:     testIdPEntityID,
+			IdPCertificates: []string{idp.CertificatePEM()},
+		},
+		now: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+// assertion returns an unsigned assertion about nameID that this service
+// provider would accept
+func (st *samlTest) assertion(id, nameID string) *etree.Element {
+	return st.idp.Assertion(samltest.Assertion{
+		ID:           id,
+		NameID:       nameID,
+		Audience:     st.sp.EntityID(testSAMLOrgID),
+		Recipient:    st.sp.ACSURL(testSAMLOrgID),
+		InResponseTo: "id-request-1",
+		NotOnOrAfter: st.now.Add(5 * time.Minute),
+		Attributes:   map[string]string{"role": "sales"},
+	})
+}
+
+func (st *samlTest) response(assertions ...*etree.Element) *etree.Element {
+	return st.idp.Response("id-response-1", st.sp.ACSURL(testSAMLOrgID), "id-request-1", assertions...)
+}
+
+func (st *samlTest) parse(t *testing.T, response *etree.Element) (*domain.SAMLAssertion, error) {
+	t.Helper()
+	return st.sp.ParseResponse(st.cfg, samltest.Encode(t, response), st.now)
+}
+
+func TestSAMLParseResponseAcceptsSignedAssertion(t *testing.T) {
+	st := newSAMLTest(t)
+
+	assertion, err := st.parse(t, st.response(st.idp.Sign(t, st.assertion("id-assertion-1", "ana@example.com"))))
+	if err != nil {
+		t.Fatalf("ParseResponse: %v", err)
+	}
+	if assertion.ID != "id-assertion-1" || assertion.NameID != "ana@example.com" || assertion.InResponseTo != "id-request-1" {
+		t.Errorf("assertion = %+v", assertion)
+	}
+	if assertion.Attribute("role") != "sales" {
+		t.Errorf("role attribute = %q", assertion.Attribute("role"))
+	}
+	if !assertion.NotOnOrAfter.After(st.now) {
+		t.Errorf("assertion expires at %s, before now", assertion.NotOnOrAfter)
+	}
+
+	// A signature over the whole response covers the assertion inside it
+	if _, err := st.parse(t, st.idp.Sign(t, st.response(st.assertion("id-assertion-2", "ana@example.com")))); err != nil {
+		t.Errorf("ParseResponse(signed response): %v", err)
+	}
+}
+
+func TestSAMLParseResponseRejectsInvalidResponses(t *testing.T) {
+	tests := []struct {
+		name     string
+		response func(t *testing.T, st *samlTest) *etree.Element
+		wantErr  string
+	}{
+		{
+			name: "unsigned assertion",
+			response: func(t *testing.T, st *samlTest) *etree.Element {
+				return st.response(st.assertion("id-assertion-1", "ana@example.com"))
+			},
+			wantErr: "neither the response nor the assertion is signed",
+		},
+		{
+			name: "signed content changed",
+			response: func(t *testing.T, st *samlTest) *etree.Element {
+				signed := st.idp.Sign(t, st.assertion("id-assertion-1", "ana@example.com"))
+				signed.FindElement("./Subject/NameID").SetText("mallory@example.com")
+				return st.response(signed)
+			},
+			wantErr: "assertion signature is invalid",
+		},
+		{
+			name: "second unsigned assertion",
+			response: func(t *testing.T, st *samlTest) *etree.Element {
+				signed := st.idp.Sign(t, st.assertion("id-assertion-1", "ana@example.com"))
+				return st.response(signed, st.assertion("id-assertion-2", "mallory@example.com"))
+			},
+			wantErr: "exactly one assertion",
+		},
+		{
+			name: "signed assertion moved out of place",
+			response: func(t *testing.T, st *samlTest) *etree.Element {
+				signed := st.idp.Sign(t, st.assertion("id-assertion-1", "ana@example.com"))
+				response := st.response(st.assertion("id-assertion-2", "mallory@example.com"))
+				response.CreateElement("samlp:Extensions").AddChild(signed)
+				return response
+			},
+			wantErr: "neither the response nor the assertion is signed",
+		},
+		{
+			name: "signature moved onto a forged assertion",
+			response: func(t *testing.T, st *samlTest) *etree.Element {
+				signed := st.idp.Sign(t, st.assertion("id-assertion-1", "ana@example.com"))
+				forged := st.assertion("id-assertion-1", "mallory@example.com")
+				forged.AddChild(signed.SelectElement("Signature").Copy())
+				return st.response(forged)
+			},
+			wantErr: "assertion signature is invalid",
+		},
+		{
+			name: "signed assertion wrapped in a forged one",
+			response: func(t *testing.T, st *samlTest) *etree.Element {
+				signed := st.idp.Sign(t, st.assertion("id-assertion-1", "ana@example.com"))
+				forged := st.assertion("id-assertion-2", "mallory@example.com")
+				forged.AddChild(signed.SelectElement("Signature").Copy())
+				forged.CreateElement("saml:Advice").AddChild(signed)
+				return st.response(forged)
+			},
+			wantErr: "assertion signature is invalid",
+		},
+		{
+			name: "wrong audience",
+			response: func(t *testing.T, st *samlTest) *etree.Element {
+				assertion := st.idp.Assertion(samltest.Assertion{
+					ID:           "id-assertion-1",
+					NameID:       "ana@example.com",
+					Audience:     st.sp.EntityID(testSAMLOrgID + 1),
+					Recipient:    st.sp.ACSURL(testSAMLOrgID),
+					NotOnOrAfter: st.now.Add(5 * time.Minute),
+				})
+				return st.response(st.idp.Sign(t, assertion))
+			},
+			wantErr: "not intended for this service provider",
+		},
+		{
+			name: "expired",
+			response: func(t *testing.T, st *samlTest) *etree.Element {
+				assertion := st.idp.Assertion(samltest.Assertion{
+					ID:           "id-assertion-1",
+					NameID:       "ana@example.com",
+					Audience:     st.sp.EntityID(testSAMLOrgID),
+					Recipient:    st.sp.ACSURL(testSAMLOrgID),
+					NotOnOrAfter: st.now.Add(-samlClockSkew - time.Second),
+				})
+				return st.response(st.idp.Sign(t, assertion))
+			},
+			wantErr: "no valid bearer subject confirmation",
+		},
+		{
+			name: "signed by another IdP",
+			response: func(t *testing.T, st *samlTest) *etree.Element {
+				other := samltest.NewIdP(t, testIdPEntityID)
+				return st.response(other.Sign(t, st.assertion("id-assertion-1", "ana@example.com")))
+			},
+			wantErr: "assertion signature is invalid",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := newSAMLTest(t)
+
+			assertion, err := st.parse(t, tt.response(t, st))
+			if err == nil {
+				t.Fatalf("ParseResponse accepted the response: %+v", assertion)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+// Package samltest plays a SAML identity provider for tests of SAML single
+// sign-on: it issues assertions, signs them with a freshly generated key and
+// wraps them in responses ready to be posted to an ACS.
+package samltest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const (
+	protocolNS  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	assertionNS = "urn:oasis:names:tc:SAML:2.0:assertion"
+	statusOK    = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	bearer      = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	nameIDEmail = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+)
+
+// IdP is a stub identity provider with its own signing key and certificate
+type IdP struct {
+	EntityID string
+
+	key  *rsa.PrivateKey
+	cert []byte
+}
+
+// NewIdP generates a key and a self-signed certificate for entityID
+func NewIdP(t testing.TB, entityID string) *IdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate IdP key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: entityID},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create IdP certificate: %v", err)
+	}
+
+	return &IdP{EntityID: entityID, key: key, cert: cert}
+}
+
+// CertificatePEM returns the IdP's signing certificate, as configured on
+// the service provider
+func (idp *IdP) CertificatePEM() string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: idp.cert}))
+}
+
+// Assertion describes an assertion for the IdP to issue
+type Assertion struct {
+	ID           string
+	NameID       string
+	Audience     string
+	Recipient    string
+	InResponseTo string
+	NotOnOrAfter time.Time
+	Attributes   map[string]string
+}
+
+// Assertion builds an unsigned assertion about a.NameID for a bearer
+// subject at a.Recipient, restricted to a.Audience
+func (idp *IdP) Assertion(a Assertion) *etree.Element {
+	issuedAt := a.NotOnOrAfter.Add(-5 * time.Minute).UTC().Format(time.RFC3339)
+	notOnOrAfter := a.NotOnOrAfter.UTC().Format(time.RFC3339)
+
+	assertion := etree.NewElement("saml:Assertion")
+	assertion.CreateAttr("xmlns:saml", assertionNS)
+	assertion.CreateAttr("ID", a.ID)
+	assertion.CreateAttr("Version", "2.0")
+	assertion.CreateAttr("IssueInstant", issuedAt)
+	assertion.CreateElement("saml:Issuer").SetText(idp.EntityID)
+
+	subject := assertion.CreateElement("saml:Subject")
+	nameID := subject.CreateElement("saml:NameID")
+	nameID.CreateAttr("Format", nameIDEmail)
+	nameID.SetText(a.NameID)
+	confirmation := subject.CreateElement("saml:SubjectConfirmation")
+	confirmation.CreateAttr("Method", bearer)
+	data := confirmation.CreateElement("saml:SubjectConfirmationData")
+	if a.InResponseTo != "" {
+		data.CreateAttr("InResponseTo", a.InResponseTo)
+	}
+	data.CreateAttr("Recipient", a.Recipient)
+	data.CreateAttr("NotOnOrAfter", notOnOrAfter)
+
+	conditions := assertion.CreateElement("saml:Conditions")
+	conditions.CreateAttr("NotBefore", issuedAt)
+	conditions.CreateAttr("NotOnOrAfter", notOnOrAfter)
+	conditions.CreateElement("saml:AudienceRestriction").CreateElement("saml:Audience").SetText(a.Audience)
+
+	statement := assertion.CreateElement("saml:AuthnStatement")
+	statement.CreateAttr("AuthnInstant", issuedAt)
+	statement.CreateAttr("SessionIndex", "session-"+a.ID)
+
+	if len(a.Attributes) > 0 {
+		attributes := assertion.CreateElement("saml:AttributeStatement")
+		for name, value := range a.Attributes {
+			attribute := attributes.CreateElement("saml:Attribute")
+			attribute.CreateAttr("Name", name)
+			attribute.CreateElement("saml:AttributeValue").SetText(value)
+		}
+	}
+
+	return assertion
+}
+
+// Response wraps assertions in a successful response to inResponseTo, or
+// an unsolicited one when it is empty
+func (idp *IdP) Response(id, destination, inResponseTo string, assertions ...*etree.Element) *etree.Element {
+	response := etree.NewElement("samlp:Response")
+	response.CreateAttr("xmlns:samlp", protocolNS)
+	response.CreateAttr("xmlns:saml", assertionNS)
+	response.CreateAttr("ID", id)
+	response.CreateAttr("Version", "2.0")
+	response.CreateAttr("IssueInstant", time.Now().UTC().Format(time.RFC3339))
+	response.CreateAttr("Destination", destination)
+	if inResponseTo != "" {
+		response.CreateAttr("InResponseTo", inResponseTo)
+	}
+	response.CreateElement("saml:Issuer").SetText(idp.EntityID)
+	response.CreateElement("samlp:Status").CreateElement("samlp:StatusCode").CreateAttr("Value", statusOK)
+
+	for _, assertion := range assertions {
+		response.AddChild(assertion)
+	}
+	return response
+}
+
+// Sign returns a copy of el carrying an enveloped signature by the IdP,
+// canonicalized with exclusive C14N as real IdPs do
+func (idp *IdP) Sign(t testing.TB, el *etree.Element) *etree.Element {
+	t.Helper()
+
+	ctx := dsig.NewDefaultSigningContext(idp)
+	ctx.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	signed, err := ctx.SignEnveloped(el.Copy())
+	if err != nil {
+		t.Fatalf("sign %s: %v", el.Tag, err)
+	}
+	return signed
+}
+
+// GetKeyPair implements dsig.X509KeyStore
+func (idp *IdP) GetKeyPair() (*rsa.PrivateKey, []byte, error) {
+	return idp.key, idp.cert, nil
+}
+
+// Encode serializes response the way the HTTP-POST binding carries it
+func Encode(t testing.TB, response *etree.Element) string {
+	t.Helper()
+
+	doc := etree.NewDocument()
+	doc.SetRoot(response.Copy())
+	raw, err := doc.WriteToBytes()
+	if err != nil {
+		t.Fatalf("encode response: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
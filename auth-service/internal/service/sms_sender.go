@@ -0,0 +1,45 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+)
+
+// SMSSender texts a message to a phone number in E.164 form
+type SMSSender interface {
+	SendSMS(to, body string) error
+}
+
+// NewSMSSender returns the sender selected by sms.sender
+func NewSMSSender(cfg config.SMSConfig) (SMSSender, error) {
+	switch cfg.Sender {
+	case "", "log":
+		return NewLogSMSSender(os.Stdout), nil
+	case "http":
+		return NewHTTPSMSSender(cfg.HTTP)
+	}
+	return nil, fmt.Errorf("unknown sms sender %q", cfg.Sender)
+}
+
+// LogSMSSender prints every message to a writer, normally stdout, instead
+// of sending it
+type LogSMSSender struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func NewLogSMSSender(out io.Writer) *LogSMSSender {
+	return &LogSMSSender{out: out}
+}
+
+func (s *LogSMSSender) SendSMS(to, body string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := fmt.Fprintf(s.out, "----- sms to %s -----\n%s\n----- end of sms -----\n", to, body)
+	return err
+}
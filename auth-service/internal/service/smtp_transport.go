@@ -0,0 +1,117 @@
+package service
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+)
+
+// SMTPTransport submits messages to an SMTP server, over implicit TLS or a
+// connection upgraded with STARTTLS
+type SMTPTransport struct {
+	config config.SMTPConfig
+}
+
+func NewSMTPTransport(config config.SMTPConfig) (*SMTPTransport, error) {
+	switch config.Security {
+	case "", "starttls", "tls", "none":
+	default:
+		return nil, fmt.Errorf("unknown smtp.security %q", config.Security)
+	}
+	return &SMTPTransport{config: config}, nil
+}
+
+func (t *SMTPTransport) Deliver(msg *MailMessage) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	// Log SMTP configuration for debugging
+	log.Printf("Sending email to %v via %s:%s\n", msg.Recipients(), t.config.Host, t.config.Port)
+
+	client, err := t.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if t.config.User != "" {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return fmt.Errorf("smtp server %s does not support AUTH", t.config.Host)
+		}
+		if err := client.Auth(smtp.PlainAuth("", t.config.User, t.config.Pass, t.config.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(msg.From.Address); err != nil {
+		return err
+	}
+	for _, recipient := range msg.Recipients() {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// dial connects and, unless security is "none", makes sure the session is
+// encrypted before anything is sent
+func (t *SMTPTransport) dial() (*smtp.Client, error) {
+	address := net.JoinHostPort(t.config.Host, t.config.Port)
+	tlsConfig := &tls.Config{
+		ServerName:         t.config.Host,
+		InsecureSkipVerify: t.config.InsecureSkipVerify,
+	}
+	dialer := &net.Dialer{Timeout: t.config.Timeout}
+
+	var conn net.Conn
+	var err error
+	if t.config.Security == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Bound the whole session, not just the connect
+	if t.config.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(t.config.Timeout))
+	}
+
+	client, err := smtp.NewClient(conn, t.config.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if t.config.Security == "" || t.config.Security == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, fmt.Errorf("smtp server %s does not support STARTTLS", t.config.Host)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+// TokenService mints the signed JWTs handed out to clients
+type TokenService struct {
+	config *config.Config
+}
+
+func NewTokenService(config *config.Config) *TokenService {
+	return &TokenService{
+		config: config,
+	}
+}
+
+// IssueUserToken signs a token for user. When membership is non-nil the
+// token is scoped to that organization and carries the per-org role.
+func (s *TokenService) IssueUserToken(user *domain.User, membership *domain.Membership) (string, error) {
+	claims := &domain.JWTClaims{
+		UserID: user.ID,
+		Role:   user.Role,
+		Email:  user.Email,
+	}
+	if membership != nil {
+		claims.OrgID = membership.OrgID
+		claims.OrgRole = membership.Role
+		if s.config.EmbedManagerClaim && membership.ManagerID != nil {
+			claims.ManagerID = *membership.ManagerID
+		}
+	}
+
+	return s.sign(claims)
+}
+
+// IssueOrganizationToken signs a token scoped to membership for a sign-in
+// that only the organization vouched for, such as an assertion from its own
+// SAML IdP. The organization speaks for the membership alone, so the token
+// carries no global role.
+func (s *TokenService) IssueOrganizationToken(user *domain.User, membership *domain.Membership) (string, error) {
+	scoped := *user
+	scoped.Role = ""
+	return s.IssueUserToken(&scoped, membership)
+}
+
+// IssueClientToken signs an OAuth2 access token for a confidential client.
+// Unlike user tokens it expires, after the configured access token TTL,
+// which is returned alongside the token.
+func (s *TokenService) IssueClientToken(client *domain.OAuthClient, scopes []string) (string, time.Duration, error) {
+	claims := &domain.JWTClaims{
+		Role: domain.OAuthClientRole,
+	}
+	if client.OrgID != nil {
+		claims.OrgID = *client.OrgID
+	}
+
+	return s.signAccessToken(claims, client.ClientID, client.ClientID, scopes)
+}
+
+// IssueDelegatedToken signs an OAuth2 access token that lets client act for
+// user within scopes, as granted through the authorization code flow
+func (s *TokenService) IssueDelegatedToken(user *domain.User, clientID string, scopes []string) (string, time.Duration, error) {
+	claims := &domain.JWTClaims{
+		UserID: user.ID,
+		Role:   user.Role,
+		Email:  user.Email,
+	}
+
+	return s.signAccessToken(claims, strconv.FormatInt(user.ID, 10), clientID, scopes)
+}
+
+func (s *TokenService) signAccessToken(claims *domain.JWTClaims, subject, clientID string, scopes []string) (string, time.Duration, error) {
+	now := time.Now()
+	ttl := s.config.OAuth.AccessTokenTTL
+	claims.ClientID = clientID
+	claims.Scope = strings.Join(scopes, " ")
+	claims.StandardClaims = jwt.StandardClaims{
+		Subject:   subject,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	}
+
+	token, err := s.sign(claims)
+	return token, ttl, err
+}
+
+func (s *TokenService) sign(claims *domain.JWTClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(s.config.JWTSecret))
+}
+
+// ParseToken checks the signature and expiry of a token signed by this
+// service and returns its claims. Tokens without an expiry never expire.
+func (s *TokenService) ParseToken(tokenString string) (*domain.JWTClaims, error) {
+	claims := &domain.JWTClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return []byte(s.config.JWTSecret), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
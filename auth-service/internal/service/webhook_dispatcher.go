@@ -0,0 +1,275 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/repository"
+)
+
+// Headers of webhook requests. The signature is the hex HMAC-SHA256, keyed
+// with the webhook's secret, of the timestamp, a dot and the request body;
+// subscribers should reject requests whose timestamp is too old to stop
+// replays of captured requests.
+const (
+	WebhookHeaderEventID   = "X-Webhook-Id"
+	WebhookHeaderEvent     = "X-Webhook-Event"
+	WebhookHeaderDelivery  = "X-Webhook-Delivery"
+	WebhookHeaderTimestamp = "X-Webhook-Timestamp"
+	WebhookHeaderSignature = "X-Webhook-Signature"
+)
+
+// maxWebhookResponseLog caps how much of a subscriber's response body is
+// kept in the delivery log
+const maxWebhookResponseLog = 1 << 10
+
+// errWebhookAddressNotAllowed is returned for requests to addresses that
+// are not on the public internet
+var errWebhookAddressNotAllowed = errors.New("webhook address is not a public address")
+
+// Ranges that pass netip's checks but are not reachable on the internet
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// isPublicAddress reports whether addr is a global unicast address outside
+// the private, loopback, link-local and other special-purpose ranges
+func isPublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// dialPublicOnly refuses connections to addresses that are not public. It
+// runs on the resolved address of every connection, so a hostname that
+// resolves, or later rebinds, to an internal address is refused too.
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !isPublicAddress(addr) {
+		return fmt.Errorf("%w: %s", errWebhookAddressNotAllowed, addr)
+	}
+	return nil
+}
+
+// newWebhookClient returns the client deliveries are posted with. Proxies
+// from the environment are ignored, as the dial check would only see the
+// proxy's address.
+func newWebhookClient(config config.WebhookConfig) *http.Client {
+	dialer := &net.Dialer{Timeout: config.Timeout, KeepAlive: 30 * time.Second}
+	if !config.AllowPrivateNetworks {
+		dialer.Control = dialPublicOnly
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   config.Timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// WebhookDispatcher sends queued webhook deliveries to their subscribers,
+// retrying failures with exponential backoff
+type WebhookDispatcher struct {
+	webhookRepository repository.WebhookRepository
+	client            *http.Client
+	config            config.WebhookConfig
+	logger            *logrus.Logger
+}
+
+// NewWebhookDispatcher returns a dispatcher posting with client, or with a
+// client bounded by the configured timeout when client is nil. That client
+// only connects to public addresses, unless private networks are allowed,
+// so neither a webhook nor its logged responses reach internal services.
+// Redirects are never followed: a subscriber that moved must be updated.
+func NewWebhookDispatcher(webhookRepository repository.WebhookRepository, client *http.Client, config config.WebhookConfig) *WebhookDispatcher {
+	if client == nil {
+		client = newWebhookClient(config)
+	}
+	return &WebhookDispatcher{
+		webhookRepository: webhookRepository,
+		client:            client,
+		config:            config,
+		logger:            logrus.New(),
+	}
+}
+
+// SignWebhookPayload is the value of the signature header of a request
+// carrying payload at timestamp
+func SignWebhookPayload(secret string, timestamp time.Time, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// DeliverDue makes one attempt at up to a batch of due deliveries and
+// returns how many were claimed. Deliveries are sent concurrently so that a
+// slow subscriber does not hold up the others; failures are recorded on the
+// delivery rather than returned.
+func (d *WebhookDispatcher) DeliverDue() (int, error) {
+	// Every request of the batch runs at once, so a lease of twice the
+	// request timeout leaves room to record the outcome
+	deliveries, err := d.webhookRepository.ClaimDueDeliveries(time.Now(), 2*d.config.Timeout, d.config.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	webhooks := make(map[int64]*domain.Webhook)
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		webhook, ok := webhooks[delivery.WebhookID]
+		if !ok {
+			webhook, err = d.webhookRepository.FindWebhookByID(delivery.WebhookID)
+			if err != nil {
+				// The attempt is retried once its lease has passed
+				d.logger.Errorf("Failed to load webhook %d for delivery %d: %v", delivery.WebhookID, delivery.ID, err)
+				continue
+			}
+			webhooks[webhook.ID] = webhook
+		}
+
+		wg.Add(1)
+		go func(webhook *domain.Webhook, delivery *domain.WebhookDelivery) {
+			defer wg.Done()
+			if err := d.deliver(webhook, delivery); err != nil {
+				d.logger.Errorf("Failed to record webhook delivery %d: %v", delivery.ID, err)
+			}
+		}(webhook, delivery)
+	}
+	wg.Wait()
+
+	return len(deliveries), nil
+}
+
+// deliver makes one attempt at delivery and records its outcome. Only 2xx
+// responses count as delivered.
+func (d *WebhookDispatcher) deliver(webhook *domain.Webhook, delivery *domain.WebhookDelivery) error {
+	attempt := &domain.WebhookDeliveryAttempt{
+		DeliveryID:  delivery.ID,
+		AttemptedAt: time.Now(),
+	}
+
+	statusCode, body, sendErr := d.send(webhook, delivery)
+	attempt.DurationMS = time.Since(attempt.AttemptedAt).Milliseconds()
+	attempt.ResponseBody = body
+	if statusCode != 0 {
+		attempt.StatusCode = &statusCode
+	}
+	if sendErr == nil && (statusCode < 200 || statusCode > 299) {
+		sendErr = fmt.Errorf("subscriber responded with status %d", statusCode)
+	}
+	if sendErr != nil {
+		attempt.Error = sendErr.Error()
+	}
+
+	if err := d.webhookRepository.RecordDeliveryAttempt(attempt); err != nil {
+		d.logger.Errorf("Failed to log attempt at webhook delivery %d: %v", delivery.ID, err)
+	}
+
+	if sendErr == nil {
+		return d.webhookRepository.MarkDeliveryDelivered(delivery.ID, statusCode, time.Now())
+	}
+	return d.recordFailure(delivery, attempt.StatusCode, sendErr)
+}
+
+// send posts the delivery's payload to the webhook, returning the response
+// status and the start of the response body
+func (d *WebhookDispatcher) send(webhook *domain.Webhook, delivery *domain.WebhookDelivery) (int, string, error) {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+
+	// Each attempt is signed afresh, so its timestamp is the time it was sent
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookHeaderEventID, delivery.EventID)
+	req.Header.Set(WebhookHeaderEvent, delivery.EventType)
+	req.Header.Set(WebhookHeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(WebhookHeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(WebhookHeaderSignature, SignWebhookPayload(webhook.Secret, now, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponseLog))
+	// Drain the rest so the connection can be reused
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, string(body), nil
+}
+
+// recordFailure schedules the next attempt, or gives up on the delivery
+// once it is out of attempts
+func (d *WebhookDispatcher) recordFailure(delivery *domain.WebhookDelivery, statusCode *int, sendErr error) error {
+	dead := delivery.Attempts >= d.config.MaxAttempts
+	fields := logrus.Fields{
+		"delivery_id": delivery.ID,
+		"webhook_id":  delivery.WebhookID,
+		"event":       delivery.EventType,
+		"attempt":     delivery.Attempts,
+	}
+	if dead {
+		d.logger.WithFields(fields).Errorf("Giving up on webhook delivery: %v", sendErr)
+	} else {
+		d.logger.WithFields(fields).Warnf("Failed to deliver webhook: %v", sendErr)
+	}
+
+	return d.webhookRepository.MarkDeliveryFailed(delivery.ID, statusCode, sendErr.Error(), time.Now().Add(d.retryDelay(delivery.Attempts)), dead)
+}
+
+// retryDelay is the wait after the given number of failed attempts: the
+// configured retry delay, doubled for every attempt after the first
+func (d *WebhookDispatcher) retryDelay(attempts int) time.Duration {
+	delay := d.config.RetryDelay
+	for i := 1; i < attempts && delay < d.config.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.config.MaxRetryDelay {
+		delay = d.config.MaxRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+func TestIsPublicAddress(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "93.184.216.34", want: true},
+		{addr: "2606:2800:220:1:248:1893:25c8:1946", want: true},
+		{addr: "127.0.0.1"},
+		{addr: "::1"},
+		{addr: "10.1.2.3"},
+		{addr: "172.16.0.1"},
+		{addr: "192.168.1.1"},
+		{addr: "169.254.169.254"},
+		{addr: "fe80::1"},
+		{addr: "fd00:ec2::254"},
+		{addr: "100.64.0.1"},
+		{addr: "0.0.0.0"},
+		{addr: "::"},
+		{addr: "224.0.0.1"},
+		{addr: "::ffff:127.0.0.1"},
+		{addr: "::ffff:10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		if got := isPublicAddress(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("isPublicAddress(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookDispatcherRefusesPrivateAddresses(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("internal secret"))
+	}))
+	defer server.Close()
+
+	webhook := &domain.Webhook{URL: server.URL, Secret: "whsec_test"}
+	delivery := &domain.WebhookDelivery{ID: 1, EventID: "evt_test", EventType: domain.WebhookEventUserCreated, Payload: []byte(`{}`)}
+
+	dispatcher := NewWebhookDispatcher(nil, nil, config.WebhookConfig{Timeout: 5 * time.Second})
+	statusCode, body, err := dispatcher.send(webhook, delivery)
+	if !errors.Is(err, errWebhookAddressNotAllowed) {
+		t.Fatalf("send to %s error = %v, want %v", server.URL, err, errWebhookAddressNotAllowed)
+	}
+	if statusCode != 0 || body != "" || requests != 0 {
+		t.Errorf("send reached the server: status %d, body %q, %d requests", statusCode, body, requests)
+	}
+
+	dispatcher = NewWebhookDispatcher(nil, nil, config.WebhookConfig{Timeout: 5 * time.Second, AllowPrivateNetworks: true})
+	if statusCode, _, err := dispatcher.send(webhook, delivery); err != nil || statusCode != http.StatusOK {
+		t.Errorf("send with private networks allowed = %d, %v", statusCode, err)
+	}
+}
@@ -0,0 +1,247 @@
+package usecase
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/repository"
+	"github.com/sales-tracker/auth-service/internal/service"
+)
+
+// API keys look like stk_<12 hex chars>_<43 char secret>. The part up to the
+// second underscore is the public prefix used to look the key up.
+const (
+	apiKeyPrefixBytes = 6
+	apiKeySecretBytes = 32
+	apiKeyPrefixLen   = len(domain.APIKeyPrefix) + 2*apiKeyPrefixBytes
+)
+
+type APIKeyUsecase struct {
+	apiKeyRepository       repository.APIKeyRepository
+	organizationRepository repository.OrganizationRepository
+	userRepository         repository.UserRepository
+	auditLogger            service.AuditLogger
+}
+
+func NewAPIKeyUsecase(apiKeyRepository repository.APIKeyRepository, organizationRepository repository.OrganizationRepository, userRepository repository.UserRepository, auditLogger service.AuditLogger) *APIKeyUsecase {
+	return &APIKeyUsecase{
+		apiKeyRepository:       apiKeyRepository,
+		organizationRepository: organizationRepository,
+		userRepository:         userRepository,
+		auditLogger:            auditLogger,
+	}
+}
+
+func (u *APIKeyUsecase) audit(info domain.RequestInfo, eventType string, subjectID *int64, err error, metadata map[string]interface{}) {
+	recordAuditEvent(u.auditLogger, info, eventType, subjectID, err, metadata)
+}
+
+// CreateAPIKey creates a key owned by userID. Organization-owned keys are
+// bound to the caller's active organization and require its admin role.
+// The plaintext key is returned once and never stored.
+func (u *APIKeyUsecase) CreateAPIKey(info domain.RequestInfo, userID, orgID int64, req domain.APIKeyCreate) (key *domain.APIKey, _ string, err error) {
+	defer func() {
+		metadata := map[string]interface{}{"name": req.Name, "scopes": req.Scopes, "org_owned": req.OrgOwned}
+		if key != nil {
+			metadata["api_key_id"] = key.ID
+			metadata["prefix"] = key.Prefix
+		}
+		u.audit(info, domain.AuditEventAPIKeyCreated, &userID, err, metadata)
+	}()
+
+	key = &domain.APIKey{
+		UserID: userID,
+		Name:   strings.TrimSpace(req.Name),
+		Scopes: req.Scopes,
+	}
+	if key.Scopes == nil {
+		key.Scopes = []string{}
+	}
+	// A scope no route checks would grant nothing, and one added to a route
+	// later would silently widen keys created before it
+	for _, scope := range key.Scopes {
+		if !containsString(domain.APIKeyScopes, scope) {
+			return nil, "", domain.ErrInvalidAPIKeyScope
+		}
+	}
+
+	if req.OrgOwned {
+		orgAdmin, err := u.isOrgAdmin(userID, orgID)
+		if err != nil {
+			return nil, "", err
+		}
+		if !orgAdmin {
+			return nil, "", domain.ErrAPIKeyForbidden
+		}
+		key.OrgID = &orgID
+	}
+
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		key.ExpiresAt = &expiresAt
+	}
+
+	plaintext, err := generateAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+	key.Prefix = plaintext[:apiKeyPrefixLen]
+	key.KeyHash = hashAPIKey(plaintext)
+
+	if err := u.apiKeyRepository.CreateAPIKey(key); err != nil {
+		return nil, "", err
+	}
+
+	return key, plaintext, nil
+}
+
+// ListAPIKeys returns the caller's personal keys plus, for organization
+// admins, every key owned by the active organization
+func (u *APIKeyUsecase) ListAPIKeys(userID, orgID int64) ([]*domain.APIKey, error) {
+	keys, err := u.apiKeyRepository.ListAPIKeysByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	orgAdmin, err := u.isOrgAdmin(userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if orgAdmin {
+		orgKeys, err := u.apiKeyRepository.ListAPIKeysByOrg(orgID)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, orgKeys...)
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey revokes a key created by the caller, or any key of the
+// active organization when the caller is its admin
+func (u *APIKeyUsecase) RevokeAPIKey(info domain.RequestInfo, userID, orgID, keyID int64) (err error) {
+	var subjectID *int64
+	defer func() {
+		u.audit(info, domain.AuditEventAPIKeyRevoked, subjectID, err, map[string]interface{}{"api_key_id": keyID})
+	}()
+
+	key, err := u.apiKeyRepository.FindAPIKeyByID(keyID)
+	if err != nil {
+		return err
+	}
+	subjectID = &key.UserID
+
+	if key.UserID != userID {
+		if key.OrgID == nil || *key.OrgID != orgID {
+			return domain.ErrAPIKeyNotFound
+		}
+		orgAdmin, err := u.isOrgAdmin(userID, orgID)
+		if err != nil {
+			return err
+		}
+		if !orgAdmin {
+			return domain.ErrAPIKeyNotFound
+		}
+	}
+
+	return u.apiKeyRepository.RevokeAPIKey(key.ID)
+}
+
+// isOrgAdmin reports whether the user is currently an admin of orgID. The
+// org_role claim of a token can be stale, so the membership is checked.
+func (u *APIKeyUsecase) isOrgAdmin(userID, orgID int64) (bool, error) {
+	if orgID == 0 {
+		return false, nil
+	}
+	membership, err := u.organizationRepository.FindMembership(userID, orgID)
+	if errors.Is(err, domain.ErrMembershipNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return membership.Role == domain.OrgRoleAdmin, nil
+}
+
+// AuthenticateAPIKey resolves a plaintext key to the user (and, for
+// organization keys, the membership) it acts as
+func (u *APIKeyUsecase) AuthenticateAPIKey(plaintext string) (*domain.APIKeyPrincipal, error) {
+	now := time.Now()
+	principal, err := resolveAPIKey(u.apiKeyRepository, u.userRepository, u.organizationRepository, plaintext, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.apiKeyRepository.TouchAPIKey(principal.Key.ID, now); err != nil {
+		return nil, err
+	}
+
+	return principal, nil
+}
+
+// resolveAPIKey checks a plaintext key without recording its use. Unknown,
+// revoked and expired keys, and keys whose owner can no longer act, are all
+// reported as domain.ErrInvalidAPIKey.
+func resolveAPIKey(apiKeyRepository repository.APIKeyRepository, userRepository repository.UserRepository, organizationRepository repository.OrganizationRepository, plaintext string, now time.Time) (*domain.APIKeyPrincipal, error) {
+	if len(plaintext) <= apiKeyPrefixLen || !strings.HasPrefix(plaintext, domain.APIKeyPrefix) {
+		return nil, domain.ErrInvalidAPIKey
+	}
+
+	key, err := apiKeyRepository.FindAPIKeyByPrefix(plaintext[:apiKeyPrefixLen])
+	if err != nil {
+		return nil, domain.ErrInvalidAPIKey
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashAPIKey(plaintext)), []byte(key.KeyHash)) != 1 {
+		return nil, domain.ErrInvalidAPIKey
+	}
+
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && key.ExpiresAt.Before(now)) {
+		return nil, domain.ErrInvalidAPIKey
+	}
+
+	user, err := userRepository.FindUserByID(key.UserID)
+	if err != nil || user.DeletedAt != nil || !user.IsActive {
+		return nil, domain.ErrInvalidAPIKey
+	}
+
+	principal := &domain.APIKeyPrincipal{Key: key, User: user}
+	if key.OrgID != nil {
+		// The key stops working if its creator leaves the organization
+		membership, err := organizationRepository.FindMembership(key.UserID, *key.OrgID)
+		if err != nil {
+			return nil, domain.ErrInvalidAPIKey
+		}
+		principal.Membership = membership
+	}
+
+	return principal, nil
+}
+
+func generateAPIKey() (string, error) {
+	prefix := make([]byte, apiKeyPrefixBytes)
+	if _, err := rand.Read(prefix); err != nil {
+		return "", err
+	}
+	secret := make([]byte, apiKeySecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return domain.APIKeyPrefix + hex.EncodeToString(prefix) + "_" + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// hashAPIKey returns the hex SHA-256 of the key. Keys carry 256 bits of
+// randomness, so a fast hash is sufficient.
+func hashAPIKey(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
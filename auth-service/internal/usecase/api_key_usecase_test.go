@@ -0,0 +1,43 @@
+package usecase
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+func TestCreateAPIKeyScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  []string
+		wantErr error
+	}{
+		{name: "no scopes"},
+		{name: "known scopes", scopes: []string{domain.ScopeOrgs, domain.ScopeUsersRead}},
+		{name: "unknown scope", scopes: []string{domain.ScopeOrgs, "admin"}, wantErr: domain.ErrInvalidAPIKeyScope},
+		{name: "OAuth client scope", scopes: []string{domain.ScopeIntrospect}, wantErr: domain.ErrInvalidAPIKeyScope},
+		{name: "wrong case", scopes: []string{"ORGS"}, wantErr: domain.ErrInvalidAPIKeyScope},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiKeys := &fakeAPIKeyRepository{}
+			apiKeyUsecase := NewAPIKeyUsecase(apiKeys, &fakeOrganizationRepository{}, &fakeUserRepository{}, discardAuditLogger{})
+
+			key, plaintext, err := apiKeyUsecase.CreateAPIKey(domain.RequestInfo{}, 1, 0, domain.APIKeyCreate{Name: "CRM sync", Scopes: tt.scopes})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreateAPIKey: error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(apiKeys.keys) != 0 {
+					t.Errorf("stored %d keys despite the error", len(apiKeys.keys))
+				}
+				return
+			}
+			if plaintext == "" || len(key.Scopes) != len(tt.scopes) {
+				t.Errorf("key = %+v, plaintext %q", key, plaintext)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package usecase
+
+import (
+	"strconv"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/repository"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+type AuditUsecase struct {
+	auditRepository repository.AuditRepository
+}
+
+func NewAuditUsecase(auditRepository repository.AuditRepository) *AuditUsecase {
+	return &AuditUsecase{
+		auditRepository: auditRepository,
+	}
+}
+
+// ListEvents returns one page of audit events matching filter, newest first,
+// along with the cursor for the next page ("" when there are no more).
+func (u *AuditUsecase) ListEvents(filter domain.AuditEventFilter) ([]*domain.AuditEvent, string, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditPageSize
+	}
+	if filter.Limit > maxAuditPageSize {
+		filter.Limit = maxAuditPageSize
+	}
+
+	// Fetch one extra row to find out whether another page exists
+	pageSize := filter.Limit
+	filter.Limit++
+
+	events, err := u.auditRepository.ListEvents(filter)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if len(events) > pageSize {
+		events = events[:pageSize]
+		nextCursor = strconv.FormatInt(events[pageSize-1].ID, 10)
+	}
+
+	return events, nextCursor, nil
+}
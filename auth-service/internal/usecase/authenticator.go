@@ -0,0 +1,203 @@
+package usecase
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/repository"
+	"github.com/sales-tracker/auth-service/internal/service"
+)
+
+// Authenticator checks the email and password a user signs in with. Wrong
+// credentials are reported as domain.ErrInvalidCredentials, together with
+// the user when the account exists so the attempt can be audited against
+// it. Account state (verified, deleted, disabled) is left to the caller.
+type Authenticator interface {
+	Authenticate(email, password string) (*domain.User, error)
+}
+
+// PasswordAuthenticator checks the bcrypt password hash stored on the account
+type PasswordAuthenticator struct {
+	userRepository repository.UserRepository
+}
+
+func NewPasswordAuthenticator(userRepository repository.UserRepository) *PasswordAuthenticator {
+	return &PasswordAuthenticator{userRepository: userRepository}
+}
+
+func (a *PasswordAuthenticator) Authenticate(email, password string) (*domain.User, error) {
+	user, err := a.userRepository.FindUserByEmail(email)
+	if err != nil {
+		return nil, domain.ErrInvalidCredentials
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return user, domain.ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
+// LDAPAuthenticator binds to a directory as the user. Accounts and the
+// membership in the directory's organization follow the directory entry.
+type LDAPAuthenticator struct {
+	directory              service.Directory
+	policy                 domain.DirectoryPolicy
+	userRepository         repository.UserRepository
+	organizationRepository repository.OrganizationRepository
+	webhooks               *WebhookUsecase
+}
+
+func NewLDAPAuthenticator(directory service.Directory, policy domain.DirectoryPolicy, userRepository repository.UserRepository, organizationRepository repository.OrganizationRepository, webhooks *WebhookUsecase) *LDAPAuthenticator {
+	if policy.DefaultRole == "" {
+		policy.DefaultRole = domain.OrgRoleClient
+	}
+	return &LDAPAuthenticator{
+		directory:              directory,
+		policy:                 policy,
+		userRepository:         userRepository,
+		organizationRepository: organizationRepository,
+		webhooks:               webhooks,
+	}
+}
+
+// HandlesEmail reports whether email is in one of the directory's domains
+func (a *LDAPAuthenticator) HandlesEmail(email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	for _, emailDomain := range a.policy.EmailDomains {
+		if strings.EqualFold(email[at+1:], strings.TrimPrefix(emailDomain, "@")) {
+			return true
+		}
+	}
+	return false
+}
+
+// HandlesAccount reports whether the directory created user's account
+func (a *LDAPAuthenticator) HandlesAccount(user *domain.User) bool {
+	return a.policy.OrgID != 0 && user.ProvisionedBy(a.policy.OrgID)
+}
+
+func (a *LDAPAuthenticator) Authenticate(email, password string) (*domain.User, error) {
+	user, findErr := a.userRepository.FindUserByEmail(email)
+
+	identity, err := a.directory.Authenticate(email, password)
+	if err != nil {
+		if findErr != nil {
+			return nil, err
+		}
+		return user, err
+	}
+
+	role, roleAsserted := a.role(identity.Groups)
+
+	if findErr != nil {
+		if !a.policy.AllowSignup {
+			return nil, domain.ErrNoLinkedAccount
+		}
+		// Directory accounts have no password and always sign in here
+		user = &domain.User{
+			Email:      email,
+			Role:       globalRoleForOrgRole(role),
+			IsVerified: true,
+		}
+		if a.policy.OrgID != 0 {
+			user.ProvisionedByOrgID = &a.policy.OrgID
+		}
+		if err := a.userRepository.CreateUser(user); err != nil {
+			return nil, err
+		}
+		if err := a.webhooks.Publish(domain.WebhookEventUserCreated, userCreatedEvent(user, "ldap")); err != nil {
+			logrus.Warnf("Failed to publish creation of user %d: %v", user.ID, err)
+		}
+	}
+
+	if name := strings.TrimSpace(identity.Name); name != "" && user.Name == "" {
+		user.Name = name
+		if err := a.userRepository.UpdateUserName(user.ID, name); err != nil {
+			return nil, err
+		}
+	}
+
+	// Memberships are left alone for disabled and deleted accounts, which
+	// the caller turns away
+	if a.policy.OrgID != 0 && user.DeletedAt == nil && user.IsActive {
+		if _, err := syncIdentityMembership(a.organizationRepository, a.webhooks, "ldap", user.ID, a.policy.OrgID, role, roleAsserted, true); err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// role maps the user's groups to the highest-ranked organization role. The
+// second result reports whether a group was mapped, as opposed to the
+// default role being used.
+func (a *LDAPAuthenticator) role(groups []string) (string, bool) {
+	role, mapped := "", false
+	for _, group := range groups {
+		for groupDN, granted := range a.policy.GroupRoles {
+			if strings.EqualFold(strings.TrimSpace(group), strings.TrimSpace(groupDN)) && orgRoleRank[granted] > orgRoleRank[role] {
+				role, mapped = granted, true
+			}
+		}
+	}
+	if !mapped {
+		return a.policy.DefaultRole, false
+	}
+	return role, true
+}
+
+// RoutingAuthenticator sends each login to the directory that owns the
+// user's email domain or created their account, and to the fallback
+// authenticator otherwise
+type RoutingAuthenticator struct {
+	fallback       Authenticator
+	directories    []*LDAPAuthenticator
+	userRepository repository.UserRepository
+}
+
+func NewRoutingAuthenticator(fallback Authenticator, directories []*LDAPAuthenticator, userRepository repository.UserRepository) *RoutingAuthenticator {
+	return &RoutingAuthenticator{
+		fallback:       fallback,
+		directories:    directories,
+		userRepository: userRepository,
+	}
+}
+
+func (a *RoutingAuthenticator) Authenticate(email, password string) (*domain.User, error) {
+	authenticator, err := a.route(email)
+	if err != nil {
+		return nil, err
+	}
+	return authenticator.Authenticate(email, password)
+}
+
+func (a *RoutingAuthenticator) route(email string) (Authenticator, error) {
+	if len(a.directories) == 0 {
+		return a.fallback, nil
+	}
+
+	for _, directory := range a.directories {
+		if directory.HandlesEmail(email) {
+			return directory, nil
+		}
+	}
+
+	user, err := a.userRepository.FindUserByEmail(email)
+	if err != nil {
+		return a.fallback, nil
+	}
+	for _, directory := range a.directories {
+		if directory.HandlesAccount(user) {
+			return directory, nil
+		}
+	}
+
+	return a.fallback, nil
+}
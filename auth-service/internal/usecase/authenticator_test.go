@@ -0,0 +1,231 @@
+package usecase
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/service"
+	"github.com/sales-tracker/auth-service/internal/service/ldaptest"
+)
+
+const (
+	directoryOrgID   = 7
+	directorySales   = "cn=Sales,ou=groups,dc=corp,dc=example"
+	directoryManager = "cn=Managers,ou=groups,dc=corp,dc=example"
+)
+
+func directoryPerson(name, email string, groups ...string) *ldaptest.Entry {
+	return &ldaptest.Entry{
+		DN:       "cn=" + name + ",ou=people,dc=corp,dc=example",
+		Password: name + "-secret",
+		Attributes: map[string][]string{
+			"objectClass": {"person"},
+			"mail":        {email},
+			"displayName": {name},
+			"memberOf":    groups,
+		},
+	}
+}
+
+type ldapAuthenticatorTest struct {
+	authenticator *LDAPAuthenticator
+	users         *fakeUserRepository
+	organizations *fakeOrganizationRepository
+}
+
+func newLDAPAuthenticatorTest(t *testing.T, entries ...*ldaptest.Entry) *ldapAuthenticatorTest {
+	t.Helper()
+
+	server := ldaptest.NewServer(t, entries...)
+	directory := service.NewLDAPDirectory("corp", config.LDAPDirectoryConfig{
+		URL:     server.URL(),
+		Timeout: 5 * time.Second,
+		BaseDN:  "dc=corp,dc=example",
+	})
+
+	at := &ldapAuthenticatorTest{
+		users:         &fakeUserRepository{},
+		organizations: &fakeOrganizationRepository{},
+	}
+	at.authenticator = NewLDAPAuthenticator(directory, domain.DirectoryPolicy{
+		OrgID: directoryOrgID,
+		// Group DNs are compared case-insensitively, ignoring surrounding space
+		GroupRoles: map[string]string{
+			"CN=Sales,OU=Groups,DC=corp,DC=example": domain.OrgRoleSalesRep,
+			" " + directoryManager + " ":            domain.OrgRoleSalesManager,
+		},
+		AllowSignup: true,
+	}, at.users, at.organizations, NewWebhookUsecase(&fakeWebhookRepository{}, discardAuditLogger{}))
+	return at
+}
+
+func (at *ldapAuthenticatorTest) role(t *testing.T, user *domain.User) string {
+	t.Helper()
+	membership, err := at.organizations.FindMembership(user.ID, directoryOrgID)
+	if err != nil {
+		t.Fatalf("FindMembership: %v", err)
+	}
+	return membership.Role
+}
+
+func TestLDAPAuthenticatorMapsGroupsToRoles(t *testing.T) {
+	at := newLDAPAuthenticatorTest(t,
+		directoryPerson("rep", "rep@corp.example", directorySales),
+		directoryPerson("manager", "manager@corp.example", directorySales, directoryManager),
+		directoryPerson("outsider", "outsider@corp.example", "cn=Others,ou=groups,dc=corp,dc=example"),
+	)
+
+	tests := []struct {
+		email    string
+		password string
+		want     string
+	}{
+		{email: "rep@corp.example", password: "rep-secret", want: domain.OrgRoleSalesRep},
+		// The highest-ranked of several mapped groups wins
+		{email: "manager@corp.example", password: "manager-secret", want: domain.OrgRoleSalesManager},
+		{email: "outsider@corp.example", password: "outsider-secret", want: domain.OrgRoleClient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			user, err := at.authenticator.Authenticate(tt.email, tt.password)
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if !user.IsVerified || user.Role != globalRoleForOrgRole(tt.want) || !user.ProvisionedBy(directoryOrgID) {
+				t.Errorf("created user = %+v", user)
+			}
+			if role := at.role(t, user); role != tt.want {
+				t.Errorf("membership role = %q, want %q", role, tt.want)
+			}
+		})
+	}
+}
+
+func TestLDAPAuthenticatorSyncsAssertedRoles(t *testing.T) {
+	at := newLDAPAuthenticatorTest(t,
+		directoryPerson("rep", "rep@corp.example", directorySales),
+		directoryPerson("outsider", "outsider@corp.example"),
+	)
+	rep := &domain.User{Email: "rep@corp.example", IsVerified: true}
+	outsider := &domain.User{Email: "outsider@corp.example", IsVerified: true}
+	at.users.CreateUser(rep)
+	at.users.CreateUser(outsider)
+	at.organizations.CreateMembership(&domain.Membership{UserID: rep.ID, OrgID: directoryOrgID, Role: domain.OrgRoleClient})
+	at.organizations.CreateMembership(&domain.Membership{UserID: outsider.ID, OrgID: directoryOrgID, Role: domain.OrgRoleSalesManager})
+
+	if _, err := at.authenticator.Authenticate("rep@corp.example", "rep-secret"); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if role := at.role(t, rep); role != domain.OrgRoleSalesRep {
+		t.Errorf("mapped member role = %q, want %q", role, domain.OrgRoleSalesRep)
+	}
+
+	// Without a mapped group the directory asserts nothing, so a role set
+	// in the app is kept rather than reset to the default
+	if _, err := at.authenticator.Authenticate("outsider@corp.example", "outsider-secret"); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if role := at.role(t, outsider); role != domain.OrgRoleSalesManager {
+		t.Errorf("unmapped member role = %q, want %q", role, domain.OrgRoleSalesManager)
+	}
+}
+
+func TestLDAPAuthenticatorRejectsCredentials(t *testing.T) {
+	at := newLDAPAuthenticatorTest(t, directoryPerson("rep", "rep@corp.example", directorySales))
+	rep := &domain.User{Email: "rep@corp.example", IsVerified: true}
+	at.users.CreateUser(rep)
+
+	for _, password := range []string{"", "wrong"} {
+		user, err := at.authenticator.Authenticate("rep@corp.example", password)
+		if !errors.Is(err, domain.ErrInvalidCredentials) {
+			t.Fatalf("Authenticate(%q) error = %v, want %v", password, err, domain.ErrInvalidCredentials)
+		}
+		// The account is returned so the failure is audited against it
+		if user == nil || user.ID != rep.ID {
+			t.Errorf("Authenticate(%q) user = %+v, want user %d", password, user, rep.ID)
+		}
+	}
+	if len(at.organizations.memberships) != 0 {
+		t.Error("membership created for a rejected login")
+	}
+}
+
+func TestLDAPAuthenticatorLeavesExistingAccountsUnverified(t *testing.T) {
+	at := newLDAPAuthenticatorTest(t, directoryPerson("rep", "rep@corp.example", directorySales))
+	// Someone registered the address before the directory signed its owner in
+	squatted := &domain.User{Email: "rep@corp.example", PasswordHash: "squatter"}
+	at.users.CreateUser(squatted)
+
+	user, err := at.authenticator.Authenticate("rep@corp.example", "rep-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if user.IsVerified {
+		t.Error("directory login verified an account it did not create")
+	}
+	if user.ProvisionedByOrgID != nil {
+		t.Errorf("directory login claimed an existing account: provisioned by %d", *user.ProvisionedByOrgID)
+	}
+}
+
+func TestRoutingAuthenticatorRoute(t *testing.T) {
+	users := &fakeUserRepository{}
+	organizations := &fakeOrganizationRepository{}
+	webhooks := NewWebhookUsecase(&fakeWebhookRepository{}, discardAuditLogger{})
+
+	fallback := NewPasswordAuthenticator(users)
+	byDomain := NewLDAPAuthenticator(nil, domain.DirectoryPolicy{OrgID: 1, EmailDomains: []string{"corp.example", "@subsidiary.example"}}, users, organizations, webhooks)
+	byOrg := NewLDAPAuthenticator(nil, domain.DirectoryPolicy{OrgID: 2}, users, organizations, webhooks)
+	router := NewRoutingAuthenticator(fallback, []*LDAPAuthenticator{byDomain, byOrg}, users)
+
+	directoryOrg := int64(2)
+	created := &domain.User{Email: "created@elsewhere.example", ProvisionedByOrgID: &directoryOrg}
+	member := &domain.User{Email: "member@elsewhere.example"}
+	users.CreateUser(created)
+	users.CreateUser(member)
+	organizations.CreateMembership(&domain.Membership{UserID: created.ID, OrgID: 2, Role: domain.OrgRoleSalesRep})
+	organizations.CreateMembership(&domain.Membership{UserID: member.ID, OrgID: 2, Role: domain.OrgRoleSalesRep})
+
+	tests := []struct {
+		name  string
+		email string
+		want  Authenticator
+	}{
+		{name: "email domain", email: "ana@corp.example", want: byDomain},
+		{name: "email domain in another case", email: "ana@CORP.Example", want: byDomain},
+		{name: "email domain configured with @", email: "ana@subsidiary.example", want: byDomain},
+		{name: "subdomain", email: "ana@mail.corp.example", want: fallback},
+		{name: "lookalike domain", email: "ana@evilcorp.example", want: fallback},
+		{name: "account the directory created", email: created.Email, want: byOrg},
+		// Invited or added members keep their own password
+		{name: "member of the directory's organization", email: member.Email, want: fallback},
+		{name: "unknown user", email: "nobody@elsewhere.example", want: fallback},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := router.route(tt.email)
+			if err != nil {
+				t.Fatalf("route: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("route(%q) = %T %p, want %T %p", tt.email, got, got, tt.want, tt.want)
+			}
+		})
+	}
+
+	t.Run("no directories", func(t *testing.T) {
+		router := NewRoutingAuthenticator(fallback, nil, users)
+		got, err := router.route("ana@corp.example")
+		if err != nil {
+			t.Fatalf("route: %v", err)
+		}
+		if got != Authenticator(fallback) {
+			t.Errorf("route = %T, want the fallback", got)
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package usecase
+
+import (
+	"strconv"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/repository"
+)
+
+const (
+	defaultOutboxPageSize = 50
+	maxOutboxPageSize     = 200
+)
+
+// EmailOutboxUsecase lets admins follow email delivery. Dead-lettered
+// emails are not retried: their links are cleared, so the user asks for a
+// new email instead.
+type EmailOutboxUsecase struct {
+	outboxRepository repository.EmailOutboxRepository
+}
+
+func NewEmailOutboxUsecase(outboxRepository repository.EmailOutboxRepository) *EmailOutboxUsecase {
+	return &EmailOutboxUsecase{
+		outboxRepository: outboxRepository,
+	}
+}
+
+// ListEmails returns one page of outbox emails matching filter, newest
+// first, along with the cursor for the next page ("" when there are no more)
+func (u *EmailOutboxUsecase) ListEmails(filter domain.OutboxEmailFilter) ([]*domain.OutboxEmail, string, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultOutboxPageSize
+	}
+	if filter.Limit > maxOutboxPageSize {
+		filter.Limit = maxOutboxPageSize
+	}
+
+	// Fetch one extra row to find out whether another page exists
+	pageSize := filter.Limit
+	filter.Limit++
+
+	emails, err := u.outboxRepository.ListEmails(filter)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if len(emails) > pageSize {
+		emails = emails[:pageSize]
+		nextCursor = strconv.FormatInt(emails[pageSize-1].ID, 10)
+	}
+
+	return emails, nextCursor, nil
+}
+
+func (u *EmailOutboxUsecase) FindEmail(emailID int64) (*domain.OutboxEmail, error) {
+	return u.outboxRepository.FindEmailByID(emailID)
+}
+
+// outboxEmail is an email of template to recipient, ready to be queued
+func outboxEmail(recipient, locale, template string, data map[string]interface{}) *domain.OutboxEmail {
+	return &domain.OutboxEmail{
+		Recipient: recipient,
+		Locale:    locale,
+		Template:  template,
+		Data:      data,
+	}
+}
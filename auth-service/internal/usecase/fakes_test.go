@@ -0,0 +1,199 @@
+package usecase
+
+import (
+	"errors"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/repository"
+)
+
+// fakeUserRepository keeps users in memory; methods the tests do not reach
+// panic through the nil embedded interface
+type fakeUserRepository struct {
+	repository.UserRepository
+	users []*domain.User
+}
+
+func (r *fakeUserRepository) CreateUser(user *domain.User) error {
+	user.ID = int64(len(r.users) + 1)
+	user.IsActive = true
+	r.users = append(r.users, user)
+	return nil
+}
+
+func (r *fakeUserRepository) FindUserByEmail(email string) (*domain.User, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, errors.New("user not found")
+}
+
+func (r *fakeUserRepository) FindUserByID(userID int64) (*domain.User, error) {
+	for _, user := range r.users {
+		if user.ID == userID {
+			return user, nil
+		}
+	}
+	return nil, errors.New("user not found")
+}
+
+func (r *fakeUserRepository) UpdateUser(user *domain.User) error {
+	stored, err := r.FindUserByID(user.ID)
+	if err != nil {
+		return err
+	}
+	stored.Name = user.Name
+	stored.PasswordHash = user.PasswordHash
+	stored.ResetToken = user.ResetToken
+	stored.ResetTokenExpiresAt = user.ResetTokenExpiresAt
+	return nil
+}
+
+func (r *fakeUserRepository) VerifyAndClearPassword(userID int64) error {
+	user, err := r.FindUserByID(userID)
+	if err != nil {
+		return err
+	}
+	user.IsVerified = true
+	user.PasswordHash = ""
+	user.ResetToken = ""
+	return nil
+}
+
+func (r *fakeUserRepository) UpdateUserName(userID int64, name string) error {
+	user, err := r.FindUserByID(userID)
+	if err != nil {
+		return err
+	}
+	user.Name = name
+	return nil
+}
+
+// fakeOrganizationRepository keeps memberships in memory
+type fakeOrganizationRepository struct {
+	repository.OrganizationRepository
+	memberships []*domain.Membership
+}
+
+func (r *fakeOrganizationRepository) FindMembership(userID, orgID int64) (*domain.Membership, error) {
+	for _, membership := range r.memberships {
+		if membership.UserID == userID && membership.OrgID == orgID {
+			found := *membership
+			return &found, nil
+		}
+	}
+	return nil, domain.ErrMembershipNotFound
+}
+
+func (r *fakeOrganizationRepository) ListMembershipsByUser(userID int64) ([]*domain.Membership, error) {
+	var memberships []*domain.Membership
+	for _, membership := range r.memberships {
+		if membership.UserID == userID {
+			memberships = append(memberships, membership)
+		}
+	}
+	return memberships, nil
+}
+
+func (r *fakeOrganizationRepository) CountMembersWithRole(orgID int64, role string) (int, error) {
+	count := 0
+	for _, membership := range r.memberships {
+		if membership.OrgID == orgID && membership.Role == role {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *fakeOrganizationRepository) CreateMembership(membership *domain.Membership) error {
+	r.memberships = append(r.memberships, membership)
+	return nil
+}
+
+func (r *fakeOrganizationRepository) UpdateMembershipRole(userID, orgID int64, role string) error {
+	for _, membership := range r.memberships {
+		if membership.UserID == userID && membership.OrgID == orgID {
+			membership.Role = role
+			return nil
+		}
+	}
+	return domain.ErrMembershipNotFound
+}
+
+func (r *fakeOrganizationRepository) SetManager(userID, orgID int64, managerID *int64) error {
+	for _, membership := range r.memberships {
+		if membership.UserID == userID && membership.OrgID == orgID {
+			membership.ManagerID = managerID
+			return nil
+		}
+	}
+	return domain.ErrMembershipNotFound
+}
+
+// ListReports returns direct reports only
+func (r *fakeOrganizationRepository) ListReports(orgID, managerID int64) ([]*domain.Report, error) {
+	var reports []*domain.Report
+	for _, membership := range r.memberships {
+		if membership.OrgID == orgID && membership.ManagerID != nil && *membership.ManagerID == managerID {
+			reports = append(reports, &domain.Report{UserID: membership.UserID, Role: membership.Role, ManagerID: managerID, Depth: 1})
+		}
+	}
+	return reports, nil
+}
+
+func (r *fakeOrganizationRepository) DeleteMembership(userID, orgID int64) error {
+	for i, membership := range r.memberships {
+		if membership.UserID == userID && membership.OrgID == orgID {
+			r.memberships = append(r.memberships[:i], r.memberships[i+1:]...)
+			return nil
+		}
+	}
+	return domain.ErrMembershipNotFound
+}
+
+// fakeTransactor runs work directly against the in-memory repositories
+type fakeTransactor struct {
+	repos repository.TxRepositories
+}
+
+func (t fakeTransactor) WithinTransaction(fn func(repos repository.TxRepositories) error) error {
+	return fn(t.repos)
+}
+
+type fakeSecurityNotificationRepository struct {
+	repository.SecurityNotificationRepository
+	devices []*domain.LoginDevice
+}
+
+func (fakeSecurityNotificationRepository) CountLoginDevices(userID int64) (int, error) {
+	return 0, nil
+}
+
+func (fakeSecurityNotificationRepository) RecordLoginDevice(userID int64, device string, seenAt time.Time) (bool, error) {
+	return false, nil
+}
+
+func (r fakeSecurityNotificationRepository) ListLoginDevices(userID int64) ([]*domain.LoginDevice, error) {
+	return r.devices, nil
+}
+
+func (fakeSecurityNotificationRepository) ListOptOuts(userID int64) ([]string, error) {
+	return nil, nil
+}
+
+type fakeWebhookRepository struct {
+	repository.WebhookRepository
+	events []*domain.WebhookEvent
+}
+
+func (r *fakeWebhookRepository) EnqueueWebhookEvent(event *domain.WebhookEvent) (int, error) {
+	r.events = append(r.events, event)
+	return 0, nil
+}
+
+type discardAuditLogger struct{}
+
+func (discardAuditLogger) Log(event *domain.AuditEvent) {}
@@ -0,0 +1,242 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/repository"
+	"github.com/sales-tracker/auth-service/internal/service"
+)
+
+// FederationUsecase signs users in through upstream OIDC providers and links
+// those identities to local accounts
+type FederationUsecase struct {
+	providers                   map[string]*service.OIDCProvider
+	federatedIdentityRepository repository.FederatedIdentityRepository
+	userRepository              repository.UserRepository
+	securityNotifications       *SecurityNotificationUsecase
+	webhooks                    *WebhookUsecase
+	auditLogger                 service.AuditLogger
+}
+
+func NewFederationUsecase(providers map[string]*service.OIDCProvider, federatedIdentityRepository repository.FederatedIdentityRepository, userRepository repository.UserRepository, securityNotifications *SecurityNotificationUsecase, webhooks *WebhookUsecase, auditLogger service.AuditLogger) *FederationUsecase {
+	return &FederationUsecase{
+		providers:                   providers,
+		federatedIdentityRepository: federatedIdentityRepository,
+		userRepository:              userRepository,
+		securityNotifications:       securityNotifications,
+		webhooks:                    webhooks,
+		auditLogger:                 auditLogger,
+	}
+}
+
+func (u *FederationUsecase) audit(info domain.RequestInfo, eventType string, subjectID *int64, err error, metadata map[string]interface{}) {
+	recordAuditEvent(u.auditLogger, info, eventType, subjectID, err, metadata)
+}
+
+// Providers returns the enabled providers keyed by name, with display names
+func (u *FederationUsecase) Providers() []map[string]string {
+	providers := make([]map[string]string, 0, len(u.providers))
+	for name, provider := range u.providers {
+		providers = append(providers, map[string]string{
+			"name":         name,
+			"display_name": provider.Config().DisplayName,
+		})
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i]["name"] < providers[j]["name"]
+	})
+	return providers
+}
+
+// StartLogin stores a new login state for providerName and returns the
+// provider URL to send the user to, along with the state value the browser
+// must present on the callback
+func (u *FederationUsecase) StartLogin(ctx context.Context, providerName string, stateTTL time.Duration) (authURL, state string, err error) {
+	provider, ok := u.providers[providerName]
+	if !ok {
+		return "", "", domain.ErrUnknownProvider
+	}
+
+	state, err = randomURLToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomURLToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	codeVerifier, err := randomURLToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	authURL, err = provider.AuthCodeURL(ctx, state, nonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if err != nil {
+		return "", "", err
+	}
+
+	err = u.federatedIdentityRepository.CreateLoginState(&domain.FederatedLoginState{
+		StateHash:    sha256Hex(state),
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().Add(stateTTL),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return authURL, state, nil
+}
+
+// CompleteLogin finishes a social login. The user is found through a
+// previously linked identity or, failing that, by the provider's verified
+// email, in which case the identity is linked. Unknown users are only
+// created when the provider allows signup.
+func (u *FederationUsecase) CompleteLogin(ctx context.Context, info domain.RequestInfo, providerName, state, code string) (user *domain.User, err error) {
+	metadata := map[string]interface{}{"provider": providerName}
+	defer func() {
+		var subjectID *int64
+		if user != nil {
+			subjectID = &user.ID
+		}
+		u.audit(info, domain.AuditEventFederatedLogin, subjectID, err, metadata)
+	}()
+
+	provider, ok := u.providers[providerName]
+	if !ok {
+		return nil, domain.ErrUnknownProvider
+	}
+
+	loginState, err := u.federatedIdentityRepository.ConsumeLoginState(sha256Hex(state), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if loginState.Provider != providerName {
+		return nil, domain.ErrInvalidLoginState
+	}
+
+	claims, err := provider.Exchange(ctx, code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrInvalidUpstreamToken, err)
+	}
+	metadata["subject"] = claims.Subject
+
+	identity, err := u.federatedIdentityRepository.FindIdentity(providerName, claims.Subject)
+	switch {
+	case err == nil:
+		user, err = u.userRepository.FindUserByID(identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if err := u.federatedIdentityRepository.TouchIdentity(identity.ID, claims.Email, time.Now()); err != nil {
+			return nil, err
+		}
+	case err == domain.ErrIdentityNotFound:
+		user, err = u.linkIdentity(info, provider, claims)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	if user.DeletedAt != nil {
+		return user, domain.ErrAccountDeleted
+	}
+	if !user.IsActive {
+		return user, domain.ErrAccountDisabled
+	}
+
+	if err := u.securityNotifications.RecordLogin(info, user); err != nil {
+		logrus.Warnf("Failed to record login device for user %d: %v", user.ID, err)
+	}
+	return user, nil
+}
+
+// linkIdentity attaches a new upstream identity to the account with the same
+// verified email, creating the account if the provider allows signup.
+// Identities from multi-tenant providers are never linked by email: any of
+// the provider's tenants can assert any address. Linking an unverified
+// account removes its password, which whoever registered the address set.
+func (u *FederationUsecase) linkIdentity(info domain.RequestInfo, provider *service.OIDCProvider, claims *domain.UpstreamClaims) (user *domain.User, err error) {
+	defer func() {
+		var subjectID *int64
+		if user != nil {
+			subjectID = &user.ID
+		}
+		u.audit(info, domain.AuditEventIdentityLinked, subjectID, err, map[string]interface{}{
+			"provider": provider.Name(),
+			"subject":  claims.Subject,
+			"email":    claims.Email,
+		})
+	}()
+
+	cfg := provider.Config()
+	if claims.Email == "" || !(claims.EmailVerified || cfg.TrustEmail) {
+		return nil, domain.ErrUnverifiedUpstreamMail
+	}
+
+	user, err = u.userRepository.FindUserByEmail(claims.Email)
+	if err == nil && claims.TenantID != "" {
+		return nil, domain.ErrNoLinkedAccount
+	}
+	if err != nil {
+		if !cfg.AllowSignup {
+			return nil, domain.ErrNoLinkedAccount
+		}
+		// Federated-only accounts have no password and cannot use /auth/login
+		user = &domain.User{
+			Email:      claims.Email,
+			Role:       cfg.DefaultRole,
+			IsVerified: true,
+		}
+		if err := u.userRepository.CreateUser(user); err != nil {
+			return nil, err
+		}
+		if err := u.webhooks.Publish(domain.WebhookEventUserCreated, userCreatedEvent(user, "oidc")); err != nil {
+			logrus.Warnf("Failed to publish creation of user %d: %v", user.ID, err)
+		}
+	} else if !user.IsVerified {
+		// The provider has verified the address on the user's behalf. The
+		// password predates that and may belong to someone else.
+		if err := u.userRepository.VerifyAndClearPassword(user.ID); err != nil {
+			return nil, err
+		}
+		user.IsVerified = true
+		user.PasswordHash = ""
+		if err := u.webhooks.Publish(domain.WebhookEventUserVerified, map[string]interface{}{"user": webhookUser(user)}); err != nil {
+			logrus.Warnf("Failed to publish verification of user %d: %v", user.ID, err)
+		}
+	}
+
+	err = u.federatedIdentityRepository.CreateIdentity(&domain.FederatedIdentity{
+		UserID:   user.ID,
+		Provider: provider.Name(),
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func randomURLToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
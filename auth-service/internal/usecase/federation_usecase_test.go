@@ -0,0 +1,377 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/service"
+	"github.com/sales-tracker/auth-service/internal/service/oidctest"
+)
+
+type fakeFederatedIdentityRepository struct {
+	states     map[string]*domain.FederatedLoginState
+	identities []*domain.FederatedIdentity
+}
+
+func (r *fakeFederatedIdentityRepository) CreateLoginState(state *domain.FederatedLoginState) error {
+	r.states[state.StateHash] = state
+	return nil
+}
+
+func (r *fakeFederatedIdentityRepository) ConsumeLoginState(stateHash string, now time.Time) (*domain.FederatedLoginState, error) {
+	state, ok := r.states[stateHash]
+	delete(r.states, stateHash)
+	if !ok || !state.ExpiresAt.After(now) {
+		return nil, domain.ErrInvalidLoginState
+	}
+	return state, nil
+}
+
+func (r *fakeFederatedIdentityRepository) FindIdentity(provider, subject string) (*domain.FederatedIdentity, error) {
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return nil, domain.ErrIdentityNotFound
+}
+
+func (r *fakeFederatedIdentityRepository) CreateIdentity(identity *domain.FederatedIdentity) error {
+	identity.ID = int64(len(r.identities) + 1)
+	r.identities = append(r.identities, identity)
+	return nil
+}
+
+func (r *fakeFederatedIdentityRepository) TouchIdentity(identityID int64, email string, loginAt time.Time) error {
+	return nil
+}
+
+func (r *fakeFederatedIdentityRepository) ListIdentitiesByUser(userID int64) ([]*domain.FederatedIdentity, error) {
+	var identities []*domain.FederatedIdentity
+	for _, identity := range r.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
+}
+
+type federationTest struct {
+	usecase    *FederationUsecase
+	upstream   *oidctest.Provider
+	identities *fakeFederatedIdentityRepository
+	users      *fakeUserRepository
+}
+
+// newFederationTest wires a FederationUsecase to a stub provider named
+// "test", configured by cfg apart from its issuer and client
+func newFederationTest(t *testing.T, upstream *oidctest.Provider, cfg config.OIDCProviderConfig) *federationTest {
+	t.Helper()
+
+	cfg.Issuer = upstream.Issuer()
+	cfg.ClientID = upstream.ClientID
+	cfg.ClientSecret = upstream.ClientSecret
+	providers := map[string]*service.OIDCProvider{
+		"test": service.NewOIDCProvider("test", cfg, "https://auth.example.com/auth/oidc/test/callback", nil),
+	}
+
+	ft := &federationTest{
+		upstream:   upstream,
+		identities: &fakeFederatedIdentityRepository{states: make(map[string]*domain.FederatedLoginState)},
+		users:      &fakeUserRepository{},
+	}
+	auditLogger := discardAuditLogger{}
+	ft.usecase = NewFederationUsecase(
+		providers,
+		ft.identities,
+		ft.users,
+		NewSecurityNotificationUsecase(fakeSecurityNotificationRepository{}, nil, auditLogger),
+		NewWebhookUsecase(&fakeWebhookRepository{}, auditLogger),
+		auditLogger,
+	)
+	return ft
+}
+
+// login signs in through the provider, whose ID token carries claims
+func (ft *federationTest) login(t *testing.T, claims map[string]interface{}) (*domain.User, error) {
+	t.Helper()
+
+	authURL, state, err := ft.usecase.StartLogin(context.Background(), "test", time.Minute)
+	if err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+	code := ft.upstream.Authorize(t, authURL, claims)
+	return ft.usecase.CompleteLogin(context.Background(), domain.RequestInfo{}, "test", state, code)
+}
+
+func TestFederationStartLoginStoresHashedState(t *testing.T) {
+	ft := newFederationTest(t, oidctest.NewProvider(t, "client", "secret"), config.OIDCProviderConfig{})
+
+	authURL, state, err := ft.usecase.StartLogin(context.Background(), "test", time.Minute)
+	if err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+
+	target, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse authorization URL: %v", err)
+	}
+	if got := target.Query().Get("state"); got != state {
+		t.Errorf("authorization URL state = %q, want %q", got, state)
+	}
+	if _, ok := ft.identities.states[state]; ok {
+		t.Error("login state stored in the clear")
+	}
+	stored, ok := ft.identities.states[sha256Hex(state)]
+	if !ok {
+		t.Fatal("login state not stored")
+	}
+	if stored.Provider != "test" || stored.Nonce != target.Query().Get("nonce") {
+		t.Errorf("stored state = %+v", stored)
+	}
+}
+
+func TestFederationCompleteLoginRejectsState(t *testing.T) {
+	upstream := oidctest.NewProvider(t, "client", "secret")
+
+	t.Run("unknown state", func(t *testing.T) {
+		ft := newFederationTest(t, upstream, config.OIDCProviderConfig{AllowSignup: true})
+		authURL, _, err := ft.usecase.StartLogin(context.Background(), "test", time.Minute)
+		if err != nil {
+			t.Fatalf("StartLogin: %v", err)
+		}
+		code := upstream.Authorize(t, authURL, nil)
+
+		_, err = ft.usecase.CompleteLogin(context.Background(), domain.RequestInfo{}, "test", "forged-state", code)
+		if !errors.Is(err, domain.ErrInvalidLoginState) {
+			t.Fatalf("CompleteLogin error = %v, want %v", err, domain.ErrInvalidLoginState)
+		}
+	})
+
+	t.Run("replayed state", func(t *testing.T) {
+		ft := newFederationTest(t, upstream, config.OIDCProviderConfig{AllowSignup: true})
+		authURL, state, err := ft.usecase.StartLogin(context.Background(), "test", time.Minute)
+		if err != nil {
+			t.Fatalf("StartLogin: %v", err)
+		}
+		code := upstream.Authorize(t, authURL, map[string]interface{}{"email": "ana@example.com", "email_verified": true})
+		if _, err := ft.usecase.CompleteLogin(context.Background(), domain.RequestInfo{}, "test", state, code); err != nil {
+			t.Fatalf("CompleteLogin: %v", err)
+		}
+
+		_, err = ft.usecase.CompleteLogin(context.Background(), domain.RequestInfo{}, "test", state, code)
+		if !errors.Is(err, domain.ErrInvalidLoginState) {
+			t.Fatalf("second CompleteLogin error = %v, want %v", err, domain.ErrInvalidLoginState)
+		}
+	})
+
+	t.Run("state issued for another provider", func(t *testing.T) {
+		ft := newFederationTest(t, upstream, config.OIDCProviderConfig{AllowSignup: true})
+		ft.identities.states[sha256Hex("other-state")] = &domain.FederatedLoginState{
+			StateHash: sha256Hex("other-state"),
+			Provider:  "other",
+			ExpiresAt: time.Now().Add(time.Minute),
+		}
+
+		_, err := ft.usecase.CompleteLogin(context.Background(), domain.RequestInfo{}, "test", "other-state", "code")
+		if !errors.Is(err, domain.ErrInvalidLoginState) {
+			t.Fatalf("CompleteLogin error = %v, want %v", err, domain.ErrInvalidLoginState)
+		}
+	})
+}
+
+func TestFederationCompleteLoginRejectsNonceOfAnotherLogin(t *testing.T) {
+	upstream := oidctest.NewProvider(t, "client", "secret")
+	ft := newFederationTest(t, upstream, config.OIDCProviderConfig{AllowSignup: true})
+
+	authURL, state, err := ft.usecase.StartLogin(context.Background(), "test", time.Minute)
+	if err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+	otherURL, _, err := ft.usecase.StartLogin(context.Background(), "test", time.Minute)
+	if err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+	other, err := url.Parse(otherURL)
+	if err != nil {
+		t.Fatalf("parse authorization URL: %v", err)
+	}
+
+	code := upstream.Authorize(t, authURL, map[string]interface{}{"nonce": other.Query().Get("nonce")})
+	_, err = ft.usecase.CompleteLogin(context.Background(), domain.RequestInfo{}, "test", state, code)
+	if !errors.Is(err, domain.ErrInvalidUpstreamToken) {
+		t.Fatalf("CompleteLogin error = %v, want %v", err, domain.ErrInvalidUpstreamToken)
+	}
+}
+
+func TestFederationLinksByVerifiedEmail(t *testing.T) {
+	upstream := oidctest.NewProvider(t, "client", "secret")
+
+	tests := []struct {
+		name       string
+		cfg        config.OIDCProviderConfig
+		verified   interface{}
+		wantErr    error
+		wantLinked bool
+	}{
+		{name: "verified email", verified: true, wantLinked: true},
+		{name: "verified email as string", verified: "true", wantLinked: true},
+		{name: "unverified email", verified: false, wantErr: domain.ErrUnverifiedUpstreamMail},
+		{name: "email_verified missing", verified: nil, wantErr: domain.ErrUnverifiedUpstreamMail},
+		{name: "trusted provider", cfg: config.OIDCProviderConfig{TrustEmail: true}, verified: nil, wantLinked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ft := newFederationTest(t, upstream, tt.cfg)
+			existing := &domain.User{Email: "ana@example.com", Role: "client"}
+			ft.users.CreateUser(existing)
+
+			user, err := ft.login(t, map[string]interface{}{
+				"sub":            "upstream-ana",
+				"email":          "ana@example.com",
+				"email_verified": tt.verified,
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CompleteLogin error = %v, want %v", err, tt.wantErr)
+			}
+
+			identities, _ := ft.identities.ListIdentitiesByUser(existing.ID)
+			if linked := len(identities) == 1; linked != tt.wantLinked {
+				t.Fatalf("identity linked = %v, want %v", linked, tt.wantLinked)
+			}
+			if !tt.wantLinked {
+				return
+			}
+			if user.ID != existing.ID {
+				t.Errorf("signed in as user %d, want %d", user.ID, existing.ID)
+			}
+			if !existing.IsVerified {
+				t.Error("linked account not marked verified")
+			}
+			if identities[0].Subject != "upstream-ana" {
+				t.Errorf("linked subject = %q, want upstream-ana", identities[0].Subject)
+			}
+		})
+	}
+}
+
+func TestFederationLinkClearsPasswordOfUnverifiedAccount(t *testing.T) {
+	upstream := oidctest.NewProvider(t, "client", "secret")
+	verified := map[string]interface{}{"sub": "upstream-ana", "email": "ana@example.com", "email_verified": true}
+
+	t.Run("unverified account", func(t *testing.T) {
+		ft := newFederationTest(t, upstream, config.OIDCProviderConfig{})
+		// Someone registered the address before its owner signed in
+		squatted := &domain.User{Email: "ana@example.com", Role: "client", PasswordHash: "squatter-hash", ResetToken: "squatter-reset"}
+		ft.users.CreateUser(squatted)
+
+		user, err := ft.login(t, verified)
+		if err != nil {
+			t.Fatalf("CompleteLogin: %v", err)
+		}
+		if user.ID != squatted.ID || !squatted.IsVerified {
+			t.Fatalf("signed in as %+v, want verified user %d", user, squatted.ID)
+		}
+		if squatted.PasswordHash != "" || squatted.ResetToken != "" {
+			t.Errorf("registrant's credentials kept: password %q, reset token %q", squatted.PasswordHash, squatted.ResetToken)
+		}
+	})
+
+	t.Run("verified account", func(t *testing.T) {
+		ft := newFederationTest(t, upstream, config.OIDCProviderConfig{})
+		owned := &domain.User{Email: "ana@example.com", Role: "client", IsVerified: true, PasswordHash: "owner-hash"}
+		ft.users.CreateUser(owned)
+
+		if _, err := ft.login(t, verified); err != nil {
+			t.Fatalf("CompleteLogin: %v", err)
+		}
+		if owned.PasswordHash != "owner-hash" {
+			t.Error("password of a verified account removed")
+		}
+	})
+}
+
+func TestFederationSignsInThroughLinkedIdentity(t *testing.T) {
+	upstream := oidctest.NewProvider(t, "client", "secret")
+	ft := newFederationTest(t, upstream, config.OIDCProviderConfig{})
+	existing := &domain.User{Email: "ana@example.com", Role: "client"}
+	ft.users.CreateUser(existing)
+	ft.identities.CreateIdentity(&domain.FederatedIdentity{UserID: existing.ID, Provider: "test", Subject: "upstream-ana"})
+
+	// The identity is already linked, so the upstream email no longer matters
+	user, err := ft.login(t, map[string]interface{}{"sub": "upstream-ana", "email": "changed@example.com"})
+	if err != nil {
+		t.Fatalf("CompleteLogin: %v", err)
+	}
+	if user.ID != existing.ID {
+		t.Errorf("signed in as user %d, want %d", user.ID, existing.ID)
+	}
+}
+
+func TestFederationSignup(t *testing.T) {
+	upstream := oidctest.NewProvider(t, "client", "secret")
+	claims := map[string]interface{}{"email": "new@example.com", "email_verified": true}
+
+	t.Run("disabled", func(t *testing.T) {
+		ft := newFederationTest(t, upstream, config.OIDCProviderConfig{})
+		if _, err := ft.login(t, claims); !errors.Is(err, domain.ErrNoLinkedAccount) {
+			t.Fatalf("CompleteLogin error = %v, want %v", err, domain.ErrNoLinkedAccount)
+		}
+		if len(ft.users.users) != 0 {
+			t.Error("account created with signup disabled")
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		ft := newFederationTest(t, upstream, config.OIDCProviderConfig{AllowSignup: true, DefaultRole: "sales_rep"})
+		user, err := ft.login(t, claims)
+		if err != nil {
+			t.Fatalf("CompleteLogin: %v", err)
+		}
+		if user.Email != "new@example.com" || user.Role != "sales_rep" || !user.IsVerified {
+			t.Errorf("created user = %+v", user)
+		}
+	})
+}
+
+func TestFederationMultiTenantNeverLinksByEmail(t *testing.T) {
+	upstream := oidctest.NewMultiTenantProvider(t, "client", "secret")
+	ft := newFederationTest(t, upstream, config.OIDCProviderConfig{
+		AllowSignup:    true,
+		AllowedTenants: []string{"tenant-a"},
+	})
+	existing := &domain.User{Email: "ana@example.com", Role: "admin", IsVerified: true}
+	ft.users.CreateUser(existing)
+
+	_, err := ft.login(t, map[string]interface{}{
+		"tid":            "tenant-a",
+		"email":          "ana@example.com",
+		"email_verified": true,
+	})
+	if !errors.Is(err, domain.ErrNoLinkedAccount) {
+		t.Fatalf("CompleteLogin error = %v, want %v", err, domain.ErrNoLinkedAccount)
+	}
+	if identities, _ := ft.identities.ListIdentitiesByUser(existing.ID); len(identities) != 0 {
+		t.Error("multi-tenant identity linked to an existing account by email")
+	}
+
+	// New users from an allowed tenant can still sign up
+	user, err := ft.login(t, map[string]interface{}{
+		"sub":            "upstream-new",
+		"tid":            "tenant-a",
+		"email":          "new@example.com",
+		"email_verified": true,
+	})
+	if err != nil {
+		t.Fatalf("CompleteLogin: %v", err)
+	}
+	if user.ID == existing.ID {
+		t.Error("signed in to the existing account")
+	}
+}
@@ -0,0 +1,178 @@
+package usecase
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/repository"
+	"github.com/sales-tracker/auth-service/internal/service"
+)
+
+// IntrospectionUsecase tells resource servers whether an access token or
+// API key is still good to use (RFC 7662). Unlike JWTMiddleware, which only
+// checks signatures, it also looks at revocation and at the account the
+// token acts for.
+type IntrospectionUsecase struct {
+	oauthClientRepository        repository.OAuthClientRepository
+	oauthAuthorizationRepository repository.OAuthAuthorizationRepository
+	apiKeyRepository             repository.APIKeyRepository
+	organizationRepository       repository.OrganizationRepository
+	userRepository               repository.UserRepository
+	tokenService                 *service.TokenService
+}
+
+func NewIntrospectionUsecase(oauthClientRepository repository.OAuthClientRepository, oauthAuthorizationRepository repository.OAuthAuthorizationRepository, apiKeyRepository repository.APIKeyRepository, organizationRepository repository.OrganizationRepository, userRepository repository.UserRepository, tokenService *service.TokenService) *IntrospectionUsecase {
+	return &IntrospectionUsecase{
+		oauthClientRepository:        oauthClientRepository,
+		oauthAuthorizationRepository: oauthAuthorizationRepository,
+		apiKeyRepository:             apiKeyRepository,
+		organizationRepository:       organizationRepository,
+		userRepository:               userRepository,
+		tokenService:                 tokenService,
+	}
+}
+
+// Introspect authenticates the calling confidential client, which must hold
+// the introspection scope, and describes token. Clients registered to an
+// organization only see tokens scoped to that organization as active. The
+// user's email and global role are left out unless the token was issued to
+// the calling client. Any token that fails a check is reported as inactive
+// rather than as an error.
+func (u *IntrospectionUsecase) Introspect(clientID, clientSecret, token string) (*domain.TokenIntrospection, error) {
+	client, err := u.oauthClientRepository.FindOAuthClientByClientID(clientID)
+	if err != nil {
+		if err == domain.ErrOAuthClientNotFound {
+			return nil, domain.ErrInvalidClient
+		}
+		return nil, err
+	}
+	if client.RevokedAt != nil || client.IsPublic() || !clientSecretMatches(client, clientSecret, time.Now()) {
+		return nil, domain.ErrInvalidClient
+	}
+	if !client.HasScope(domain.ScopeIntrospect) {
+		return nil, domain.ErrIntrospectionDenied
+	}
+
+	var introspection *domain.TokenIntrospection
+	if strings.HasPrefix(token, domain.APIKeyPrefix) {
+		introspection, err = u.introspectAPIKey(token)
+	} else {
+		introspection, err = u.introspectAccessToken(token)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !introspection.Active || (client.OrgID != nil && introspection.OrgID != *client.OrgID) {
+		return &domain.TokenIntrospection{Active: false}, nil
+	}
+	if introspection.ClientID != client.ClientID {
+		introspection.Email = ""
+		introspection.Role = ""
+	}
+	return introspection, nil
+}
+
+func (u *IntrospectionUsecase) introspectAPIKey(plaintext string) (*domain.TokenIntrospection, error) {
+	principal, err := resolveAPIKey(u.apiKeyRepository, u.userRepository, u.organizationRepository, plaintext, time.Now())
+	if err != nil {
+		return &domain.TokenIntrospection{Active: false}, nil
+	}
+
+	introspection := &domain.TokenIntrospection{
+		Active:    true,
+		TokenType: domain.IntrospectedAPIKey,
+		Subject:   strconv.FormatInt(principal.User.ID, 10),
+		UserID:    principal.User.ID,
+		Role:      principal.GlobalRole(),
+		Email:     principal.User.Email,
+		Scope:     strings.Join(principal.Key.Scopes, " "),
+		IssuedAt:  principal.Key.CreatedAt.Unix(),
+	}
+	if principal.Key.ExpiresAt != nil {
+		introspection.ExpiresAt = principal.Key.ExpiresAt.Unix()
+	}
+	if principal.Membership != nil {
+		introspection.OrgID = principal.Membership.OrgID
+		introspection.OrgRole = principal.Membership.Role
+	}
+	return introspection, nil
+}
+
+// introspectAccessToken checks a signed token: client tokens need their
+// client to be unrevoked, user tokens an active account and, when scoped
+// to an organization, a membership in it, and delegated tokens both plus
+// the user's consent to the client
+func (u *IntrospectionUsecase) introspectAccessToken(token string) (*domain.TokenIntrospection, error) {
+	inactive := &domain.TokenIntrospection{Active: false}
+
+	claims, err := u.tokenService.ParseToken(token)
+	if err != nil {
+		return inactive, nil
+	}
+
+	introspection := &domain.TokenIntrospection{
+		Active:    true,
+		TokenType: domain.IntrospectedAccessToken,
+		ClientID:  claims.ClientID,
+		Subject:   claims.Subject,
+		Role:      claims.Role,
+		OrgID:     claims.OrgID,
+		Scope:     claims.Scope,
+		ExpiresAt: claims.ExpiresAt,
+		IssuedAt:  claims.IssuedAt,
+	}
+
+	if claims.ClientID != "" {
+		client, err := u.oauthClientRepository.FindOAuthClientByClientID(claims.ClientID)
+		if err == domain.ErrOAuthClientNotFound {
+			return inactive, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if client.RevokedAt != nil {
+			return inactive, nil
+		}
+	}
+
+	// Client credentials tokens act for no user
+	if claims.UserID == 0 {
+		return introspection, nil
+	}
+
+	user, err := u.userRepository.FindUserByID(claims.UserID)
+	if err != nil || user.DeletedAt != nil || !user.IsActive {
+		return inactive, nil
+	}
+	introspection.UserID = user.ID
+	introspection.Role = user.Role
+	introspection.Email = user.Email
+	if introspection.Subject == "" {
+		introspection.Subject = strconv.FormatInt(user.ID, 10)
+	}
+
+	if claims.ClientID != "" {
+		if _, err := u.oauthAuthorizationRepository.FindConsent(user.ID, claims.ClientID); err != nil {
+			if err == domain.ErrConsentNotFound {
+				return inactive, nil
+			}
+			return nil, err
+		}
+	}
+
+	if claims.OrgID != 0 {
+		membership, err := u.organizationRepository.FindMembership(user.ID, claims.OrgID)
+		if err == domain.ErrMembershipNotFound {
+			return inactive, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		introspection.OrgRole = membership.Role
+	}
+
+	return introspection, nil
+}
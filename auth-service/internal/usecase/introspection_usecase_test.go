@@ -0,0 +1,99 @@
+package usecase
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/sales-tracker/auth-service/internal/config"
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/repository"
+	"github.com/sales-tracker/auth-service/internal/service"
+)
+
+type fakeOAuthClientRepository struct {
+	repository.OAuthClientRepository
+	clients []*domain.OAuthClient
+}
+
+func (r *fakeOAuthClientRepository) FindOAuthClientByClientID(clientID string) (*domain.OAuthClient, error) {
+	for _, client := range r.clients {
+		if client.ClientID == clientID {
+			return client, nil
+		}
+	}
+	return nil, domain.ErrOAuthClientNotFound
+}
+
+// fakeOAuthAuthorizationRepository has every user consent to every client
+type fakeOAuthAuthorizationRepository struct {
+	repository.OAuthAuthorizationRepository
+}
+
+func (fakeOAuthAuthorizationRepository) FindConsent(userID int64, clientID string) (*domain.OAuthConsent, error) {
+	return &domain.OAuthConsent{UserID: userID, ClientID: clientID}, nil
+}
+
+func (fakeOAuthAuthorizationRepository) ListConsentsByUser(userID int64) ([]*domain.OAuthConsent, error) {
+	return nil, nil
+}
+
+const introspectionSecret = "client-secret"
+
+func TestIntrospect(t *testing.T) {
+	secretHash, err := bcrypt.GenerateFromPassword([]byte(introspectionSecret), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resourceServer := &domain.OAuthClient{ClientID: "stc_resource", Type: domain.OAuthClientConfidential, SecretHash: string(secretHash), Scopes: []string{domain.ScopeIntrospect}}
+	app := &domain.OAuthClient{ClientID: "stc_app", Type: domain.OAuthClientConfidential, SecretHash: string(secretHash), Scopes: []string{domain.ScopeEmail}}
+	clients := &fakeOAuthClientRepository{clients: []*domain.OAuthClient{resourceServer, app}}
+
+	users := &fakeUserRepository{}
+	user := &domain.User{Email: "ana@example.com", Role: "sales_rep", IsVerified: true}
+	users.CreateUser(user)
+
+	tokenService := service.NewTokenService(&config.Config{JWTSecret: "test-secret", OAuth: config.OAuthConfig{AccessTokenTTL: time.Hour}})
+	introspectionUsecase := NewIntrospectionUsecase(clients, fakeOAuthAuthorizationRepository{}, nil, &fakeOrganizationRepository{}, users, tokenService)
+
+	issue := func(clientID string) string {
+		t.Helper()
+		token, _, err := tokenService.IssueDelegatedToken(user, clientID, []string{domain.ScopeEmail})
+		if err != nil {
+			t.Fatalf("IssueDelegatedToken: %v", err)
+		}
+		return token
+	}
+
+	t.Run("client without the introspection scope", func(t *testing.T) {
+		_, err := introspectionUsecase.Introspect(app.ClientID, introspectionSecret, issue(app.ClientID))
+		if !errors.Is(err, domain.ErrIntrospectionDenied) {
+			t.Fatalf("Introspect error = %v, want %v", err, domain.ErrIntrospectionDenied)
+		}
+	})
+
+	t.Run("token issued to another client", func(t *testing.T) {
+		introspection, err := introspectionUsecase.Introspect(resourceServer.ClientID, introspectionSecret, issue(app.ClientID))
+		if err != nil {
+			t.Fatalf("Introspect: %v", err)
+		}
+		if !introspection.Active || introspection.UserID != user.ID || introspection.ClientID != app.ClientID {
+			t.Errorf("introspection = %+v", introspection)
+		}
+		if introspection.Email != "" || introspection.Role != "" {
+			t.Errorf("introspection disclosed email %q and role %q", introspection.Email, introspection.Role)
+		}
+	})
+
+	t.Run("token issued to the caller", func(t *testing.T) {
+		introspection, err := introspectionUsecase.Introspect(resourceServer.ClientID, introspectionSecret, issue(resourceServer.ClientID))
+		if err != nil {
+			t.Fatalf("Introspect: %v", err)
+		}
+		if !introspection.Active || introspection.Email != user.Email || introspection.Role != user.Role {
+			t.Errorf("introspection = %+v", introspection)
+		}
+	})
+}
@@ -0,0 +1,324 @@
+package usecase
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/repository"
+	"github.com/sales-tracker/auth-service/internal/service"
+)
+
+type InvitationUsecase struct {
+	invitationRepository   repository.InvitationRepository
+	organizationRepository repository.OrganizationRepository
+	userRepository         repository.UserRepository
+	transactor             repository.Transactor
+	emailLinks             *service.EmailLinks
+	auditLogger            service.AuditLogger
+}
+
+func NewInvitationUsecase(invitationRepository repository.InvitationRepository, organizationRepository repository.OrganizationRepository, userRepository repository.UserRepository, transactor repository.Transactor, emailLinks *service.EmailLinks, auditLogger service.AuditLogger) *InvitationUsecase {
+	return &InvitationUsecase{
+		invitationRepository:   invitationRepository,
+		organizationRepository: organizationRepository,
+		userRepository:         userRepository,
+		transactor:             transactor,
+		emailLinks:             emailLinks,
+		auditLogger:            auditLogger,
+	}
+}
+
+func (u *InvitationUsecase) audit(info domain.RequestInfo, eventType string, subjectID *int64, err error, metadata map[string]interface{}) {
+	recordAuditEvent(u.auditLogger, info, eventType, subjectID, err, metadata)
+}
+
+// CreateInvitation invites email to the organization with role and queues
+// the invitation email. Sales managers may only invite reps and clients;
+// admins may assign any role.
+func (u *InvitationUsecase) CreateInvitation(info domain.RequestInfo, orgID int64, inviterRole, email, role string, ttl time.Duration) (invitation *domain.Invitation, err error) {
+	email = strings.TrimSpace(email)
+	defer func() {
+		metadata := map[string]interface{}{"org_id": orgID, "email": email, "role": role}
+		if invitation != nil {
+			metadata["invitation_id"] = invitation.ID
+		}
+		u.audit(info, domain.AuditEventInvitationCreated, nil, err, metadata)
+	}()
+
+	if !domain.IsValidOrgRole(role) {
+		return nil, domain.ErrInvalidOrgRole
+	}
+	if !canAssignRole(inviterRole, role) {
+		return nil, domain.ErrRoleNotAssignable
+	}
+
+	if _, err := u.invitationRepository.FindPendingInvitation(orgID, email); err == nil {
+		return nil, domain.ErrInvitationExists
+	} else if !errors.Is(err, domain.ErrInvitationNotFound) {
+		return nil, err
+	}
+
+	if user, err := u.userRepository.FindUserByEmail(email); err == nil {
+		if _, err := u.organizationRepository.FindMembership(user.ID, orgID); err == nil {
+			return nil, domain.ErrMembershipExists
+		}
+	}
+
+	invitation = &domain.Invitation{
+		OrgID:     orgID,
+		Email:     email,
+		Role:      role,
+		Token:     uuid.New().String(),
+		InvitedBy: info.ActorID,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	err = u.transactor.WithinTransaction(func(repos repository.TxRepositories) error {
+		if err := repos.Invitations.CreateInvitation(invitation); err != nil {
+			return err
+		}
+		// Re-read to pick up the organization name for the email
+		invitation, err = repos.Invitations.FindInvitationByID(orgID, invitation.ID)
+		if err != nil {
+			return err
+		}
+		return repos.EmailOutbox.EnqueueEmail(u.invitationEmail(invitation))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+func (u *InvitationUsecase) ListInvitations(orgID int64) ([]*domain.Invitation, error) {
+	return u.invitationRepository.ListInvitationsByOrg(orgID)
+}
+
+// ResendInvitation issues a fresh token and expiry for a pending invitation,
+// invalidating the previously emailed link, and queues a new email. Sales
+// managers may only resend their own invitations.
+func (u *InvitationUsecase) ResendInvitation(info domain.RequestInfo, orgID, invitationID int64, inviterRole string, ttl time.Duration) (_ *domain.Invitation, err error) {
+	defer func() {
+		u.audit(info, domain.AuditEventInvitationResent, nil, err, map[string]interface{}{
+			"org_id":        orgID,
+			"invitation_id": invitationID,
+		})
+	}()
+
+	invitation, err := u.findManagedInvitation(info, orgID, invitationID, inviterRole)
+	if err != nil {
+		return nil, err
+	}
+
+	invitation.Token = uuid.New().String()
+	invitation.ExpiresAt = time.Now().Add(ttl)
+	err = u.transactor.WithinTransaction(func(repos repository.TxRepositories) error {
+		if err := repos.Invitations.RenewInvitation(invitation.ID, invitation.Token, invitation.ExpiresAt); err != nil {
+			return err
+		}
+		return repos.EmailOutbox.EnqueueEmail(u.invitationEmail(invitation))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+// invitationEmail carries the accept link. Invitees often have no account,
+// and so no locale, yet; invitations use the default locale.
+func (u *InvitationUsecase) invitationEmail(invitation *domain.Invitation) *domain.OutboxEmail {
+	return outboxEmail(invitation.Email, "", service.EmailTemplateInvitation, map[string]interface{}{
+		"OrgName": invitation.OrgName,
+		"Role":    invitation.Role,
+		"URL":     u.emailLinks.Invitation(domain.LinkHint{}, invitation.Token),
+	})
+}
+
+// RevokeInvitation cancels a pending invitation. Sales managers may only
+// revoke their own invitations.
+func (u *InvitationUsecase) RevokeInvitation(info domain.RequestInfo, orgID, invitationID int64, inviterRole string) (err error) {
+	defer func() {
+		u.audit(info, domain.AuditEventInvitationRevoked, nil, err, map[string]interface{}{
+			"org_id":        orgID,
+			"invitation_id": invitationID,
+		})
+	}()
+
+	invitation, err := u.findManagedInvitation(info, orgID, invitationID, inviterRole)
+	if err != nil {
+		return err
+	}
+
+	return u.invitationRepository.RevokeInvitation(invitation.ID)
+}
+
+// findManagedInvitation returns the invitation if the caller, a member with
+// inviterRole, may manage it: admins manage every invitation, others only
+// those they sent
+func (u *InvitationUsecase) findManagedInvitation(info domain.RequestInfo, orgID, invitationID int64, inviterRole string) (*domain.Invitation, error) {
+	invitation, err := u.invitationRepository.FindInvitationByID(orgID, invitationID)
+	if err != nil {
+		return nil, err
+	}
+	if inviterRole == domain.OrgRoleAdmin {
+		return invitation, nil
+	}
+	if info.ActorID == nil || invitation.InvitedBy == nil || *invitation.InvitedBy != *info.ActorID {
+		return nil, domain.ErrInvitationForbidden
+	}
+	return invitation, nil
+}
+
+// FindPendingInvitationByToken returns the invitation for token if it can
+// still be accepted
+func (u *InvitationUsecase) FindPendingInvitationByToken(token string) (*domain.Invitation, error) {
+	invitation, err := u.invitationRepository.FindInvitationByToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if invitation.Status() != domain.InvitationStatusPending {
+		return nil, domain.ErrInvitationNotPending
+	}
+	return invitation, nil
+}
+
+// PasswordRequired reports whether accepting the invitation sets a
+// password: the invited email has no account, or only an unverified one
+func (u *InvitationUsecase) PasswordRequired(invitation *domain.Invitation) bool {
+	user, err := u.userRepository.FindUserByEmail(invitation.Email)
+	return err != nil || !user.IsVerified
+}
+
+// AcceptInvitation links the invited email's account to the organization,
+// creating a verified account with password first if none exists. An
+// unverified account is verified, and its password, chosen by whoever
+// registered the address, is replaced with password. The token only proves
+// control of the email, so created reports whether the account is new:
+// existing accounts must still sign in as usual, with their own password,
+// directory or second factor.
+func (u *InvitationUsecase) AcceptInvitation(info domain.RequestInfo, token, password, name string) (user *domain.User, _ *domain.Membership, created bool, err error) {
+	var orgID int64
+	defer func() {
+		var subjectID *int64
+		if user != nil && user.ID != 0 {
+			subjectID = &user.ID
+		}
+		u.audit(info, domain.AuditEventInvitationAccepted, subjectID, err, map[string]interface{}{"org_id": orgID})
+	}()
+
+	invitation, err := u.FindPendingInvitationByToken(token)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	orgID = invitation.OrgID
+
+	user, err = u.userRepository.FindUserByEmail(invitation.Email)
+	if err != nil {
+		passwordHash, err := hashInvitationPassword(password)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		user = &domain.User{
+			Email:        invitation.Email,
+			PasswordHash: passwordHash,
+			Role:         globalRoleForOrgRole(invitation.Role),
+			Name:         strings.TrimSpace(name),
+			IsVerified:   true,
+		}
+	} else if user.DeletedAt != nil {
+		return nil, nil, false, domain.ErrAccountDeleted
+	} else if !user.IsActive {
+		return nil, nil, false, domain.ErrAccountDisabled
+	} else if !user.IsVerified {
+		if user.PasswordHash, err = hashInvitationPassword(password); err != nil {
+			return nil, nil, false, err
+		}
+	}
+
+	// Accepting an invitation verifies the address it was sent to. The
+	// invitation, account and membership change together, along with the
+	// webhook event announcing the account.
+	created, verified := user.ID == 0, !user.IsVerified
+	err = u.transactor.WithinTransaction(func(repos repository.TxRepositories) error {
+		if err := repos.Invitations.AcceptInvitation(invitation); err != nil {
+			return err
+		}
+
+		if created {
+			if err := repos.Users.CreateUser(user); err != nil {
+				return err
+			}
+			if user.Name != "" {
+				if err := repos.Users.UpdateUserName(user.ID, user.Name); err != nil {
+					return err
+				}
+			}
+		} else if verified {
+			// The invitee replaces the password whoever registered the
+			// address chose, along with any reset they requested
+			if err := repos.Users.VerifyAndClearPassword(user.ID); err != nil {
+				return err
+			}
+			if err := repos.Users.UpdateUserPassword(user.ID, user.PasswordHash); err != nil {
+				return err
+			}
+		}
+
+		if err := repos.Organizations.CreateMembership(&domain.Membership{UserID: user.ID, OrgID: invitation.OrgID, Role: invitation.Role}); err != nil {
+			return err
+		}
+
+		switch {
+		case created:
+			return enqueueWebhookEvent(repos.Webhooks, domain.WebhookEventUserCreated, userCreatedEvent(user, "invitation"))
+		case verified:
+			return enqueueWebhookEvent(repos.Webhooks, domain.WebhookEventUserVerified, map[string]interface{}{"user": webhookUser(user)})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, false, err
+	}
+	user.IsVerified = true
+
+	membership, err := u.organizationRepository.FindMembership(user.ID, invitation.OrgID)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	return user, membership, created, nil
+}
+
+func hashInvitationPassword(password string) (string, error) {
+	if len(password) < 8 {
+		return "", domain.ErrPasswordTooShort
+	}
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(passwordHash), err
+}
+
+// canAssignRole reports whether a member with inviterRole may hand out role
+func canAssignRole(inviterRole, role string) bool {
+	switch inviterRole {
+	case domain.OrgRoleAdmin:
+		return true
+	case domain.OrgRoleSalesManager:
+		return role == domain.OrgRoleSalesRep || role == domain.OrgRoleClient
+	}
+	return false
+}
+
+// globalRoleForOrgRole picks the users.role for an account created through
+// an invitation. Organization admin rights never grant global admin.
+func globalRoleForOrgRole(role string) string {
+	if role == domain.OrgRoleClient {
+		return "client"
+	}
+	return "sales_rep"
+}
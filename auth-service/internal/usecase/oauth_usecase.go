@@ -0,0 +1,481 @@
+package usecase
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/repository"
+	"github.com/sales-tracker/auth-service/internal/service"
+)
+
+const (
+	oauthClientIDBytes     = 12
+	oauthClientSecretBytes = 32
+	authorizationCodeBytes = 32
+)
+
+type OAuthUsecase struct {
+	oauthClientRepository        repository.OAuthClientRepository
+	oauthAuthorizationRepository repository.OAuthAuthorizationRepository
+	organizationRepository       repository.OrganizationRepository
+	userRepository               repository.UserRepository
+	auditLogger                  service.AuditLogger
+}
+
+func NewOAuthUsecase(oauthClientRepository repository.OAuthClientRepository, oauthAuthorizationRepository repository.OAuthAuthorizationRepository, organizationRepository repository.OrganizationRepository, userRepository repository.UserRepository, auditLogger service.AuditLogger) *OAuthUsecase {
+	return &OAuthUsecase{
+		oauthClientRepository:        oauthClientRepository,
+		oauthAuthorizationRepository: oauthAuthorizationRepository,
+		organizationRepository:       organizationRepository,
+		userRepository:               userRepository,
+		auditLogger:                  auditLogger,
+	}
+}
+
+func (u *OAuthUsecase) audit(info domain.RequestInfo, eventType string, subjectID *int64, err error, metadata map[string]interface{}) {
+	recordAuditEvent(u.auditLogger, info, eventType, subjectID, err, metadata)
+}
+
+// CreateClient registers a client. Confidential clients get a secret, which
+// is returned once and only stored as a bcrypt hash; public clients have
+// none and must use PKCE.
+func (u *OAuthUsecase) CreateClient(info domain.RequestInfo, createdBy int64, req domain.OAuthClientCreate) (client *domain.OAuthClient, _ string, err error) {
+	defer func() {
+		metadata := map[string]interface{}{"name": req.Name, "client_type": req.Type, "scopes": req.Scopes, "grant_types": req.GrantTypes}
+		if client != nil {
+			metadata["client_id"] = client.ClientID
+		}
+		u.audit(info, domain.AuditEventOAuthClientCreated, nil, err, metadata)
+	}()
+
+	client = &domain.OAuthClient{
+		Type:         req.Type,
+		Name:         strings.TrimSpace(req.Name),
+		OrgID:        req.OrgID,
+		Scopes:       req.Scopes,
+		RedirectURIs: req.RedirectURIs,
+		GrantTypes:   req.GrantTypes,
+		CreatedBy:    &createdBy,
+	}
+	if err := normalizeOAuthClient(client); err != nil {
+		return nil, "", err
+	}
+
+	if req.OrgID != nil {
+		if _, err := u.organizationRepository.FindOrganizationByID(*req.OrgID); err != nil {
+			return nil, "", err
+		}
+	}
+
+	client.ClientID, err = generateOAuthClientID()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var secret string
+	if !client.IsPublic() {
+		secret, client.SecretHash, err = generateOAuthClientSecret()
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	if err := u.oauthClientRepository.CreateOAuthClient(client); err != nil {
+		return nil, "", err
+	}
+
+	return client, secret, nil
+}
+
+func (u *OAuthUsecase) ListClients() ([]*domain.OAuthClient, error) {
+	return u.oauthClientRepository.ListOAuthClients()
+}
+
+// RotateClientSecret issues a new secret for the client. The old secret is
+// still accepted for gracePeriod so deployments can pick up the new one.
+func (u *OAuthUsecase) RotateClientSecret(info domain.RequestInfo, clientID string, gracePeriod time.Duration) (_ string, err error) {
+	defer func() {
+		u.audit(info, domain.AuditEventOAuthClientRotated, nil, err, map[string]interface{}{"client_id": clientID, "grace_period": gracePeriod.String()})
+	}()
+
+	client, err := u.oauthClientRepository.FindOAuthClientByClientID(clientID)
+	if err != nil {
+		return "", err
+	}
+	if client.IsPublic() {
+		return "", domain.ErrPublicClientSecret
+	}
+
+	secret, secretHash, err := generateOAuthClientSecret()
+	if err != nil {
+		return "", err
+	}
+
+	if err := u.oauthClientRepository.RotateOAuthClientSecret(client.ID, secretHash, time.Now().Add(gracePeriod)); err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+func (u *OAuthUsecase) RevokeClient(info domain.RequestInfo, clientID string) (err error) {
+	defer func() {
+		u.audit(info, domain.AuditEventOAuthClientRevoked, nil, err, map[string]interface{}{"client_id": clientID})
+	}()
+
+	client, err := u.oauthClientRepository.FindOAuthClientByClientID(clientID)
+	if err != nil {
+		return err
+	}
+
+	return u.oauthClientRepository.RevokeOAuthClient(client.ID)
+}
+
+// AuthorizeClientCredentials authenticates a client for the
+// client_credentials grant and returns the scopes the access token may carry
+func (u *OAuthUsecase) AuthorizeClientCredentials(info domain.RequestInfo, clientID, clientSecret, scope string) (client *domain.OAuthClient, scopes []string, err error) {
+	defer func() {
+		metadata := map[string]interface{}{"client_id": clientID, "grant_type": domain.GrantTypeClientCredentials}
+		if scopes != nil {
+			metadata["scopes"] = scopes
+		}
+		u.audit(info, domain.AuditEventOAuthTokenIssued, nil, err, metadata)
+	}()
+
+	client, err = u.oauthClientRepository.FindOAuthClientByClientID(clientID)
+	if err != nil {
+		if err == domain.ErrOAuthClientNotFound {
+			return nil, nil, domain.ErrInvalidClient
+		}
+		return nil, nil, err
+	}
+
+	if client.RevokedAt != nil || client.IsPublic() || !clientSecretMatches(client, clientSecret, time.Now()) {
+		return nil, nil, domain.ErrInvalidClient
+	}
+	if !client.AllowsGrant(domain.GrantTypeClientCredentials) {
+		return nil, nil, domain.ErrUnauthorizedClient
+	}
+
+	scopes, err = client.GrantedScopes(scope)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return client, scopes, nil
+}
+
+// ValidateAuthorizationRequest checks an /oauth/authorize request and returns
+// the client and the scopes it asks for. domain.ErrInvalidClient and
+// domain.ErrInvalidRedirectURI must be shown to the user; every other error
+// can be reported back to the client's redirect URI.
+func (u *OAuthUsecase) ValidateAuthorizationRequest(req domain.AuthorizationRequest) (*domain.OAuthClient, []string, error) {
+	client, err := u.oauthClientRepository.FindOAuthClientByClientID(req.ClientID)
+	if err != nil {
+		if err == domain.ErrOAuthClientNotFound {
+			return nil, nil, domain.ErrInvalidClient
+		}
+		return nil, nil, err
+	}
+	if client.RevokedAt != nil {
+		return nil, nil, domain.ErrInvalidClient
+	}
+	if !client.HasRedirectURI(req.RedirectURI) {
+		return nil, nil, domain.ErrInvalidRedirectURI
+	}
+
+	if req.ResponseType != "code" {
+		return client, nil, domain.ErrUnsupportedResponseType
+	}
+	if !client.AllowsGrant(domain.GrantTypeAuthorizationCode) {
+		return client, nil, domain.ErrUnauthorizedClient
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != domain.CodeChallengeMethodS256 {
+		return client, nil, domain.ErrPKCERequired
+	}
+
+	scopes, err := client.GrantedScopes(req.Scope)
+	if err != nil {
+		return client, nil, err
+	}
+
+	return client, scopes, nil
+}
+
+// GrantAuthorization records the user's consent to share scopes with the
+// client and returns a single-use authorization code valid for codeTTL
+func (u *OAuthUsecase) GrantAuthorization(info domain.RequestInfo, client *domain.OAuthClient, user *domain.User, req domain.AuthorizationRequest, scopes []string, codeTTL time.Duration) (_ string, err error) {
+	defer func() {
+		u.audit(info, domain.AuditEventOAuthAuthorized, &user.ID, err, map[string]interface{}{"client_id": client.ClientID, "scopes": scopes})
+	}()
+
+	consent := &domain.OAuthConsent{
+		UserID:   user.ID,
+		ClientID: client.ClientID,
+		Scopes:   scopes,
+	}
+	if existing, err := u.oauthAuthorizationRepository.FindConsent(user.ID, client.ClientID); err == nil {
+		consent.Scopes = mergeScopes(existing.Scopes, scopes)
+	} else if err != domain.ErrConsentNotFound {
+		return "", err
+	}
+	if err := u.oauthAuthorizationRepository.SaveConsent(consent); err != nil {
+		return "", err
+	}
+
+	b := make([]byte, authorizationCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := base64.RawURLEncoding.EncodeToString(b)
+
+	now := time.Now()
+	err = u.oauthAuthorizationRepository.CreateAuthorizationCode(&domain.AuthorizationCode{
+		CodeHash:            sha256Hex(code),
+		ClientID:            client.ClientID,
+		UserID:              user.ID,
+		RedirectURI:         req.RedirectURI,
+		Scopes:              scopes,
+		Nonce:               req.Nonce,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		AuthTime:            now,
+		ExpiresAt:           now.Add(codeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// ExchangeAuthorizationCode redeems an authorization code for the client
+// that requested it. Confidential clients must authenticate; for every
+// client the PKCE code_verifier must match the original code_challenge.
+func (u *OAuthUsecase) ExchangeAuthorizationCode(info domain.RequestInfo, clientID, clientSecret, code, redirectURI, codeVerifier string) (client *domain.OAuthClient, user *domain.User, authCode *domain.AuthorizationCode, err error) {
+	defer func() {
+		var subjectID *int64
+		metadata := map[string]interface{}{"client_id": clientID, "grant_type": domain.GrantTypeAuthorizationCode}
+		if authCode != nil {
+			subjectID = &authCode.UserID
+			metadata["scopes"] = authCode.Scopes
+		}
+		u.audit(info, domain.AuditEventOAuthTokenIssued, subjectID, err, metadata)
+	}()
+
+	client, err = u.oauthClientRepository.FindOAuthClientByClientID(clientID)
+	if err != nil {
+		if err == domain.ErrOAuthClientNotFound {
+			return nil, nil, nil, domain.ErrInvalidClient
+		}
+		return nil, nil, nil, err
+	}
+	if client.RevokedAt != nil {
+		return nil, nil, nil, domain.ErrInvalidClient
+	}
+	if !client.IsPublic() && !clientSecretMatches(client, clientSecret, time.Now()) {
+		return nil, nil, nil, domain.ErrInvalidClient
+	}
+	if !client.AllowsGrant(domain.GrantTypeAuthorizationCode) {
+		return nil, nil, nil, domain.ErrUnauthorizedClient
+	}
+
+	// Only the client the code was issued to can use it up; another client
+	// presenting it must not deny the legitimate client its token
+	authCode, err = u.oauthAuthorizationRepository.ConsumeAuthorizationCode(sha256Hex(code), client.ClientID, time.Now())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if authCode.RedirectURI != redirectURI {
+		return nil, nil, authCode, domain.ErrInvalidGrant
+	}
+	if !verifyCodeChallenge(authCode.CodeChallenge, codeVerifier) {
+		return nil, nil, authCode, domain.ErrInvalidGrant
+	}
+
+	user, err = u.userRepository.FindUserByID(authCode.UserID)
+	if err != nil || user.DeletedAt != nil || !user.IsActive {
+		return nil, nil, authCode, domain.ErrInvalidGrant
+	}
+
+	return client, user, authCode, nil
+}
+
+// UserInfo returns the claims about userID released under scopes
+func (u *OAuthUsecase) UserInfo(userID int64, scopes []string) (*domain.UserInfo, error) {
+	user, err := u.userRepository.FindUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletedAt != nil {
+		return nil, domain.ErrAccountDeleted
+	}
+	if !user.IsActive {
+		return nil, domain.ErrAccountDisabled
+	}
+
+	return domain.NewUserInfo(user, scopes), nil
+}
+
+func (u *OAuthUsecase) ListConsents(userID int64) ([]*domain.OAuthConsent, error) {
+	return u.oauthAuthorizationRepository.ListConsentsByUser(userID)
+}
+
+// RevokeConsent withdraws the user's consent for the client. Access tokens
+// already issued are reported inactive by introspection but pass
+// JWTMiddleware until they expire.
+func (u *OAuthUsecase) RevokeConsent(info domain.RequestInfo, userID int64, clientID string) (err error) {
+	defer func() {
+		u.audit(info, domain.AuditEventOAuthConsentRevoked, &userID, err, map[string]interface{}{"client_id": clientID})
+	}()
+
+	return u.oauthAuthorizationRepository.DeleteConsent(userID, clientID)
+}
+
+// normalizeOAuthClient fills in registration defaults and rejects
+// combinations that would be unsafe, such as public clients using
+// client_credentials or authorization_code clients without redirect URIs
+func normalizeOAuthClient(client *domain.OAuthClient) error {
+	if client.Type == "" {
+		client.Type = domain.OAuthClientConfidential
+	}
+	if client.Type != domain.OAuthClientConfidential && client.Type != domain.OAuthClientPublic {
+		return domain.ErrInvalidOAuthClient
+	}
+
+	if len(client.GrantTypes) == 0 {
+		if client.IsPublic() {
+			client.GrantTypes = []string{domain.GrantTypeAuthorizationCode}
+		} else {
+			client.GrantTypes = []string{domain.GrantTypeClientCredentials}
+		}
+	}
+	for _, grantType := range client.GrantTypes {
+		switch grantType {
+		case domain.GrantTypeAuthorizationCode:
+		case domain.GrantTypeClientCredentials:
+			if client.IsPublic() {
+				return domain.ErrInvalidOAuthClient
+			}
+		default:
+			return domain.ErrInvalidOAuthClient
+		}
+	}
+
+	if client.AllowsGrant(domain.GrantTypeAuthorizationCode) && len(client.RedirectURIs) == 0 {
+		return domain.ErrInvalidOAuthClient
+	}
+	for _, redirectURI := range client.RedirectURIs {
+		if !validRedirectURI(redirectURI) {
+			return domain.ErrInvalidOAuthClient
+		}
+	}
+
+	if client.Scopes == nil {
+		client.Scopes = []string{}
+	}
+	if client.RedirectURIs == nil {
+		client.RedirectURIs = []string{}
+	}
+	return nil
+}
+
+// validRedirectURI accepts absolute URIs without a fragment. Plain http is
+// only allowed for loopback addresses; custom schemes are allowed for
+// mobile apps.
+func validRedirectURI(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() || u.Fragment != "" {
+		return false
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "https":
+		return u.Host != ""
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	case "javascript", "data", "file":
+		return false
+	}
+	return true
+}
+
+// verifyCodeChallenge checks an S256 PKCE code_verifier (RFC 7636 section 4.6)
+func verifyCodeChallenge(challenge, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+func mergeScopes(existing, added []string) []string {
+	merged := append([]string{}, existing...)
+	for _, scope := range added {
+		if !containsString(merged, scope) {
+			merged = append(merged, scope)
+		}
+	}
+	return merged
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sha256Hex(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// clientSecretMatches reports whether secret is the client's current secret,
+// or its previous one while that is still within the rotation grace period
+func clientSecretMatches(client *domain.OAuthClient, secret string, now time.Time) bool {
+	if bcrypt.CompareHashAndPassword([]byte(client.SecretHash), []byte(secret)) == nil {
+		return true
+	}
+	if client.PreviousSecretHash == "" || client.PreviousSecretExpiresAt == nil || !now.Before(*client.PreviousSecretExpiresAt) {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(client.PreviousSecretHash), []byte(secret)) == nil
+}
+
+func generateOAuthClientID() (string, error) {
+	b := make([]byte, oauthClientIDBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return domain.OAuthClientIDPrefix + hex.EncodeToString(b), nil
+}
+
+// generateOAuthClientSecret returns a new secret and its bcrypt hash. Client
+// secrets are hashed like passwords since they are long-lived credentials.
+func generateOAuthClientSecret() (string, string, error) {
+	b := make([]byte, oauthClientSecretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", "", err
+	}
+	return secret, string(hash), nil
+}
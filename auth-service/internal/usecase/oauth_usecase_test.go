@@ -0,0 +1,155 @@
+package usecase
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+// fakeAuthorizationCodeRepository stores authorization codes in memory and
+// consumes them the way the Postgres repository does
+type fakeAuthorizationCodeRepository struct {
+	fakeOAuthAuthorizationRepository
+	codes map[string]*domain.AuthorizationCode
+}
+
+func (r *fakeAuthorizationCodeRepository) SaveConsent(consent *domain.OAuthConsent) error {
+	return nil
+}
+
+func (r *fakeAuthorizationCodeRepository) CreateAuthorizationCode(code *domain.AuthorizationCode) error {
+	code.CreatedAt = time.Now()
+	r.codes[code.CodeHash] = code
+	return nil
+}
+
+func (r *fakeAuthorizationCodeRepository) ConsumeAuthorizationCode(codeHash, clientID string, now time.Time) (*domain.AuthorizationCode, error) {
+	code, ok := r.codes[codeHash]
+	if !ok || code.ClientID != clientID || code.ConsumedAt != nil || !code.ExpiresAt.After(now) {
+		return nil, domain.ErrInvalidGrant
+	}
+	code.ConsumedAt = &now
+	return code, nil
+}
+
+func TestExchangeAuthorizationCode(t *testing.T) {
+	const redirectURI = "https://app.example.com/callback"
+	verifier := strings.Repeat("v", 43)
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	app := &domain.OAuthClient{ClientID: "stc_app", Type: domain.OAuthClientPublic, RedirectURIs: []string{redirectURI}, GrantTypes: []string{domain.GrantTypeAuthorizationCode}, Scopes: []string{domain.ScopeEmail}}
+	other := &domain.OAuthClient{ClientID: "stc_other", Type: domain.OAuthClientPublic, RedirectURIs: []string{redirectURI}, GrantTypes: []string{domain.GrantTypeAuthorizationCode}, Scopes: []string{domain.ScopeEmail}}
+
+	type exchange struct {
+		clientID, redirectURI, verifier string
+	}
+	valid := exchange{clientID: app.ClientID, redirectURI: redirectURI, verifier: verifier}
+
+	tests := []struct {
+		name   string
+		before []exchange
+		redeem exchange
+		// wantErr is the error of redeem; the code is still redeemable by
+		// the client it was issued to afterwards only if wantUsable
+		wantErr    error
+		wantUsable bool
+	}{
+		{
+			name:   "valid",
+			redeem: valid,
+		},
+		{
+			name:    "verifier mismatch",
+			redeem:  exchange{clientID: app.ClientID, redirectURI: redirectURI, verifier: strings.Repeat("w", 43)},
+			wantErr: domain.ErrInvalidGrant,
+		},
+		{
+			name:    "verifier missing",
+			redeem:  exchange{clientID: app.ClientID, redirectURI: redirectURI},
+			wantErr: domain.ErrInvalidGrant,
+		},
+		{
+			name:    "code reused",
+			before:  []exchange{valid},
+			redeem:  valid,
+			wantErr: domain.ErrInvalidGrant,
+		},
+		{
+			name:    "redirect URI mismatch",
+			redeem:  exchange{clientID: app.ClientID, redirectURI: "https://app.example.com/other", verifier: verifier},
+			wantErr: domain.ErrInvalidGrant,
+		},
+		{
+			name:       "redeemed by another client",
+			redeem:     exchange{clientID: other.ClientID, redirectURI: redirectURI, verifier: verifier},
+			wantErr:    domain.ErrInvalidGrant,
+			wantUsable: true,
+		},
+		{
+			name:    "unknown client",
+			redeem:  exchange{clientID: "stc_unknown", redirectURI: redirectURI, verifier: verifier},
+			wantErr: domain.ErrInvalidClient,
+			// The code is never looked at for an unknown client
+			wantUsable: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &fakeUserRepository{}
+			user := &domain.User{Email: "ana@example.com", Role: "sales_rep", IsVerified: true}
+			users.CreateUser(user)
+			codes := &fakeAuthorizationCodeRepository{codes: make(map[string]*domain.AuthorizationCode)}
+			oauthUsecase := NewOAuthUsecase(&fakeOAuthClientRepository{clients: []*domain.OAuthClient{app, other}}, codes, &fakeOrganizationRepository{}, users, discardAuditLogger{})
+
+			req := domain.AuthorizationRequest{
+				ResponseType:        "code",
+				ClientID:            app.ClientID,
+				RedirectURI:         redirectURI,
+				Scope:               domain.ScopeEmail,
+				CodeChallenge:       challenge,
+				CodeChallengeMethod: domain.CodeChallengeMethodS256,
+			}
+			client, scopes, err := oauthUsecase.ValidateAuthorizationRequest(req)
+			if err != nil {
+				t.Fatalf("ValidateAuthorizationRequest: %v", err)
+			}
+			code, err := oauthUsecase.GrantAuthorization(domain.RequestInfo{}, client, user, req, scopes, time.Minute)
+			if err != nil {
+				t.Fatalf("GrantAuthorization: %v", err)
+			}
+
+			redeem := func(e exchange) (*domain.User, *domain.AuthorizationCode, error) {
+				_, user, authCode, err := oauthUsecase.ExchangeAuthorizationCode(domain.RequestInfo{}, e.clientID, "", code, e.redirectURI, e.verifier)
+				return user, authCode, err
+			}
+			for _, e := range tt.before {
+				if _, _, err := redeem(e); err != nil {
+					t.Fatalf("earlier exchange by %s: %v", e.clientID, err)
+				}
+			}
+
+			redeemed, authCode, err := redeem(tt.redeem)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ExchangeAuthorizationCode: error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil {
+				if redeemed.ID != user.ID || authCode.ClientID != app.ClientID {
+					t.Errorf("redeemed user %d for %s, want user %d for %s", redeemed.ID, authCode.ClientID, user.ID, app.ClientID)
+				}
+				return
+			}
+
+			_, _, err = redeem(valid)
+			if usable := err == nil; usable != tt.wantUsable {
+				t.Errorf("code usable by %s afterwards = %v (error %v), want %v", app.ClientID, usable, err, tt.wantUsable)
+			}
+		})
+	}
+}
@@ -0,0 +1,370 @@
+package usecase
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/repository"
+	"github.com/sales-tracker/auth-service/internal/service"
+)
+
+var slugInvalidChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+type OrganizationUsecase struct {
+	organizationRepository repository.OrganizationRepository
+	userRepository         repository.UserRepository
+	transactor             repository.Transactor
+	webhooks               *WebhookUsecase
+	auditLogger            service.AuditLogger
+}
+
+func NewOrganizationUsecase(organizationRepository repository.OrganizationRepository, userRepository repository.UserRepository, transactor repository.Transactor, webhooks *WebhookUsecase, auditLogger service.AuditLogger) *OrganizationUsecase {
+	return &OrganizationUsecase{
+		organizationRepository: organizationRepository,
+		userRepository:         userRepository,
+		transactor:             transactor,
+		webhooks:               webhooks,
+		auditLogger:            auditLogger,
+	}
+}
+
+func (u *OrganizationUsecase) audit(info domain.RequestInfo, eventType string, subjectID *int64, err error, metadata map[string]interface{}) {
+	recordAuditEvent(u.auditLogger, info, eventType, subjectID, err, metadata)
+}
+
+// CreateOrganization creates an organization with userID as its first admin.
+// When slug is empty it is derived from name.
+func (u *OrganizationUsecase) CreateOrganization(info domain.RequestInfo, userID int64, name, slug string) (_ *domain.Organization, err error) {
+	org := &domain.Organization{
+		Name: strings.TrimSpace(name),
+		Slug: slugify(slug),
+	}
+	if org.Slug == "" {
+		org.Slug = slugify(org.Name)
+	}
+
+	defer func() {
+		u.audit(info, domain.AuditEventOrganizationCreated, &userID, err, map[string]interface{}{
+			"org_id": org.ID,
+			"slug":   org.Slug,
+		})
+	}()
+
+	if org.Name == "" || org.Slug == "" {
+		return nil, domain.ErrInvalidOrganization
+	}
+
+	if err := u.organizationRepository.CreateOrganization(org, userID); err != nil {
+		return nil, err
+	}
+
+	return org, nil
+}
+
+// ListUserMemberships returns every organization the user belongs to
+func (u *OrganizationUsecase) ListUserMemberships(userID int64) ([]*domain.Membership, error) {
+	return u.organizationRepository.ListMembershipsByUser(userID)
+}
+
+// FindMembership returns the user's current membership of orgID
+func (u *OrganizationUsecase) FindMembership(userID, orgID int64) (*domain.Membership, error) {
+	return u.organizationRepository.FindMembership(userID, orgID)
+}
+
+// DefaultMembership returns the membership a fresh login is scoped to (the
+// user's oldest), or nil if the user belongs to no organization
+func (u *OrganizationUsecase) DefaultMembership(userID int64) (*domain.Membership, error) {
+	memberships, err := u.organizationRepository.ListMembershipsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(memberships) == 0 {
+		return nil, nil
+	}
+	return memberships[0], nil
+}
+
+// SwitchOrganization checks that the user belongs to orgID and returns the
+// user and membership to mint a new token from
+func (u *OrganizationUsecase) SwitchOrganization(info domain.RequestInfo, userID, orgID int64) (_ *domain.User, _ *domain.Membership, err error) {
+	defer func() {
+		u.audit(info, domain.AuditEventOrganizationSwitched, &userID, err, map[string]interface{}{"org_id": orgID})
+	}()
+
+	membership, err := u.organizationRepository.FindMembership(userID, orgID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := u.userRepository.FindUserByID(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.DeletedAt != nil {
+		return nil, nil, domain.ErrAccountDeleted
+	}
+	if !user.IsActive {
+		return nil, nil, domain.ErrAccountDisabled
+	}
+
+	return user, membership, nil
+}
+
+func (u *OrganizationUsecase) ListMembers(orgID int64) ([]*domain.Membership, error) {
+	return u.organizationRepository.ListMembershipsByOrg(orgID)
+}
+
+// AddMember adds a user, looked up by email, to the organization. Only
+// accounts the organization provisioned are added directly: anyone else must
+// consent by accepting an invitation, so domain.ErrInvitationRequired is
+// returned for them and for emails without an account.
+func (u *OrganizationUsecase) AddMember(info domain.RequestInfo, orgID int64, email, role string) (_ *domain.Membership, err error) {
+	var subjectID *int64
+	defer func() {
+		if errors.Is(err, domain.ErrInvitationRequired) {
+			return
+		}
+		u.audit(info, domain.AuditEventMemberAdded, subjectID, err, map[string]interface{}{
+			"org_id": orgID,
+			"email":  email,
+			"role":   role,
+		})
+	}()
+
+	if !domain.IsValidOrgRole(role) {
+		return nil, domain.ErrInvalidOrgRole
+	}
+
+	user, err := u.userRepository.FindUserByEmail(email)
+	if err != nil || !user.ProvisionedBy(orgID) {
+		return nil, domain.ErrInvitationRequired
+	}
+	subjectID = &user.ID
+
+	membership := &domain.Membership{
+		UserID: user.ID,
+		OrgID:  orgID,
+		Role:   role,
+		Email:  user.Email,
+	}
+	if err := u.organizationRepository.CreateMembership(membership); err != nil {
+		return nil, err
+	}
+
+	return membership, nil
+}
+
+// ChangeMemberRole updates a member's role within the organization
+func (u *OrganizationUsecase) ChangeMemberRole(info domain.RequestInfo, orgID, userID int64, role string) (err error) {
+	metadata := map[string]interface{}{
+		"org_id":   orgID,
+		"new_role": role,
+	}
+	defer func() {
+		u.audit(info, domain.AuditEventRoleChanged, &userID, err, metadata)
+	}()
+
+	if !domain.IsValidOrgRole(role) {
+		return domain.ErrInvalidOrgRole
+	}
+
+	membership, err := u.organizationRepository.FindMembership(userID, orgID)
+	if err != nil {
+		return err
+	}
+	metadata["old_role"] = membership.Role
+
+	if membership.Role == domain.OrgRoleAdmin && role != domain.OrgRoleAdmin {
+		if err := u.ensureAnotherAdmin(orgID); err != nil {
+			return err
+		}
+	}
+
+	if err := u.organizationRepository.UpdateMembershipRole(userID, orgID, role); err != nil {
+		return err
+	}
+
+	if membership.Role != role {
+		if err := u.webhooks.Publish(domain.WebhookEventUserRoleChanged, roleChangedEvent(userID, orgID, membership.Role, role, "admin")); err != nil {
+			logrus.Warnf("Failed to publish role change of user %d: %v", userID, err)
+		}
+	}
+	return nil
+}
+
+// RemoveMember removes a user from the organization. Their direct reports
+// move up to the user's own manager, or are left without one.
+func (u *OrganizationUsecase) RemoveMember(info domain.RequestInfo, orgID, userID int64) (err error) {
+	defer func() {
+		u.audit(info, domain.AuditEventMemberRemoved, &userID, err, map[string]interface{}{"org_id": orgID})
+	}()
+
+	membership, err := u.organizationRepository.FindMembership(userID, orgID)
+	if err != nil {
+		return err
+	}
+
+	if membership.Role == domain.OrgRoleAdmin {
+		if err := u.ensureAnotherAdmin(orgID); err != nil {
+			return err
+		}
+	}
+
+	return u.transactor.WithinTransaction(func(repos repository.TxRepositories) error {
+		reports, err := repos.Organizations.ListReports(orgID, userID)
+		if err != nil {
+			return err
+		}
+		for _, report := range reports {
+			if report.Depth != 1 {
+				continue
+			}
+			if err := repos.Organizations.SetManager(report.UserID, orgID, membership.ManagerID); err != nil {
+				return err
+			}
+		}
+		return repos.Organizations.DeleteMembership(userID, orgID)
+	})
+}
+
+// SetManager makes managerID the manager of userID within the organization,
+// or clears it when managerID is nil. The manager must be another member and
+// may not be one of the user's own reports.
+func (u *OrganizationUsecase) SetManager(info domain.RequestInfo, orgID, userID int64, managerID *int64) (err error) {
+	metadata := map[string]interface{}{
+		"org_id":         orgID,
+		"new_manager_id": managerID,
+	}
+	defer func() {
+		u.audit(info, domain.AuditEventManagerChanged, &userID, err, metadata)
+	}()
+
+	membership, err := u.organizationRepository.FindMembership(userID, orgID)
+	if err != nil {
+		return err
+	}
+	metadata["old_manager_id"] = membership.ManagerID
+
+	if managerID != nil {
+		if *managerID == userID {
+			return domain.ErrInvalidManager
+		}
+		if _, err := u.organizationRepository.FindMembership(*managerID, orgID); err != nil {
+			return domain.ErrInvalidManager
+		}
+
+		reports, err := u.organizationRepository.ListReports(orgID, userID)
+		if err != nil {
+			return err
+		}
+		if containsReport(reports, *managerID) {
+			return domain.ErrInvalidManager
+		}
+	}
+
+	return u.organizationRepository.SetManager(userID, orgID, managerID)
+}
+
+// ListReports returns the transitive reports of userID in the organization.
+// Callers may list their own reports, those of anyone below them, or, as an
+// organization admin, anyone's. The caller's role is read from their current
+// membership, not their token.
+func (u *OrganizationUsecase) ListReports(orgID, callerID, userID int64) ([]*domain.Report, error) {
+	caller, err := u.organizationRepository.FindMembership(callerID, orgID)
+	if errors.Is(err, domain.ErrMembershipNotFound) {
+		return nil, domain.ErrReportsForbidden
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := u.organizationRepository.FindMembership(userID, orgID); err != nil {
+		return nil, err
+	}
+
+	if callerID != userID && caller.Role != domain.OrgRoleAdmin {
+		callerReports, err := u.organizationRepository.ListReports(orgID, callerID)
+		if err != nil {
+			return nil, err
+		}
+		if !containsReport(callerReports, userID) {
+			return nil, domain.ErrReportsForbidden
+		}
+	}
+
+	return u.organizationRepository.ListReports(orgID, userID)
+}
+
+func containsReport(reports []*domain.Report, userID int64) bool {
+	for _, report := range reports {
+		if report.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *OrganizationUsecase) ensureAnotherAdmin(orgID int64) error {
+	admins, err := u.organizationRepository.CountMembersWithRole(orgID, domain.OrgRoleAdmin)
+	if err != nil {
+		return err
+	}
+	if admins <= 1 {
+		return domain.ErrLastOrgAdmin
+	}
+	return nil
+}
+
+// slugify lowercases s and collapses anything but letters and digits into dashes
+func slugify(s string) string {
+	slug := slugInvalidChars.ReplaceAllString(strings.ToLower(strings.TrimSpace(s)), "-")
+	return strings.Trim(slug, "-")
+}
+
+// syncIdentityMembership makes a membership match the role an external
+// identity source (a SAML IdP or an LDAP directory) reports. A missing
+// membership is only created when provision is set, otherwise
+// domain.ErrMembershipNotFound is returned, and the organization's last
+// admin is never demoted. Role changes are published to webhooks as made by
+// source.
+func syncIdentityMembership(organizationRepository repository.OrganizationRepository, webhooks *WebhookUsecase, source string, userID, orgID int64, role string, roleAsserted, provision bool) (*domain.Membership, error) {
+	membership, err := organizationRepository.FindMembership(userID, orgID)
+	if errors.Is(err, domain.ErrMembershipNotFound) {
+		if !provision {
+			return nil, err
+		}
+		membership = &domain.Membership{UserID: userID, OrgID: orgID, Role: role}
+		if err := organizationRepository.CreateMembership(membership); err != nil {
+			return nil, err
+		}
+		return organizationRepository.FindMembership(userID, orgID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !roleAsserted || membership.Role == role {
+		return membership, nil
+	}
+	if membership.Role == domain.OrgRoleAdmin {
+		admins, err := organizationRepository.CountMembersWithRole(orgID, domain.OrgRoleAdmin)
+		if err != nil {
+			return nil, err
+		}
+		if admins <= 1 {
+			return membership, nil
+		}
+	}
+	if err := organizationRepository.UpdateMembershipRole(userID, orgID, role); err != nil {
+		return nil, err
+	}
+	if err := webhooks.Publish(domain.WebhookEventUserRoleChanged, roleChangedEvent(userID, orgID, membership.Role, role, source)); err != nil {
+		logrus.Warnf("Failed to publish role change of user %d: %v", userID, err)
+	}
+	membership.Role = role
+
+	return membership, nil
+}
@@ -0,0 +1,91 @@
+package usecase
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/repository"
+)
+
+func TestAddMemberOnlyAddsProvisionedAccounts(t *testing.T) {
+	const orgID = 3
+	users := &fakeUserRepository{}
+	organizations := &fakeOrganizationRepository{}
+	organizationUsecase := NewOrganizationUsecase(organizations, users, fakeTransactor{}, NewWebhookUsecase(&fakeWebhookRepository{}, discardAuditLogger{}), discardAuditLogger{})
+
+	provisionedBy := func(orgID int64) *int64 { return &orgID }
+	own := &domain.User{Email: "own@example.com", ProvisionedByOrgID: provisionedBy(orgID)}
+	foreign := &domain.User{Email: "foreign@example.com", ProvisionedByOrgID: provisionedBy(orgID + 1)}
+	admin := &domain.User{Email: "admin@example.com", Role: "admin"}
+	users.CreateUser(own)
+	users.CreateUser(foreign)
+	users.CreateUser(admin)
+
+	membership, err := organizationUsecase.AddMember(domain.RequestInfo{}, orgID, own.Email, domain.OrgRoleSalesRep)
+	if err != nil {
+		t.Fatalf("AddMember(provisioned account): %v", err)
+	}
+	if membership.UserID != own.ID || membership.Role != domain.OrgRoleSalesRep {
+		t.Errorf("membership = %+v", membership)
+	}
+
+	// Accounts from elsewhere, and emails without one, must accept an
+	// invitation before they join
+	for _, email := range []string{foreign.Email, admin.Email, "nobody@example.com"} {
+		if _, err := organizationUsecase.AddMember(domain.RequestInfo{}, orgID, email, domain.OrgRoleAdmin); !errors.Is(err, domain.ErrInvitationRequired) {
+			t.Errorf("AddMember(%s) error = %v, want %v", email, err, domain.ErrInvitationRequired)
+		}
+	}
+	if len(organizations.memberships) != 1 {
+		t.Errorf("memberships = %d, want only the provisioned account's", len(organizations.memberships))
+	}
+}
+
+func TestRemoveMemberReassignsReports(t *testing.T) {
+	const orgID = 3
+	managerOf := func(userID int64) *int64 { return &userID }
+	organizations := &fakeOrganizationRepository{memberships: []*domain.Membership{
+		{UserID: 1, OrgID: orgID, Role: domain.OrgRoleSalesManager},
+		{UserID: 2, OrgID: orgID, Role: domain.OrgRoleSalesManager, ManagerID: managerOf(1)},
+		{UserID: 3, OrgID: orgID, Role: domain.OrgRoleSalesRep, ManagerID: managerOf(2)},
+		{UserID: 4, OrgID: orgID, Role: domain.OrgRoleSalesRep, ManagerID: managerOf(2)},
+		{UserID: 5, OrgID: orgID, Role: domain.OrgRoleClient, ManagerID: managerOf(4)},
+	}}
+	transactor := fakeTransactor{repos: repository.TxRepositories{Organizations: organizations}}
+	organizationUsecase := NewOrganizationUsecase(organizations, &fakeUserRepository{}, transactor, NewWebhookUsecase(&fakeWebhookRepository{}, discardAuditLogger{}), discardAuditLogger{})
+
+	if err := organizationUsecase.RemoveMember(domain.RequestInfo{}, orgID, 2); err != nil {
+		t.Fatalf("RemoveMember: %v", err)
+	}
+	if _, err := organizations.FindMembership(2, orgID); !errors.Is(err, domain.ErrMembershipNotFound) {
+		t.Errorf("removed member still found: %v", err)
+	}
+
+	// Direct reports move up to the removed member's manager; their own
+	// reports keep reporting to them
+	want := map[int64]int64{3: 1, 4: 1, 5: 4}
+	for userID, managerID := range want {
+		membership, err := organizations.FindMembership(userID, orgID)
+		if err != nil {
+			t.Fatalf("FindMembership(%d): %v", userID, err)
+		}
+		if membership.ManagerID == nil || *membership.ManagerID != managerID {
+			t.Errorf("manager of %d = %v, want %d", userID, membership.ManagerID, managerID)
+		}
+	}
+
+	// A member without a manager leaves their reports without one
+	if err := organizationUsecase.RemoveMember(domain.RequestInfo{}, orgID, 1); err != nil {
+		t.Fatalf("RemoveMember: %v", err)
+	}
+	for _, userID := range []int64{3, 4} {
+		membership, err := organizations.FindMembership(userID, orgID)
+		if err != nil {
+			t.Fatalf("FindMembership(%d): %v", userID, err)
+		}
+		if membership.ManagerID != nil {
+			t.Errorf("manager of %d = %d, want none", userID, *membership.ManagerID)
+		}
+	}
+}
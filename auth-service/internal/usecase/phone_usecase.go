@@ -0,0 +1,414 @@
+package usecase
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/repository"
+	"github.com/sales-tracker/auth-service/internal/service"
+)
+
+// SMSCodePolicy bounds the one-time codes PhoneUsecase texts to users
+type SMSCodePolicy struct {
+	TTL            time.Duration
+	ResendInterval time.Duration
+	MaxAttempts    int
+	// MaxCodesPerDay caps the codes texted to one user, for any purpose,
+	// within 24 hours. Zero means no cap.
+	MaxCodesPerDay int
+}
+
+// smsResetTokenTTL is how long the reset token handed out for a verified
+// SMS code stays valid. The user is already at the reset form, so it is
+// much shorter than that of emailed reset links.
+const smsResetTokenTTL = 15 * time.Minute
+
+// PhoneUsecase verifies users' phone numbers and uses them to send the
+// one-time codes of SMS two-factor login and SMS password resets
+type PhoneUsecase struct {
+	userRepository    repository.UserRepository
+	smsCodeRepository repository.SMSCodeRepository
+	authenticator     Authenticator
+	transactor        repository.Transactor
+	smsSender         service.SMSSender
+	policy            SMSCodePolicy
+	productName       string
+	webhooks          *WebhookUsecase
+	auditLogger       service.AuditLogger
+}
+
+func NewPhoneUsecase(userRepository repository.UserRepository, smsCodeRepository repository.SMSCodeRepository, authenticator Authenticator, transactor repository.Transactor, smsSender service.SMSSender, policy SMSCodePolicy, productName string, webhooks *WebhookUsecase, auditLogger service.AuditLogger) *PhoneUsecase {
+	return &PhoneUsecase{
+		userRepository:    userRepository,
+		smsCodeRepository: smsCodeRepository,
+		authenticator:     authenticator,
+		transactor:        transactor,
+		smsSender:         smsSender,
+		policy:            policy,
+		productName:       productName,
+		webhooks:          webhooks,
+		auditLogger:       auditLogger,
+	}
+}
+
+func (u *PhoneUsecase) audit(info domain.RequestInfo, eventType string, subjectID *int64, err error, metadata map[string]interface{}) {
+	recordAuditEvent(u.auditLogger, info, eventType, subjectID, err, metadata)
+}
+
+// StartPhoneVerification re-checks the user's password and texts a code to
+// phone. The number is only stored once the code is confirmed.
+func (u *PhoneUsecase) StartPhoneVerification(info domain.RequestInfo, userID int64, phone, password string) (err error) {
+	normalized := domain.NormalizePhoneNumber(phone)
+	defer func() {
+		u.audit(info, domain.AuditEventSMSCodeSent, &userID, err, map[string]interface{}{
+			"purpose": domain.SMSPurposePhoneVerification,
+			"phone":   domain.MaskPhoneNumber(normalized),
+		})
+	}()
+
+	if normalized == "" {
+		return domain.ErrInvalidPhoneNumber
+	}
+
+	user, err := u.userRepository.FindUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := checkPassword(u.authenticator, user, password); err != nil {
+		return err
+	}
+
+	_, err = u.sendCode(user, normalized, domain.SMSPurposePhoneVerification, "", nil)
+	return err
+}
+
+// ConfirmPhoneVerification checks the code last texted to verify a number
+// and stores that number on the account
+func (u *PhoneUsecase) ConfirmPhoneVerification(info domain.RequestInfo, userID int64, code string) (user *domain.User, err error) {
+	metadata := map[string]interface{}{}
+	defer func() {
+		u.audit(info, domain.AuditEventPhoneVerified, &userID, err, metadata)
+	}()
+
+	smsCode, err := u.smsCodeRepository.FindLatestSMSCode(userID, domain.SMSPurposePhoneVerification)
+	if err != nil {
+		return nil, err
+	}
+	metadata["phone"] = domain.MaskPhoneNumber(smsCode.PhoneNumber)
+
+	now := time.Now()
+	if err := u.checkCode(smsCode, code, now); err != nil {
+		return nil, err
+	}
+	if err := u.userRepository.SetPhoneNumber(userID, smsCode.PhoneNumber, &now); err != nil {
+		return nil, err
+	}
+	return u.userRepository.FindUserByID(userID)
+}
+
+// RemovePhone re-checks the user's password and removes their phone
+// number. SMS two-factor login is turned off with it, which the user is
+// alerted to.
+func (u *PhoneUsecase) RemovePhone(info domain.RequestInfo, userID int64, password string) (err error) {
+	defer func() {
+		u.audit(info, domain.AuditEventPhoneRemoved, &userID, err, nil)
+	}()
+
+	user, err := u.userRepository.FindUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := checkPassword(u.authenticator, user, password); err != nil {
+		return err
+	}
+	if user.PhoneNumber == "" {
+		return domain.ErrNoVerifiedPhone
+	}
+
+	return u.transactor.WithinTransaction(func(repos repository.TxRepositories) error {
+		if err := repos.Users.SetPhoneNumber(userID, "", nil); err != nil {
+			return err
+		}
+		if !user.SMSMFAEnabled {
+			return nil
+		}
+		return repos.EmailOutbox.EnqueueEmail(securityAlert(info, user, domain.SecurityNotificationMFADisabled, nil))
+	})
+}
+
+// EnableSMSMFA re-checks the user's password and makes a code texted to
+// their verified phone a second factor of every password login
+func (u *PhoneUsecase) EnableSMSMFA(info domain.RequestInfo, userID int64, password string) (err error) {
+	defer func() {
+		u.audit(info, domain.AuditEventMFAEnabled, &userID, err, map[string]interface{}{"method": domain.MFAMethodSMS})
+	}()
+
+	user, err := u.userRepository.FindUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := checkPassword(u.authenticator, user, password); err != nil {
+		return err
+	}
+	if user.PhoneNumber == "" {
+		return domain.ErrNoVerifiedPhone
+	}
+	if user.SMSMFAEnabled {
+		return domain.ErrMFAAlreadyEnabled
+	}
+
+	return u.userRepository.SetSMSMFA(userID, true)
+}
+
+// DisableSMSMFA re-checks the user's password, turns SMS two-factor login
+// off and alerts the user to it
+func (u *PhoneUsecase) DisableSMSMFA(info domain.RequestInfo, userID int64, password string) (err error) {
+	defer func() {
+		u.audit(info, domain.AuditEventMFADisabled, &userID, err, map[string]interface{}{"method": domain.MFAMethodSMS})
+	}()
+
+	user, err := u.userRepository.FindUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := checkPassword(u.authenticator, user, password); err != nil {
+		return err
+	}
+	if !user.SMSMFAEnabled {
+		return domain.ErrMFANotEnabled
+	}
+
+	return u.transactor.WithinTransaction(func(repos repository.TxRepositories) error {
+		if err := repos.Users.SetSMSMFA(userID, false); err != nil {
+			return err
+		}
+		return repos.EmailOutbox.EnqueueEmail(securityAlert(info, user, domain.SecurityNotificationMFADisabled, nil))
+	})
+}
+
+// StartLoginChallenge texts a login code to a user whose first factor was
+// just checked and returns the challenge that CompleteLoginChallenge
+// redeems. orgID is the organization a single sign-on scoped the login to,
+// nil for password logins.
+func (u *PhoneUsecase) StartLoginChallenge(info domain.RequestInfo, user *domain.User, orgID *int64) (_ *domain.MFAChallenge, err error) {
+	defer func() {
+		u.audit(info, domain.AuditEventSMSCodeSent, &user.ID, err, map[string]interface{}{
+			"purpose": domain.SMSPurposeLogin,
+			"phone":   domain.MaskPhoneNumber(user.PhoneNumber),
+		})
+	}()
+
+	if user.PhoneNumber == "" {
+		return nil, domain.ErrNoVerifiedPhone
+	}
+
+	token, err := randomURLToken(32)
+	if err != nil {
+		return nil, err
+	}
+	smsCode, err := u.sendCode(user, user.PhoneNumber, domain.SMSPurposeLogin, sha256Hex(token), orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.MFAChallenge{
+		Token:     token,
+		Method:    domain.MFAMethodSMS,
+		PhoneHint: domain.MaskPhoneNumber(user.PhoneNumber),
+		ExpiresAt: smsCode.ExpiresAt,
+	}, nil
+}
+
+// CompleteLoginChallenge checks the code texted for the challenge token and
+// returns the user it signs in, with the organization the challenge was
+// started for. Failures are published to webhooks as failed logins.
+func (u *PhoneUsecase) CompleteLoginChallenge(info domain.RequestInfo, token, code string) (user *domain.User, orgID *int64, err error) {
+	var subjectID *int64
+	defer func() {
+		u.audit(info, domain.AuditEventMFALogin, subjectID, err, map[string]interface{}{"method": domain.MFAMethodSMS})
+		if err != nil {
+			if err := u.webhooks.Publish(domain.WebhookEventLoginFailed, loginFailedEvent(info, "", subjectID, domain.MFAMethodSMS, err)); err != nil {
+				logrus.Warnf("Failed to publish failed SMS login: %v", err)
+			}
+		}
+	}()
+
+	smsCode, err := u.smsCodeRepository.FindSMSCodeByChallenge(sha256Hex(token))
+	if err != nil {
+		return nil, nil, err
+	}
+	subjectID = &smsCode.UserID
+	if smsCode.Purpose != domain.SMSPurposeLogin {
+		return nil, nil, domain.ErrInvalidSMSCode
+	}
+
+	if err := u.checkCode(smsCode, code, time.Now()); err != nil {
+		return nil, nil, err
+	}
+
+	user, err = u.userRepository.FindUserByID(smsCode.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.DeletedAt != nil {
+		return nil, nil, domain.ErrAccountDeleted
+	}
+	if !user.IsActive {
+		return nil, nil, domain.ErrAccountDisabled
+	}
+	return user, smsCode.OrgID, nil
+}
+
+// RequestPasswordResetSMS texts a password reset code to the verified phone
+// of the user with email. Users with SMS MFA enabled must reset through the
+// emailed link: their phone alone would otherwise pass both factors.
+func (u *PhoneUsecase) RequestPasswordResetSMS(info domain.RequestInfo, email string) (err error) {
+	var subjectID *int64
+	defer func() {
+		u.audit(info, domain.AuditEventSMSCodeSent, subjectID, err, map[string]interface{}{
+			"purpose": domain.SMSPurposePasswordReset,
+			"email":   email,
+		})
+	}()
+
+	user, err := u.userRepository.FindUserByEmail(email)
+	if err != nil {
+		return err
+	}
+	subjectID = &user.ID
+
+	if user.PhoneNumber == "" {
+		return domain.ErrNoVerifiedPhone
+	}
+	if user.SMSMFAEnabled {
+		return domain.ErrSMSResetWithMFA
+	}
+
+	_, err = u.sendCode(user, user.PhoneNumber, domain.SMSPurposePasswordReset, "", nil)
+	return err
+}
+
+// VerifyPasswordResetSMS checks the reset code texted to the user with
+// email and returns a reset token for the password reset endpoint. Codes
+// sent before the user turned on SMS MFA no longer work.
+func (u *PhoneUsecase) VerifyPasswordResetSMS(info domain.RequestInfo, email, code string) (_ string, err error) {
+	var subjectID *int64
+	defer func() {
+		u.audit(info, domain.AuditEventPasswordResetSMSVerified, subjectID, err, map[string]interface{}{"email": email})
+	}()
+
+	user, err := u.userRepository.FindUserByEmail(email)
+	if err != nil {
+		return "", domain.ErrInvalidSMSCode
+	}
+	subjectID = &user.ID
+	if user.SMSMFAEnabled {
+		return "", domain.ErrSMSResetWithMFA
+	}
+
+	smsCode, err := u.smsCodeRepository.FindLatestSMSCode(user.ID, domain.SMSPurposePasswordReset)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	if err := u.checkCode(smsCode, code, now); err != nil {
+		return "", err
+	}
+
+	user.ResetToken = uuid.New().String()
+	user.ResetTokenExpiresAt = now.Add(smsResetTokenTTL)
+	if err := u.userRepository.UpdateUser(user); err != nil {
+		return "", err
+	}
+	return user.ResetToken, nil
+}
+
+// sendCode texts a new code for purpose to phone, unless one was sent to
+// the user for the same purpose within the resend interval or the user
+// reached the daily cap
+func (u *PhoneUsecase) sendCode(user *domain.User, phone, purpose, challengeHash string, orgID *int64) (*domain.SMSCode, error) {
+	now := time.Now()
+	latest, err := u.smsCodeRepository.FindLatestSMSCode(user.ID, purpose)
+	switch {
+	case err == nil && now.Sub(latest.CreatedAt) < u.policy.ResendInterval:
+		return nil, domain.ErrSMSCodeRateLimited
+	case err != nil && !errors.Is(err, domain.ErrInvalidSMSCode):
+		return nil, err
+	}
+
+	if u.policy.MaxCodesPerDay > 0 {
+		sent, err := u.smsCodeRepository.CountSMSCodesSince(user.ID, now.Add(-24*time.Hour))
+		if err != nil {
+			return nil, err
+		}
+		if sent >= u.policy.MaxCodesPerDay {
+			return nil, domain.ErrSMSCodeLimit
+		}
+	}
+
+	code, err := randomSMSCode()
+	if err != nil {
+		return nil, err
+	}
+
+	smsCode := &domain.SMSCode{
+		UserID:        user.ID,
+		Purpose:       purpose,
+		PhoneNumber:   phone,
+		CodeHash:      sha256Hex(code),
+		ChallengeHash: challengeHash,
+		OrgID:         orgID,
+		ExpiresAt:     now.Add(u.policy.TTL),
+	}
+	if err := u.smsCodeRepository.CreateSMSCode(smsCode); err != nil {
+		return nil, err
+	}
+
+	if err := u.smsSender.SendSMS(phone, u.smsMessage(purpose, code)); err != nil {
+		return nil, fmt.Errorf("sending %s code: %w", purpose, err)
+	}
+	return smsCode, nil
+}
+
+func (u *PhoneUsecase) smsMessage(purpose, code string) string {
+	minutes := int(u.policy.TTL.Minutes())
+	switch purpose {
+	case domain.SMSPurposeLogin:
+		return fmt.Sprintf("%s sign-in code: %s. It expires in %d minutes. Never share it with anyone.", u.productName, code, minutes)
+	case domain.SMSPurposePasswordReset:
+		return fmt.Sprintf("%s password reset code: %s. It expires in %d minutes. If you didn't ask to reset your password, ignore this message.", u.productName, code, minutes)
+	}
+	return fmt.Sprintf("%s verification code: %s. It expires in %d minutes.", u.productName, code, minutes)
+}
+
+// checkCode consumes smsCode if code matches it. Codes are void once used,
+// expired or guessed wrong too often. Every check claims an attempt before
+// comparing, so parallel requests cannot guess more than MaxAttempts times.
+func (u *PhoneUsecase) checkCode(smsCode *domain.SMSCode, code string, now time.Time) error {
+	codeHash, err := u.smsCodeRepository.ClaimSMSCodeAttempt(smsCode.ID, u.policy.MaxAttempts, now)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(sha256Hex(code)), []byte(codeHash)) != 1 {
+		return domain.ErrInvalidSMSCode
+	}
+	return u.smsCodeRepository.ConsumeSMSCode(smsCode.ID, now)
+}
+
+// randomSMSCode returns a random six-digit code
+func randomSMSCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
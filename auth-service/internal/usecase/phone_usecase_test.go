@@ -0,0 +1,156 @@
+package usecase
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+// fakeSMSCodeRepository keeps codes in memory
+type fakeSMSCodeRepository struct {
+	codes []*domain.SMSCode
+}
+
+func (r *fakeSMSCodeRepository) CreateSMSCode(code *domain.SMSCode) error {
+	code.ID = int64(len(r.codes) + 1)
+	code.CreatedAt = time.Now()
+	r.codes = append(r.codes, code)
+	return nil
+}
+
+func (r *fakeSMSCodeRepository) FindLatestSMSCode(userID int64, purpose string) (*domain.SMSCode, error) {
+	for i := len(r.codes) - 1; i >= 0; i-- {
+		if r.codes[i].UserID == userID && r.codes[i].Purpose == purpose {
+			return r.codes[i], nil
+		}
+	}
+	return nil, domain.ErrInvalidSMSCode
+}
+
+func (r *fakeSMSCodeRepository) FindSMSCodeByChallenge(challengeHash string) (*domain.SMSCode, error) {
+	for _, code := range r.codes {
+		if code.ChallengeHash == challengeHash {
+			return code, nil
+		}
+	}
+	return nil, domain.ErrInvalidSMSCode
+}
+
+func (r *fakeSMSCodeRepository) CountSMSCodesSince(userID int64, since time.Time) (int, error) {
+	return 0, nil
+}
+
+func (r *fakeSMSCodeRepository) ClaimSMSCodeAttempt(codeID int64, maxAttempts int, now time.Time) (string, error) {
+	code := r.codes[codeID-1]
+	if code.ConsumedAt != nil || !code.ExpiresAt.After(now) || code.Attempts >= maxAttempts {
+		return "", domain.ErrInvalidSMSCode
+	}
+	code.Attempts++
+	return code.CodeHash, nil
+}
+
+func (r *fakeSMSCodeRepository) ConsumeSMSCode(codeID int64, consumedAt time.Time) error {
+	code := r.codes[codeID-1]
+	if code.ConsumedAt != nil {
+		return domain.ErrInvalidSMSCode
+	}
+	code.ConsumedAt = &consumedAt
+	return nil
+}
+
+// recordingSMSSender keeps the messages it is asked to send
+type recordingSMSSender struct {
+	messages []string
+}
+
+func (s *recordingSMSSender) SendSMS(to, body string) error {
+	s.messages = append(s.messages, body)
+	return nil
+}
+
+var smsCodePattern = regexp.MustCompile(`\b\d{6}\b`)
+
+type phoneTest struct {
+	usecase *PhoneUsecase
+	users   *fakeUserRepository
+	sender  *recordingSMSSender
+}
+
+func newPhoneTest() *phoneTest {
+	pt := &phoneTest{users: &fakeUserRepository{}, sender: &recordingSMSSender{}}
+	auditLogger := discardAuditLogger{}
+	pt.usecase = NewPhoneUsecase(pt.users, &fakeSMSCodeRepository{}, nil, nil, pt.sender, SMSCodePolicy{
+		TTL:         5 * time.Minute,
+		MaxAttempts: 3,
+	}, "Sales Tracker", NewWebhookUsecase(&fakeWebhookRepository{}, auditLogger), auditLogger)
+	return pt
+}
+
+// lastCode returns the code in the last message sent
+func (pt *phoneTest) lastCode(t *testing.T) string {
+	t.Helper()
+	if len(pt.sender.messages) == 0 {
+		t.Fatal("no SMS sent")
+	}
+	code := smsCodePattern.FindString(pt.sender.messages[len(pt.sender.messages)-1])
+	if code == "" {
+		t.Fatalf("no code in %q", pt.sender.messages[len(pt.sender.messages)-1])
+	}
+	return code
+}
+
+func TestPasswordResetSMS(t *testing.T) {
+	pt := newPhoneTest()
+	user := &domain.User{Email: "ana@example.com", PhoneNumber: "+14155550123", IsVerified: true}
+	pt.users.CreateUser(user)
+
+	if err := pt.usecase.RequestPasswordResetSMS(domain.RequestInfo{}, user.Email); err != nil {
+		t.Fatalf("RequestPasswordResetSMS: %v", err)
+	}
+	token, err := pt.usecase.VerifyPasswordResetSMS(domain.RequestInfo{}, user.Email, pt.lastCode(t))
+	if err != nil {
+		t.Fatalf("VerifyPasswordResetSMS: %v", err)
+	}
+	if token == "" || user.ResetToken != token {
+		t.Errorf("reset token = %q, stored %q", token, user.ResetToken)
+	}
+}
+
+func TestPasswordResetSMSRefusedWithSMSMFA(t *testing.T) {
+	t.Run("request", func(t *testing.T) {
+		pt := newPhoneTest()
+		user := &domain.User{Email: "ana@example.com", PhoneNumber: "+14155550123", IsVerified: true, SMSMFAEnabled: true}
+		pt.users.CreateUser(user)
+
+		err := pt.usecase.RequestPasswordResetSMS(domain.RequestInfo{}, user.Email)
+		if !errors.Is(err, domain.ErrSMSResetWithMFA) {
+			t.Fatalf("RequestPasswordResetSMS error = %v, want %v", err, domain.ErrSMSResetWithMFA)
+		}
+		if len(pt.sender.messages) != 0 {
+			t.Errorf("sent %d messages, want none", len(pt.sender.messages))
+		}
+	})
+
+	// A code sent before SMS MFA was turned on must not yield a reset token
+	t.Run("verify", func(t *testing.T) {
+		pt := newPhoneTest()
+		user := &domain.User{Email: "ana@example.com", PhoneNumber: "+14155550123", IsVerified: true}
+		pt.users.CreateUser(user)
+
+		if err := pt.usecase.RequestPasswordResetSMS(domain.RequestInfo{}, user.Email); err != nil {
+			t.Fatalf("RequestPasswordResetSMS: %v", err)
+		}
+		user.SMSMFAEnabled = true
+
+		_, err := pt.usecase.VerifyPasswordResetSMS(domain.RequestInfo{}, user.Email, pt.lastCode(t))
+		if !errors.Is(err, domain.ErrSMSResetWithMFA) {
+			t.Fatalf("VerifyPasswordResetSMS error = %v, want %v", err, domain.ErrSMSResetWithMFA)
+		}
+		if user.ResetToken != "" {
+			t.Error("reset token issued")
+		}
+	})
+}
@@ -0,0 +1,296 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/repository"
+	"github.com/sales-tracker/auth-service/internal/service"
+)
+
+// SAMLUsecase manages per-organization SAML identity providers and signs
+// users in from their assertions
+type SAMLUsecase struct {
+	samlRepository         repository.SAMLRepository
+	organizationRepository repository.OrganizationRepository
+	userRepository         repository.UserRepository
+	serviceProvider        *service.SAMLServiceProvider
+	securityNotifications  *SecurityNotificationUsecase
+	webhooks               *WebhookUsecase
+	auditLogger            service.AuditLogger
+}
+
+func NewSAMLUsecase(samlRepository repository.SAMLRepository, organizationRepository repository.OrganizationRepository, userRepository repository.UserRepository, serviceProvider *service.SAMLServiceProvider, securityNotifications *SecurityNotificationUsecase, webhooks *WebhookUsecase, auditLogger service.AuditLogger) *SAMLUsecase {
+	return &SAMLUsecase{
+		samlRepository:         samlRepository,
+		organizationRepository: organizationRepository,
+		userRepository:         userRepository,
+		serviceProvider:        serviceProvider,
+		securityNotifications:  securityNotifications,
+		webhooks:               webhooks,
+		auditLogger:            auditLogger,
+	}
+}
+
+func (u *SAMLUsecase) audit(info domain.RequestInfo, eventType string, subjectID *int64, err error, metadata map[string]interface{}) {
+	recordAuditEvent(u.auditLogger, info, eventType, subjectID, err, metadata)
+}
+
+func (u *SAMLUsecase) GetConfig(orgID int64) (*domain.SAMLConfig, error) {
+	return u.samlRepository.FindConfig(orgID)
+}
+
+// SaveConfig replaces the organization's IdP configuration. Metadata in the
+// update is parsed first so explicit fields can override it.
+func (u *SAMLUsecase) SaveConfig(info domain.RequestInfo, orgID int64, update *domain.SAMLConfigUpdate) (cfg *domain.SAMLConfig, err error) {
+	defer func() {
+		u.audit(info, domain.AuditEventSAMLConfigUpdated, nil, err, map[string]interface{}{"org_id": orgID})
+	}()
+
+	cfg = &domain.SAMLConfig{
+		OrgID:             orgID,
+		EmailAttribute:    strings.TrimSpace(update.EmailAttribute),
+		NameAttribute:     strings.TrimSpace(update.NameAttribute),
+		RoleAttribute:     strings.TrimSpace(update.RoleAttribute),
+		RoleMapping:       update.RoleMapping,
+		DefaultRole:       update.DefaultRole,
+		JITProvisioning:   update.JITProvisioning,
+		AllowIdPInitiated: update.AllowIdPInitiated,
+		Enabled:           true,
+	}
+	if update.Enabled != nil {
+		cfg.Enabled = *update.Enabled
+	}
+	if cfg.DefaultRole == "" {
+		cfg.DefaultRole = domain.OrgRoleClient
+	}
+
+	if update.IdPMetadata != "" {
+		cfg.IdPEntityID, cfg.IdPSSOURL, cfg.IdPCertificates, err = service.ParseIdPMetadata([]byte(update.IdPMetadata))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", domain.ErrInvalidSAMLConfig, err)
+		}
+	}
+	if update.IdPEntityID != "" {
+		cfg.IdPEntityID = strings.TrimSpace(update.IdPEntityID)
+	}
+	if update.IdPSSOURL != "" {
+		cfg.IdPSSOURL = strings.TrimSpace(update.IdPSSOURL)
+	}
+	if len(update.IdPCertificates) > 0 {
+		cfg.IdPCertificates = update.IdPCertificates
+	}
+
+	if err := validateSAMLConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	if _, err := u.organizationRepository.FindOrganizationByID(orgID); err != nil {
+		return nil, err
+	}
+	if err := u.samlRepository.SaveConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func validateSAMLConfig(cfg *domain.SAMLConfig) error {
+	if cfg.IdPEntityID == "" {
+		return fmt.Errorf("%w: IdP entity ID is required", domain.ErrInvalidSAMLConfig)
+	}
+	ssoURL, err := url.Parse(cfg.IdPSSOURL)
+	if err != nil || (ssoURL.Scheme != "https" && ssoURL.Scheme != "http") || ssoURL.Host == "" {
+		return fmt.Errorf("%w: IdP SSO URL must be an absolute HTTP(S) URL", domain.ErrInvalidSAMLConfig)
+	}
+	certs, err := service.ParseSAMLCertificates(cfg.IdPCertificates)
+	if err != nil {
+		return fmt.Errorf("%w: %v", domain.ErrInvalidSAMLConfig, err)
+	}
+	if len(certs) == 0 {
+		return fmt.Errorf("%w: at least one IdP signing certificate is required", domain.ErrInvalidSAMLConfig)
+	}
+	if !domain.IsValidOrgRole(cfg.DefaultRole) {
+		return fmt.Errorf("%w: default role %q", domain.ErrInvalidSAMLConfig, cfg.DefaultRole)
+	}
+	for value, role := range cfg.RoleMapping {
+		if !domain.IsValidOrgRole(role) {
+			return fmt.Errorf("%w: role mapping %q -> %q", domain.ErrInvalidSAMLConfig, value, role)
+		}
+	}
+	return nil
+}
+
+func (u *SAMLUsecase) DeleteConfig(info domain.RequestInfo, orgID int64) (err error) {
+	defer func() {
+		u.audit(info, domain.AuditEventSAMLConfigDeleted, nil, err, map[string]interface{}{"org_id": orgID})
+	}()
+
+	return u.samlRepository.DeleteConfig(orgID)
+}
+
+// Metadata returns the SP metadata the organization registers with its IdP.
+// It is available before SAML is configured.
+func (u *SAMLUsecase) Metadata(orgID int64) ([]byte, error) {
+	if _, err := u.organizationRepository.FindOrganizationByID(orgID); err != nil {
+		return nil, err
+	}
+	return u.serviceProvider.Metadata(orgID)
+}
+
+// StartLogin records a new AuthnRequest and returns the IdP URL to send the
+// user to
+func (u *SAMLUsecase) StartLogin(orgID int64, relayState string, requestTTL time.Duration) (string, error) {
+	cfg, err := u.enabledConfig(orgID)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := randomURLToken(20)
+	if err != nil {
+		return "", err
+	}
+	// IDs must be XML NCNames, which cannot start with a digit
+	requestID := "id-" + token
+
+	if err := u.samlRepository.CreateRequest(orgID, requestID, time.Now().Add(requestTTL)); err != nil {
+		return "", err
+	}
+
+	return u.serviceProvider.AuthnRequestURL(cfg, requestID, relayState)
+}
+
+// CompleteLogin validates a SAMLResponse posted to the organization's ACS
+// and returns the user and their membership. Unknown users are provisioned
+// when JIT provisioning is on. Existing accounts can only sign in when the
+// organization provisioned them, through JIT or SCIM, and is still their
+// member: the organization controls its IdP, so its assertions must never
+// speak for accounts it does not own, even ones it has as members.
+func (u *SAMLUsecase) CompleteLogin(info domain.RequestInfo, orgID int64, samlResponse string) (user *domain.User, membership *domain.Membership, err error) {
+	metadata := map[string]interface{}{"org_id": orgID}
+	defer func() {
+		var subjectID *int64
+		if user != nil && user.ID != 0 {
+			subjectID = &user.ID
+		}
+		u.audit(info, domain.AuditEventSAMLLogin, subjectID, err, metadata)
+	}()
+
+	cfg, err := u.enabledConfig(orgID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	assertion, err := u.serviceProvider.ParseResponse(cfg, samlResponse, now)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", domain.ErrInvalidSAMLResp, err)
+	}
+	metadata["name_id"] = assertion.NameID
+	metadata["assertion_id"] = assertion.ID
+
+	if assertion.InResponseTo != "" {
+		if err := u.samlRepository.ConsumeRequest(orgID, assertion.InResponseTo, now); err != nil {
+			return nil, nil, err
+		}
+	} else if !cfg.AllowIdPInitiated {
+		return nil, nil, fmt.Errorf("%w: IdP-initiated login is disabled", domain.ErrInvalidSAMLResp)
+	}
+	if err := u.samlRepository.RecordAssertion(orgID, assertion.ID, assertion.NotOnOrAfter); err != nil {
+		return nil, nil, err
+	}
+
+	email := assertion.NameID
+	if cfg.EmailAttribute != "" {
+		email = assertion.Attribute(cfg.EmailAttribute)
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	if !strings.Contains(email, "@") {
+		return nil, nil, fmt.Errorf("%w: assertion has no email address", domain.ErrInvalidSAMLResp)
+	}
+	metadata["email"] = email
+
+	role, roleAsserted := samlRole(cfg, assertion)
+
+	provisioned := false
+	user, err = u.userRepository.FindUserByEmail(email)
+	if err != nil {
+		if !cfg.JITProvisioning {
+			return nil, nil, domain.ErrSAMLNoAccount
+		}
+		// SAML-only accounts have no password and cannot use /auth/login
+		user = &domain.User{
+			Email:              email,
+			Role:               globalRoleForOrgRole(role),
+			IsVerified:         true,
+			ProvisionedByOrgID: &orgID,
+		}
+		if err := u.userRepository.CreateUser(user); err != nil {
+			return nil, nil, err
+		}
+		provisioned = true
+		metadata["provisioned"] = true
+		if err := u.webhooks.Publish(domain.WebhookEventUserCreated, userCreatedEvent(user, "saml")); err != nil {
+			logrus.Warnf("Failed to publish creation of user %d: %v", user.ID, err)
+		}
+	} else if !user.ProvisionedBy(orgID) {
+		return nil, nil, domain.ErrSAMLNoAccount
+	} else if user.DeletedAt != nil {
+		return user, nil, domain.ErrAccountDeleted
+	} else if !user.IsActive {
+		return user, nil, domain.ErrAccountDisabled
+	}
+
+	membership, err = syncIdentityMembership(u.organizationRepository, u.webhooks, "saml", user.ID, orgID, role, roleAsserted, provisioned)
+	if errors.Is(err, domain.ErrMembershipNotFound) {
+		return nil, nil, domain.ErrSAMLNoAccount
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cfg.NameAttribute != "" && user.Name == "" {
+		if name := strings.TrimSpace(assertion.Attribute(cfg.NameAttribute)); name != "" {
+			user.Name = name
+			if err := u.userRepository.UpdateUserName(user.ID, name); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	if err := u.securityNotifications.RecordLogin(info, user); err != nil {
+		logrus.Warnf("Failed to record login device for user %d: %v", user.ID, err)
+	}
+	return user, membership, nil
+}
+
+// samlRole maps the assertion's role attribute to an organization role. The
+// second result reports whether the IdP asserted a mapped role, as opposed
+// to the configured default.
+func samlRole(cfg *domain.SAMLConfig, assertion *domain.SAMLAssertion) (string, bool) {
+	if cfg.RoleAttribute != "" {
+		for _, value := range assertion.Attributes[cfg.RoleAttribute] {
+			if role, ok := cfg.RoleMapping[value]; ok {
+				return role, true
+			}
+		}
+	}
+	return cfg.DefaultRole, false
+}
+
+func (u *SAMLUsecase) enabledConfig(orgID int64) (*domain.SAMLConfig, error) {
+	cfg, err := u.samlRepository.FindConfig(orgID)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.Enabled {
+		return nil, domain.ErrSAMLNotConfigured
+	}
+	return cfg, nil
+}
@@ -0,0 +1,114 @@
+package usecase
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/repository"
+	"github.com/sales-tracker/auth-service/internal/service"
+	"github.com/sales-tracker/auth-service/internal/service/samltest"
+)
+
+// fakeSAMLRepository keeps outstanding requests and consumed assertion IDs
+// in memory, failing the way the Postgres repository does
+type fakeSAMLRepository struct {
+	repository.SAMLRepository
+	cfg        *domain.SAMLConfig
+	requests   map[string]bool
+	assertions map[string]bool
+}
+
+func (r *fakeSAMLRepository) FindConfig(orgID int64) (*domain.SAMLConfig, error) {
+	if r.cfg == nil || r.cfg.OrgID != orgID {
+		return nil, domain.ErrSAMLNotConfigured
+	}
+	return r.cfg, nil
+}
+
+func (r *fakeSAMLRepository) ConsumeRequest(orgID int64, requestID string, now time.Time) error {
+	if !r.requests[requestID] {
+		return domain.ErrInvalidSAMLResp
+	}
+	delete(r.requests, requestID)
+	return nil
+}
+
+func (r *fakeSAMLRepository) RecordAssertion(orgID int64, assertionID string, expiresAt time.Time) error {
+	if r.assertions[assertionID] {
+		return domain.ErrSAMLReplay
+	}
+	r.assertions[assertionID] = true
+	return nil
+}
+
+func TestSAMLCompleteLoginRejectsReplays(t *testing.T) {
+	const orgID = 7
+	idp := samltest.NewIdP(t, "https://idp.example.com/metadata")
+	sp := service.NewSAMLServiceProvider("https://auth.example.com")
+	samlRepository := &fakeSAMLRepository{
+		cfg: &domain.SAMLConfig{
+			OrgID:             orgID,
+			IdPEntityID:       idp.EntityID,
+			IdPCertificates:   []string{idp.CertificatePEM()},
+			DefaultRole:       domain.OrgRoleSalesRep,
+			AllowIdPInitiated: true,
+			Enabled:           true,
+		},
+		requests:   map[string]bool{"id-request-1": true},
+		assertions: make(map[string]bool),
+	}
+
+	users := &fakeUserRepository{}
+	provisionedBy := int64(orgID)
+	user := &domain.User{Email: "ana@example.com", IsVerified: true, ProvisionedByOrgID: &provisionedBy}
+	users.CreateUser(user)
+	organizations := &fakeOrganizationRepository{memberships: []*domain.Membership{
+		{UserID: user.ID, OrgID: orgID, Role: domain.OrgRoleSalesRep},
+	}}
+
+	auditLogger := discardAuditLogger{}
+	webhooks := NewWebhookUsecase(&fakeWebhookRepository{}, auditLogger)
+	samlUsecase := NewSAMLUsecase(samlRepository, organizations, users, sp,
+		NewSecurityNotificationUsecase(fakeSecurityNotificationRepository{}, nil, auditLogger), webhooks, auditLogger)
+
+	// signedResponse answers inResponseTo, or is unsolicited when it is empty
+	signedResponse := func(assertionID, inResponseTo string) string {
+		assertion := idp.Sign(t, idp.Assertion(samltest.Assertion{
+			ID:           assertionID,
+			NameID:       user.Email,
+			Audience:     sp.EntityID(orgID),
+			Recipient:    sp.ACSURL(orgID),
+			InResponseTo: inResponseTo,
+			NotOnOrAfter: time.Now().Add(5 * time.Minute),
+		}))
+		return samltest.Encode(t, idp.Response("id-response-"+assertionID, sp.ACSURL(orgID), inResponseTo, assertion))
+	}
+
+	solicited := signedResponse("id-assertion-1", "id-request-1")
+	if _, _, err := samlUsecase.CompleteLogin(domain.RequestInfo{}, orgID, solicited); err != nil {
+		t.Fatalf("CompleteLogin: %v", err)
+	}
+
+	// The request it answered is used up
+	if _, _, err := samlUsecase.CompleteLogin(domain.RequestInfo{}, orgID, solicited); !errors.Is(err, domain.ErrInvalidSAMLResp) {
+		t.Errorf("replayed InResponseTo: error = %v, want %v", err, domain.ErrInvalidSAMLResp)
+	}
+
+	// Unsolicited responses have no request to use up, so the assertion ID
+	// is what stops a replay
+	unsolicited := signedResponse("id-assertion-2", "")
+	if _, _, err := samlUsecase.CompleteLogin(domain.RequestInfo{}, orgID, unsolicited); err != nil {
+		t.Fatalf("CompleteLogin(unsolicited): %v", err)
+	}
+	if _, _, err := samlUsecase.CompleteLogin(domain.RequestInfo{}, orgID, unsolicited); !errors.Is(err, domain.ErrSAMLReplay) {
+		t.Errorf("replayed assertion ID: error = %v, want %v", err, domain.ErrSAMLReplay)
+	}
+
+	// An assertion ID is never accepted twice, even for a new request
+	samlRepository.requests["id-request-2"] = true
+	if _, _, err := samlUsecase.CompleteLogin(domain.RequestInfo{}, orgID, signedResponse("id-assertion-1", "id-request-2")); !errors.Is(err, domain.ErrSAMLReplay) {
+		t.Errorf("reused assertion ID: error = %v, want %v", err, domain.ErrSAMLReplay)
+	}
+}
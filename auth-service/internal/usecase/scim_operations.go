@@ -0,0 +1,305 @@
+package usecase
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+)
+
+// scimFilterPattern matches a single attribute expression such as
+// `userName eq "bob@example.com"` (RFC 7644 section 3.4.2.2). Logical
+// operators and grouping are not supported.
+var scimFilterPattern = regexp.MustCompile(`(?i)^\s*([a-z][\w.:$-]*)\s+(eq|ne|co|sw|ew|pr)(?:\s+(.+?))?\s*$`)
+
+type scimFilter struct {
+	attr  string
+	op    string
+	value string
+}
+
+func parseSCIMFilter(filter string) (*scimFilter, error) {
+	match := scimFilterPattern.FindStringSubmatch(filter)
+	if match == nil {
+		return nil, fmt.Errorf("%w: unsupported filter %q", domain.ErrSCIMInvalidFilter, filter)
+	}
+
+	parsed := &scimFilter{attr: strings.ToLower(stripSCIMSchema(match[1])), op: strings.ToLower(match[2])}
+	if parsed.op == "pr" {
+		if match[3] != "" {
+			return nil, fmt.Errorf("%w: pr takes no value", domain.ErrSCIMInvalidFilter)
+		}
+		return parsed, nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(match[3]), &value); err != nil {
+		return nil, fmt.Errorf("%w: invalid comparison value %s", domain.ErrSCIMInvalidFilter, match[3])
+	}
+	parsed.value = fmt.Sprint(value)
+
+	return parsed, nil
+}
+
+// matches reports whether any of an attribute's values satisfies the
+// filter. Comparisons are case-insensitive, as for caseExact=false strings.
+func (f *scimFilter) matches(values []string) bool {
+	if f.op == "pr" {
+		for _, v := range values {
+			if v != "" {
+				return true
+			}
+		}
+		return false
+	}
+	if f.op == "ne" {
+		return !(&scimFilter{attr: f.attr, op: "eq", value: f.value}).matches(values)
+	}
+
+	want := strings.ToLower(f.value)
+	for _, v := range values {
+		v = strings.ToLower(v)
+		switch {
+		case f.op == "eq" && v == want,
+			f.op == "co" && strings.Contains(v, want),
+			f.op == "sw" && strings.HasPrefix(v, want),
+			f.op == "ew" && strings.HasSuffix(v, want):
+			return true
+		}
+	}
+	return false
+}
+
+// stripSCIMSchema removes a core schema URN prefix from an attribute path,
+// e.g. "urn:ietf:params:scim:schemas:core:2.0:User:userName"
+func stripSCIMSchema(path string) string {
+	for _, schema := range []string{domain.SCIMSchemaUser, domain.SCIMSchemaGroup} {
+		if len(path) > len(schema) && strings.EqualFold(path[:len(schema)+1], schema+":") {
+			return path[len(schema)+1:]
+		}
+	}
+	return path
+}
+
+// applySCIMPatch applies PATCH operations (RFC 7644 section 3.5.2) to the
+// JSON form of current and decodes the result into target. Operations on
+// extension schemas are ignored, since no extension attributes are stored.
+func applySCIMPatch(current interface{}, operations []domain.SCIMPatchOperation, target interface{}) error {
+	data, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	var resource map[string]interface{}
+	if err := json.Unmarshal(data, &resource); err != nil {
+		return err
+	}
+
+	for _, operation := range operations {
+		op := strings.ToLower(operation.Op)
+		if op != "add" && op != "replace" && op != "remove" {
+			return fmt.Errorf("%w: unsupported op %q", domain.ErrSCIMInvalidValue, operation.Op)
+		}
+
+		var value interface{}
+		if len(operation.Value) > 0 {
+			if err := json.Unmarshal(operation.Value, &value); err != nil {
+				return fmt.Errorf("%w: %v", domain.ErrSCIMInvalidValue, err)
+			}
+		}
+
+		if operation.Path == "" {
+			// Without a path the value holds attribute paths and their values
+			values, ok := value.(map[string]interface{})
+			if !ok || op == "remove" {
+				return fmt.Errorf("%w: a path is required", domain.ErrSCIMInvalidPath)
+			}
+			for path, v := range values {
+				if err := applySCIMPatchPath(resource, op, path, v); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := applySCIMPatchPath(resource, op, operation.Path, value); err != nil {
+			return err
+		}
+	}
+
+	data, err = json.Marshal(resource)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, target); err != nil {
+		return fmt.Errorf("%w: %v", domain.ErrSCIMInvalidValue, err)
+	}
+	return nil
+}
+
+// scimPathPattern splits attr[valueFilter].subAttr
+var scimPathPattern = regexp.MustCompile(`^([^.\[\]]+)(?:\[(.+)\])?(?:\.([^.\[\]]+))?$`)
+
+func applySCIMPatchPath(resource map[string]interface{}, op, path string, value interface{}) error {
+	path = stripSCIMSchema(path)
+	if strings.HasPrefix(strings.ToLower(path), "urn:") {
+		return nil
+	}
+
+	match := scimPathPattern.FindStringSubmatch(path)
+	if match == nil {
+		return fmt.Errorf("%w: %q", domain.ErrSCIMInvalidPath, path)
+	}
+	attr, filterExpr, subAttr := resourceKey(resource, match[1]), match[2], match[3]
+
+	if filterExpr == "" {
+		if subAttr == "" {
+			patchValue(resource, op, attr, value)
+			return nil
+		}
+		switch existing := resource[attr].(type) {
+		case []interface{}:
+			for _, element := range existing {
+				if element, ok := element.(map[string]interface{}); ok {
+					patchValue(element, op, resourceKey(element, subAttr), value)
+				}
+			}
+			if len(existing) == 0 && op != "remove" {
+				resource[attr] = []interface{}{map[string]interface{}{subAttr: value}}
+			}
+		case map[string]interface{}:
+			patchValue(existing, op, resourceKey(existing, subAttr), value)
+		default:
+			if op != "remove" {
+				resource[attr] = map[string]interface{}{subAttr: value}
+			}
+		}
+		return nil
+	}
+
+	filter, err := parseSCIMFilter(filterExpr)
+	if err != nil {
+		return fmt.Errorf("%w: %q", domain.ErrSCIMInvalidPath, path)
+	}
+	elements, _ := resource[attr].([]interface{})
+
+	var kept []interface{}
+	matched := false
+	for _, element := range elements {
+		object, ok := element.(map[string]interface{})
+		if !ok || !filter.matches([]string{fmt.Sprint(object[resourceKey(object, filter.attr)])}) {
+			kept = append(kept, element)
+			continue
+		}
+		matched = true
+		if op == "remove" && subAttr == "" {
+			continue
+		}
+		if subAttr == "" {
+			patchObject(object, value)
+		} else {
+			patchValue(object, op, resourceKey(object, subAttr), value)
+		}
+		kept = append(kept, object)
+	}
+
+	if !matched && op != "remove" {
+		// add and replace create the element the filter describes
+		if filter.op != "eq" {
+			return fmt.Errorf("%w: no values match %q", domain.ErrSCIMNoTarget, path)
+		}
+		object := map[string]interface{}{filter.attr: filter.value}
+		if subAttr == "" {
+			patchObject(object, value)
+		} else {
+			object[subAttr] = value
+		}
+		kept = append(kept, object)
+	}
+	resource[attr] = kept
+
+	return nil
+}
+
+// patchValue applies op to object[key]. Adding to a multi-valued attribute
+// appends and adding or replacing a complex attribute merges sub-attributes.
+// Removing with a value removes only the listed elements.
+func patchValue(object map[string]interface{}, op, key string, value interface{}) {
+	existing, exists := object[key]
+
+	if op == "remove" {
+		elements, isList := existing.([]interface{})
+		removals, hasRemovals := value.([]interface{})
+		if !isList || !hasRemovals {
+			delete(object, key)
+			return
+		}
+		var kept []interface{}
+		for _, element := range elements {
+			if !containsSCIMValue(removals, element) {
+				kept = append(kept, element)
+			}
+		}
+		object[key] = kept
+		return
+	}
+
+	if !exists {
+		object[key] = value
+		return
+	}
+	switch existing := existing.(type) {
+	case []interface{}:
+		if op == "add" {
+			if additions, ok := value.([]interface{}); ok {
+				object[key] = append(existing, additions...)
+				return
+			}
+			object[key] = append(existing, value)
+			return
+		}
+	case map[string]interface{}:
+		if patchObject(existing, value) {
+			return
+		}
+	}
+	object[key] = value
+}
+
+// patchObject merges value's sub-attributes into object, reporting whether
+// value was an object
+func patchObject(object map[string]interface{}, value interface{}) bool {
+	values, ok := value.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for key, v := range values {
+		object[resourceKey(object, key)] = v
+	}
+	return true
+}
+
+// containsSCIMValue reports whether element's "value" is listed in values
+func containsSCIMValue(values []interface{}, element interface{}) bool {
+	object, ok := element.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for _, v := range values {
+		if candidate, ok := v.(map[string]interface{}); ok && fmt.Sprint(candidate["value"]) == fmt.Sprint(object["value"]) {
+			return true
+		}
+	}
+	return false
+}
+
+// resourceKey returns the existing key matching name case-insensitively,
+// since SCIM attribute names are case-insensitive
+func resourceKey(object map[string]interface{}, name string) string {
+	for key := range object {
+		if strings.EqualFold(key, name) {
+			return key
+		}
+	}
+	return name
+}
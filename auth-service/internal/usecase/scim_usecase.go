@@ -0,0 +1,781 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/repository"
+	"github.com/sales-tracker/auth-service/internal/service"
+)
+
+// scimMaxPageSize caps the count a directory may request per page
+const scimMaxPageSize = 200
+
+var groupRoleInvalidChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// orgRoleRank orders organization roles by privilege, for members whose
+// groups grant several roles
+var orgRoleRank = map[string]int{
+	domain.OrgRoleClient:       1,
+	domain.OrgRoleSalesRep:     2,
+	domain.OrgRoleSalesManager: 3,
+	domain.OrgRoleAdmin:        4,
+}
+
+// SCIMUsecase provisions an organization's members and groups from its
+// directory (RFC 7644). Users map onto accounts and memberships, the roles
+// attribute onto the organization role and active onto account status.
+type SCIMUsecase struct {
+	scimRepository         repository.SCIMRepository
+	organizationRepository repository.OrganizationRepository
+	userRepository         repository.UserRepository
+	transactor             repository.Transactor
+	webhooks               *WebhookUsecase
+	auditLogger            service.AuditLogger
+}
+
+func NewSCIMUsecase(scimRepository repository.SCIMRepository, organizationRepository repository.OrganizationRepository, userRepository repository.UserRepository, transactor repository.Transactor, webhooks *WebhookUsecase, auditLogger service.AuditLogger) *SCIMUsecase {
+	return &SCIMUsecase{
+		scimRepository:         scimRepository,
+		organizationRepository: organizationRepository,
+		userRepository:         userRepository,
+		transactor:             transactor,
+		webhooks:               webhooks,
+		auditLogger:            auditLogger,
+	}
+}
+
+func (u *SCIMUsecase) audit(info domain.RequestInfo, eventType string, subjectID *int64, err error, metadata map[string]interface{}) {
+	recordAuditEvent(u.auditLogger, info, eventType, subjectID, err, metadata)
+}
+
+// ListUsers returns the page of members matching filter starting at the
+// 1-based startIndex, along with the total number of matches. Filtering
+// and paging happen in the database query.
+func (u *SCIMUsecase) ListUsers(orgID int64, filter string, startIndex, count int) ([]*domain.DirectoryUser, int, error) {
+	var userFilter *domain.DirectoryUserFilter
+	if filter != "" {
+		parsed, err := parseSCIMFilter(filter)
+		if err != nil {
+			return nil, 0, err
+		}
+		attribute, err := directoryUserAttribute(parsed.attr)
+		if err != nil {
+			return nil, 0, err
+		}
+		userFilter = &domain.DirectoryUserFilter{Attribute: attribute, Operator: parsed.op, Value: parsed.value}
+	}
+
+	offset, limit := scimPage(startIndex, count)
+	return u.scimRepository.ListUsers(orgID, userFilter, offset, limit)
+}
+
+func (u *SCIMUsecase) GetUser(orgID, userID int64) (*domain.DirectoryUser, error) {
+	return u.scimRepository.FindUser(orgID, userID)
+}
+
+// CreateUser provisions a member, creating a verified account for them.
+// The account and membership are created in one transaction, so a failure
+// leaves nothing behind for a retry to trip over. Existing accounts are
+// never claimed: an email that already has one is a uniqueness conflict,
+// unless this organization's directory created the account and is
+// provisioning it again after deprovisioning it.
+func (u *SCIMUsecase) CreateUser(info domain.RequestInfo, orgID int64, resource *domain.SCIMUser) (member *domain.DirectoryUser, err error) {
+	var subjectID *int64
+	defer func() {
+		u.audit(info, domain.AuditEventSCIMUserProvisioned, subjectID, err, map[string]interface{}{
+			"org_id":      orgID,
+			"user_name":   resource.UserName,
+			"external_id": resource.ExternalID,
+		})
+	}()
+
+	email := scimUserEmail(resource, "")
+	if email == "" {
+		return nil, fmt.Errorf("%w: userName must be an email address", domain.ErrSCIMInvalidValue)
+	}
+	role, err := scimUserRole(resource, domain.OrgRoleClient)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing, err := u.userRepository.FindUserByEmail(email); err == nil {
+		subjectID = &existing.ID
+		return u.reprovisionUser(orgID, existing, role, resource)
+	}
+
+	user := &domain.User{
+		Email:              email,
+		Role:               globalRoleForOrgRole(role),
+		Name:               scimUserName(resource, ""),
+		IsVerified:         true,
+		ProvisionedByOrgID: &orgID,
+	}
+	if resource.Password != "" {
+		if len(resource.Password) < 8 {
+			return nil, fmt.Errorf("%w: %v", domain.ErrSCIMInvalidValue, domain.ErrPasswordTooShort)
+		}
+		passwordHash, err := bcrypt.GenerateFromPassword([]byte(resource.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		user.PasswordHash = string(passwordHash)
+	}
+	err = u.transactor.WithinTransaction(func(repos repository.TxRepositories) error {
+		if err := repos.Users.CreateUser(user); err != nil {
+			return err
+		}
+		if user.Name != "" {
+			if err := repos.Users.UpdateUserName(user.ID, user.Name); err != nil {
+				return err
+			}
+		}
+		if resource.Active != nil && !bool(*resource.Active) {
+			if err := repos.Users.SetUserActive(user.ID, false); err != nil {
+				return err
+			}
+			user.IsActive = false
+		}
+		if err := createMembership(repos.Organizations, orgID, user.ID, email, role); err != nil {
+			return err
+		}
+		if resource.ExternalID != "" {
+			if err := repos.SCIM.SetExternalID(orgID, user.ID, resource.ExternalID); err != nil {
+				return err
+			}
+		}
+		return enqueueWebhookEvent(repos.Webhooks, domain.WebhookEventUserCreated, userCreatedEvent(user, "scim"))
+	})
+	if err != nil {
+		return nil, err
+	}
+	subjectID = &user.ID
+
+	return u.scimRepository.FindUser(orgID, user.ID)
+}
+
+// reprovisionUser brings back an account the organization's directory
+// created and later deprovisioned, applying resource to it. It is active
+// again unless resource says otherwise.
+func (u *SCIMUsecase) reprovisionUser(orgID int64, user *domain.User, role string, resource *domain.SCIMUser) (*domain.DirectoryUser, error) {
+	if !user.ProvisionedBy(orgID) {
+		return nil, fmt.Errorf("%w: %s already has an account", domain.ErrSCIMUniqueness, user.Email)
+	}
+
+	if resource.Active == nil {
+		active := domain.SCIMBool(true)
+		resource.Active = &active
+	}
+	member := &domain.DirectoryUser{
+		UserID:      user.ID,
+		Email:       user.Email,
+		Name:        user.Name,
+		IsActive:    user.IsActive,
+		Role:        role,
+		Provisioned: true,
+	}
+	update, err := u.planUserUpdate(orgID, member, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	err = u.transactor.WithinTransaction(func(repos repository.TxRepositories) error {
+		if err := createMembership(repos.Organizations, orgID, user.ID, user.Email, role); err != nil {
+			return err
+		}
+		return update.apply(repos)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u.scimRepository.FindUser(orgID, user.ID)
+}
+
+func createMembership(organizationRepository repository.OrganizationRepository, orgID, userID int64, email, role string) error {
+	err := organizationRepository.CreateMembership(&domain.Membership{UserID: userID, OrgID: orgID, Role: role})
+	if errors.Is(err, domain.ErrMembershipExists) {
+		return fmt.Errorf("%w: %s is already a member", domain.ErrSCIMUniqueness, email)
+	}
+	return err
+}
+
+// ReplaceUser applies a full User resource to the member (PUT)
+func (u *SCIMUsecase) ReplaceUser(info domain.RequestInfo, orgID, userID int64, resource *domain.SCIMUser) (member *domain.DirectoryUser, err error) {
+	defer func() {
+		u.audit(info, domain.AuditEventSCIMUserUpdated, &userID, err, map[string]interface{}{"org_id": orgID, "op": "replace"})
+	}()
+
+	member, err = u.scimRepository.FindUser(orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return u.updateUser(orgID, member, resource)
+}
+
+// PatchUser applies PATCH operations to the member
+func (u *SCIMUsecase) PatchUser(info domain.RequestInfo, orgID, userID int64, patch *domain.SCIMPatchRequest) (member *domain.DirectoryUser, err error) {
+	defer func() {
+		u.audit(info, domain.AuditEventSCIMUserUpdated, &userID, err, map[string]interface{}{"org_id": orgID, "op": "patch"})
+	}()
+
+	member, err = u.scimRepository.FindUser(orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var resource domain.SCIMUser
+	if err := applySCIMPatch(domain.NewSCIMUser(member, ""), patch.Operations, &resource); err != nil {
+		return nil, err
+	}
+	return u.updateUser(orgID, member, &resource)
+}
+
+// updateUser brings the member in line with resource. Email, name,
+// password and status belong to the account, so they can only change when
+// the organization's directory created it. Nothing is written unless the
+// whole resource is valid, and then all of it is written in one transaction.
+func (u *SCIMUsecase) updateUser(orgID int64, member *domain.DirectoryUser, resource *domain.SCIMUser) (*domain.DirectoryUser, error) {
+	update, err := u.planUserUpdate(orgID, member, resource)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.transactor.WithinTransaction(update.apply); err != nil {
+		return nil, err
+	}
+	return u.scimRepository.FindUser(orgID, member.UserID)
+}
+
+// scimUserUpdate is a validated change to a member, ready to be written
+type scimUserUpdate struct {
+	orgID        int64
+	member       *domain.DirectoryUser
+	email        string
+	name         string
+	active       bool
+	passwordHash string
+	role         string
+	externalID   string
+}
+
+// planUserUpdate validates resource against the member, including the
+// password and the organization keeping an admin, without writing anything
+func (u *SCIMUsecase) planUserUpdate(orgID int64, member *domain.DirectoryUser, resource *domain.SCIMUser) (*scimUserUpdate, error) {
+	update := &scimUserUpdate{
+		orgID:      orgID,
+		member:     member,
+		email:      scimUserEmail(resource, member.Email),
+		name:       scimUserName(resource, member.Name),
+		active:     member.IsActive,
+		externalID: resource.ExternalID,
+	}
+	if update.email == "" {
+		return nil, fmt.Errorf("%w: userName must be an email address", domain.ErrSCIMInvalidValue)
+	}
+	if resource.Active != nil {
+		update.active = bool(*resource.Active)
+	}
+	role, err := scimUserRole(resource, member.Role)
+	if err != nil {
+		return nil, err
+	}
+	update.role = role
+
+	if update.email != member.Email || update.name != member.Name || update.active != member.IsActive || resource.Password != "" {
+		if !member.Provisioned {
+			return nil, domain.ErrSCIMUnmanagedUser
+		}
+	}
+
+	if resource.Password != "" {
+		if len(resource.Password) < 8 {
+			return nil, fmt.Errorf("%w: %v", domain.ErrSCIMInvalidValue, domain.ErrPasswordTooShort)
+		}
+		passwordHash, err := bcrypt.GenerateFromPassword([]byte(resource.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		update.passwordHash = string(passwordHash)
+	}
+	if role != member.Role && member.Role == domain.OrgRoleAdmin {
+		if err := u.ensureAnotherAdmin(orgID); err != nil {
+			return nil, err
+		}
+	}
+
+	return update, nil
+}
+
+// apply writes the update through repos
+func (update *scimUserUpdate) apply(repos repository.TxRepositories) error {
+	member := update.member
+
+	if update.email != member.Email {
+		if err := repos.Users.ConfirmEmailChange(member.UserID, update.email); err != nil {
+			if errors.Is(err, domain.ErrEmailAlreadyInUse) {
+				return fmt.Errorf("%w: %v", domain.ErrSCIMUniqueness, err)
+			}
+			return err
+		}
+	}
+	if update.name != member.Name {
+		if err := repos.Users.UpdateUserName(member.UserID, update.name); err != nil {
+			return err
+		}
+	}
+	if update.active != member.IsActive {
+		if err := repos.Users.SetUserActive(member.UserID, update.active); err != nil {
+			return err
+		}
+	}
+	if update.passwordHash != "" {
+		if err := repos.Users.UpdateUserPassword(member.UserID, update.passwordHash); err != nil {
+			return err
+		}
+	}
+	if update.role != member.Role {
+		if err := repos.Organizations.UpdateMembershipRole(member.UserID, update.orgID, update.role); err != nil {
+			return err
+		}
+		if err := enqueueWebhookEvent(repos.Webhooks, domain.WebhookEventUserRoleChanged, roleChangedEvent(member.UserID, update.orgID, member.Role, update.role, "scim")); err != nil {
+			return err
+		}
+	}
+	if update.externalID != member.ExternalID {
+		if err := repos.SCIM.SetExternalID(update.orgID, member.UserID, update.externalID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteUser deprovisions a member by removing them from the organization.
+// Accounts the organization's directory created are deactivated as well, in
+// the same transaction.
+func (u *SCIMUsecase) DeleteUser(info domain.RequestInfo, orgID, userID int64) (err error) {
+	defer func() {
+		u.audit(info, domain.AuditEventSCIMUserDeprovisioned, &userID, err, map[string]interface{}{"org_id": orgID})
+	}()
+
+	member, err := u.scimRepository.FindUser(orgID, userID)
+	if err != nil {
+		return err
+	}
+	if member.Role == domain.OrgRoleAdmin {
+		if err := u.ensureAnotherAdmin(orgID); err != nil {
+			return err
+		}
+	}
+
+	return u.transactor.WithinTransaction(func(repos repository.TxRepositories) error {
+		if err := repos.SCIM.RemoveUserFromGroups(orgID, userID); err != nil {
+			return err
+		}
+		if err := repos.Organizations.DeleteMembership(userID, orgID); err != nil {
+			return err
+		}
+		if member.Provisioned {
+			return repos.Users.SetUserActive(userID, false)
+		}
+		return nil
+	})
+}
+
+// ListGroups returns the page of groups matching filter
+func (u *SCIMUsecase) ListGroups(orgID int64, filter string, startIndex, count int) ([]*domain.DirectoryGroup, int, error) {
+	var parsed *scimFilter
+	if filter != "" {
+		var err error
+		if parsed, err = parseSCIMFilter(filter); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	groups, err := u.scimRepository.ListGroups(orgID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var matched []*domain.DirectoryGroup
+	for _, group := range groups {
+		if parsed != nil {
+			values, err := directoryGroupValues(group, parsed.attr)
+			if err != nil {
+				return nil, 0, err
+			}
+			if !parsed.matches(values) {
+				continue
+			}
+		}
+		matched = append(matched, group)
+	}
+
+	start, end := scimPageBounds(len(matched), startIndex, count)
+	return matched[start:end], len(matched), nil
+}
+
+func (u *SCIMUsecase) GetGroup(orgID, groupID int64) (*domain.DirectoryGroup, error) {
+	return u.scimRepository.FindGroup(orgID, groupID)
+}
+
+// CreateGroup creates a group. Groups named after an organization role, such
+// as "Sales Managers", grant that role to their members.
+func (u *SCIMUsecase) CreateGroup(info domain.RequestInfo, orgID int64, resource *domain.SCIMGroup) (group *domain.DirectoryGroup, err error) {
+	defer func() {
+		metadata := map[string]interface{}{"org_id": orgID, "display_name": resource.DisplayName}
+		if group != nil {
+			metadata["group_id"] = group.ID
+		}
+		u.audit(info, domain.AuditEventSCIMGroupCreated, nil, err, metadata)
+	}()
+
+	group = &domain.DirectoryGroup{OrgID: orgID}
+	if err := u.applyGroup(group, resource); err != nil {
+		return nil, err
+	}
+	if err := u.scimRepository.CreateGroup(group); err != nil {
+		return nil, err
+	}
+	if err := u.syncGroupRoles(orgID, groupMemberIDs(group.Members)); err != nil {
+		return nil, err
+	}
+
+	return u.scimRepository.FindGroup(orgID, group.ID)
+}
+
+// ReplaceGroup applies a full Group resource (PUT)
+func (u *SCIMUsecase) ReplaceGroup(info domain.RequestInfo, orgID, groupID int64, resource *domain.SCIMGroup) (group *domain.DirectoryGroup, err error) {
+	defer func() {
+		u.audit(info, domain.AuditEventSCIMGroupUpdated, nil, err, map[string]interface{}{"org_id": orgID, "group_id": groupID, "op": "replace"})
+	}()
+
+	group, err = u.scimRepository.FindGroup(orgID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	return u.updateGroup(group, resource)
+}
+
+// PatchGroup applies PATCH operations, typically member additions and
+// removals, to the group
+func (u *SCIMUsecase) PatchGroup(info domain.RequestInfo, orgID, groupID int64, patch *domain.SCIMPatchRequest) (group *domain.DirectoryGroup, err error) {
+	defer func() {
+		u.audit(info, domain.AuditEventSCIMGroupUpdated, nil, err, map[string]interface{}{"org_id": orgID, "group_id": groupID, "op": "patch"})
+	}()
+
+	group, err = u.scimRepository.FindGroup(orgID, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	var resource domain.SCIMGroup
+	if err := applySCIMPatch(domain.NewSCIMGroup(group, ""), patch.Operations, &resource); err != nil {
+		return nil, err
+	}
+	return u.updateGroup(group, &resource)
+}
+
+func (u *SCIMUsecase) updateGroup(group *domain.DirectoryGroup, resource *domain.SCIMGroup) (*domain.DirectoryGroup, error) {
+	affected := groupMemberIDs(group.Members)
+	previousRole := group.Role
+
+	if err := u.applyGroup(group, resource); err != nil {
+		return nil, err
+	}
+	if err := u.scimRepository.UpdateGroup(group); err != nil {
+		return nil, err
+	}
+
+	if previousRole != "" || group.Role != "" {
+		if err := u.syncGroupRoles(group.OrgID, append(affected, groupMemberIDs(group.Members)...)); err != nil {
+			return nil, err
+		}
+	}
+
+	return u.scimRepository.FindGroup(group.OrgID, group.ID)
+}
+
+// DeleteGroup deletes a group; members of a role group lose the role it
+// granted
+func (u *SCIMUsecase) DeleteGroup(info domain.RequestInfo, orgID, groupID int64) (err error) {
+	defer func() {
+		u.audit(info, domain.AuditEventSCIMGroupDeleted, nil, err, map[string]interface{}{"org_id": orgID, "group_id": groupID})
+	}()
+
+	group, err := u.scimRepository.FindGroup(orgID, groupID)
+	if err != nil {
+		return err
+	}
+	if err := u.scimRepository.DeleteGroup(orgID, groupID); err != nil {
+		return err
+	}
+
+	if group.Role == "" {
+		return nil
+	}
+	return u.syncGroupRoles(orgID, groupMemberIDs(group.Members))
+}
+
+// applyGroup copies resource onto group. Every member must belong to the
+// organization.
+func (u *SCIMUsecase) applyGroup(group *domain.DirectoryGroup, resource *domain.SCIMGroup) error {
+	group.DisplayName = strings.TrimSpace(resource.DisplayName)
+	if group.DisplayName == "" {
+		return fmt.Errorf("%w: displayName is required", domain.ErrSCIMInvalidValue)
+	}
+	group.ExternalID = resource.ExternalID
+	group.Role = groupRole(group.DisplayName)
+
+	group.Members = nil
+	seen := make(map[int64]bool)
+	for _, value := range resource.Members {
+		userID, err := strconv.ParseInt(value.Value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: unknown member %q", domain.ErrSCIMInvalidValue, value.Value)
+		}
+		if seen[userID] {
+			continue
+		}
+		member, err := u.scimRepository.FindUser(group.OrgID, userID)
+		if errors.Is(err, domain.ErrSCIMNotFound) {
+			return fmt.Errorf("%w: unknown member %q", domain.ErrSCIMInvalidValue, value.Value)
+		}
+		if err != nil {
+			return err
+		}
+		seen[userID] = true
+		group.Members = append(group.Members, domain.DirectoryGroupMember{UserID: userID, Email: member.Email})
+	}
+
+	return nil
+}
+
+// syncGroupRoles gives each user the most privileged role granted by their
+// role groups, or the client role when they are in none. The organization's
+// last admin is never demoted.
+func (u *SCIMUsecase) syncGroupRoles(orgID int64, userIDs []int64) error {
+	synced := make(map[int64]bool)
+	for _, userID := range userIDs {
+		if synced[userID] {
+			continue
+		}
+		synced[userID] = true
+
+		membership, err := u.organizationRepository.FindMembership(userID, orgID)
+		if errors.Is(err, domain.ErrMembershipNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		roles, err := u.scimRepository.ListGroupRoles(orgID, userID)
+		if err != nil {
+			return err
+		}
+		role := domain.OrgRoleClient
+		for _, granted := range roles {
+			if orgRoleRank[granted] > orgRoleRank[role] {
+				role = granted
+			}
+		}
+
+		if role == membership.Role {
+			continue
+		}
+		if membership.Role == domain.OrgRoleAdmin {
+			if err := u.ensureAnotherAdmin(orgID); errors.Is(err, domain.ErrLastOrgAdmin) {
+				continue
+			} else if err != nil {
+				return err
+			}
+		}
+		if err := u.organizationRepository.UpdateMembershipRole(userID, orgID, role); err != nil {
+			return err
+		}
+		if err := u.webhooks.Publish(domain.WebhookEventUserRoleChanged, roleChangedEvent(userID, orgID, membership.Role, role, "scim")); err != nil {
+			logrus.Warnf("Failed to publish role change of user %d: %v", userID, err)
+		}
+	}
+	return nil
+}
+
+func (u *SCIMUsecase) ensureAnotherAdmin(orgID int64) error {
+	admins, err := u.organizationRepository.CountMembersWithRole(orgID, domain.OrgRoleAdmin)
+	if err != nil {
+		return err
+	}
+	if admins <= 1 {
+		return domain.ErrLastOrgAdmin
+	}
+	return nil
+}
+
+// scimUserEmail picks the sign-in email from userName or, when userName is
+// not an address, the primary email. Of several candidates the first that
+// differs from current wins, so a PATCH to either attribute takes effect.
+func scimUserEmail(resource *domain.SCIMUser, current string) string {
+	var candidates []string
+	if strings.Contains(resource.UserName, "@") {
+		candidates = append(candidates, resource.UserName)
+	}
+	if email := primarySCIMValue(resource.Emails); strings.Contains(email, "@") {
+		candidates = append(candidates, email)
+	}
+	for i := range candidates {
+		candidates[i] = strings.ToLower(strings.TrimSpace(candidates[i]))
+	}
+	return changedValue(current, candidates)
+}
+
+// scimUserName picks the display name from name.givenName/familyName,
+// name.formatted or displayName, preferring whichever changed
+func scimUserName(resource *domain.SCIMUser, current string) string {
+	var candidates []string
+	if resource.Name != nil {
+		candidates = append(candidates,
+			strings.TrimSpace(resource.Name.GivenName+" "+resource.Name.FamilyName),
+			strings.TrimSpace(resource.Name.Formatted))
+	}
+	candidates = append(candidates, strings.TrimSpace(resource.DisplayName))
+
+	var nonEmpty []string
+	for _, candidate := range candidates {
+		if candidate != "" {
+			nonEmpty = append(nonEmpty, candidate)
+		}
+	}
+	return changedValue(current, nonEmpty)
+}
+
+// scimUserRole returns the organization role in the roles attribute, or
+// fallback when there is none
+func scimUserRole(resource *domain.SCIMUser, fallback string) (string, error) {
+	role := primarySCIMValue(resource.Roles)
+	if role == "" {
+		return fallback, nil
+	}
+	if !domain.IsValidOrgRole(role) {
+		return "", fmt.Errorf("%w: unknown role %q", domain.ErrSCIMInvalidValue, role)
+	}
+	return role, nil
+}
+
+func primarySCIMValue(values []domain.SCIMValue) string {
+	for _, value := range values {
+		if value.Primary {
+			return value.Value
+		}
+	}
+	if len(values) > 0 {
+		return values[0].Value
+	}
+	return ""
+}
+
+// changedValue returns the first candidate that differs from current, or
+// current when none do. No candidates at all yields "".
+func changedValue(current string, candidates []string) string {
+	if len(candidates) == 0 {
+		return ""
+	}
+	for _, candidate := range candidates {
+		if candidate != current {
+			return candidate
+		}
+	}
+	return current
+}
+
+// groupRole returns the organization role a group grants, matching its
+// display name against role names in singular or plural form
+func groupRole(displayName string) string {
+	name := strings.Trim(groupRoleInvalidChars.ReplaceAllString(strings.ToLower(displayName), "_"), "_")
+	for _, role := range []string{domain.OrgRoleAdmin, domain.OrgRoleSalesManager, domain.OrgRoleSalesRep, domain.OrgRoleClient} {
+		if name == role || name == role+"s" {
+			return role
+		}
+	}
+	return ""
+}
+
+func groupMemberIDs(members []domain.DirectoryGroupMember) []int64 {
+	ids := make([]int64, 0, len(members))
+	for _, member := range members {
+		ids = append(ids, member.UserID)
+	}
+	return ids
+}
+
+// directoryUserAttribute maps a SCIM User attribute path to the member
+// attribute it is stored as
+func directoryUserAttribute(attr string) (string, error) {
+	switch attr {
+	case "id":
+		return domain.DirectoryUserID, nil
+	case "username", "emails", "emails.value":
+		return domain.DirectoryUserEmail, nil
+	case "externalid":
+		return domain.DirectoryUserExternalID, nil
+	case "displayname", "name.formatted":
+		return domain.DirectoryUserName, nil
+	case "active":
+		return domain.DirectoryUserActive, nil
+	case "roles", "roles.value":
+		return domain.DirectoryUserRole, nil
+	}
+	return "", fmt.Errorf("%w: cannot filter on %q", domain.ErrSCIMInvalidFilter, attr)
+}
+
+func directoryGroupValues(group *domain.DirectoryGroup, attr string) ([]string, error) {
+	switch attr {
+	case "id":
+		return []string{strconv.FormatInt(group.ID, 10)}, nil
+	case "displayname":
+		return []string{group.DisplayName}, nil
+	case "externalid":
+		return []string{group.ExternalID}, nil
+	case "members", "members.value":
+		values := make([]string, 0, len(group.Members))
+		for _, id := range groupMemberIDs(group.Members) {
+			values = append(values, strconv.FormatInt(id, 10))
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("%w: cannot filter on %q", domain.ErrSCIMInvalidFilter, attr)
+}
+
+// scimPage returns the offset and size of the page starting at the 1-based
+// startIndex
+func scimPage(startIndex, count int) (offset, limit int) {
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > scimMaxPageSize {
+		count = scimMaxPageSize
+	}
+	return startIndex - 1, count
+}
+
+// scimPageBounds returns the slice bounds of the page starting at the
+// 1-based startIndex
+func scimPageBounds(total, startIndex, count int) (int, int) {
+	offset, limit := scimPage(startIndex, count)
+	if offset > total {
+		return total, total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	return offset, end
+}
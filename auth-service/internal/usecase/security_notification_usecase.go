@@ -0,0 +1,198 @@
+package usecase
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/repository"
+	"github.com/sales-tracker/auth-service/internal/service"
+)
+
+// SecurityNotificationUsecase emails users alerts about security-relevant
+// activity on their account and keeps track of the alerts they opted out of
+type SecurityNotificationUsecase struct {
+	notificationRepository repository.SecurityNotificationRepository
+	outboxRepository       repository.EmailOutboxRepository
+	auditLogger            service.AuditLogger
+}
+
+func NewSecurityNotificationUsecase(notificationRepository repository.SecurityNotificationRepository, outboxRepository repository.EmailOutboxRepository, auditLogger service.AuditLogger) *SecurityNotificationUsecase {
+	return &SecurityNotificationUsecase{
+		notificationRepository: notificationRepository,
+		outboxRepository:       outboxRepository,
+		auditLogger:            auditLogger,
+	}
+}
+
+// Preferences returns whether the user receives each security notification
+func (u *SecurityNotificationUsecase) Preferences(userID int64) ([]domain.SecurityNotificationPreference, error) {
+	optOuts, err := u.notificationRepository.ListOptOuts(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	optedOut := make(map[string]bool, len(optOuts))
+	for _, notification := range optOuts {
+		optedOut[notification] = true
+	}
+
+	notifications := make([]string, 0, len(domain.SecurityNotifications))
+	for notification := range domain.SecurityNotifications {
+		notifications = append(notifications, notification)
+	}
+	sort.Strings(notifications)
+
+	preferences := make([]domain.SecurityNotificationPreference, 0, len(notifications))
+	for _, notification := range notifications {
+		critical := domain.SecurityNotifications[notification]
+		preferences = append(preferences, domain.SecurityNotificationPreference{
+			Notification: notification,
+			Critical:     critical,
+			Enabled:      critical || !optedOut[notification],
+		})
+	}
+	return preferences, nil
+}
+
+// UpdatePreferences turns the notifications in enabled on or off for the
+// user. Notifications left out are unchanged; critical ones cannot be
+// turned off.
+func (u *SecurityNotificationUsecase) UpdatePreferences(info domain.RequestInfo, userID int64, enabled map[string]bool) (_ []domain.SecurityNotificationPreference, err error) {
+	defer func() {
+		metadata := make(map[string]interface{}, len(enabled))
+		for notification, on := range enabled {
+			metadata[notification] = on
+		}
+		recordAuditEvent(u.auditLogger, info, domain.AuditEventNotificationsUpdated, &userID, err, metadata)
+	}()
+
+	for notification, on := range enabled {
+		critical, ok := domain.SecurityNotifications[notification]
+		if !ok {
+			return nil, domain.ErrUnknownSecurityNotification
+		}
+		if critical && !on {
+			return nil, domain.ErrCriticalSecurityNotification
+		}
+	}
+
+	for notification, on := range enabled {
+		if domain.SecurityNotifications[notification] {
+			continue
+		}
+		if err := u.notificationRepository.SetOptOut(userID, notification, !on); err != nil {
+			return nil, err
+		}
+	}
+
+	return u.Preferences(userID)
+}
+
+// Notify queues notification for the user unless they opted out of it.
+// data adds to the request details every alert carries.
+func (u *SecurityNotificationUsecase) Notify(info domain.RequestInfo, user *domain.User, notification string, data map[string]interface{}) error {
+	critical, ok := domain.SecurityNotifications[notification]
+	if !ok {
+		return domain.ErrUnknownSecurityNotification
+	}
+	if !critical {
+		optedOut, err := u.notificationRepository.IsOptedOut(user.ID, notification)
+		if err != nil || optedOut {
+			return err
+		}
+	}
+	return u.outboxRepository.EnqueueEmail(securityAlert(info, user, notification, data))
+}
+
+// RecordLogin notes the device behind a successful login and alerts the
+// user when they have not logged in from it before. The first device
+// recorded for a user is not reported, as there is nothing to compare it to.
+func (u *SecurityNotificationUsecase) RecordLogin(info domain.RequestInfo, user *domain.User) error {
+	devices, err := u.notificationRepository.CountLoginDevices(user.ID)
+	if err != nil {
+		return err
+	}
+
+	known, err := u.notificationRepository.RecordLoginDevice(user.ID, describeUserAgent(info.UserAgent), time.Now())
+	if err != nil || known || devices == 0 {
+		return err
+	}
+	return u.Notify(info, user, domain.SecurityNotificationNewDeviceLogin, nil)
+}
+
+// LoginDevices returns the devices the user has logged in from, most
+// recently used first
+func (u *SecurityNotificationUsecase) LoginDevices(userID int64) ([]*domain.LoginDevice, error) {
+	return u.notificationRepository.ListLoginDevices(userID)
+}
+
+// securityAlert is the email alerting user to notification, giving the time
+// of the request and where it came from. Critical alerts are queued with it
+// directly, in the transaction making the change they report.
+func securityAlert(info domain.RequestInfo, user *domain.User, notification string, data map[string]interface{}) *domain.OutboxEmail {
+	values := map[string]interface{}{
+		"Event":  notification,
+		"IP":     info.IP,
+		"Device": describeUserAgent(info.UserAgent),
+		"Time":   time.Now().UTC().Format("2006-01-02 15:04 MST"),
+	}
+	for key, value := range data {
+		values[key] = value
+	}
+	return outboxEmail(user.Email, user.Locale, service.EmailTemplateSecurityAlert, values)
+}
+
+// userAgentBrowsers and userAgentSystems are matched in order, as user
+// agents also name the browsers and systems they claim compatibility with
+var (
+	userAgentBrowsers = []struct{ token, name string }{
+		{"Edg", "Edge"},
+		{"OPR/", "Opera"},
+		{"SamsungBrowser/", "Samsung Internet"},
+		{"Firefox/", "Firefox"},
+		{"FxiOS/", "Firefox"},
+		{"CriOS/", "Chrome"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+	}
+	userAgentSystems = []struct{ token, name string }{
+		{"Windows", "Windows"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Android", "Android"},
+		{"CrOS", "ChromeOS"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// describeUserAgent approximates the browser and operating system behind a
+// User-Agent header, such as "Chrome on Windows"
+func describeUserAgent(userAgent string) string {
+	browser := ""
+	for _, b := range userAgentBrowsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	system := ""
+	for _, s := range userAgentSystems {
+		if strings.Contains(userAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return "Unknown browser on " + system
+	}
+	return "Unknown device"
+}
@@ -1,7 +1,9 @@
 package usecase
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,6 +12,7 @@ import (
 
 	"github.com/sales-tracker/auth-service/internal/domain"
 	"github.com/sales-tracker/auth-service/internal/repository"
+	"github.com/sales-tracker/auth-service/internal/service"
 )
 
 // min returns the smaller of x or y
@@ -21,30 +24,138 @@ func min(x, y int) int {
 }
 
 type UserUsecase struct {
-	userRepository repository.UserRepository
+	userRepository               repository.UserRepository
+	auditRepository              repository.AuditRepository
+	oauthAuthorizationRepository repository.OAuthAuthorizationRepository
+	federatedIdentityRepository  repository.FederatedIdentityRepository
+	apiKeyRepository             repository.APIKeyRepository
+	authenticator                Authenticator
+	transactor                   repository.Transactor
+	emailLinks                   *service.EmailLinks
+	securityNotifications        *SecurityNotificationUsecase
+	webhooks                     *WebhookUsecase
+	auditLogger                  service.AuditLogger
 }
 
 type UserUsecaseInterface interface {
 	FindUserByEmail(email string) (*domain.User, error)
 	FindUserByResetToken(token string) (*domain.User, error)
-	RegisterUser(user *domain.User) error
-	GenerateResetToken(email string) (string, error)
-	ResetPassword(token, newPassword string) error
-	VerifyEmail(token string) error
-	ResendVerificationEmail(email string) (string, error)
+	Login(info domain.RequestInfo, email, password string) (*domain.User, error)
+	RegisterUser(info domain.RequestInfo, user *domain.User, hint domain.LinkHint) error
+	RequestPasswordReset(info domain.RequestInfo, email string, hint domain.LinkHint) error
+	ResetPassword(info domain.RequestInfo, token, newPassword string) error
+	VerifyEmail(info domain.RequestInfo, token string) error
+	ResendVerificationEmail(info domain.RequestInfo, email string, hint domain.LinkHint) error
+	RequestEmailChange(info domain.RequestInfo, userID int64, newEmail, password string, hint domain.LinkHint) error
+	ConfirmEmailChange(info domain.RequestInfo, token string) (*domain.User, error)
+	ScheduleAccountDeletion(info domain.RequestInfo, userID int64, password string, purgeAfter time.Time) (*domain.User, error)
+	CancelAccountDeletion(info domain.RequestInfo, userID int64) error
+	UpdateLocale(userID int64, locale string) error
+	RecordEmailDeliveryEvents(info domain.RequestInfo, events []domain.EmailDeliveryEvent) (int, error)
+	PurgeDeletedAccounts() (int64, error)
+	ExportUserData(info domain.RequestInfo, userID int64) (*domain.UserExport, error)
 }
 
 func (u *UserUsecase) FindUserByEmail(email string) (*domain.User, error) {
 	return u.userRepository.FindUserByEmail(email)
 }
 
-func NewUserUsecase(userRepository repository.UserRepository) *UserUsecase {
+func NewUserUsecase(userRepository repository.UserRepository, auditRepository repository.AuditRepository, oauthAuthorizationRepository repository.OAuthAuthorizationRepository, federatedIdentityRepository repository.FederatedIdentityRepository, apiKeyRepository repository.APIKeyRepository, authenticator Authenticator, transactor repository.Transactor, emailLinks *service.EmailLinks, securityNotifications *SecurityNotificationUsecase, webhooks *WebhookUsecase, auditLogger service.AuditLogger) *UserUsecase {
 	return &UserUsecase{
-		userRepository: userRepository,
+		userRepository:               userRepository,
+		auditRepository:              auditRepository,
+		oauthAuthorizationRepository: oauthAuthorizationRepository,
+		federatedIdentityRepository:  federatedIdentityRepository,
+		apiKeyRepository:             apiKeyRepository,
+		authenticator:                authenticator,
+		transactor:                   transactor,
+		emailLinks:                   emailLinks,
+		securityNotifications:        securityNotifications,
+		webhooks:                     webhooks,
+		auditLogger:                  auditLogger,
 	}
 }
 
-func (u *UserUsecase) RegisterUser(user *domain.User) error {
+func (u *UserUsecase) audit(info domain.RequestInfo, eventType string, subjectID *int64, err error, metadata map[string]interface{}) {
+	recordAuditEvent(u.auditLogger, info, eventType, subjectID, err, metadata)
+}
+
+// recordAuditEvent records the outcome of a usecase call. A nil err is a success.
+func recordAuditEvent(auditLogger service.AuditLogger, info domain.RequestInfo, eventType string, subjectID *int64, err error, metadata map[string]interface{}) {
+	event := &domain.AuditEvent{
+		EventType: eventType,
+		ActorID:   info.ActorID,
+		SubjectID: subjectID,
+		IP:        info.IP,
+		UserAgent: info.UserAgent,
+		Outcome:   domain.AuditOutcomeSuccess,
+		Metadata:  metadata,
+	}
+	if err != nil {
+		event.Outcome = domain.AuditOutcomeFailure
+		if event.Metadata == nil {
+			event.Metadata = map[string]interface{}{}
+		}
+		event.Metadata["error"] = err.Error()
+	}
+	auditLogger.Log(event)
+}
+
+// Login checks the user's credentials and account status. A login from a
+// device the user has not used before is reported to them, and failed
+// logins to webhook subscribers.
+func (u *UserUsecase) Login(info domain.RequestInfo, email, password string) (user *domain.User, err error) {
+	defer func() {
+		var subjectID *int64
+		if user != nil {
+			subjectID = &user.ID
+		}
+		u.audit(info, domain.AuditEventLogin, subjectID, err, map[string]interface{}{"email": email})
+		if err != nil {
+			if err := u.webhooks.Publish(domain.WebhookEventLoginFailed, loginFailedEvent(info, email, subjectID, "password", err)); err != nil {
+				logrus.Warnf("Failed to publish failed login of %s: %v", email, err)
+			}
+		}
+	}()
+
+	user, err = u.authenticator.Authenticate(email, password)
+	if err != nil {
+		return user, err
+	}
+
+	if !user.IsVerified {
+		return user, domain.ErrAccountNotVerified
+	}
+
+	if user.DeletedAt != nil {
+		return user, domain.ErrAccountDeleted
+	}
+
+	if !user.IsActive {
+		return user, domain.ErrAccountDisabled
+	}
+
+	if err := u.securityNotifications.RecordLogin(info, user); err != nil {
+		logrus.Warnf("Failed to record login device for user %d: %v", user.ID, err)
+	}
+	return user, nil
+}
+
+// RegisterUser creates the user and queues the email verifying their
+// address, whose link opens the page chosen by hint
+func (u *UserUsecase) RegisterUser(info domain.RequestInfo, user *domain.User, hint domain.LinkHint) (err error) {
+	defer func() {
+		var subjectID *int64
+		if user.ID != 0 {
+			subjectID = &user.ID
+		}
+		u.audit(info, domain.AuditEventUserRegistered, subjectID, err, map[string]interface{}{"role": user.Role})
+	}()
+
+	if err := u.emailLinks.Check(hint); err != nil {
+		return err
+	}
+
 	passwordHash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return err
@@ -52,54 +163,98 @@ func (u *UserUsecase) RegisterUser(user *domain.User) error {
 
 	user.PasswordHash = string(passwordHash)
 	user.Password = "" // Clear the plaintext password
-	return u.userRepository.CreateUser(user)
+
+	return u.transactor.WithinTransaction(func(repos repository.TxRepositories) error {
+		if err := repos.Users.CreateUser(user); err != nil {
+			return err
+		}
+		if err := enqueueWebhookEvent(repos.Webhooks, domain.WebhookEventUserCreated, userCreatedEvent(user, "signup")); err != nil {
+			return err
+		}
+		return repos.EmailOutbox.EnqueueEmail(outboxEmail(user.Email, user.Locale, service.EmailTemplateVerification, map[string]interface{}{
+			"URL": u.emailLinks.Verification(hint, user.VerificationToken),
+		}))
+	})
 }
 
-func (u *UserUsecase) GenerateResetToken(email string) (string, error) {
+// RequestPasswordReset issues a reset token for the user with email and
+// queues the email with the reset link, which opens the page chosen by hint
+func (u *UserUsecase) RequestPasswordReset(info domain.RequestInfo, email string, hint domain.LinkHint) (err error) {
+	var subjectID *int64
+	defer func() {
+		u.audit(info, domain.AuditEventPasswordResetRequested, subjectID, err, map[string]interface{}{"email": email})
+	}()
+
+	if err := u.emailLinks.Check(hint); err != nil {
+		return err
+	}
+
 	user, err := u.userRepository.FindUserByEmail(email)
 	if err != nil {
-		return "", err
+		return err
 	}
+	subjectID = &user.ID
 
 	resetToken := uuid.New().String()
 	resetTokenExpiration := time.Now().Add(24 * time.Hour)
 
 	user.ResetToken = resetToken
 	user.ResetTokenExpiresAt = resetTokenExpiration
-	if err := u.userRepository.UpdateUser(user); err != nil {
-		return "", err
-	}
-
-	return resetToken, nil
+	return u.transactor.WithinTransaction(func(repos repository.TxRepositories) error {
+		if err := repos.Users.UpdateUser(user); err != nil {
+			return err
+		}
+		return repos.EmailOutbox.EnqueueEmail(outboxEmail(user.Email, user.Locale, service.EmailTemplatePasswordReset, map[string]interface{}{
+			"URL": u.emailLinks.PasswordReset(hint, resetToken),
+		}))
+	})
 }
 
-func (u *UserUsecase) VerifyEmail(token string) error {
+func (u *UserUsecase) VerifyEmail(info domain.RequestInfo, token string) (err error) {
+	var subjectID *int64
+	defer func() {
+		u.audit(info, domain.AuditEventEmailVerified, subjectID, err, nil)
+	}()
+
 	// Find the user by verification token
 	user, err := u.userRepository.FindUserByVerificationToken(token)
 	if err != nil {
 		return err
 	}
-
-	// Update the user's verification status
-	err = u.userRepository.UpdateUserVerificationStatus(user.ID, true)
-	if err != nil {
-		return err
-	}
+	subjectID = &user.ID
 
 	// Clear the verification token
+	user.IsVerified = true
 	user.VerificationToken = ""
-	return u.userRepository.UpdateUser(user)
+	return u.transactor.WithinTransaction(func(repos repository.TxRepositories) error {
+		// Update the user's verification status
+		if err := repos.Users.UpdateUserVerificationStatus(user.ID, true); err != nil {
+			return err
+		}
+		if err := repos.Users.UpdateUser(user); err != nil {
+			return err
+		}
+		return enqueueWebhookEvent(repos.Webhooks, domain.WebhookEventUserVerified, map[string]interface{}{
+			"user": webhookUser(user),
+		})
+	})
 }
 
 func (u *UserUsecase) FindUserByResetToken(token string) (*domain.User, error) {
 	return u.userRepository.FindUserByResetToken(token)
 }
 
-func (u *UserUsecase) ResetPassword(token, newPassword string) error {
+func (u *UserUsecase) ResetPassword(info domain.RequestInfo, token, newPassword string) (err error) {
+	var subjectID *int64
+	defer func() {
+		u.audit(info, domain.AuditEventPasswordReset, subjectID, err, nil)
+	}()
+
 	user, err := u.userRepository.FindUserByResetToken(token)
 	if err != nil {
 		return fmt.Errorf("invalid reset token: %w", err)
 	}
+	subjectID = &user.ID
 
 	if user.ResetTokenExpiresAt.Before(time.Now()) {
 		return domain.ErrExpiredResetToken
@@ -111,7 +266,7 @@ func (u *UserUsecase) ResetPassword(token, newPassword string) error {
 	}
 
 	// Log the password before hashing (for debugging only - remove in production)
-	logrus.Debugf("Resetting password for user %s (email: %s)", user.ID, user.Email)
+	logrus.Debugf("Resetting password for user %d (email: %s)", user.ID, user.Email)
 	logrus.Debugf("New password (before hashing): %s", newPassword)
 
 	// Generate new password hash
@@ -138,34 +293,340 @@ func (u *UserUsecase) ResetPassword(token, newPassword string) error {
 		return fmt.Errorf("failed to verify new password: %w", err)
 	}
 
-	// Save the updated user
-	if err := u.userRepository.UpdateUser(user); err != nil {
+	// Save the updated user and alert them to the reset
+	err = u.transactor.WithinTransaction(func(repos repository.TxRepositories) error {
+		if err := repos.Users.UpdateUser(user); err != nil {
+			return err
+		}
+		return repos.EmailOutbox.EnqueueEmail(securityAlert(info, user, domain.SecurityNotificationPasswordReset, nil))
+	})
+	if err != nil {
 		logrus.Errorf("Failed to update user after password reset: %v", err)
 		return fmt.Errorf("failed to update user: %w", err)
 	}
 	println(user)
 
-	logrus.Infof("Successfully reset password for user %s (email: %s)", user.ID, user.Email)
+	logrus.Infof("Successfully reset password for user %d (email: %s)", user.ID, user.Email)
 	return nil
 }
 
-func (u *UserUsecase) ResendVerificationEmail(email string) (string, error) {
+// ResendVerificationEmail issues a new verification token for an unverified
+// user and queues the email with the new link
+func (u *UserUsecase) ResendVerificationEmail(info domain.RequestInfo, email string, hint domain.LinkHint) (err error) {
+	var subjectID *int64
+	defer func() {
+		u.audit(info, domain.AuditEventVerificationResent, subjectID, err, map[string]interface{}{"email": email})
+	}()
+
+	if err := u.emailLinks.Check(hint); err != nil {
+		return err
+	}
+
 	user, err := u.userRepository.FindUserByEmail(email)
 	if err != nil {
-		return "", err
+		return err
 	}
+	subjectID = &user.ID
 
 	if user.IsVerified {
-		return "", fmt.Errorf("email already verified")
+		return fmt.Errorf("email already verified")
 	}
 
 	// Generate a new verification token
 	token := uuid.New().String()
 	user.VerificationToken = token
 
-	if err := u.userRepository.UpdateUser(user); err != nil {
-		return "", err
+	return u.transactor.WithinTransaction(func(repos repository.TxRepositories) error {
+		if err := repos.Users.UpdateUser(user); err != nil {
+			return err
+		}
+		return repos.EmailOutbox.EnqueueEmail(outboxEmail(user.Email, user.Locale, service.EmailTemplateVerification, map[string]interface{}{
+			"URL": u.emailLinks.Verification(hint, token),
+		}))
+	})
+}
+
+// checkPassword re-checks the password of a signed-in user with the same
+// authenticator they log in through
+func checkPassword(authenticator Authenticator, user *domain.User, password string) error {
+	authenticated, err := authenticator.Authenticate(user.Email, password)
+	if err != nil {
+		if errors.Is(err, domain.ErrDirectoryUnavailable) {
+			return err
+		}
+		return domain.ErrInvalidCredentials
+	}
+	if authenticated.ID != user.ID {
+		return domain.ErrInvalidCredentials
+	}
+	return nil
+}
+
+// RequestEmailChange re-checks the user's password and stores newEmail as a
+// pending address. The new address is sent the link that confirms the
+// change and the current address a notice that it was requested.
+func (u *UserUsecase) RequestEmailChange(info domain.RequestInfo, userID int64, newEmail, password string, hint domain.LinkHint) (err error) {
+	defer func() {
+		u.audit(info, domain.AuditEventEmailChangeRequested, &userID, err, map[string]interface{}{"new_email": newEmail})
+	}()
+
+	if err := u.emailLinks.Check(hint); err != nil {
+		return err
+	}
+
+	user, err := u.userRepository.FindUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := checkPassword(u.authenticator, user, password); err != nil {
+		return err
+	}
+
+	if strings.EqualFold(user.Email, newEmail) {
+		return fmt.Errorf("new email must be different from the current email")
+	}
+
+	if existing, err := u.userRepository.FindUserByEmail(newEmail); err == nil && existing != nil {
+		return domain.ErrEmailAlreadyInUse
+	}
+
+	token := uuid.New().String()
+	return u.transactor.WithinTransaction(func(repos repository.TxRepositories) error {
+		if err := repos.Users.SetPendingEmail(user.ID, newEmail, token, time.Now().Add(24*time.Hour)); err != nil {
+			return err
+		}
+		err := repos.EmailOutbox.EnqueueEmail(outboxEmail(newEmail, user.Locale, service.EmailTemplateEmailChangeConfirmation, map[string]interface{}{
+			"URL": u.emailLinks.EmailChange(hint, token),
+		}))
+		if err != nil {
+			return err
+		}
+		return repos.EmailOutbox.EnqueueEmail(outboxEmail(user.Email, user.Locale, service.EmailTemplateEmailChangeNotice, map[string]interface{}{
+			"NewEmail": newEmail,
+		}))
+	})
+}
+
+// ConfirmEmailChange swaps in the pending email for the user holding token
+// and alerts the previous address to the change. It returns the user with
+// the previous email still set in Email.
+func (u *UserUsecase) ConfirmEmailChange(info domain.RequestInfo, token string) (_ *domain.User, err error) {
+	var subjectID *int64
+	metadata := map[string]interface{}{}
+	defer func() {
+		u.audit(info, domain.AuditEventEmailChanged, subjectID, err, metadata)
+	}()
+
+	user, err := u.userRepository.FindUserByEmailChangeToken(token)
+	if err != nil {
+		return nil, domain.ErrInvalidEmailChangeToken
+	}
+	subjectID = &user.ID
+	metadata["old_email"] = user.Email
+	metadata["new_email"] = user.PendingEmail
+
+	if user.PendingEmail == "" {
+		return nil, domain.ErrInvalidEmailChangeToken
+	}
+
+	if user.EmailChangeExpiresAt.Before(time.Now()) {
+		return nil, domain.ErrExpiredEmailChangeToken
+	}
+
+	err = u.transactor.WithinTransaction(func(repos repository.TxRepositories) error {
+		if err := repos.Users.ConfirmEmailChange(user.ID, user.PendingEmail); err != nil {
+			return err
+		}
+		return repos.EmailOutbox.EnqueueEmail(securityAlert(info, user, domain.SecurityNotificationEmailChanged, map[string]interface{}{
+			"NewEmail": user.PendingEmail,
+		}))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Infof("Changed email for user %d from %s to %s", user.ID, user.Email, user.PendingEmail)
+	return user, nil
+}
+
+// ScheduleAccountDeletion re-checks the user's password and soft deletes the
+// account. Personal data is anonymized by PurgeDeletedAccounts once
+// purgeAfter has passed.
+func (u *UserUsecase) ScheduleAccountDeletion(info domain.RequestInfo, userID int64, password string, purgeAfter time.Time) (_ *domain.User, err error) {
+	defer func() {
+		u.audit(info, domain.AuditEventAccountDeletionScheduled, &userID, err, map[string]interface{}{"purge_after": purgeAfter})
+	}()
+
+	user, err := u.userRepository.FindUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkPassword(u.authenticator, user, password); err != nil {
+		return nil, err
+	}
+
+	if user.DeletedAt != nil {
+		return nil, domain.ErrAccountDeleted
+	}
+
+	now := time.Now()
+	if err := u.userRepository.ScheduleUserDeletion(user.ID, now, purgeAfter); err != nil {
+		return nil, err
+	}
+
+	user.DeletedAt = &now
+	user.PurgeAfter = &purgeAfter
+	logrus.Infof("Scheduled deletion of user %d, purge after %s", user.ID, purgeAfter.Format(time.RFC3339))
+	return user, nil
+}
+
+// CancelAccountDeletion restores a soft-deleted account during its grace period
+func (u *UserUsecase) CancelAccountDeletion(info domain.RequestInfo, userID int64) error {
+	err := u.userRepository.CancelUserDeletion(userID)
+	u.audit(info, domain.AuditEventAccountDeletionCancelled, &userID, err, nil)
+	return err
+}
+
+// UpdateLocale sets the language the user's emails are written in
+func (u *UserUsecase) UpdateLocale(userID int64, locale string) error {
+	return u.userRepository.SetUserLocale(userID, locale)
+}
+
+// RecordEmailDeliveryEvents marks the accounts whose address a provider
+// reported as hard bouncing or complaining, and returns how many were newly
+// marked. Addresses without an account, such as invitees, are skipped.
+func (u *UserUsecase) RecordEmailDeliveryEvents(info domain.RequestInfo, events []domain.EmailDeliveryEvent) (int, error) {
+	marked := 0
+	for _, event := range events {
+		user, err := u.userRepository.FindUserByEmail(event.Address)
+		if err != nil || user.EmailUndeliverableAt != nil {
+			continue
+		}
+
+		reason := event.Type
+		if event.Reason != "" {
+			reason += ": " + event.Reason
+		}
+		occurredAt := event.OccurredAt
+		if occurredAt.IsZero() {
+			occurredAt = time.Now()
+		}
+
+		err = u.userRepository.MarkEmailUndeliverable(user.ID, reason, occurredAt)
+		u.audit(info, domain.AuditEventEmailUndeliverable, &user.ID, err, map[string]interface{}{
+			"type":   event.Type,
+			"reason": event.Reason,
+		})
+		if err != nil {
+			return marked, err
+		}
+		marked++
+	}
+	return marked, nil
+}
+
+// PurgeDeletedAccounts anonymizes accounts whose deletion grace period has
+// ended, along with the webhook events and audit events about them. Only
+// then are they reported deleted to webhook subscribers, as until then the
+// deletion can be cancelled.
+func (u *UserUsecase) PurgeDeletedAccounts() (purged int64, err error) {
+	err = u.transactor.WithinTransaction(func(repos repository.TxRepositories) error {
+		now := time.Now()
+		users, err := repos.Users.AnonymizeDeletedUsers(now)
+		if err != nil {
+			return err
+		}
+		userIDs := make([]int64, 0, len(users))
+		for _, user := range users {
+			if err := repos.Audit.RedactUserEvents(user.ID, user.FormerAddresses, user.Email, now); err != nil {
+				return err
+			}
+			userIDs = append(userIDs, user.ID)
+		}
+		// Redact before the user.deleted events below are queued
+		if err := repos.Webhooks.RedactUserDeliveries(userIDs, now); err != nil {
+			return err
+		}
+		for _, userID := range userIDs {
+			if err := enqueueWebhookEvent(repos.Webhooks, domain.WebhookEventUserDeleted, map[string]interface{}{
+				"user": map[string]interface{}{"id": userID},
+			}); err != nil {
+				return err
+			}
+		}
+		purged = int64(len(users))
+		return nil
+	})
+	if err != nil {
+		purged = 0
+	}
+	if err != nil || purged > 0 {
+		u.audit(domain.RequestInfo{}, domain.AuditEventAccountsPurged, nil, err, map[string]interface{}{"count": purged})
+	}
+	return purged, err
+}
+
+// ExportUserData collects everything stored about the user for data portability
+func (u *UserUsecase) ExportUserData(info domain.RequestInfo, userID int64) (_ *domain.UserExport, err error) {
+	defer func() {
+		u.audit(info, domain.AuditEventDataExported, &userID, err, nil)
+	}()
+
+	user, err := u.userRepository.FindUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect every audit event about the user, following the cursor
+	var auditEvents []*domain.AuditEvent
+	filter := domain.AuditEventFilter{SubjectID: &userID, Limit: 500}
+	for {
+		events, err := u.auditRepository.ListEvents(filter)
+		if err != nil {
+			return nil, err
+		}
+		auditEvents = append(auditEvents, events...)
+		if len(events) < filter.Limit {
+			break
+		}
+		filter.Cursor = events[len(events)-1].ID
+	}
+
+	consents, err := u.oauthAuthorizationRepository.ListConsentsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	identities, err := u.federatedIdentityRepository.ListIdentitiesByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := u.securityNotifications.LoginDevices(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKeys, err := u.apiKeyRepository.ListAPIKeysByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	preferences, err := u.securityNotifications.Preferences(userID)
+	if err != nil {
+		return nil, err
 	}
 
-	return token, nil
+	return &domain.UserExport{
+		ExportedAt:              time.Now().UTC(),
+		Profile:                 user,
+		AuditEvents:             auditEvents,
+		OAuthConsents:           consents,
+		Identities:              identities,
+		LoginDevices:            devices,
+		APIKeys:                 apiKeys,
+		NotificationPreferences: preferences,
+	}, nil
 }
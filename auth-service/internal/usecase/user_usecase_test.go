@@ -0,0 +1,72 @@
+package usecase
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/repository"
+)
+
+type fakeAuditRepository struct {
+	repository.AuditRepository
+}
+
+func (fakeAuditRepository) ListEvents(filter domain.AuditEventFilter) ([]*domain.AuditEvent, error) {
+	return nil, nil
+}
+
+type fakeAPIKeyRepository struct {
+	repository.APIKeyRepository
+	keys []*domain.APIKey
+}
+
+func (r *fakeAPIKeyRepository) CreateAPIKey(key *domain.APIKey) error {
+	key.ID = int64(len(r.keys) + 1)
+	r.keys = append(r.keys, key)
+	return nil
+}
+
+func (r *fakeAPIKeyRepository) ListAPIKeysByUser(userID int64) ([]*domain.APIKey, error) {
+	var keys []*domain.APIKey
+	for _, key := range r.keys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func TestExportUserData(t *testing.T) {
+	users := &fakeUserRepository{}
+	user := &domain.User{Email: "ana@example.com", IsVerified: true}
+	users.CreateUser(user)
+
+	now := time.Now()
+	devices := []*domain.LoginDevice{{Device: "Firefox on Linux", FirstSeenAt: now, LastSeenAt: now}}
+	apiKeys := &fakeAPIKeyRepository{keys: []*domain.APIKey{
+		{ID: 1, UserID: user.ID, Name: "CRM sync", Prefix: "stk_abc"},
+		{ID: 2, UserID: user.ID + 1, Name: "someone else's"},
+	}}
+	auditLogger := discardAuditLogger{}
+	userUsecase := NewUserUsecase(users, fakeAuditRepository{}, fakeOAuthAuthorizationRepository{}, &fakeFederatedIdentityRepository{}, apiKeys, nil, nil, nil,
+		NewSecurityNotificationUsecase(fakeSecurityNotificationRepository{devices: devices}, nil, auditLogger),
+		NewWebhookUsecase(&fakeWebhookRepository{}, auditLogger), auditLogger)
+
+	export, err := userUsecase.ExportUserData(domain.RequestInfo{}, user.ID)
+	if err != nil {
+		t.Fatalf("ExportUserData: %v", err)
+	}
+	if export.Profile.ID != user.ID {
+		t.Errorf("profile = %+v", export.Profile)
+	}
+	if len(export.LoginDevices) != 1 || export.LoginDevices[0].Device != devices[0].Device {
+		t.Errorf("login devices = %+v", export.LoginDevices)
+	}
+	if len(export.APIKeys) != 1 || export.APIKeys[0].ID != 1 {
+		t.Errorf("API keys = %+v", export.APIKeys)
+	}
+	if len(export.NotificationPreferences) != len(domain.SecurityNotifications) {
+		t.Errorf("notification preferences = %+v", export.NotificationPreferences)
+	}
+}
@@ -0,0 +1,341 @@
+package usecase
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sales-tracker/auth-service/internal/domain"
+	"github.com/sales-tracker/auth-service/internal/repository"
+	"github.com/sales-tracker/auth-service/internal/service"
+)
+
+const (
+	webhookSecretBytes  = 32
+	webhookEventIDBytes = 16
+
+	defaultWebhookDeliveryPageSize = 50
+	maxWebhookDeliveryPageSize     = 200
+)
+
+// webhookSecretPrefix marks webhook signing secrets so they are easy to tell
+// apart from other credentials
+const webhookSecretPrefix = "whsec_"
+
+// WebhookUsecase manages the webhooks external services subscribe with and
+// publishes auth events to them
+type WebhookUsecase struct {
+	webhookRepository repository.WebhookRepository
+	auditLogger       service.AuditLogger
+}
+
+func NewWebhookUsecase(webhookRepository repository.WebhookRepository, auditLogger service.AuditLogger) *WebhookUsecase {
+	return &WebhookUsecase{
+		webhookRepository: webhookRepository,
+		auditLogger:       auditLogger,
+	}
+}
+
+func (u *WebhookUsecase) audit(info domain.RequestInfo, eventType string, err error, metadata map[string]interface{}) {
+	recordAuditEvent(u.auditLogger, info, eventType, nil, err, metadata)
+}
+
+// CreateWebhook subscribes a URL to events. The signing secret is returned
+// once; deliveries are signed with it from then on.
+func (u *WebhookUsecase) CreateWebhook(info domain.RequestInfo, createdBy int64, req domain.WebhookCreate) (webhook *domain.Webhook, _ string, err error) {
+	defer func() {
+		metadata := map[string]interface{}{"url": req.URL, "events": req.Events}
+		if webhook != nil {
+			metadata["webhook_id"] = webhook.ID
+		}
+		u.audit(info, domain.AuditEventWebhookCreated, err, metadata)
+	}()
+
+	webhook = &domain.Webhook{
+		URL:         strings.TrimSpace(req.URL),
+		Description: strings.TrimSpace(req.Description),
+		Events:      req.Events,
+		Active:      true,
+		CreatedBy:   &createdBy,
+	}
+	if err := normalizeWebhook(webhook); err != nil {
+		return nil, "", err
+	}
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	webhook.Secret = secret
+
+	if err := u.webhookRepository.CreateWebhook(webhook); err != nil {
+		return nil, "", err
+	}
+	return webhook, secret, nil
+}
+
+func (u *WebhookUsecase) ListWebhooks() ([]*domain.Webhook, error) {
+	return u.webhookRepository.ListWebhooks()
+}
+
+func (u *WebhookUsecase) FindWebhook(webhookID int64) (*domain.Webhook, error) {
+	return u.webhookRepository.FindWebhookByID(webhookID)
+}
+
+// UpdateWebhook changes the webhook's URL, description, events or whether
+// it is active. Deliveries queued while a webhook is inactive wait for it to
+// be activated again.
+func (u *WebhookUsecase) UpdateWebhook(info domain.RequestInfo, webhookID int64, req domain.WebhookUpdate) (webhook *domain.Webhook, err error) {
+	defer func() {
+		metadata := map[string]interface{}{"webhook_id": webhookID}
+		if req.URL != nil {
+			metadata["url"] = *req.URL
+		}
+		if req.Events != nil {
+			metadata["events"] = req.Events
+		}
+		if req.Active != nil {
+			metadata["active"] = *req.Active
+		}
+		u.audit(info, domain.AuditEventWebhookUpdated, err, metadata)
+	}()
+
+	webhook, err = u.webhookRepository.FindWebhookByID(webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.URL != nil {
+		webhook.URL = strings.TrimSpace(*req.URL)
+	}
+	if req.Description != nil {
+		webhook.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Events != nil {
+		webhook.Events = req.Events
+	}
+	if req.Active != nil {
+		webhook.Active = *req.Active
+	}
+	if err := normalizeWebhook(webhook); err != nil {
+		return nil, err
+	}
+
+	if err := u.webhookRepository.UpdateWebhook(webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+// DeleteWebhook unsubscribes the webhook, dropping its delivery log
+func (u *WebhookUsecase) DeleteWebhook(info domain.RequestInfo, webhookID int64) (err error) {
+	defer func() {
+		u.audit(info, domain.AuditEventWebhookDeleted, err, map[string]interface{}{"webhook_id": webhookID})
+	}()
+
+	return u.webhookRepository.DeleteWebhook(webhookID)
+}
+
+// RotateWebhookSecret replaces the webhook's signing secret. Deliveries are
+// signed with the new secret from their next attempt on.
+func (u *WebhookUsecase) RotateWebhookSecret(info domain.RequestInfo, webhookID int64) (_ string, err error) {
+	defer func() {
+		u.audit(info, domain.AuditEventWebhookSecretRotated, err, map[string]interface{}{"webhook_id": webhookID})
+	}()
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		return "", err
+	}
+	if err := u.webhookRepository.RotateWebhookSecret(webhookID, secret); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// ListDeliveries returns one page of the webhook's deliveries matching
+// filter, newest first, along with the cursor for the next page ("" when
+// there are no more)
+func (u *WebhookUsecase) ListDeliveries(filter domain.WebhookDeliveryFilter) ([]*domain.WebhookDelivery, string, error) {
+	if _, err := u.webhookRepository.FindWebhookByID(filter.WebhookID); err != nil {
+		return nil, "", err
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultWebhookDeliveryPageSize
+	}
+	if filter.Limit > maxWebhookDeliveryPageSize {
+		filter.Limit = maxWebhookDeliveryPageSize
+	}
+
+	// Fetch one extra row to find out whether another page exists
+	pageSize := filter.Limit
+	filter.Limit++
+
+	deliveries, err := u.webhookRepository.ListDeliveries(filter)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if len(deliveries) > pageSize {
+		deliveries = deliveries[:pageSize]
+		nextCursor = strconv.FormatInt(deliveries[pageSize-1].ID, 10)
+	}
+
+	return deliveries, nextCursor, nil
+}
+
+// FindDelivery returns one of the webhook's deliveries with the log of its
+// attempts
+func (u *WebhookUsecase) FindDelivery(webhookID, deliveryID int64) (*domain.WebhookDelivery, error) {
+	delivery, err := u.webhookRepository.FindDeliveryByID(deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if delivery.WebhookID != webhookID {
+		return nil, domain.ErrWebhookDeliveryNotFound
+	}
+
+	delivery.AttemptLog, err = u.webhookRepository.ListDeliveryAttempts(deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// ReplayDelivery sends the event of one of the webhook's deliveries again,
+// whatever became of it, as a new delivery with a fresh set of attempts
+func (u *WebhookUsecase) ReplayDelivery(info domain.RequestInfo, webhookID, deliveryID int64) (replay *domain.WebhookDelivery, err error) {
+	defer func() {
+		metadata := map[string]interface{}{"webhook_id": webhookID, "delivery_id": deliveryID}
+		if replay != nil {
+			metadata["replay_id"] = replay.ID
+		}
+		u.audit(info, domain.AuditEventWebhookReplayed, err, metadata)
+	}()
+
+	delivery, err := u.webhookRepository.FindDeliveryByID(deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if delivery.WebhookID != webhookID {
+		return nil, domain.ErrWebhookDeliveryNotFound
+	}
+
+	return u.webhookRepository.ReplayDelivery(deliveryID, time.Now())
+}
+
+// Publish queues eventType for the webhooks subscribed to it. Changes made
+// in a transaction queue their event through enqueueWebhookEvent instead,
+// so it is only sent if the change commits.
+func (u *WebhookUsecase) Publish(eventType string, data map[string]interface{}) error {
+	return enqueueWebhookEvent(u.webhookRepository, eventType, data)
+}
+
+// enqueueWebhookEvent queues a new event of eventType carrying data through
+// webhookRepository
+func enqueueWebhookEvent(webhookRepository repository.WebhookRepository, eventType string, data map[string]interface{}) error {
+	id, err := randomURLToken(webhookEventIDBytes)
+	if err != nil {
+		return err
+	}
+
+	_, err = webhookRepository.EnqueueWebhookEvent(&domain.WebhookEvent{
+		ID:        "evt_" + id,
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	return err
+}
+
+// webhookUser is how events describe the user they are about
+func webhookUser(user *domain.User) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          user.ID,
+		"email":       user.Email,
+		"name":        user.Name,
+		"role":        user.Role,
+		"is_verified": user.IsVerified,
+		"created_at":  user.CreatedAt,
+	}
+}
+
+// userCreatedEvent is the data of a user.created event. source is how the
+// account came to be: "signup", "invitation", "scim", "ldap", "oidc" or
+// "saml".
+func userCreatedEvent(user *domain.User, source string) map[string]interface{} {
+	return map[string]interface{}{
+		"user":   webhookUser(user),
+		"source": source,
+	}
+}
+
+// roleChangedEvent is the data of a user.role_changed event. source is what
+// changed the role: "admin", "scim", "ldap" or "saml".
+func roleChangedEvent(userID, orgID int64, previousRole, role, source string) map[string]interface{} {
+	return map[string]interface{}{
+		"user":          map[string]interface{}{"id": userID},
+		"org_id":        orgID,
+		"role":          role,
+		"previous_role": previousRole,
+		"source":        source,
+	}
+}
+
+// loginFailedEvent is the data of a login.failed event. userID is nil when
+// the attempt matches no account; method is the step that failed,
+// "password" or the second factor, which knows the user but not the email.
+func loginFailedEvent(info domain.RequestInfo, email string, userID *int64, method string, err error) map[string]interface{} {
+	data := map[string]interface{}{
+		"method":     method,
+		"reason":     err.Error(),
+		"ip":         info.IP,
+		"user_agent": info.UserAgent,
+	}
+	if email != "" {
+		data["email"] = email
+	}
+	if userID != nil {
+		data["user_id"] = *userID
+	}
+	return data
+}
+
+// normalizeWebhook checks the webhook's URL and sorts out its events,
+// dropping duplicates. Payloads carry personal data, so they are only sent
+// over https; the dispatcher refuses private addresses.
+func normalizeWebhook(webhook *domain.Webhook) error {
+	parsed, err := url.Parse(webhook.URL)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" || parsed.User != nil {
+		return domain.ErrInvalidWebhookURL
+	}
+
+	seen := make(map[string]bool, len(webhook.Events))
+	events := make([]string, 0, len(webhook.Events))
+	for _, event := range webhook.Events {
+		event = strings.TrimSpace(event)
+		if event != domain.WebhookEventAll && !domain.IsWebhookEvent(event) {
+			return domain.ErrUnknownWebhookEvent
+		}
+		if !seen[event] {
+			seen[event] = true
+			events = append(events, event)
+		}
+	}
+	if len(events) == 0 {
+		return domain.ErrNoWebhookEvents
+	}
+	webhook.Events = events
+	return nil
+}
+
+func generateWebhookSecret() (string, error) {
+	secret, err := randomURLToken(webhookSecretBytes)
+	if err != nil {
+		return "", err
+	}
+	return webhookSecretPrefix + secret, nil
+}
@@ -0,0 +1,8 @@
+-- Add pending email change columns to users table
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS pending_email VARCHAR(255),
+ADD COLUMN IF NOT EXISTS email_change_token VARCHAR(255),
+ADD COLUMN IF NOT EXISTS email_change_token_expires_at TIMESTAMP WITH TIME ZONE;
+
+-- Create an index for faster lookups
+CREATE INDEX IF NOT EXISTS idx_users_email_change_token ON users(email_change_token);
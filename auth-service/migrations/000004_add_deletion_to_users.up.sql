@@ -0,0 +1,8 @@
+-- Add soft delete columns to users table
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN IF NOT EXISTS purge_after TIMESTAMP WITH TIME ZONE,
+ADD COLUMN IF NOT EXISTS anonymized_at TIMESTAMP WITH TIME ZONE;
+
+-- Create an index for the purge job
+CREATE INDEX IF NOT EXISTS idx_users_purge_after ON users(purge_after) WHERE anonymized_at IS NULL;
@@ -0,0 +1,7 @@
+-- Link every audit event to its predecessor. Events written before this
+-- migration have no hash and are reported as unchained by the verifier.
+ALTER TABLE audit_events
+ADD COLUMN IF NOT EXISTS prev_hash VARCHAR(64),
+ADD COLUMN IF NOT EXISTS hash VARCHAR(64);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_audit_events_hash ON audit_events(hash);
@@ -0,0 +1,6 @@
+-- Each membership can point at the member's manager within the same organization
+ALTER TABLE memberships
+ADD COLUMN IF NOT EXISTS manager_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+-- Create an index for walking the reporting hierarchy
+CREATE INDEX IF NOT EXISTS idx_memberships_org_manager ON memberships(org_id, manager_id);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id SERIAL PRIMARY KEY,
+    client_id VARCHAR(64) UNIQUE NOT NULL,
+    client_secret_hash VARCHAR(255) NOT NULL,
+    previous_secret_hash VARCHAR(255),
+    previous_secret_expires_at TIMESTAMP WITH TIME ZONE,
+    name VARCHAR(255) NOT NULL,
+    org_id INTEGER REFERENCES organizations(id) ON DELETE CASCADE,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    secret_rotated_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
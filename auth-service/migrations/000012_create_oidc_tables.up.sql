@@ -0,0 +1,36 @@
+-- Clients can now use the authorization code flow. Public clients (SPAs,
+-- mobile apps) have no secret and must use PKCE.
+ALTER TABLE oauth_clients
+ADD COLUMN IF NOT EXISTS client_type VARCHAR(20) NOT NULL DEFAULT 'confidential',
+ADD COLUMN IF NOT EXISTS redirect_uris TEXT[] NOT NULL DEFAULT '{}',
+ADD COLUMN IF NOT EXISTS grant_types TEXT[] NOT NULL DEFAULT '{client_credentials}';
+
+ALTER TABLE oauth_clients ALTER COLUMN client_secret_hash DROP NOT NULL;
+
+-- Authorization codes are single use; only a SHA-256 of the code is stored
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes (
+    code_hash VARCHAR(64) PRIMARY KEY,
+    client_id VARCHAR(64) NOT NULL REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    nonce TEXT,
+    code_challenge VARCHAR(128) NOT NULL,
+    code_challenge_method VARCHAR(10) NOT NULL,
+    auth_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    consumed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_oauth_authorization_codes_expires_at ON oauth_authorization_codes(expires_at);
+
+-- The scopes each user has agreed to share with each client
+CREATE TABLE IF NOT EXISTS oauth_consents (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_id VARCHAR(64) NOT NULL REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, client_id)
+);
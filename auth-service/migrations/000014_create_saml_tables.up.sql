@@ -0,0 +1,32 @@
+-- Per-organization SAML 2.0 identity provider configuration
+CREATE TABLE IF NOT EXISTS saml_configs (
+    org_id INTEGER PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+    idp_entity_id TEXT NOT NULL,
+    idp_sso_url TEXT NOT NULL,
+    idp_certificates TEXT[] NOT NULL DEFAULT '{}',
+    email_attribute VARCHAR(255) NOT NULL DEFAULT '',
+    name_attribute VARCHAR(255) NOT NULL DEFAULT '',
+    role_attribute VARCHAR(255) NOT NULL DEFAULT '',
+    role_mapping JSONB NOT NULL DEFAULT '{}',
+    default_role VARCHAR(50) NOT NULL DEFAULT 'client',
+    jit_provisioning BOOLEAN NOT NULL DEFAULT false,
+    allow_idp_initiated BOOLEAN NOT NULL DEFAULT false,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Outstanding AuthnRequests, matched against InResponseTo
+CREATE TABLE IF NOT EXISTS saml_requests (
+    id VARCHAR(64) PRIMARY KEY,
+    org_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- IDs of consumed assertions, kept until they expire to block replays
+CREATE TABLE IF NOT EXISTS saml_assertions (
+    assertion_id VARCHAR(255) NOT NULL,
+    org_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (org_id, assertion_id)
+);
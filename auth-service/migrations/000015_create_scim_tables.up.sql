@@ -0,0 +1,35 @@
+-- Account status, managed by directory provisioning. Inactive users cannot sign in.
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS is_active BOOLEAN NOT NULL DEFAULT true;
+
+-- The organization whose directory created the account. Only that
+-- directory may change the account's email, name, password or status.
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS provisioned_by_org_id INTEGER REFERENCES organizations(id) ON DELETE SET NULL;
+
+-- The identifier a directory uses for the member, per organization
+ALTER TABLE memberships
+ADD COLUMN IF NOT EXISTS external_id VARCHAR(255);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_memberships_external_id ON memberships(org_id, external_id) WHERE external_id IS NOT NULL;
+
+-- Groups pushed by a directory. Groups named after an organization role
+-- grant that role to their members.
+CREATE TABLE IF NOT EXISTS scim_groups (
+    id SERIAL PRIMARY KEY,
+    org_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    display_name VARCHAR(255) NOT NULL,
+    external_id VARCHAR(255),
+    role VARCHAR(50),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (org_id, display_name)
+);
+
+CREATE TABLE IF NOT EXISTS scim_group_members (
+    group_id INTEGER NOT NULL REFERENCES scim_groups(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_scim_group_members_user_id ON scim_group_members(user_id);
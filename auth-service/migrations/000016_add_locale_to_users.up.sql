@@ -0,0 +1,3 @@
+-- Preferred language for emails, as a BCP 47 tag. Empty means the default locale.
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS locale VARCHAR(35) NOT NULL DEFAULT '';
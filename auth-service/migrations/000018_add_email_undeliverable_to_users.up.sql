@@ -0,0 +1,4 @@
+-- Set when the email provider reports a hard bounce or spam complaint for
+-- the user's address, and cleared when the address changes
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_undeliverable_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_undeliverable_reason TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,18 @@
+-- Devices each user has logged in from, described by browser and OS, so
+-- that a login from a new one can be reported to the user
+CREATE TABLE IF NOT EXISTS user_login_devices (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device VARCHAR(100) NOT NULL,
+    first_seen_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, device)
+);
+
+-- Security notifications a user chose not to receive. Critical ones are
+-- always sent and never stored here.
+CREATE TABLE IF NOT EXISTS security_notification_opt_outs (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    notification VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, notification)
+);
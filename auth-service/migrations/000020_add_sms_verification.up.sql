@@ -0,0 +1,24 @@
+-- A user's phone number is only stored once it has been verified by SMS
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_number VARCHAR(20) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_verified_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS sms_mfa_enabled BOOLEAN NOT NULL DEFAULT false;
+
+-- One-time codes texted to users. Only hashes are stored; login codes also
+-- carry the hash of the challenge token that ties them to a password check,
+-- and the organization of a single sign-on the login was scoped to.
+CREATE TABLE IF NOT EXISTS sms_codes (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(20) NOT NULL,
+    phone_number VARCHAR(20) NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    challenge_hash VARCHAR(64) UNIQUE,
+    org_id INTEGER REFERENCES organizations(id) ON DELETE CASCADE,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    consumed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sms_codes_user_purpose ON sms_codes(user_id, purpose, created_at);
+CREATE INDEX IF NOT EXISTS idx_sms_codes_user_created ON sms_codes(user_id, created_at);
@@ -0,0 +1,28 @@
+-- An event's hash covers a separate hash of its metadata rather than the
+-- metadata itself, so personal data can be redacted from the metadata of a
+-- purged user's events while the chain still links. Each redaction is
+-- recorded by an audit.redacted event committing to the redacted metadata.
+-- Events recorded before this migration have no metadata_hash and are
+-- never redacted.
+ALTER TABLE audit_events
+ADD COLUMN IF NOT EXISTS metadata_hash VARCHAR(64),
+ADD COLUMN IF NOT EXISTS redacted_at TIMESTAMP WITH TIME ZONE;
+
+-- Audit events stay append-only apart from redaction: only the metadata may
+-- change, only while setting redacted_at, and only on events performed by
+-- or about an anonymized user
+CREATE OR REPLACE FUNCTION prevent_audit_event_changes() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND NEW.redacted_at IS NOT NULL AND OLD.metadata_hash IS NOT NULL
+        AND (NEW.id, NEW.event_type, NEW.actor_id, NEW.subject_id, NEW.ip, NEW.user_agent, NEW.outcome, NEW.created_at, NEW.prev_hash, NEW.hash, NEW.metadata_hash)
+            IS NOT DISTINCT FROM
+            (OLD.id, OLD.event_type, OLD.actor_id, OLD.subject_id, OLD.ip, OLD.user_agent, OLD.outcome, OLD.created_at, OLD.prev_hash, OLD.hash, OLD.metadata_hash)
+        AND EXISTS (
+            SELECT 1 FROM users
+            WHERE id IN (OLD.subject_id, OLD.actor_id) AND anonymized_at IS NOT NULL
+        ) THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;